@@ -0,0 +1,190 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// A/B comparison against an earlier bounce. The bounce streams from the
+// card on the mixer's cue bus while the project plays, so both run side by
+// side and switching between them is instant. The bounce is scaled to the
+// loudness of the live mix, so the louder version doesn't win by being
+// louder. Bounces play in mono.
+const (
+	CUE_MATCH_SHIFT = 9               // Smoothing of the loudness match, in blocks: about 2.5s
+	CUE_MATCH_FLOOR = 1 << 16         // Mean square below which a side counts as silent
+	CUE_MAX_GAIN    = 4 << GAIN_SHIFT // Most the bounce is raised, +12dB
+)
+
+// Monitor bus the mixer plays instead of the mix while Solo is set. The
+// voice renders all the time so it keeps its place. Gain is Q12.
+type CueBus struct {
+	Voice Voice
+	Solo  bool
+	Gain  int32
+
+	mixPower int64 // Mean squares, smoothed
+	cuePower int64
+	buf      [BLOCK_SIZE]int32
+	mono     [BLOCK_SIZE]int32 // The mix, to measure
+}
+
+// Mean square of a block, with the previous value smoothed towards it
+func smoothPower(prev int64, block []int32) int64 {
+	sum := int64(0)
+	for _, x := range block {
+		sum += int64(x) * int64(x)
+	}
+	return prev + (sum/int64(max(len(block), 1))-prev)>>CUE_MATCH_SHIFT
+}
+
+// Render the cue voice and measure both sides, putting the cue in place of
+// the mix when soloed. Called from Mixer.Render after the master effects.
+func (c *CueBus) Mix(left, right []int32) {
+	buf := c.buf[:len(left)]
+	clear(buf)
+	if c.Voice != nil {
+		c.Voice.Render(buf)
+	}
+	mono := c.mono[:len(left)]
+	for i := range mono {
+		mono[i] = (left[i] + right[i]) >> 1
+	}
+	c.cuePower = smoothPower(c.cuePower, buf)
+	c.mixPower = smoothPower(c.mixPower, mono)
+	if !c.Solo {
+		return
+	}
+	for i, x := range buf {
+		left[i] = x * c.Gain >> GAIN_SHIFT
+		right[i] = left[i]
+	}
+}
+
+// Gain that brings the cue to the loudness of the mix, holding the last
+// one while either is silent
+func (c *CueBus) matchGain() int32 {
+	if c.mixPower < CUE_MATCH_FLOOR || c.cuePower < CUE_MATCH_FLOOR {
+		return c.Gain
+	}
+	g := math.Sqrt(float64(c.mixPower)/float64(c.cuePower)) * GAIN_UNITY
+	return int32(min(g, CUE_MAX_GAIN))
+}
+
+// The bounce being compared, nil when not comparing, and its name
+var (
+	compareStream *StreamVoice
+	compareName   string
+)
+
+func init() {
+	addTool("A/B COMPARE", openCompareView)
+}
+
+// Pick a bounce to compare with, then switch between it and the project
+func openCompareView() {
+	if needsCard() {
+		return
+	}
+	if compareStream != nil {
+		pushCompareView()
+		return
+	}
+	var names []string
+	entries, _ := storage.ReadDir(rendersDir)
+	for _, e := range entries {
+		if !e.Dir && strings.HasSuffix(strings.ToLower(e.Name), ".wav") {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		showStatus("NO BOUNCES", colorRed)
+		return
+	}
+	pushView(&ListView{Title: "COMPARE WITH", Items: names, OnSelect: func(i int) {
+		v, err := openStream(joinPath(rendersDir, names[i]))
+		if err != nil {
+			println("Failed to open bounce:", err.Error())
+			showStatus("OPEN FAILED", colorRed)
+			return
+		}
+		v.Fixed = true
+		audioMu.Lock()
+		compareStream, compareName = v, names[i]
+		mixer.Cue = &CueBus{Voice: v, Gain: GAIN_UNITY}
+		restartCompare()
+		audioMu.Unlock()
+		popView()
+		pushCompareView()
+	}})
+}
+
+// Switch between A, the live project, and B, the bounce
+func pushCompareView() {
+	list := &ListView{Title: "A/B " + compareName}
+	refresh := func() {
+		audioMu.Lock()
+		cue := *mixer.Cue
+		audioMu.Unlock()
+		hearing := "A: PROJECT"
+		if cue.Solo {
+			hearing = "B: BOUNCE"
+		}
+		list.Items = append(list.Items[:0], "HEARING "+hearing,
+			"B LEVEL "+decimal1(20*math.Log10(float64(cue.Gain)/GAIN_UNITY))+"dB",
+			"RESTART B", "STOP COMPARE")
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		switch i {
+		case 0:
+			audioMu.Lock()
+			mixer.Cue.Solo = !mixer.Cue.Solo
+			audioMu.Unlock()
+		case 2:
+			audioMu.Lock()
+			restartCompare()
+			audioMu.Unlock()
+		case 3:
+			stopCompare()
+			popView()
+			return
+		}
+		refresh()
+	}
+	pushView(list)
+}
+
+// Start the bounce from the top, as playback starts. Called with audioMu
+// held.
+func restartCompare() {
+	if compareStream != nil {
+		compareStream.NoteOn(compareStream.info.RootNote, 127)
+	}
+}
+
+// Close the bounce and go back to the project alone
+func stopCompare() {
+	audioMu.Lock()
+	mixer.Cue = nil
+	v := compareStream
+	compareStream = nil
+	audioMu.Unlock()
+	if v != nil {
+		v.Close()
+	}
+}
+
+// Follow the loudness of the mix with the bounce. Called from the main
+// loop.
+func updateCompare() {
+	if compareStream == nil {
+		return
+	}
+	audioMu.Lock()
+	mixer.Cue.Gain = mixer.Cue.matchGain()
+	audioMu.Unlock()
+}
@@ -0,0 +1,105 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// UI actions that buttons are mapped to through the keymap
+type Action uint8
+
+const (
+	ACTION_NONE Action = iota
+	ACTION_CURSOR_UP
+	ACTION_CURSOR_DOWN
+	ACTION_CURSOR_LEFT
+	ACTION_CURSOR_RIGHT
+	ACTION_ENTER
+	ACTION_MENU
+	ACTION_PLAY
+	ACTION_MACRO_RECORD
+	ACTION_MACRO_1
+	ACTION_MACRO_2
+	ACTION_MACRO_3
+	ACTION_MACRO_4
+	ACTION_LOCK
+	ACTION_TUTORIAL_SKIP
+	ACTION_BEND_UP // Held, see bendKey
+	ACTION_BEND_DOWN
+	ACTION_EDIT_UP // Change the value under the cursor, see editors
+	ACTION_EDIT_DOWN
+	ACTION_EDIT_LEFT
+	ACTION_EDIT_RIGHT
+	ACTION_CLEAR
+	ACTION_SNAPSHOT_STORE // Arm the next snapshot slot to store, see snapshot.go
+	ACTION_SNAPSHOT_1
+	ACTION_SNAPSHOT_2
+	ACTION_SNAPSHOT_3
+	ACTION_SNAPSHOT_4
+	ACTION_FILL   // Held or latched, see fillKey
+	ACTION_NAV_UP // Move between screens, see chainedit.go
+	ACTION_NAV_DOWN
+	ACTION_NAV_LEFT
+	ACTION_NAV_RIGHT
+	ACTION_COPY // The phrase, chain or instrument being edited, see clipboard.go
+	ACTION_PASTE
+	ACTION_MUTE // The track under the cursor, see toggleMute
+	NUM_ACTIONS
+)
+
+// Names actions are saved by, so saved macros survive actions being added
+// or reordered
+var actionNames = [NUM_ACTIONS]string{"none", "cursor-up", "cursor-down", "cursor-left", "cursor-right",
+	"enter", "menu", "play", "macro-record", "macro-1", "macro-2", "macro-3", "macro-4", "lock",
+	"tutorial-skip", "bend-up", "bend-down", "edit-up", "edit-down", "edit-left", "edit-right", "clear",
+	"snapshot-store", "snapshot-1", "snapshot-2", "snapshot-3", "snapshot-4", "fill",
+	"nav-up", "nav-down", "nav-left", "nav-right", "copy", "paste", "mute"}
+
+// Step of an EDIT+arrow: RIGHT and UP go up, LEFT and DOWN down, and UP
+// and DOWN take the editor's big step
+func editDelta(a Action) (delta int, big bool) {
+	switch a {
+	case ACTION_EDIT_UP:
+		return 1, true
+	case ACTION_EDIT_DOWN:
+		return -1, true
+	case ACTION_EDIT_LEFT:
+		return -1, false
+	}
+	return 1, false
+}
+
+// Run a single UI action
+func dispatchAction(a Action) {
+	if a == ACTION_NONE {
+		return
+	}
+	if performanceLocked && !performanceAction(a) {
+		showStatus("LOCKED", colorRed)
+		return
+	}
+	recordMacroAction(a)
+
+	switch a {
+	case ACTION_PLAY:
+		playPressed()
+	case ACTION_MACRO_RECORD:
+		toggleMacroRecording()
+	case ACTION_MACRO_1, ACTION_MACRO_2, ACTION_MACRO_3, ACTION_MACRO_4:
+		macroSlotPressed(int(a - ACTION_MACRO_1))
+	case ACTION_LOCK:
+		toggleLock()
+	case ACTION_MENU:
+		openToolsMenu()
+	case ACTION_SNAPSHOT_STORE:
+		armSnapshotStore()
+	case ACTION_SNAPSHOT_1, ACTION_SNAPSHOT_2, ACTION_SNAPSHOT_3, ACTION_SNAPSHOT_4:
+		snapshotSlotPressed(int(a - ACTION_SNAPSHOT_1))
+	case ACTION_TUTORIAL_SKIP:
+		// Handled by tutorialAfterAction
+	default:
+		if v := currentView(); v != nil {
+			v.HandleAction(a)
+		}
+	}
+	tutorialAfterAction(a)
+	speakFocus()
+}
@@ -0,0 +1,11 @@
+//go:build tinygo && scheduler.cores
+// +build tinygo,scheduler.cores
+
+package main
+
+// Built with -scheduler=cores the goroutines share both cores, so the audio
+// loop can keep running on one core while the other is busy drawing or
+// reading the card. The scheduler can't pin a goroutine to a core, so this
+// is only a hint that audio won't wait for the main loop to yield, not a
+// core of its own.
+const AUDIO_DEDICATED_CORE = true
@@ -0,0 +1,8 @@
+//go:build tinygo && !scheduler.cores
+// +build tinygo,!scheduler.cores
+
+package main
+
+// With the single-core schedulers the audio loop only runs when the main
+// loop yields
+const AUDIO_DEDICATED_CORE = false
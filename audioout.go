@@ -0,0 +1,15 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Where mixed audio goes: the I2S DAC, or with -tags pwmaudio two PWM pins
+// for boards without one. Blocks are stereo frames with the left channel in
+// the upper half.
+type AudioOutput interface {
+	// Play a block, returning once it is queued in the hardware
+	WriteStereo(block []uint32) (int, error)
+
+	// Change the frame rate
+	SetSampleFrequency(rate uint32) error
+}
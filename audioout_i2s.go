@@ -0,0 +1,42 @@
+//go:build tinygo && !pwmaudio
+// +build tinygo,!pwmaudio
+
+package main
+
+import (
+	"machine"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/piolib"
+)
+
+const AUDIO_OUTPUT = "I2S"
+
+// I2S DAC driven by a PIO state machine
+func newAudioOutput() (AudioOutput, error) {
+	sm, err := pio.PIO0.ClaimStateMachine()
+	if err != nil {
+		return nil, err
+	}
+	i2s, err := piolib.NewI2S(sm, AUDIO_SDATA, AUDIO_BCLK)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the sample rate with error checking
+	err = i2s.SetSampleFrequency(sampleRate)
+	if err != nil {
+		println("Warning: Failed to set sample rate:", err.Error())
+	}
+
+	// Debug information
+	clockHz := uint64(machine.CPUFrequency())
+	targetBitClock := uint64(sampleRate * 64) // 32 bits per channel * 2 channels
+
+	// The SetSampleFrequency method already calculates and sets the appropriate
+	// clock divider for the PIO state machine to achieve the desired sample rate.
+	// It uses pio.ClkDivFromFrequency internally to handle the calculation.
+	println("System clock:", clockHz/1000000, "MHz")
+	println("Target bit clock:", targetBitClock/1000, "kHz")
+	return i2s, nil
+}
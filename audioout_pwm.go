@@ -0,0 +1,92 @@
+//go:build tinygo && pwmaudio && scheduler.cores
+// +build tinygo,pwmaudio,scheduler.cores
+
+package main
+
+import (
+	"machine"
+	"time"
+)
+
+// PWM output for boards without an I2S DAC, built with -tags pwmaudio.
+// Each channel is a PWM slice whose period is one frame; the duty cycle
+// is set to the frame's level as the slice wraps. The output loop spins
+// on the counter between frames, so it only builds with -scheduler=cores,
+// which leaves the other core free for the main loop. Filter each pin
+// with an RC low pass (1k and 10nF) and a DC blocking capacitor.
+const (
+	AUDIO_OUTPUT = "PWM"
+
+	PWM_AUDIO_LEFT  = machine.Pin(AUDIO_SDATA) // Slice 0
+	PWM_AUDIO_RIGHT = machine.Pin(AUDIO_BCLK)  // Slice 1
+)
+
+type pwmSlice interface {
+	Configure(config machine.PWMConfig) error
+	Channel(pin machine.Pin) (uint8, error)
+	Set(channel uint8, value uint32)
+	Top() uint32
+	Counter() uint32
+	SetPeriod(period uint64) error
+}
+
+type PWMAudio struct {
+	left, right     pwmSlice
+	leftCh, rightCh uint8
+}
+
+func newAudioOutput() (AudioOutput, error) {
+	p := &PWMAudio{left: machine.PWM0, right: machine.PWM1}
+	var err error
+	if p.leftCh, err = pwmChannel(p.left, PWM_AUDIO_LEFT); err != nil {
+		return nil, err
+	}
+	if p.rightCh, err = pwmChannel(p.right, PWM_AUDIO_RIGHT); err != nil {
+		return nil, err
+	}
+	if err := p.SetSampleFrequency(sampleRate); err != nil {
+		return nil, err
+	}
+	println("PWM resolution:", p.left.Top()+1, "steps")
+	return p, nil
+}
+
+// Set up a slice and the channel driving pin
+func pwmChannel(s pwmSlice, pin machine.Pin) (uint8, error) {
+	if err := s.Configure(machine.PWMConfig{}); err != nil {
+		return 0, err
+	}
+	return s.Channel(pin)
+}
+
+func (p *PWMAudio) SetSampleFrequency(rate uint32) error {
+	period := uint64(time.Second) / uint64(rate)
+	if err := p.left.SetPeriod(period); err != nil {
+		return err
+	}
+	return p.right.SetPeriod(period)
+}
+
+// Duty cycle for a sample at a slice's resolution
+func pwmLevel(sample uint16, top uint32) uint32 {
+	return uint32(sample^0x8000) * (top + 1) >> 16
+}
+
+func (p *PWMAudio) WriteStereo(block []uint32) (int, error) {
+	top := p.left.Top()
+	last := p.left.Counter()
+	for _, frame := range block {
+		// Wait for the left slice to wrap; both run from the same clock
+		for {
+			c := p.left.Counter()
+			if c < last {
+				last = c
+				break
+			}
+			last = c
+		}
+		p.left.Set(p.leftCh, pwmLevel(uint16(frame>>16), top))
+		p.right.Set(p.rightCh, pwmLevel(uint16(frame), top))
+	}
+	return len(block), nil
+}
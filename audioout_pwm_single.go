@@ -0,0 +1,8 @@
+//go:build tinygo && pwmaudio && !scheduler.cores
+// +build tinygo,pwmaudio,!scheduler.cores
+
+package main
+
+// The PWM output spins between frames, which would starve the main loop on
+// a single core, so building it without -scheduler=cores stops here
+var _ = pwmaudio_needs_scheduler_cores
@@ -0,0 +1,40 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Blocks the mixer can render ahead of the output, including the one
+// being written
+const AUDIO_QUEUE_BLOCKS = 2
+
+// Audio blocks travel from the mixer to the output and back through two
+// channels, so the mixer renders the next block while the output writes
+// the last one instead of waiting on the I2S FIFO. A nil block marks the
+// end of playback.
+type AudioQueue struct {
+	free   chan []uint32
+	filled chan []uint32
+}
+
+func newAudioQueue(blocks, size int) *AudioQueue {
+	q := &AudioQueue{
+		free:   make(chan []uint32, blocks),
+		filled: make(chan []uint32, blocks+1), // Room for the end marker
+	}
+	for range blocks {
+		q.free <- make([]uint32, size)
+	}
+	return q
+}
+
+// Block to render into, waiting while the output holds all of them
+func (q *AudioQueue) Acquire() []uint32 { return <-q.free }
+
+// Hand a rendered block, or nil at the end of playback, to the output
+func (q *AudioQueue) Submit(block []uint32) { q.filled <- block }
+
+// Next block to write, waiting for the mixer
+func (q *AudioQueue) Next() []uint32 { return <-q.filled }
+
+// Give a written block back to the mixer
+func (q *AudioQueue) Release(block []uint32) { q.free <- block }
@@ -0,0 +1,107 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "time"
+
+// A block counts as late when rendering it takes more than this share of
+// its playing time, leaving little slack before the output runs dry
+const (
+	LATE_BLOCK_PERCENT   = 75
+	UNDERRUN_FLASH_TIME  = 500 * time.Millisecond
+	AUDIO_STATS_INTERVAL = 5 * time.Second // Periodic UART report while playing
+)
+
+// Playback loop counters
+type AudioStats struct {
+	Blocks    uint32
+	Late      uint32 // Rendered too close to the deadline
+	Underruns uint32 // Written after the previous block finished playing
+	MaxRender time.Duration
+}
+
+var (
+	audioStats AudioStats
+
+	lastBlockWrite  time.Time
+	reportedStats   AudioStats
+	lastStatsReport time.Time
+	underrunShownAt time.Time
+)
+
+func init() {
+	addSetting("UNDERRUN FLASH", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.UnderrunFlash)) },
+		func(i int) { settings.UnderrunFlash = i == 1 })
+	addTool("AUDIO STATS", func() {
+		reportAudioStats()
+		showStatus("BLOCKS "+itoa(int(audioStats.Blocks))+" LATE "+itoa(int(audioStats.Late))+
+			" XRUN "+itoa(int(audioStats.Underruns)), colorText)
+	})
+}
+
+// Time one block takes to play
+func blockPeriod() time.Duration {
+	return time.Duration(BLOCK_SIZE) * time.Second / time.Duration(sampleRate)
+}
+
+// Account for a block rendered in render time
+func recordBlock(render time.Duration) {
+	audioStats.Blocks++
+	noteQualityLoad(render)
+	if render > audioStats.MaxRender {
+		audioStats.MaxRender = render
+	}
+	if render > blockPeriod()*LATE_BLOCK_PERCENT/100 {
+		audioStats.Late++
+	}
+}
+
+// Account for a block about to be written. Writes block while the
+// previous block plays, so a gap longer than a block since the last write
+// returned means the output went silent.
+func recordWrite() {
+	if !lastBlockWrite.IsZero() && time.Since(lastBlockWrite) > blockPeriod() {
+		audioStats.Underruns++
+	}
+}
+
+// Forget the last write so a pause isn't counted as an underrun
+func resetBlockClock() {
+	lastBlockWrite = time.Time{}
+}
+
+// Print the counters on the debug UART
+func reportAudioStats() {
+	println("Audio blocks:", audioStats.Blocks, "late:", audioStats.Late,
+		"underruns:", audioStats.Underruns, "max render:", audioStats.MaxRender.Microseconds(),
+		"us of", blockPeriod().Microseconds(), "us")
+	if used, total := voiceUsage(); total > 0 {
+		println("Voices:", used, "of", total)
+	}
+	reportedStats = audioStats
+	lastStatsReport = time.Now()
+}
+
+// Called every frame: report new problems right away, the rest now and
+// then, and flash the indicator on underruns
+func updateAudioStats() {
+	problems := audioStats.Late != reportedStats.Late || audioStats.Underruns != reportedStats.Underruns
+	if problems || (isAudioPlaying && time.Since(lastStatsReport) > AUDIO_STATS_INTERVAL) {
+		if settings.UnderrunFlash && audioStats.Underruns != reportedStats.Underruns {
+			underrunShownAt = time.Now()
+			refreshStatusBar()
+		}
+		reportAudioStats()
+	}
+	if !underrunShownAt.IsZero() && time.Since(underrunShownAt) > UNDERRUN_FLASH_TIME {
+		underrunShownAt = time.Time{}
+		refreshStatusBar()
+	}
+}
+
+// Whether the status bar should show the underrun indicator
+func underrunFlashing() bool {
+	return !underrunShownAt.IsZero()
+}
@@ -0,0 +1,193 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Audition: a voice of its own, mixed in after the song's master bus, that
+// plays the sample file or instrument the cursor moves onto in a browser.
+// It sounds whether or not the song is playing and leaves the song's
+// tracks, fades and effects alone. Files stream from the card and play
+// for a few seconds at most; instruments play one note. A new audition
+// cuts the last one. While stopped, each change to an instrument's
+// parameters plays a preview note through the same voice, the last note
+// entered in a phrase for as long as the PREVIEW setting says.
+const (
+	AUDITION_LEVEL   = 192  // 0-255
+	AUDITION_NOTE_MS = 600  // An instrument's note, before its note off
+	AUDITION_FILE_MS = 5000 // Most of a file that plays
+	AUDITION_TAIL_MS = 400  // Release after the note off
+)
+
+// The voice auditioning, nil when quiet. Frames count down to the note
+// off, then through the tail.
+type Audition struct {
+	Voice  Voice
+	frames int
+	tail   int
+	buf    [BLOCK_SIZE]int32
+}
+
+var (
+	audition       Audition
+	auditionStream *StreamVoice // Open for a file audition, closed by updateAudition
+
+	// Wakes the audio loop while the song is stopped
+	auditionWake = make(chan struct{}, 1)
+)
+
+// Preview note lengths in ms, by PREVIEW setting, 0 for off
+var previewLengths = []int{0, 150, 300, 600}
+
+func init() {
+	addSetting("AUDITION", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.Audition)) },
+		func(i int) { settings.Audition = i == 1 })
+	addSetting("PREVIEW", []string{"OFF", "150MS", "300MS", "600MS"},
+		func() int { return int(settings.Preview) % len(previewLengths) },
+		func(i int) { settings.Preview = uint8(i) })
+	addTool("INSTRUMENTS", openInstrumentsView)
+}
+
+// Whether anything is auditioning, for the audio loop
+func auditioning() bool {
+	return audition.Voice != nil
+}
+
+// Start auditioning a voice already playing its note, cutting any other
+func startAudition(v Voice, ms int) {
+	audioMu.Lock()
+	audition = Audition{Voice: v, frames: ms * int(sampleRate) / 1000,
+		tail: AUDITION_TAIL_MS * int(sampleRate) / 1000}
+	audioMu.Unlock()
+	select {
+	case auditionWake <- struct{}{}:
+	default:
+	}
+}
+
+// Cut the audition and close its file
+func stopAudition() {
+	audioMu.Lock()
+	audition.Voice = nil
+	s := auditionStream
+	auditionStream = nil
+	audioMu.Unlock()
+	if s != nil {
+		s.Close()
+	}
+}
+
+// Audition a wav file, streaming it at its own rate
+func auditionFile(path string) {
+	if !settings.Audition {
+		return
+	}
+	stopAudition()
+	v, err := openStream(path)
+	if err != nil {
+		println("Failed to audition", path+":", err.Error())
+		return
+	}
+	v.Fixed, v.Level = true, AUDITION_LEVEL
+	v.NoteOn(v.info.RootNote, 127)
+	auditionStream = v
+	startAudition(v, AUDITION_FILE_MS)
+}
+
+// Audition an instrument playing middle C
+func auditionInstrument(in *Instrument) {
+	auditionNote(in, NOTE_C4)
+}
+
+// Audition an instrument playing a note
+func auditionNote(in *Instrument, note uint8) {
+	if settings.Audition {
+		playAudition(in, note, AUDITION_NOTE_MS)
+	}
+}
+
+// Play an instrument's note for ms on the audition voice
+func playAudition(in *Instrument, note uint8, ms int) {
+	stopAudition()
+	v := newInstrumentVoice(in)
+	if v == nil {
+		return
+	}
+	v.NoteOn(note, 100)
+	startAudition(v, ms)
+}
+
+// Preview an instrument after a change to it, unless the song is playing
+func previewInstrument(in *Instrument) {
+	ms := previewLengths[int(settings.Preview)%len(previewLengths)]
+	if ms > 0 && !isAudioPlaying {
+		playAudition(in, phraseLast.note, ms)
+	}
+}
+
+// Parameter list of an instrument, previewing it after each change
+func openInstrumentParams(title string, in *Instrument, items []settingItem, changed func()) {
+	openParamList(title, items, func() {
+		if changed != nil {
+			changed()
+		}
+		previewInstrument(in)
+	})
+}
+
+// Add the audition to a rendered block, counting it down. Called from the
+// audio loop.
+func mixAudition(out []uint32) {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	a := &audition
+	if a.Voice == nil {
+		return
+	}
+	n := min(len(out), BLOCK_SIZE)
+	buf := a.buf[:n]
+	clear(buf)
+	a.Voice.Render(buf)
+	for i, x := range buf {
+		x = x * AUDITION_LEVEL >> 8
+		out[i] = packStereo(int32(int16(out[i]>>16))+x, int32(int16(out[i]))+x)
+	}
+	if a.frames > 0 {
+		if a.frames -= n; a.frames <= 0 {
+			a.Voice.NoteOff()
+		}
+	} else if a.tail -= n; a.tail <= 0 {
+		a.Voice = nil
+	}
+}
+
+// Close the file of a finished audition. Called from the main loop.
+func updateAudition() {
+	if auditionStream != nil && !auditioning() {
+		stopAudition()
+	}
+}
+
+// Pick the instrument the instrument tools work on, hearing each as the
+// cursor moves onto it
+func openInstrumentsView() {
+	names := instrumentTypeNames
+	list := &ListView{Title: "INSTRUMENTS", Cursor: int(session.Instrument % NUM_INSTRUMENTS)}
+	for i := range project.Instruments {
+		in := &project.Instruments[i]
+		item := hexByte(uint8(i)) + " " + names[int(in.Type)%len(names)]
+		if in.Name != "" {
+			item += " " + in.Name
+		}
+		list.Items = append(list.Items, item)
+	}
+	list.OnCursor = func(i int) {
+		auditionInstrument(&project.Instruments[i])
+	}
+	list.OnSelect = func(i int) {
+		session.Instrument = uint8(i)
+		popView()
+		showStatus("INSTR "+itoa(i), colorGreen)
+	}
+	pushView(list)
+}
@@ -0,0 +1,133 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	BENCH_BLOCKS      = 200
+	BENCH_SAMPLE_SIZE = 4096
+	BENCH_CARD_FILE   = "/bench.tmp"
+	BENCH_CARD_CHUNKS = 32
+)
+
+func init() {
+	addTool("BENCHMARK", runBenchmarks)
+}
+
+// Time the voices and inserts, keep the costs for the CPU budget planner
+// and print them, as microseconds and as a share of the time one block
+// takes to play
+func runBenchmarks() {
+	measureCosts()
+	saveCostTable()
+	showStatus("NEAREST "+itoa(cpuCosts[COST_SAMPLE])+"us LINEAR "+itoa(cpuCosts[COST_SAMPLE_LINEAR])+"us", colorGreen)
+}
+
+// Measure every entry of the cost table
+func measureCosts() {
+	s := &Sample{Name: "bench", Data: make([]int16, BENCH_SAMPLE_SIZE), Rate: SAMPLE_RATE,
+		RootNote: NOTE_C4, LoopEnd: BENCH_SAMPLE_SIZE}
+	for i := range s.Data {
+		s.Data[i] = wavetables[WAVE_SINE][i%WAVETABLE_SIZE]
+	}
+	nearest := &SampleVoice{Sample: s, Level: 255}
+	linear := &SampleVoice{Sample: s, Level: 255, Interpolate: true}
+	nearest.Trigger(NOTE_C4+7, 0)
+	linear.Trigger(NOTE_C4+7, 0)
+	cpuCosts[COST_SAMPLE] = benchmarkVoice("sample nearest", newPitchVoice(nearest))
+	cpuCosts[COST_SAMPLE_LINEAR] = benchmarkVoice("sample linear", newPitchVoice(linear))
+
+	wave := &WavetableVoice{Table: &wavetables[WAVE_SINE], Level: 255}
+	cpuCosts[COST_WAVETABLE] = benchmarkVoice("wavetable", playing(newPitchVoice(wave)))
+	cpuCosts[COST_OSCILLATOR] = benchmarkVoice("oscillator", playing(newPitchVoice(newOscillatorVoice(OSC_PULSE))))
+	// The hat's six partials make it the dearest drum
+	hat := newDrumVoice(DRUM_HAT)
+	hat.Level, hat.Decay = 255, 255
+	cpuCosts[COST_DRUM] = benchmarkVoice("drum", playing(newPitchVoice(hat)))
+	fm := newFMVoice()
+	fm.Feedback = 255
+	cpuCosts[COST_FM] = benchmarkVoice("fm", playing(newPitchVoice(fm)))
+	// Long grains started often keep every grain busy
+	grains := newGranularVoice(s)
+	grains.Size, grains.Density = 250, 250
+	cpuCosts[COST_GRANULAR] = benchmarkVoice("granular", playing(newPitchVoice(grains)))
+	pluck := newPluckVoice()
+	pluck.Decay = 255
+	cpuCosts[COST_PLUCK] = benchmarkVoice("pluck", playing(newPitchVoice(pluck)))
+
+	cpuCosts[COST_CHORUS] = benchmarkEffect("chorus", newChorus())
+	cpuCosts[COST_GATE] = benchmarkEffect("gate", &Gate{Threshold: 48, Release: 10, gain: GAIN_UNITY})
+	cpuCosts[COST_CRUSH] = benchmarkEffect("crush", &Bitcrusher{Bits: 8, Downsample: 1})
+	cpuCosts[COST_CARD_READ] = benchmarkCard()
+}
+
+// A voice playing a note, to benchmark
+func playing(v Voice) Voice {
+	v.NoteOn(NOTE_C4, 127)
+	return v
+}
+
+// Render BENCH_BLOCKS blocks of a voice, returning microseconds per block
+func benchmarkVoice(name string, v Voice) int {
+	buf := make([]int32, BLOCK_SIZE)
+	start := time.Now()
+	for i := 0; i < BENCH_BLOCKS; i++ {
+		v.Render(buf)
+	}
+	us := int(time.Since(start).Microseconds()) / BENCH_BLOCKS
+	blockUs := BLOCK_SIZE * 1_000_000 / int(sampleRate)
+	println("Benchmark", name+":", us, "us per block,", us*100/blockUs, "% of real time")
+	return us
+}
+
+// Process BENCH_BLOCKS blocks of a full scale sine through an effect,
+// returning microseconds per block
+func benchmarkEffect(name string, fx Effect) int {
+	left, right := make([]int32, BLOCK_SIZE), make([]int32, BLOCK_SIZE)
+	start := time.Now()
+	for i := 0; i < BENCH_BLOCKS; i++ {
+		for j := range left {
+			left[j] = int32(wavetables[WAVE_SINE][j%WAVETABLE_SIZE])
+			right[j] = left[j]
+		}
+		fx.Process(left, right)
+	}
+	us := int(time.Since(start).Microseconds()) / BENCH_BLOCKS
+	blockUs := BLOCK_SIZE * 1_000_000 / int(sampleRate)
+	println("Benchmark", name+":", us, "us per block,", us*100/blockUs, "% of real time")
+	return us
+}
+
+// Read a file of 16-bit stereo back a chunk at a time as a stream does,
+// returning microseconds per chunk, 0 when the card can't be written
+func benchmarkCard() int {
+	size := STREAM_CHUNK * 4
+	if err := writeFile(BENCH_CARD_FILE, make([]byte, size*BENCH_CARD_CHUNKS)); err != nil {
+		println("Failed to benchmark card:", err.Error())
+		return 0
+	}
+	defer storage.Remove(BENCH_CARD_FILE)
+	f, err := storage.Open(BENCH_CARD_FILE)
+	if err != nil {
+		println("Failed to benchmark card:", err.Error())
+		return 0
+	}
+	defer f.Close()
+	ring := make([]int16, STREAM_CHUNK)
+	start := time.Now()
+	for i := 0; i < BENCH_CARD_CHUNKS; i++ {
+		if _, err := f.Seek(int64(i*size), io.SeekStart); err != nil {
+			return 0
+		}
+		io.ReadFull(f, streamChunk[:size])
+		decodePCM(ring, streamChunk[:size], 2, 16)
+	}
+	us := max(int(time.Since(start).Microseconds())/BENCH_CARD_CHUNKS, 1)
+	println("Benchmark card read:", us, "us per", STREAM_CHUNK, "frames")
+	return us
+}
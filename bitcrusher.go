@@ -0,0 +1,113 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Lo-fi insert that truncates samples to Bits of resolution (1-16) and
+// holds every sample for Downsample frames to lower the effective rate
+type Bitcrusher struct {
+	Bits       uint8
+	Downsample uint8
+
+	holdL, holdR int32
+	count        uint8
+}
+
+// Create a bitcrusher that passes audio through unchanged
+func newBitcrusher() *Bitcrusher {
+	return &Bitcrusher{Bits: 16, Downsample: 1}
+}
+
+func (b *Bitcrusher) Process(left, right []int32) {
+	bits := b.Bits
+	if bits < 1 {
+		bits = 1
+	} else if bits > 16 {
+		bits = 16
+	}
+	mask := int32(-1) << (16 - bits)
+	hold := b.Downsample
+	if hold < 1 {
+		hold = 1
+	}
+
+	for i := range left {
+		if b.count == 0 {
+			b.holdL = int32(clip16(left[i])) & mask
+			b.holdR = int32(clip16(right[i])) & mask
+		}
+		b.count++
+		if b.count >= hold {
+			b.count = 0
+		}
+		left[i] = b.holdL
+		right[i] = b.holdR
+	}
+}
+
+func init() {
+	addTool("BITCRUSHER", openCrushView)
+}
+
+// Crusher off: full resolution at the full rate
+func defaultCrush() CrushSettings {
+	return CrushSettings{Bits: 16, Downsample: 1}
+}
+
+// Whether the settings change the sound at all
+func (cs *CrushSettings) on() bool {
+	return cs.Bits < 16 || cs.Downsample > 1
+}
+
+// Bitcrushers kept per track once used
+var trackCrush [NUM_TRACKS]*Bitcrusher
+
+// Follow the active project's bitcrusher settings, adding the insert to a
+// track while it crushes and removing it once it is back to 16 bits at the
+// full rate
+func updateCrushers() {
+	for t := range project.Crush {
+		cs := &project.Crush[t]
+		b := trackCrush[t]
+		if !cs.on() {
+			if b != nil {
+				setInsert(t, b, false)
+			}
+			continue
+		}
+		if b == nil {
+			b = newBitcrusher()
+			trackCrush[t] = b
+		}
+		b.Bits, b.Downsample = cs.Bits, cs.Downsample
+		setInsert(t, b, true)
+	}
+}
+
+// Pick a track, then step its bits and downsampling
+func openCrushView() {
+	list := &ListView{Title: "BITCRUSHER"}
+	for t := range project.Crush {
+		list.Items = append(list.Items, "TRACK "+itoa(t+1))
+	}
+	list.OnSelect = func(t int) {
+		cs := &project.Crush[t]
+		openParamList("CRUSH "+itoa(t+1), []settingItem{
+			byteChoice("BITS", func() *uint8 { return &cs.Bits }, []uint8{16, 12, 10, 8, 6, 5, 4, 3, 2, 1},
+				func(v uint8) string {
+					if v == 16 {
+						return "OFF"
+					}
+					return itoa(int(v))
+				}),
+			byteChoice("DOWNSAMPLE", func() *uint8 { return &cs.Downsample }, []uint8{1, 2, 3, 4, 6, 8, 12, 16},
+				func(v uint8) string {
+					if v == 1 {
+						return "OFF"
+					}
+					return "/" + itoa(int(v))
+				}),
+		}, nil)
+	}
+	pushView(list)
+}
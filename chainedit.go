@@ -0,0 +1,212 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Chain editor: a row per chain entry with the phrase it plays and the
+// semitones it is transposed by. Editing works as in the phrase editor,
+// EDIT+UP/DOWN moving a phrase by 16 or a transpose by an octave. The
+// entry the song is playing in the chain is highlighted.
+//
+// The song, chain and phrase screens sit side by side: NAV+RIGHT opens the
+// chain or phrase under the cursor and NAV+LEFT goes back to the one it is
+// in. NAV+UP/DOWN step the chain or phrase editor to the previous or next
+// chain or phrase.
+const (
+	CHAIN_COL_PHRASE = iota
+	CHAIN_COL_TRANSPOSE
+	NUM_CHAIN_COLS
+
+	MAX_CHAIN_TRANSPOSE = 48 // Semitones either way
+)
+
+// Where each column is drawn and how wide, in characters
+var chainColumns = [NUM_CHAIN_COLS]struct{ x, width int }{{3, 2}, {6, 3}}
+
+func init() {
+	registerView(VIEW_CHAIN, func() View { return &chainView{playhead: -1} })
+	addTool("CHAIN", openChainList)
+}
+
+type chainView struct {
+	playhead int // Entry being played, -1 for none
+}
+
+// Last phrase entered, for filling in empty entries
+var chainLastPhrase uint8
+
+func (v *chainView) ID() ViewID { return VIEW_CHAIN }
+
+func (v *chainView) state() *ViewState { return &session.Views[VIEW_CHAIN] }
+
+func (v *chainView) chain() *Chain {
+	return &project.Chains[session.Chain%NUM_CHAINS]
+}
+
+// Entry of the chain the song is playing, -1 when no track plays it
+func (v *chainView) playingEntry() int {
+	if !sequencer.Playing || sequencer.Song != project {
+		return -1
+	}
+	for _, c := range project.Song[sequencer.Row%SONG_ROWS] {
+		if c == session.Chain {
+			return sequencer.Entry
+		}
+	}
+	return -1
+}
+
+func (v *chainView) Tick() {
+	if e := v.playingEntry(); e != v.playhead {
+		v.playhead = e
+		redrawView()
+	}
+}
+
+func (v *chainView) Draw() {
+	st := v.state()
+	drawText(0, 0, "CHAIN "+hexByte(session.Chain), colorGreen)
+	v.playhead = v.playingEntry()
+	first := int(st.Scroll)
+	for e := first; e < CHAIN_LENGTH && e < first+viewRows()-1; e++ {
+		row := e - first + 1
+		if e == v.playhead {
+			drawHighlight(0, row, 9, colorGrid)
+		}
+		if e == int(st.Row) {
+			c := chainColumns[st.Col%NUM_CHAIN_COLS]
+			drawHighlight(c.x, row, c.width, colorBlue)
+		}
+		text := hexByte(uint8(e)) + " -- ---"
+		if entry := v.chain().Entries[e]; entry.Phrase != EMPTY {
+			text = hexByte(uint8(e)) + " " + hexByte(entry.Phrase) + " " + transposeText(entry.Transpose)
+		}
+		drawText(0, row, text, colorText)
+	}
+}
+
+func (v *chainView) Describe() string {
+	st := v.state()
+	e := v.chain().Entries[st.Row%CHAIN_LENGTH]
+	text := "CHAIN " + hexByte(session.Chain) + " ENTRY " + hexByte(st.Row)
+	if st.Col == CHAIN_COL_PHRASE || e.Phrase == EMPTY {
+		return text + " PHRASE " + spokenByte(e.Phrase)
+	}
+	return text + " TRANSPOSE " + transposeText(e.Transpose)
+}
+
+func (v *chainView) HandleAction(a Action) {
+	st := v.state()
+	entry := &v.chain().Entries[st.Row%CHAIN_LENGTH]
+	switch a {
+	case ACTION_CURSOR_UP:
+		if st.Row > 0 {
+			st.Row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if st.Row < CHAIN_LENGTH-1 {
+			st.Row++
+		}
+	case ACTION_CURSOR_LEFT:
+		if st.Col == 0 {
+			popView()
+			return
+		}
+		st.Col--
+	case ACTION_CURSOR_RIGHT:
+		if st.Col < NUM_CHAIN_COLS-1 {
+			st.Col++
+		}
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		delta, big := editDelta(a)
+		if entry.Phrase >= NUM_PHRASES {
+			entry.Phrase, entry.Transpose = chainLastPhrase, 0
+		} else if st.Col == CHAIN_COL_PHRASE {
+			entry.Phrase = stepByte(entry.Phrase, delta, big, 16, NUM_PHRASES-1)
+		} else {
+			if big {
+				delta *= 12
+			}
+			t := max(min(int(entry.Transpose)+delta, MAX_CHAIN_TRANSPOSE), -MAX_CHAIN_TRANSPOSE)
+			entry.Transpose = int8(t)
+		}
+		chainLastPhrase = entry.Phrase
+	case ACTION_CLEAR:
+		if st.Col == CHAIN_COL_PHRASE {
+			*entry = ChainEntry{EMPTY, 0}
+		} else {
+			entry.Transpose = 0
+		}
+	case ACTION_COPY:
+		copyChain(project, session.Chain)
+		showStatus("COPIED CHAIN "+hexByte(session.Chain), colorGreen)
+	case ACTION_PASTE:
+		pasteInEditor(CLIP_CHAIN, session.Chain)
+	case ACTION_NAV_LEFT:
+		replaceView(&songView{playhead: -1})
+		return
+	case ACTION_NAV_RIGHT:
+		if entry.Phrase >= NUM_PHRASES {
+			showStatus("NO PHRASE", colorRed)
+			return
+		}
+		session.Phrase = entry.Phrase
+		replaceView(&phraseView{playhead: -1})
+		return
+	case ACTION_NAV_UP, ACTION_NAV_DOWN:
+		session.Chain = uint8((int(session.Chain) + navDelta(a) + NUM_CHAINS) % NUM_CHAINS)
+	default:
+		return
+	}
+	rows := viewRows() - 1
+	if int(st.Row) < int(st.Scroll) {
+		st.Scroll = st.Row
+	} else if int(st.Row) >= int(st.Scroll)+rows {
+		st.Scroll = st.Row - uint8(rows) + 1
+	}
+	redrawView()
+}
+
+// A transpose as a signed number of semitones
+func transposeText(t int8) string {
+	sign, n := "+", int(t)
+	if n < 0 {
+		sign, n = "-", -n
+	} else if n == 0 {
+		sign = " "
+	}
+	if n < 10 {
+		return sign + "0" + itoa(n)
+	}
+	return sign + itoa(n)
+}
+
+// Step of NAV+UP/DOWN through chains or phrases
+func navDelta(a Action) int {
+	if a == ACTION_NAV_UP {
+		return -1
+	}
+	return 1
+}
+
+// Open the chain editor on a chain
+func openChain(index uint8) {
+	session.Chain = index % NUM_CHAINS
+	pushView(&chainView{playhead: -1})
+}
+
+// Pick a chain to edit, those in use marked
+func openChainList() {
+	list := &ListView{Title: "CHAIN", Cursor: int(session.Chain % NUM_CHAINS)}
+	for i := range project.Chains {
+		item := "CHAIN " + hexByte(uint8(i))
+		if !project.Chains[i].IsEmpty() {
+			item += " *"
+		}
+		list.Items = append(list.Items, item)
+	}
+	list.OnSelect = func(i int) {
+		openChain(uint8(i))
+	}
+	pushView(list)
+}
@@ -0,0 +1,163 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Stereo chorus insert: each channel is mixed with a copy of itself read
+// from a short delay line, the delay swept by an LFO. The right channel's
+// sweep runs a quarter cycle ahead, which widens the image. The delay is
+// updated every CHORUS_CHUNK frames and slid linearly in between.
+const (
+	CHORUS_BUF_BITS = 10 // 23ms at 44.1kHz, enough for BASE + DEPTH at 48kHz
+	CHORUS_BUF_SIZE = 1 << CHORUS_BUF_BITS
+	CHORUS_BUF_MASK = CHORUS_BUF_SIZE - 1
+	CHORUS_CHUNK    = 16
+
+	CHORUS_BASE_MS  = 12 // Delay at the center of the sweep
+	CHORUS_DEPTH_MS = 6  // Sweep either side at full Depth
+)
+
+// Rate is in 0.1Hz units, Depth and Mix are 0-255. Mix 255 leaves only the
+// delayed copy, which makes a vibrato.
+type Chorus struct {
+	Rate  uint8
+	Depth uint8
+	Mix   uint8
+
+	lfo        LFO
+	bufL, bufR []int16
+	pos        uint32
+	delayL     int32 // Delays at the end of the last chunk, Q8 frames
+	delayR     int32
+}
+
+// Allocate a chorus with its delay lines
+func newChorus() *Chorus {
+	c := &Chorus{Rate: 8, Depth: 128, Mix: 128, lfo: LFO{Shape: WAVE_SINE}}
+	c.bufL = make([]int16, CHORUS_BUF_SIZE)
+	c.bufR = make([]int16, CHORUS_BUF_SIZE)
+	return c
+}
+
+// Read a delay line delay frames (Q8) behind pos
+func (c *Chorus) tap(buf []int16, pos uint32, delay int32) int32 {
+	at := pos - uint32(delay>>8)
+	frac := delay & 0xff
+	a := int32(buf[at&CHORUS_BUF_MASK])
+	b := int32(buf[(at-1)&CHORUS_BUF_MASK])
+	return a + (b-a)*frac>>8
+}
+
+func (c *Chorus) Process(left, right []int32) {
+	c.lfo.Rate = uint32(c.Rate) * 100
+	base := int32(sampleRate) * CHORUS_BASE_MS * 256 / 1000
+	span := int32(sampleRate) * CHORUS_DEPTH_MS / 1000 * int32(c.Depth)
+	if c.delayL == 0 {
+		c.delayL, c.delayR = base, base
+	}
+	wet := int32(c.Mix)
+	dry := 256 - wet
+
+	for start := 0; start < len(left); start += CHORUS_CHUNK {
+		end := min(start+CHORUS_CHUNK, len(left))
+		c.lfo.Advance(end - start)
+		toL := base + span*(c.lfo.Value(0)>>4)>>11
+		toR := base + span*(c.lfo.Value(LFO_QUARTER)>>4)>>11
+		stepL := (toL - c.delayL) / int32(end-start)
+		stepR := (toR - c.delayR) / int32(end-start)
+		for i := start; i < end; i++ {
+			c.delayL += stepL
+			c.delayR += stepR
+			c.bufL[c.pos&CHORUS_BUF_MASK] = clip16(left[i])
+			c.bufR[c.pos&CHORUS_BUF_MASK] = clip16(right[i])
+			left[i] = (left[i]*dry + c.tap(c.bufL, c.pos, c.delayL)*wet) >> 8
+			right[i] = (right[i]*dry + c.tap(c.bufR, c.pos, c.delayR)*wet) >> 8
+			c.pos++
+		}
+		c.delayL, c.delayR = toL, toR
+	}
+}
+
+func init() {
+	addTool("CHORUS", openChorusView)
+}
+
+// Chorus off; Mix 0 leaves a track without the insert
+func defaultChorus() ChorusSettings {
+	return ChorusSettings{Rate: 8, Depth: 128}
+}
+
+// Choruses kept per track once used, so their delay lines are reused
+var trackChorus [NUM_TRACKS]*Chorus
+
+// Follow the active project's chorus settings, plus any macro knob on
+// the chorus of the instrument a track plays, adding or removing the
+// insert on each track as its mix turns on or off
+func updateChorus() {
+	for t := range project.Chorus {
+		cs := &project.Chorus[t]
+		c := trackChorus[t]
+		mix := cs.Mix
+		if in := trackInstrument(t); in != nil {
+			mix = in.knobByte(mix, KNOB_CHORUS)
+		}
+		if mix == 0 {
+			if c != nil {
+				setInsert(t, c, false)
+			}
+			continue
+		}
+		if c == nil {
+			c = newChorus()
+			trackChorus[t] = c
+		}
+		c.Rate, c.Depth, c.Mix = cs.Rate, cs.Depth, mix
+		setInsert(t, c, true)
+	}
+}
+
+// Add or remove an effect from a track's inserts
+func setInsert(t int, fx Effect, on bool) {
+	track := &mixer.Tracks[t]
+	for i, e := range track.Inserts {
+		if e == fx {
+			if !on {
+				audioMu.Lock()
+				track.Inserts = append(track.Inserts[:i:i], track.Inserts[i+1:]...)
+				mixer.Compensate()
+				audioMu.Unlock()
+			}
+			return
+		}
+	}
+	if on {
+		audioMu.Lock()
+		track.Inserts = append(track.Inserts, fx)
+		mixer.Compensate()
+		audioMu.Unlock()
+	}
+}
+
+// Pick a track, then step its rate, depth and mix
+func openChorusView() {
+	list := &ListView{Title: "CHORUS"}
+	for t := range project.Chorus {
+		list.Items = append(list.Items, "TRACK "+itoa(t+1))
+	}
+	list.OnSelect = func(t int) {
+		cs := &project.Chorus[t]
+		openParamList("CHORUS "+itoa(t+1), []settingItem{
+			byteChoice("RATE", func() *uint8 { return &cs.Rate }, []uint8{2, 4, 8, 15, 30, 60},
+				func(v uint8) string { return itoa(int(v)/10) + "." + itoa(int(v)%10) + "HZ" }),
+			byteChoice("DEPTH", func() *uint8 { return &cs.Depth }, []uint8{32, 64, 128, 192, 255},
+				func(v uint8) string { return itoa(int(v)*100/255) + "%" }),
+			byteChoice("MIX", func() *uint8 { return &cs.Mix }, []uint8{0, 64, 128, 192, 255}, func(v uint8) string {
+				if v == 0 {
+					return "OFF"
+				}
+				return itoa(int(v)*100/255) + "%"
+			}),
+		}, nil)
+	}
+	pushView(list)
+}
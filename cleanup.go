@@ -0,0 +1,150 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// What the cleanup tool found unused in a project
+type CleanupReport struct {
+	Instruments []uint8
+	Samples     []uint8
+	Orphans     []string // Files of the unused samples no other project uses
+
+	RAMBytes  int   // Sample data freed from RAM
+	CardBytes int64 // Space freed on the card by deleting orphans
+}
+
+func init() {
+	addTool("CLEAN UP PROJECT", openCleanupView)
+}
+
+// Find instruments no step plays, samples no remaining instrument uses and
+// which of their files in the samples folder no other project on the card
+// plays either
+func scanUnused(p *Project) CleanupReport {
+	var r CleanupReport
+
+	var instrumentUsed [NUM_INSTRUMENTS]bool
+	for ph := range p.Phrases {
+		for _, s := range p.Phrases[ph].Steps {
+			if int(s.Instrument) < NUM_INSTRUMENTS {
+				instrumentUsed[s.Instrument] = true
+			}
+		}
+	}
+	var sampleUsed [MAX_SAMPLES]bool
+	for i, in := range p.Instruments {
+		if !instrumentUsed[i] {
+			if in != defaultInstrument() {
+				r.Instruments = append(r.Instruments, uint8(i))
+			}
+			continue
+		}
+		for _, s := range in.usedSamples() {
+			if int(s) < MAX_SAMPLES {
+				sampleUsed[s] = true
+			}
+		}
+	}
+	var shared map[string]bool
+	for i, name := range p.Samples {
+		if name == "" || sampleUsed[i] {
+			continue
+		}
+		r.Samples = append(r.Samples, uint8(i))
+		if samples[i] != nil {
+			r.RAMBytes += len(samples[i].Data) * 2
+		}
+		if shared == nil {
+			shared = otherProjectSamples(p.Name)
+		}
+		if shared[name] {
+			continue
+		}
+		path := joinPath(samplesDir, name)
+		if info, err := storage.Stat(path); err == nil && !info.Dir {
+			r.Orphans = append(r.Orphans, path)
+			r.CardBytes += info.Size
+		}
+	}
+	return r
+}
+
+// Sample paths the projects on the card other than the named one list,
+// read from their sample chunks without loading them
+func otherProjectSamples(name string) map[string]bool {
+	used := make(map[string]bool)
+	entries, _ := storage.ReadDir(projectsDir)
+	for _, e := range entries {
+		if !e.Dir || e.Name == name {
+			continue
+		}
+		data, err := readFile(projectPath(e.Name))
+		if err != nil || len(data) < 6 || string(data[:4]) != PROJECT_MAGIC {
+			continue
+		}
+		r := &byteReader{buf: data, pos: 6}
+		for !r.done() {
+			id := string(r.sub(4).buf)
+			c := r.sub(int(r.u32()))
+			if id != "SMPL" {
+				continue
+			}
+			for n := int(c.u8()); n > 0; n-- {
+				if s := c.str(); s != "" {
+					used[s] = true
+				}
+			}
+		}
+	}
+	return used
+}
+
+// Reset unused instruments, drop unused samples and optionally move the
+// orphaned files to the trash
+func applyCleanup(p *Project, r *CleanupReport, deleteOrphans bool) {
+	for _, i := range r.Instruments {
+		p.Instruments[i] = defaultInstrument()
+	}
+	for _, i := range r.Samples {
+		p.Samples[i], p.SampleEdits[i], p.SampleSums[i] = "", SampleEdit{}, 0
+		samples[i] = nil
+	}
+	if deleteOrphans {
+		for _, path := range r.Orphans {
+			if err := deleteFile(path); err != nil {
+				println("Failed to delete", path+":", err.Error())
+			}
+		}
+	}
+}
+
+// Summary of the scan with actions to apply it
+func openCleanupView() {
+	list := &ListView{Title: "CLEAN UP PROJECT"}
+	var report CleanupReport
+	refresh := func() {
+		report = scanUnused(project)
+		list.Items = append(list.Items[:0],
+			"UNUSED INSTRUMENTS: "+itoa(len(report.Instruments)),
+			"UNUSED SAMPLES: "+itoa(len(report.Samples)),
+			"ORPHAN FILES: "+itoa(len(report.Orphans)),
+			"FREES "+itoa((report.RAMBytes+1023)/1024)+"K RAM "+itoa(int((report.CardBytes+1023)/1024))+"K CARD",
+			"REMOVE UNUSED",
+			"REMOVE + DELETE FILES",
+		)
+	}
+	refresh()
+	list.OnSelect = func(index int) {
+		switch list.Items[index] {
+		case "REMOVE UNUSED":
+			applyCleanup(project, &report, false)
+		case "REMOVE + DELETE FILES":
+			applyCleanup(project, &report, true)
+		default:
+			return
+		}
+		showStatus("PROJECT CLEANED UP", colorGreen)
+		refresh()
+	}
+	pushView(list)
+}
@@ -0,0 +1,335 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "errors"
+
+// What the clipboard holds
+type ClipKind uint8
+
+const (
+	CLIP_NONE ClipKind = iota
+	CLIP_PHRASE
+	CLIP_CHAIN
+	CLIP_INSTRUMENT
+)
+
+// The clipboard file starts with a magic, then the sizes of step and
+// instrument records so they can grow like in project files
+const (
+	CLIPBOARD_FILE  = "/clipboard.bin"
+	CLIPBOARD_MAGIC = "PTCB"
+)
+
+var (
+	errClipboardEmpty = errors.New("clipboard: empty")
+	errProjectFull    = errors.New("project: no free slot")
+)
+
+var clipKindNames = [...]string{"NOTHING", "PHRASE", "CHAIN", "INSTRUMENT"}
+
+// Copied data, self-contained so it can be pasted into any project. A
+// copied chain carries its phrases and its entries index Phrases.
+type Clipboard struct {
+	Kind       ClipKind
+	Phrases    [CHAIN_LENGTH]Phrase
+	NumPhrases uint8
+	Chain      Chain
+	Instrument Instrument
+	Sample     string
+	Zones      [MAX_ZONES]string // Sample of each instrument zone
+}
+
+var (
+	clipboard Clipboard
+
+	// Second project opened read-only to copy from
+	browseProject *Project
+)
+
+// Open another project read-only next to the active one
+func openBrowseProject(name string) error {
+	p := newProject(name)
+	if err := loadProject(name, p); err != nil {
+		return err
+	}
+	browseProject = p
+	return nil
+}
+
+func closeBrowseProject() {
+	browseProject = nil
+}
+
+// Copy a phrase from any open project or a scratch phrase
+func copyPhrase(ph *Phrase) {
+	clipboard = Clipboard{Kind: CLIP_PHRASE, NumPhrases: 1}
+	clipboard.Phrases[0] = *ph
+	saveClipboard()
+}
+
+// Copy a chain and the phrases it plays
+func copyChain(src *Project, index uint8) {
+	clipboard = Clipboard{Kind: CLIP_CHAIN, Chain: emptyChain()}
+	var slot [NUM_PHRASES]uint8
+	for i := range slot {
+		slot[i] = EMPTY
+	}
+	for i, e := range src.Chains[index].Entries {
+		if e.Phrase == EMPTY {
+			continue
+		}
+		if slot[e.Phrase] == EMPTY {
+			slot[e.Phrase] = clipboard.NumPhrases
+			clipboard.Phrases[clipboard.NumPhrases] = src.Phrases[e.Phrase]
+			clipboard.NumPhrases++
+		}
+		clipboard.Chain.Entries[i] = ChainEntry{slot[e.Phrase], e.Transpose}
+	}
+	saveClipboard()
+}
+
+// Copy an instrument along with its sample path
+func copyInstrument(src *Project, index uint8) {
+	in := src.Instruments[index]
+	clipboard = Clipboard{Kind: CLIP_INSTRUMENT, Instrument: in}
+	if in.Sample != EMPTY {
+		clipboard.Sample = src.Samples[in.Sample]
+	}
+	for i, z := range in.Zones[:in.NumZones] {
+		clipboard.Zones[i] = src.Samples[z.Sample]
+	}
+	saveClipboard()
+}
+
+// Paste into dst at index, or into the first free slot when index is
+// EMPTY. Returns the slot written.
+func pasteClipboard(dst *Project, index uint8) (uint8, error) {
+	if dst == browseProject {
+		return EMPTY, errReadOnly
+	}
+	switch clipboard.Kind {
+	case CLIP_PHRASE:
+		if index == EMPTY {
+			index = dst.freePhrase()
+		}
+		if index == EMPTY {
+			return EMPTY, errProjectFull
+		}
+		dst.Phrases[index] = clipboard.Phrases[0]
+
+	case CLIP_CHAIN:
+		if index == EMPTY {
+			index = dst.freeChain()
+		}
+		if index == EMPTY {
+			return EMPTY, errProjectFull
+		}
+		// Give every copied phrase a free slot in the target project
+		var phrases [CHAIN_LENGTH]uint8
+		for i := 0; i < int(clipboard.NumPhrases); i++ {
+			ph := dst.freePhrase()
+			if ph == EMPTY {
+				return EMPTY, errProjectFull
+			}
+			dst.Phrases[ph] = clipboard.Phrases[i]
+			phrases[i] = ph
+		}
+		chain := clipboard.Chain
+		for i, e := range chain.Entries {
+			if e.Phrase != EMPTY {
+				chain.Entries[i].Phrase = phrases[e.Phrase]
+			}
+		}
+		dst.Chains[index] = chain
+
+	case CLIP_INSTRUMENT:
+		if index == EMPTY {
+			index = dst.freeInstrument()
+		}
+		if index == EMPTY {
+			return EMPTY, errProjectFull
+		}
+		in := clipboard.Instrument
+		if clipboard.Sample != "" {
+			in.Sample = dst.sampleIndex(clipboard.Sample)
+		}
+		for i := range in.Zones[:in.NumZones] {
+			in.Zones[i].Sample = dst.sampleIndex(clipboard.Zones[i])
+		}
+		dst.Instruments[index] = in
+
+	default:
+		return EMPTY, errClipboardEmpty
+	}
+	return index, nil
+}
+
+// Paste from an editor into the slot of the kind it shows. The clipboard
+// must hold the same kind.
+func pasteInEditor(kind ClipKind, index uint8) {
+	if clipboard.Kind != kind {
+		showStatus("CLIPBOARD HOLDS "+clipKindNames[clipboard.Kind], colorRed)
+		return
+	}
+	if _, err := pasteClipboard(project, index); err != nil {
+		println("Failed to paste:", err.Error())
+		showStatus("PASTE FAILED", colorRed)
+		return
+	}
+	showStatus("PASTED "+clipKindNames[kind], colorGreen)
+}
+
+func init() {
+	addTool("BROWSE PROJECT", openBrowsePicker)
+}
+
+// Pick another project, then a phrase, chain or instrument of it to copy.
+// CLOSE lets go of the project.
+func openBrowsePicker() {
+	var names []string
+	entries, _ := storage.ReadDir(projectsDir)
+	for _, e := range entries {
+		if e.Dir && e.Name != project.Name {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		showStatus("NO OTHER PROJECTS", colorRed)
+		return
+	}
+	pushView(&ListView{Title: "BROWSE", Items: names, OnSelect: func(i int) {
+		if err := openBrowseProject(names[i]); err != nil {
+			println("Failed to load project:", err.Error())
+			showStatus("LOAD FAILED", colorRed)
+			return
+		}
+		openBrowseParts(names[i])
+	}})
+}
+
+// The parts of the browsed project to copy from
+func openBrowseParts(name string) {
+	pushView(&ListView{Title: name, Items: []string{"PHRASES", "CHAINS", "INSTRUMENTS", "CLOSE"},
+		OnSelect: func(i int) {
+			p := browseProject
+			if i == 3 || p == nil {
+				closeBrowseProject()
+				popView()
+				popView()
+				return
+			}
+			kind := CLIP_PHRASE + ClipKind(i)
+			var slots []uint8
+			var items []string
+			add := func(s int, used bool) {
+				if used {
+					slots = append(slots, uint8(s))
+					items = append(items, clipKindNames[kind]+" "+hexByte(uint8(s)))
+				}
+			}
+			switch kind {
+			case CLIP_PHRASE:
+				for s := range p.Phrases {
+					add(s, !p.Phrases[s].IsEmpty())
+				}
+			case CLIP_CHAIN:
+				for s := range p.Chains {
+					add(s, !p.Chains[s].IsEmpty())
+				}
+			default:
+				for s := range p.Instruments {
+					add(s, p.Instruments[s].Type != INSTR_NONE)
+				}
+			}
+			if len(items) == 0 {
+				showStatus("NOTHING TO COPY", colorRed)
+				return
+			}
+			pushView(&ListView{Title: name, Items: items, OnSelect: func(j int) {
+				switch kind {
+				case CLIP_PHRASE:
+					copyPhrase(&p.Phrases[slots[j]])
+				case CLIP_CHAIN:
+					copyChain(p, slots[j])
+				default:
+					copyInstrument(p, slots[j])
+				}
+				showStatus("COPIED "+items[j], colorGreen)
+			}})
+		}})
+}
+
+// Keep the clipboard on the card so it survives project switches and reboots
+func saveClipboard() {
+	w := &byteWriter{}
+	w.buf = append(w.buf, CLIPBOARD_MAGIC...)
+	rec := &byteWriter{}
+	encodeInstrument(rec, &clipboard.Instrument)
+	w.u8(STEP_RECORD_SIZE)
+	w.u16(uint16(len(rec.buf)))
+	w.u8(uint8(clipboard.Kind))
+	w.u8(clipboard.NumPhrases)
+	for i := 0; i < int(clipboard.NumPhrases); i++ {
+		for _, s := range clipboard.Phrases[i].Steps {
+			encodeStep(w, &s)
+		}
+	}
+	for _, e := range clipboard.Chain.Entries {
+		w.u8(e.Phrase)
+		w.u8(uint8(e.Transpose))
+	}
+	w.buf = append(w.buf, rec.buf...)
+	w.str(clipboard.Sample)
+	for _, z := range clipboard.Zones {
+		w.str(z)
+	}
+	for i := 0; i < int(clipboard.NumPhrases); i++ {
+		w.u16(clipboard.Phrases[i].Tempo)
+		w.u8(clipboard.Phrases[i].Groove)
+	}
+	if err := writeFile(CLIPBOARD_FILE, w.buf); err != nil {
+		println("Failed to save clipboard:", err.Error())
+	}
+}
+
+// Restore the clipboard saved by saveClipboard
+func loadClipboard() {
+	data, err := readFile(CLIPBOARD_FILE)
+	if err != nil {
+		return
+	}
+	if len(data) < len(CLIPBOARD_MAGIC) || string(data[:len(CLIPBOARD_MAGIC)]) != CLIPBOARD_MAGIC {
+		return
+	}
+	r := &byteReader{buf: data, pos: len(CLIPBOARD_MAGIC)}
+	stepSize, instrumentSize := int(r.u8()), int(r.u16())
+	c := Clipboard{Kind: ClipKind(r.u8()), NumPhrases: r.u8()}
+	if int(c.Kind) >= len(clipKindNames) || c.NumPhrases > CHAIN_LENGTH {
+		return
+	}
+	for i := 0; i < int(c.NumPhrases); i++ {
+		for s := range c.Phrases[i].Steps {
+			rec := r.sub(stepSize)
+			decodeStep(&rec, &c.Phrases[i].Steps[s])
+		}
+	}
+	for i := range c.Chain.Entries {
+		e := ChainEntry{r.u8(), int8(r.u8())}
+		if e.Phrase != EMPTY && e.Phrase >= c.NumPhrases {
+			return // Entries index the copied phrases
+		}
+		c.Chain.Entries[i] = e
+	}
+	rec := r.sub(instrumentSize)
+	decodeInstrument(&rec, &c.Instrument)
+	c.Sample = r.str()
+	for i := range c.Zones {
+		c.Zones[i] = r.str()
+	}
+	for i := 0; i < int(c.NumPhrases); i++ {
+		c.Phrases[i].Tempo, c.Phrases[i].Groove = r.u16(), r.u8()
+	}
+	clipboard = c
+}
@@ -0,0 +1,195 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"machine"
+	"sync/atomic"
+	"time"
+)
+
+// Following an external clock. Pulses from the clock input pin (modular
+// or Pocket Operator sync, through a divider down to 3.3V) or from MIDI
+// clock are timestamped into a queue, and the tempo is taken from the
+// pulses counted over at least CLOCK_WINDOW, scaled by CLOCK RATE. The
+// first pulse while stopped starts the transport, and the transport stops
+// again when pulses stop coming. MIDI clock comes from midi.go, counted
+// each time the UART is drained, as its bytes aren't timed on arrival.
+const (
+	SYNC_INTERNAL = iota
+	SYNC_CLOCK_IN
+	SYNC_MIDI
+
+	MIDI_CLOCK_PPQN  = 24
+	PULSE_QUEUE_SIZE = 16            // must be a power of two
+	PULSE_MIN_GAP    = 2_000_000     // Shorter gaps are bounce, in ns
+	CLOCK_TIMEOUT    = 2_000_000_000 // Stop once no pulse came for this long, in ns
+	CLOCK_WINDOW     = 500_000_000   // Pulses are counted over at least this long, in ns
+	CLOCK_SMOOTHING  = 2             // The interval follows over about 2^n pulses
+	CLOCK_RATE_X1    = 2             // Index of X1 in clockRates
+
+	// GP1 beside it is MIDI_RX_PIN; the I2S input borrows both, see main.go
+	CLOCK_IN_PIN = machine.Pin(0)
+)
+
+var (
+	clockSources   = []string{"INTERNAL", "CLOCK IN", "MIDI"}
+	clockPPQNs     = []uint8{1, 2, 4, 24}
+	clockPPQNNames = []string{"1", "2", "4", "24"}
+	clockRates     = []string{"/4", "/2", "X1", "X2", "X4"}
+)
+
+var (
+	pulseQueue [PULSE_QUEUE_SIZE]pulseBatch
+	pulseHead  atomic.Uint32 // Written by the selected source only
+	pulseTail  atomic.Uint32
+	pulseLast  int64 // Source side, for PULSE_MIN_GAP
+
+	clockInPin = machine.NoPin // No interrupt set up
+	clockSync  ClockSync
+)
+
+// Pulses that had come by a time, in ns
+type pulseBatch struct {
+	at int64
+	n  int32
+}
+
+// Tempo tracking from the pulses of the selected source
+type ClockSync struct {
+	interval int64 // Smoothed ns between pulses, 0 before the first window
+	last     int64
+	since    int64 // Start of the counting window
+	count    int64 // Pulses since it started
+	started  bool  // The transport was started by the clock
+}
+
+func init() {
+	addSetting("CLOCK SOURCE", clockSources,
+		func() int { return int(settings.ClockSource) },
+		func(i int) { settings.ClockSource = uint8(i); watchClockIn() })
+	addSetting("CLOCK PPQN", clockPPQNNames,
+		func() int { return int(settings.ClockPPQN) },
+		func(i int) { settings.ClockPPQN = uint8(i) })
+	addSetting("CLOCK RATE", clockRates,
+		func() int { return int(settings.ClockRate) },
+		func(i int) { settings.ClockRate = uint8(i) })
+}
+
+// Set up the interrupt on the clock input pin, or take it down when the
+// clock input isn't the source
+func watchClockIn() {
+	pin := machine.NoPin
+	if settings.ClockSource == SYNC_CLOCK_IN {
+		pin = CLOCK_IN_PIN
+	}
+	if pin == clockInPin {
+		return
+	}
+	if clockInPin != machine.NoPin {
+		clockInPin.SetInterrupt(0, nil)
+	}
+	clockInPin = pin
+	if pin == machine.NoPin {
+		return
+	}
+	pin.Configure(machine.PinConfig{Mode: machine.PinInputPulldown})
+	err := pin.SetInterrupt(machine.PinRising, func(machine.Pin) { syncPulse(SYNC_CLOCK_IN) })
+	if err != nil {
+		println("Failed to watch clock input:", err.Error())
+		clockInPin = machine.NoPin
+	}
+}
+
+// Log a clock pulse from a source; ignored unless it is the selected one.
+// Called from interrupts, must not allocate.
+func syncPulse(source uint8) {
+	syncPulses(source, 1)
+}
+
+// Log n clock pulses that came by now from a source
+func syncPulses(source uint8, n int32) {
+	if source != settings.ClockSource || n <= 0 {
+		return
+	}
+	at := time.Now().UnixNano()
+	if at-pulseLast < PULSE_MIN_GAP {
+		return
+	}
+	pulseLast = at
+	head := pulseHead.Load()
+	if head-pulseTail.Load() >= PULSE_QUEUE_SIZE {
+		return
+	}
+	pulseQueue[head%PULSE_QUEUE_SIZE] = pulseBatch{at, n}
+	pulseHead.Store(head + 1)
+}
+
+// Pulses per quarter note of the selected source
+func syncPPQN() int64 {
+	if settings.ClockSource == SYNC_MIDI {
+		return MIDI_CLOCK_PPQN
+	}
+	return int64(clockPPQNs[int(settings.ClockPPQN)%len(clockPPQNs)])
+}
+
+// Handle logged pulses: start the transport on the first one, follow the
+// tempo, and stop when they have stopped. Called from the main loop.
+func updateClockSync() {
+	c := &clockSync
+	for tail := pulseTail.Load(); tail != pulseHead.Load(); tail++ {
+		c.pulse(pulseQueue[tail%PULSE_QUEUE_SIZE])
+		pulseTail.Store(tail + 1)
+	}
+	if c.started && isAudioPlaying && time.Now().UnixNano()-c.last > CLOCK_TIMEOUT {
+		c.started = false
+		toggleAudio()
+	}
+}
+
+// Count a batch of pulses, taking the interval once the window is long
+// enough. The pulses of the batch that starts a window came before it and
+// aren't counted.
+func (c *ClockSync) pulse(b pulseBatch) {
+	at := b.at
+	if !isAudioPlaying {
+		*c = ClockSync{last: at, since: at, started: true}
+		toggleAudio()
+		return
+	}
+	stalled := at-c.last > CLOCK_TIMEOUT
+	c.last = at
+	if stalled {
+		c.since, c.count = at, 0
+		return
+	}
+	c.count += int64(b.n)
+	if at-c.since < CLOCK_WINDOW {
+		return
+	}
+	gap := (at - c.since) / c.count
+	c.since, c.count = at, 0
+	if c.interval == 0 {
+		c.interval = gap
+	} else {
+		c.interval += (gap - c.interval) >> CLOCK_SMOOTHING
+	}
+}
+
+// Tempo the clock is running at, or false before it has one. The rate
+// setting divides or multiplies the tempo the pulses give. The sequencer
+// plays at it in place of the song's.
+func (c *ClockSync) Tempo() (uint16, bool) {
+	if settings.ClockSource == SYNC_INTERNAL || c.interval == 0 {
+		return 0, false
+	}
+	bpm := int64(60_000_000_000) / (c.interval * syncPPQN())
+	shift := int(settings.ClockRate) - CLOCK_RATE_X1
+	if shift > 0 {
+		bpm <<= shift
+	} else {
+		bpm >>= -shift
+	}
+	return uint16(min(max(bpm, TEMPO_MIN), TEMPO_MAX)), true
+}
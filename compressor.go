@@ -0,0 +1,90 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Envelope-follower compressor. The level is followed once per
+// COMP_CHUNK frames and the gain slides linearly across each chunk, which
+// keeps the divides out of the per-sample loop. As the mixer's Ducker it is
+// keyed from a track, so a kick can push the rest of the mix down.
+const (
+	COMP_CHUNK       = 16
+	COMP_CHUNK_SHIFT = 4
+	COMP_ENV_SHIFT   = 8 // Envelope fraction bits
+)
+
+// Attenuation of 0-5dB in Q15, for dbLevel
+var dbSteps = [6]int32{32768, 29205, 26029, 23198, 20675, 18427}
+
+// Linear level of a dB amount below full scale
+func dbLevel(db uint8) int32 {
+	return 32767 * dbSteps[db%6] >> 15 >> (db / 6)
+}
+
+// Threshold is in dB below full scale and Ratio the x:1 reduction above
+// it. Attack is in ms and Release in 10ms units. Key is the mixer track
+// that drives it as the Ducker, EMPTY for none.
+type Compressor struct {
+	Threshold uint8
+	Ratio     uint8
+	Attack    uint8
+	Release   uint8
+	Key       uint8
+
+	env  int32 // Followed level, COMP_ENV_SHIFT fraction bits
+	gain int32 // Gain at the end of the last chunk, GAIN_UNITY is none
+}
+
+func newCompressor() *Compressor {
+	return &Compressor{Threshold: 18, Ratio: 4, Attack: 5, Release: 20, Key: EMPTY, gain: GAIN_UNITY}
+}
+
+// Following coefficient in Q16 for a time constant of ms per chunk
+func compCoef(ms int32) int32 {
+	frames := max(ms*int32(sampleRate)/1000, 1)
+	return min(65536*COMP_CHUNK/frames, 65536)
+}
+
+// Compress a block by its own level
+func (c *Compressor) Process(left, right []int32) {
+	c.Duck(left, right, left, right)
+}
+
+// Compress left and right by the level of keyL and keyR, which may be the
+// same slices
+func (c *Compressor) Duck(left, right, keyL, keyR []int32) {
+	attack := compCoef(int32(c.Attack))
+	release := compCoef(int32(c.Release) * 10)
+	threshold := dbLevel(c.Threshold)
+	ratio := max(int32(c.Ratio), 1)
+
+	for start := 0; start < len(left); start += COMP_CHUNK {
+		end := min(start+COMP_CHUNK, len(left))
+		var peak int32
+		for i := start; i < end; i++ {
+			peak = max(peak, keyL[i], -keyL[i], keyR[i], -keyR[i])
+		}
+		level := min(peak, 65535) << COMP_ENV_SHIFT
+		coef := release
+		if level > c.env {
+			coef = attack
+		}
+		c.env += int32(int64(level-c.env) * int64(coef) >> 16)
+
+		target := int32(GAIN_UNITY)
+		if env := c.env >> COMP_ENV_SHIFT; env > threshold {
+			target = (threshold + (env-threshold)/ratio) << GAIN_SHIFT / env
+		}
+		// Slide from the last chunk's gain so steps don't click
+		from, step := c.gain, (target-c.gain)>>COMP_CHUNK_SHIFT
+		if from == GAIN_UNITY && target == GAIN_UNITY {
+			continue
+		}
+		for i := start; i < end; i++ {
+			from += step
+			left[i] = left[i] * from >> GAIN_SHIFT
+			right[i] = right[i] * from >> GAIN_SHIFT
+		}
+		c.gain = target
+	}
+}
@@ -0,0 +1,192 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CPU budget planner: what a voice of an instrument costs to render, and
+// what the song costs at its busiest, from a table of costs the BENCHMARK
+// tool measures on the device and keeps on the card. Each track plays one
+// voice at a time, so a track's load is its dearest instrument anywhere in
+// the song plus its inserts, and the song's worst case is every track at
+// its dearest at once. The mixer's own work comes on top, so aim well
+// below 100%.
+const CPU_TABLE_FILE = "/cputable.txt"
+
+// What the cost table has a cost for
+type CostKind uint8
+
+const (
+	COST_SAMPLE CostKind = iota
+	COST_SAMPLE_LINEAR
+	COST_WAVETABLE
+	COST_OSCILLATOR
+	COST_DRUM
+	COST_FM
+	COST_GRANULAR
+	COST_PLUCK
+	COST_CHORUS
+	COST_GATE
+	COST_CRUSH
+	COST_CARD_READ // Reading and decoding STREAM_CHUNK stereo frames, see streamRingSize
+	NUM_COST_KINDS
+)
+
+// Names in the table file
+var costNames = [NUM_COST_KINDS]string{"sample", "sample-linear", "wavetable", "oscillator", "drum", "fm", "granular", "pluck",
+	"chorus", "gate", "crush", "card-read"}
+
+var (
+	// Microseconds per block of each kind, or per read for the card, 0
+	// until measured
+	cpuCosts     [NUM_COST_KINDS]int
+	cpuCostsRead bool
+)
+
+func init() {
+	addTool("CPU BUDGET", openBudgetView)
+}
+
+// Read the cost table once, ignoring unknown names
+func loadCostTable() {
+	if cpuCostsRead {
+		return
+	}
+	cpuCostsRead = true
+	data, err := readFile(CPU_TABLE_FILE)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		us, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		for k, n := range costNames {
+			if n == name {
+				cpuCosts[k] = us
+			}
+		}
+	}
+}
+
+func saveCostTable() {
+	var b strings.Builder
+	for k, n := range costNames {
+		b.WriteString(n + "=" + itoa(cpuCosts[k]) + "\n")
+	}
+	if err := writeFile(CPU_TABLE_FILE, []byte(b.String())); err != nil {
+		println("Failed to save CPU table:", err.Error())
+	}
+	cpuCostsRead = true
+}
+
+// Microseconds a voice of an instrument takes per block, 0 for none
+func instrumentCost(in *Instrument) int {
+	switch in.Type {
+	case INSTR_SAMPLE:
+		if in.Interpolate {
+			return cpuCosts[COST_SAMPLE_LINEAR]
+		}
+		return cpuCosts[COST_SAMPLE]
+	case INSTR_WAVETABLE:
+		return cpuCosts[COST_WAVETABLE]
+	case INSTR_OSCILLATOR:
+		return cpuCosts[COST_OSCILLATOR]
+	case INSTR_DRUM:
+		return cpuCosts[COST_DRUM]
+	case INSTR_FM:
+		return cpuCosts[COST_FM]
+	case INSTR_GRANULAR:
+		return cpuCosts[COST_GRANULAR]
+	case INSTR_PLUCK:
+		return cpuCosts[COST_PLUCK]
+	}
+	return 0
+}
+
+// Worst case microseconds per block of each track: its dearest
+// instrument in the song, or the MIDI part played on it with all its
+// voices if dearer, and its inserts. Tracks routed off cost nothing.
+func trackLoads(p *Project) (loads [NUM_TRACKS]int) {
+	for r := range p.Song {
+		for t, c := range p.Song[r] {
+			if c == EMPTY || int(c) >= NUM_CHAINS {
+				continue
+			}
+			for _, e := range p.Chains[c].Entries {
+				if e.Phrase == EMPTY || int(e.Phrase) >= NUM_PHRASES {
+					continue
+				}
+				for _, st := range p.Phrases[e.Phrase].Steps {
+					if st.Instrument < NUM_INSTRUMENTS {
+						loads[t] = max(loads[t], instrumentCost(&p.Instruments[st.Instrument]))
+					}
+				}
+			}
+		}
+	}
+	if settings.MidiIn {
+		for part := range settings.MidiTrack {
+			t := settings.MidiTrack[part] % NUM_TRACKS
+			in := &p.Instruments[settings.MidiInstrument[part]%NUM_INSTRUMENTS]
+			loads[t] = max(loads[t], instrumentCost(in)*MIDI_POLYPHONY)
+		}
+	}
+	for t := range loads {
+		if p.Chorus[t].Mix != 0 {
+			loads[t] += cpuCosts[COST_CHORUS]
+		}
+		if p.Gates[t].Threshold != 0 {
+			loads[t] += cpuCosts[COST_GATE]
+		}
+		if p.Crush[t].on() {
+			loads[t] += cpuCosts[COST_CRUSH]
+		}
+		if p.Routes[t] != ROUTE_MIX {
+			loads[t] = 0 // Not rendered
+		}
+	}
+	return loads
+}
+
+// A cost as microseconds and its share of the time a block plays
+func costText(us int) string {
+	blockUs := BLOCK_SIZE * 1_000_000 / int(sampleRate)
+	return itoa(us) + "US " + itoa(us*100/blockUs) + "%"
+}
+
+// Show the selected instrument's voice cost, each track's worst case and
+// the song's, measuring the costs first if they never have been
+func openBudgetView() {
+	loadCostTable()
+	if cpuCosts == [NUM_COST_KINDS]int{} {
+		showStatus("MEASURING CPU", colorText)
+		measureCosts()
+		saveCostTable()
+	}
+	list := &ListView{Title: "CPU BUDGET"}
+	if slot := session.Instrument; slot < NUM_INSTRUMENTS {
+		in := &project.Instruments[slot]
+		list.Items = append(list.Items, "INSTRUMENT "+hexByte(slot)+": "+costText(instrumentCost(in)),
+			"  AS MIDI PART: "+costText(instrumentCost(in)*MIDI_POLYPHONY))
+	}
+	total := 0
+	for t, us := range trackLoads(project) {
+		list.Items = append(list.Items, "TRACK "+itoa(t+1)+": "+costText(us))
+		total += us
+	}
+	list.Items = append(list.Items, "SONG WORST CASE: "+costText(total))
+	if n := streamsSustained(); n > 0 {
+		list.Items = append(list.Items, "CARD STREAMS: "+itoa(n))
+	}
+	pushView(list)
+}
@@ -0,0 +1,52 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Headphone crossfeed: each channel takes in a little of the other, low
+// passed, as a speaker's sound reaches the far ear, so hard panned parts
+// don't sit inside one ear on headphones. It goes on the master output
+// after the meters and leaves bounces alone.
+const (
+	CROSSFEED_CUTOFF = 700 // Hz
+	CROSSFEED_GAIN   = 77  // Q8 share of the far channel, about -10dB
+)
+
+type Crossfeed struct {
+	coef int32    // Q12 one-pole coefficient at rate
+	rate uint32   // Sample rate coef was made for
+	lp   [2]int32 // Low passed left and right
+}
+
+func init() {
+	addSetting("CROSSFEED", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.Crossfeed)) },
+		func(i int) {
+			settings.Crossfeed = i == 1
+			var cf *Crossfeed
+			if settings.Crossfeed {
+				cf = &Crossfeed{}
+			}
+			audioMu.Lock()
+			mixer.Crossfeed = cf
+			audioMu.Unlock()
+		})
+}
+
+func (c *Crossfeed) Process(left, right []int32) {
+	if c.rate != sampleRate {
+		c.coef = int32((1 - math.Exp(-2*math.Pi*CROSSFEED_CUTOFF/float64(sampleRate))) * 4096)
+		c.rate = sampleRate
+	}
+	lpL, lpR := c.lp[0], c.lp[1]
+	for i := range left {
+		l, r := left[i], right[i]
+		lpL += (l - lpL) * c.coef >> 12
+		lpR += (r - lpR) * c.coef >> 12
+		left[i] = (l<<8 + lpR*CROSSFEED_GAIN) / (256 + CROSSFEED_GAIN)
+		right[i] = (r<<8 + lpL*CROSSFEED_GAIN) / (256 + CROSSFEED_GAIN)
+	}
+	c.lp[0], c.lp[1] = lpL, lpR
+}
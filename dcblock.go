@@ -0,0 +1,34 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// One-pole high pass on the master bus that removes DC offset, as from
+// pulse voices: y = x - x1 + y1 - y1/2^DC_POLE_SHIFT. The output is kept
+// with DC_FRAC_BITS of fraction so the slow decay isn't lost to rounding.
+// The corner sits at a few Hz, well below anything audible. Overs pass
+// through untouched for the soft clipper or limiter after it.
+const (
+	DC_POLE_SHIFT = 11
+	DC_FRAC_BITS  = 8
+)
+
+type DCBlocker struct {
+	x1 [2]int32
+	y1 [2]int64 // Last output with DC_FRAC_BITS of fraction
+}
+
+func (d *DCBlocker) Process(left, right []int32) {
+	d.channel(0, left)
+	d.channel(1, right)
+}
+
+func (d *DCBlocker) channel(c int, buf []int32) {
+	x1, y1 := d.x1[c], d.y1[c]
+	for i, x := range buf {
+		y1 += int64(x-x1)<<DC_FRAC_BITS - y1>>DC_POLE_SHIFT
+		x1 = x
+		buf[i] = int32(y1 >> DC_FRAC_BITS)
+	}
+	d.x1[c], d.y1[c] = x1, y1
+}
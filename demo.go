@@ -0,0 +1,139 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "time"
+
+// Attract mode for show floors: plays a built-in song with the scope and
+// rotating hints until any key is pressed. It can also start by itself
+// after a while without input.
+const DEMO_HINT_TIME = 4 * time.Second
+
+var (
+	demoActive    bool
+	demoPrevious  *Project // Project to return to on exit
+	demoStarted   time.Time
+	demoOwnsAudio bool // Playback was started by the demo
+
+	lastInputTime = time.Now()
+
+	demoIdleDelays = []time.Duration{0, 2 * time.Minute, 10 * time.Minute}
+
+	demoHints = []string{
+		"PRESS ANY KEY TO PLAY",
+		"8 TRACKS, SONG-CHAIN-PHRASE",
+		"SAMPLES, WAVETABLES AND FM",
+		"BUILT WITH TINYGO",
+	}
+)
+
+func init() {
+	addTool("DEMO MODE", startDemo)
+	addSetting("DEMO WHEN IDLE", []string{"OFF", "2 MIN", "10 MIN"},
+		func() int { return int(settings.DemoIdle) },
+		func(i int) { settings.DemoIdle = uint8(i) })
+}
+
+// Short song played by the demo, using only synth voices
+func newDemoProject() *Project {
+	p := newProject("DEMO")
+	p.Instruments[0] = Instrument{Name: "BASS", Type: INSTR_OSCILLATOR, Sample: EMPTY,
+		Wave: uint8(OSC_PULSE), Volume: 200, Pan: PAN_CENTER}
+	p.Instruments[1] = Instrument{Name: "LEAD", Type: INSTR_WAVETABLE, Sample: EMPTY,
+		Wave: WAVE_SAW, Volume: 140, Pan: PAN_CENTER + 40}
+	p.Instruments[2] = Instrument{Name: "HAT", Type: INSTR_OSCILLATOR, Sample: EMPTY,
+		Wave: uint8(OSC_NOISE), Volume: 90, Pan: PAN_CENTER - 40}
+
+	bass := []uint8{36, EMPTY, 36, 48, EMPTY, 36, 46, EMPTY, 36, EMPTY, 36, 48, EMPTY, 43, 46, 48}
+	lead := []uint8{72, EMPTY, 75, EMPTY, 79, EMPTY, 77, 75, EMPTY, EMPTY, 72, EMPTY, 70, EMPTY, 72, EMPTY}
+	for i := 0; i < PHRASE_STEPS; i++ {
+		if bass[i] != EMPTY {
+			p.Phrases[0].Steps[i] = Step{Note: bass[i], Instrument: 0}
+		}
+		if lead[i] != EMPTY {
+			p.Phrases[1].Steps[i] = Step{Note: lead[i], Instrument: 1}
+		}
+		if i%2 == 0 {
+			p.Phrases[2].Steps[i] = Step{Note: 84, Instrument: 2}
+		}
+	}
+
+	// Bass and lead move through I-I-IV-V, the hats just repeat
+	for i, transpose := range []int8{0, 0, 5, 7} {
+		p.Chains[0].Entries[i] = ChainEntry{0, transpose}
+		p.Chains[1].Entries[i] = ChainEntry{1, transpose}
+		p.Chains[2].Entries[i] = ChainEntry{2, 0}
+	}
+	p.Song[0][0], p.Song[0][1], p.Song[0][2] = 0, 1, 2
+	return p
+}
+
+// Swap in the demo song and start playing it
+func startDemo() {
+	if demoActive {
+		return
+	}
+	demoActive = true
+	demoPrevious = project
+	project = newDemoProject()
+	demoStarted = time.Now()
+	// Playing already, updateSequencer starts the demo song from the top
+	demoOwnsAudio = !isAudioPlaying
+	if demoOwnsAudio {
+		toggleAudio()
+	}
+	pushView(&demoView{})
+}
+
+// Leave the demo and put back what was there before
+func stopDemo() {
+	demoActive = false
+	project = demoPrevious
+	demoPrevious = nil
+	if demoOwnsAudio && isAudioPlaying {
+		toggleAudio()
+	}
+	popView()
+}
+
+// Any key press ends the demo and is not passed on. Also notes the time of
+// the last input for the idle timer.
+func demoConsumeKey(ev KeyEvent) bool {
+	lastInputTime = time.Now()
+	if !demoActive {
+		return false
+	}
+	if ev.Pressed {
+		stopDemo()
+	}
+	return true
+}
+
+// Start the demo when the device has been left alone long enough
+func demoIdleCheck() {
+	delay := demoIdleDelays[settings.DemoIdle%uint8(len(demoIdleDelays))]
+	if delay == 0 || demoActive || isAudioPlaying || performanceLocked {
+		return
+	}
+	if time.Since(lastInputTime) > delay {
+		startDemo()
+	}
+}
+
+// Full screen scope with a hint line that changes every few seconds
+type demoView struct{}
+
+func (*demoView) Draw() {
+	drawText(0, 0, "picoTracker DEMO", colorGreen)
+	drawScope(SCREEN_HEIGHT/2, SCREEN_HEIGHT/2, colorGreen)
+	hint := int(time.Since(demoStarted)/DEMO_HINT_TIME) % len(demoHints)
+	drawText(0, viewRows()-1, demoHints[hint], colorText)
+}
+
+func (*demoView) HandleAction(a Action) {}
+
+// Redraw every frame to animate the scope
+func (*demoView) Tick() {
+	redrawView()
+}
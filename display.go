@@ -0,0 +1,108 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"image/color"
+
+	"tinygo.org/x/drivers/st7789"
+)
+
+// The panel is drawn through Screen, which can batch a region of the
+// screen. Drawing straight to the ST7789 sets a window, toggling DC and CS,
+// for every rectangle and for every pixel of text. Inside drawBatched the
+// region is drawn in bands of BAND_ROWS lines into RAM instead, and each
+// band goes out in one window write. CS is held low for good since the
+// panel is alone on its bus.
+const BAND_ROWS = 24
+
+// ST7789 with batched region drawing
+type Screen struct {
+	st7789.Device
+
+	band     []uint8 // RGB565 big endian, SCREEN_WIDTH wide
+	bandY    int16
+	bandH    int16
+	batching bool
+}
+
+// Run draw once per band over rows y to y+h, sending each band in a single
+// write. draw must paint every pixel of the region.
+func drawBatched(y, h int16, draw func()) {
+	s := &display
+	if s.band == nil {
+		s.band = make([]uint8, SCREEN_WIDTH*BAND_ROWS*2)
+	}
+	s.batching = true
+	for top := y; top < y+h; top += BAND_ROWS {
+		s.bandY, s.bandH = top, min(BAND_ROWS, y+h-top)
+		draw()
+		err := s.Device.DrawRGBBitmap8(0, top, s.band[:SCREEN_WIDTH*int(s.bandH)*2], SCREEN_WIDTH, s.bandH)
+		if err != nil {
+			println("Failed to flush display band:", err.Error())
+		}
+		streamBand(top, s.band, s.bandH)
+	}
+	s.batching = false
+	endScreenFrame(y == 0 && h == SCREEN_HEIGHT)
+}
+
+// Panel pixel format, as the driver sends it
+func rgb565(c color.RGBA) uint16 {
+	return uint16(c.R&0xF8)<<8 | uint16(c.G&0xFC)<<3 | uint16(c.B>>3)
+}
+
+func (s *Screen) SetPixel(x, y int16, c color.RGBA) {
+	if !s.batching {
+		s.Device.SetPixel(x, y, c)
+		return
+	}
+	if x < 0 || x >= SCREEN_WIDTH || y < s.bandY || y >= s.bandY+s.bandH {
+		return
+	}
+	i := (int(y-s.bandY)*SCREEN_WIDTH + int(x)) * 2
+	v := rgb565(c)
+	s.band[i], s.band[i+1] = uint8(v>>8), uint8(v)
+}
+
+func (s *Screen) FillRectangle(x, y, width, height int16, c color.RGBA) error {
+	if !s.batching {
+		return s.Device.FillRectangle(x, y, width, height, c)
+	}
+	x0, x1 := max(x, 0), min(x+width, SCREEN_WIDTH)
+	y0, y1 := max(y, s.bandY), min(y+height, s.bandY+s.bandH)
+	v := rgb565(c)
+	hi, lo := uint8(v>>8), uint8(v)
+	for row := y0; row < y1; row++ {
+		line := s.band[int(row-s.bandY)*SCREEN_WIDTH*2:]
+		for col := x0; col < x1; col++ {
+			line[col*2], line[col*2+1] = hi, lo
+		}
+	}
+	return nil
+}
+
+func (s *Screen) FillScreen(c color.RGBA) {
+	if !s.batching {
+		s.Device.FillScreen(c)
+		return
+	}
+	s.FillRectangle(0, 0, SCREEN_WIDTH, SCREEN_HEIGHT, c)
+}
+
+func (s *Screen) DrawFastVLine(x, y0, y1 int16, c color.RGBA) {
+	if !s.batching {
+		s.Device.DrawFastVLine(x, y0, y1, c)
+		return
+	}
+	s.FillRectangle(x, min(y0, y1), 1, max(y0, y1)-min(y0, y1)+1, c)
+}
+
+// Batched bands are sent as they finish, so there is nothing to flush
+func (s *Screen) Display() error {
+	if s.batching {
+		return nil
+	}
+	return s.Device.Display()
+}
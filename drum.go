@@ -0,0 +1,215 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Synthesized drums, so a kit can be made without samples. Each drum has
+// three macro parameters, 0-255:
+//
+//	KICK   DECAY, TONE how far the pitch sweeps down, SNAP the click
+//	SNARE  DECAY, TONE the level of the drum body, SNAP the noise level
+//	HAT    DECAY, TONE the brightness, SNAP how metallic it rings
+//
+// Kick and snare bodies play at the note's pitch; hats ignore the note.
+type DrumKind uint8
+
+const (
+	DRUM_KICK DrumKind = iota
+	DRUM_SNARE
+	DRUM_HAT
+	NUM_DRUMS
+)
+
+const (
+	DRUM_SWEEP_MS = 40 // Time constant of the kick's pitch drop
+	DRUM_BODY_MS  = 60 // Time constant of the snare body
+	DRUM_CLICK_MS = 3  // Length of the kick's click
+	DRUM_UNITY    = 1 << 24
+	DRUM_SILENT   = DRUM_UNITY >> 10 // Envelope level where a drum stops
+)
+
+var drumNames = []string{"KICK", "SNARE", "HAT"}
+
+// Frequencies of the six square waves of an 808 style hat, in mHz
+var hatPartials = [6]uint32{205300, 304400, 369600, 522700, 540000, 800000}
+
+// Macro settings a drum starts from
+var drumDefaults = [NUM_DRUMS]DrumParams{
+	DRUM_KICK:  {Decay: 96, Tone: 160, Snap: 64},
+	DRUM_SNARE: {Decay: 64, Tone: 128, Snap: 192},
+	DRUM_HAT:   {Decay: 32, Tone: 192, Snap: 96},
+}
+
+// A kick, snare or hat. Envelopes are Q24 and fall by a Q16 factor each
+// frame.
+type DrumVoice struct {
+	Kind  DrumKind
+	Level uint8
+	DrumParams
+
+	freq     uint32 // Body pitch in mHz, with the bend
+	phase    uint32
+	env      int32 // Main envelope
+	body     int32 // Snare body or kick pitch envelope
+	decay    int32 // Factors per frame, Q16
+	bodyFall int32
+	click    int32 // Frames of click left
+	velocity uint8
+	rng      uint32
+	lp       int32                    // Hat noise low pass state
+	partials [len(hatPartials)]uint32 // Phases
+	partInc  [len(hatPartials)]uint32
+	note     uint8
+	bend     int // Cents, see Bend
+}
+
+func newDrumVoice(kind DrumKind) *DrumVoice {
+	v := new(DrumVoice)
+	v.reset(kind)
+	return v
+}
+
+// Start the voice over as new, in place
+func (v *DrumVoice) reset(kind DrumKind) {
+	*v = DrumVoice{Kind: kind, Level: 255, DrumParams: drumDefaults[kind%NUM_DRUMS], rng: 0x9e3779b9}
+}
+
+// Factor per frame, Q16, for an exponential fall with a time constant
+func decayFactor(ms float64) int32 {
+	return int32(65536 * math.Exp(-1000/(ms*float64(sampleRate))))
+}
+
+// Main envelope time constant: 10ms to about a second
+func drumDecayMs(d uint8) float64 {
+	return 10 + float64(d)*float64(d)/64
+}
+
+func (v *DrumVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	v.note, v.velocity = noteIndex(note), velocity
+	v.freq = noteFrequency(int(v.note), v.bend)
+	v.phase, v.env, v.body, v.lp = 0, DRUM_UNITY, DRUM_UNITY, 0
+	v.decay = decayFactor(drumDecayMs(v.Decay))
+	v.bodyFall = decayFactor(DRUM_BODY_MS)
+	if v.Kind == DRUM_KICK {
+		v.bodyFall = decayFactor(DRUM_SWEEP_MS)
+	}
+	v.click = int32(sampleRate) * DRUM_CLICK_MS / 1000
+	for j, f := range hatPartials {
+		v.partInc[j] = phaseIncrement(f)
+	}
+}
+
+// Drums ring out; a note off leaves them be
+func (v *DrumVoice) NoteOff() {}
+
+func (v *DrumVoice) Sounding() bool { return v.env >= DRUM_SILENT }
+
+func (v *DrumVoice) Retune() { v.freq = noteFrequency(int(v.note), v.bend) }
+
+// Offset the body pitch from the last NoteOn by cents
+func (v *DrumVoice) Bend(cents int) {
+	v.bend = cents
+	v.Retune()
+}
+
+// Next white noise sample, -32768 to 32767
+func (v *DrumVoice) noise() int32 {
+	v.rng ^= v.rng << 13
+	v.rng ^= v.rng >> 17
+	v.rng ^= v.rng << 5
+	return int32(int16(v.rng))
+}
+
+func (v *DrumVoice) Render(out []int32) {
+	if v.env < DRUM_SILENT {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	sine := &wavetables[WAVE_SINE]
+	inc := phaseIncrement(v.freq)
+	for i := range out {
+		var s int32
+		switch v.Kind {
+		case DRUM_KICK:
+			// Up to five times the pitch at the start, falling to the note
+			sweep := uint32(int64(inc) * int64(v.Tone) * int64(v.body) >> 30)
+			v.phase += inc + sweep
+			s = int32(sine[v.phase>>(32-WAVETABLE_BITS)]) * 3 >> 2
+			if v.click > 0 {
+				s += v.noise() * int32(v.Snap) >> 10
+				v.click--
+			}
+		case DRUM_SNARE:
+			v.phase += inc
+			body := int32(sine[v.phase>>(32-WAVETABLE_BITS)]) * (v.body >> 9) >> 15
+			s = (body*int32(v.Tone) + v.noise()*int32(v.Snap)) >> 9
+		default:
+			s = v.hat()
+		}
+		out[i] += int32(int64(s) * int64(v.env) >> 24 * int64(level) >> 8)
+		v.env = int32(int64(v.env) * int64(v.decay) >> 16)
+		v.body = int32(int64(v.body) * int64(v.bodyFall) >> 16)
+	}
+}
+
+// Next hat sample: noise and square partials through a high pass that
+// cuts higher the higher Tone is
+func (v *DrumVoice) hat() int32 {
+	var metal int32
+	for j, inc := range v.partInc {
+		v.partials[j] += inc
+		if v.partials[j]&(1<<31) != 0 {
+			metal += 5000
+		} else {
+			metal -= 5000
+		}
+	}
+	x := v.noise()*int32(255-v.Snap)>>8 + metal*int32(v.Snap)>>8
+	v.lp += (x - v.lp) >> (4 - min(v.Tone/64, 3))
+	return x - v.lp
+}
+
+func init() {
+	addTool("DRUM VOICE", openDrumView)
+}
+
+// Turn the selected instrument into a drum and step its macros
+func openDrumView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	macro := func(name string, field func() *uint8) settingItem {
+		return byteChoice(name, field, []uint8{0, 32, 64, 96, 128, 160, 192, 224, 255},
+			func(v uint8) string { return itoa(int(v)*100/255) + "%" })
+	}
+	openInstrumentParams("DRUM "+itoa(int(slot)), in, []settingItem{
+		{"DRUM", append([]string{"OFF"}, drumNames...),
+			func() int {
+				if in.Type != INSTR_DRUM {
+					return 0
+				}
+				return int(in.Wave%uint8(NUM_DRUMS)) + 1
+			},
+			func(i int) {
+				if i == 0 {
+					if in.Type == INSTR_DRUM {
+						in.Type = INSTR_NONE
+					}
+					return
+				}
+				in.Type, in.Wave, in.Drum = INSTR_DRUM, uint8(i-1), drumDefaults[i-1]
+			}},
+		macro("DECAY", func() *uint8 { return &in.Drum.Decay }),
+		macro("TONE", func() *uint8 { return &in.Drum.Tone }),
+		macro("SNAP", func() *uint8 { return &in.Drum.Snap }),
+	}, nil)
+}
@@ -0,0 +1,165 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Three-band channel EQ: a low shelf, a peaking mid and a high shelf, run
+// as cascaded biquads. Coefficients are Q12 from the RBJ cookbook and are
+// worked out in floating point only when a gain or the sample rate
+// changes. Bands left at 0dB are skipped. Each filter feeds the rounding
+// error of its output back in, which keeps the low shelf from hissing.
+const (
+	EQ_COEF_SHIFT = 12
+	EQ_MAX_DB     = 12
+
+	EQ_LOW_HZ  = 250
+	EQ_MID_HZ  = 1500
+	EQ_HIGH_HZ = 5000
+	EQ_SLOPE   = 0.707 // Shelf slope and mid Q
+)
+
+// EQ bands
+const (
+	EQ_LOW = iota
+	EQ_MID
+	EQ_HIGH
+	NUM_EQ_BANDS
+)
+
+// Biquad coefficients, Q12, with the feedback terms negated
+type biquad struct {
+	b0, b1, b2, a1, a2 int32
+}
+
+// Direct form I history of one channel through one biquad
+type biquadState struct {
+	x1, x2, y1, y2 int32
+	err            int32 // Bits dropped from the last output
+}
+
+func (f *biquad) process(s *biquadState, x int32) int32 {
+	acc := f.b0*x + f.b1*s.x1 + f.b2*s.x2 + f.a1*s.y1 + f.a2*s.y2 + s.err
+	y := acc >> EQ_COEF_SHIFT
+	s.err = acc & (1<<EQ_COEF_SHIFT - 1)
+	s.x2, s.x1 = s.x1, x
+	s.y2, s.y1 = s.y1, int32(clip16(y))
+	return y
+}
+
+// RBJ cookbook filter for a band at a gain in dB
+func eqBiquad(band int, db int8, rate uint32) biquad {
+	freq := [NUM_EQ_BANDS]float64{EQ_LOW_HZ, EQ_MID_HZ, EQ_HIGH_HZ}[band]
+	return rbjBiquad(band, freq, float64(db), rate)
+}
+
+// RBJ cookbook low shelf, peak or high shelf, by EQ band, at any corner
+func rbjBiquad(band int, freq, db float64, rate uint32) biquad {
+	a := math.Pow(10, db/40)
+	w := 2 * math.Pi * freq / float64(rate)
+	cosw := math.Cos(w)
+	alpha := math.Sin(w) / (2 * EQ_SLOPE)
+	sq := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch band {
+	case EQ_LOW:
+		b0 = a * ((a + 1) - (a-1)*cosw + sq)
+		b1 = 2 * a * ((a - 1) - (a+1)*cosw)
+		b2 = a * ((a + 1) - (a-1)*cosw - sq)
+		a0 = (a + 1) + (a-1)*cosw + sq
+		a1 = -2 * ((a - 1) + (a+1)*cosw)
+		a2 = (a + 1) + (a-1)*cosw - sq
+	case EQ_MID:
+		b0 = 1 + alpha*a
+		b1 = -2 * cosw
+		b2 = 1 - alpha*a
+		a0 = 1 + alpha/a
+		a1 = -2 * cosw
+		a2 = 1 - alpha/a
+	default:
+		b0 = a * ((a + 1) + (a-1)*cosw + sq)
+		b1 = -2 * a * ((a - 1) + (a+1)*cosw)
+		b2 = a * ((a + 1) + (a-1)*cosw - sq)
+		a0 = (a + 1) - (a-1)*cosw + sq
+		a1 = 2 * ((a - 1) - (a+1)*cosw)
+		a2 = (a + 1) - (a-1)*cosw - sq
+	}
+	q := func(c float64) int32 { return int32(math.Round(c / a0 * (1 << EQ_COEF_SHIFT))) }
+	return biquad{q(b0), q(b1), q(b2), -q(a1), -q(a2)}
+}
+
+// Gains are in dB, -EQ_MAX_DB to EQ_MAX_DB
+type EQ struct {
+	Gains [NUM_EQ_BANDS]int8
+
+	filters [NUM_EQ_BANDS]biquad
+	state   [2][NUM_EQ_BANDS]biquadState
+	built   [NUM_EQ_BANDS]int8 // Gains the filters were worked out for
+	rate    uint32
+}
+
+// Whether every band is at 0dB
+func (e *EQ) flat() bool {
+	return e.Gains == [NUM_EQ_BANDS]int8{}
+}
+
+func (e *EQ) Process(left, right []int32) {
+	if e.flat() && e.built == e.Gains {
+		return
+	}
+	if e.Gains != e.built || e.rate != sampleRate {
+		for b, db := range e.Gains {
+			db = max(min(db, EQ_MAX_DB), -EQ_MAX_DB)
+			e.filters[b] = eqBiquad(b, db, sampleRate)
+		}
+		e.built, e.rate = e.Gains, sampleRate
+	}
+	for b := range e.filters {
+		if e.built[b] == 0 {
+			continue
+		}
+		f, sl, sr := &e.filters[b], &e.state[0][b], &e.state[1][b]
+		for i := range left {
+			left[i] = f.process(sl, int32(clip16(left[i])))
+			right[i] = f.process(sr, int32(clip16(right[i])))
+		}
+	}
+}
+
+// Set a track's EQ, as an instrument's gains when it starts playing on the
+// track. Safe from the audio loop.
+func setTrackEQ(t int, gains [NUM_EQ_BANDS]int8) {
+	mixer.Tracks[t].EQ.Gains = gains
+}
+
+func init() {
+	addTool("INSTRUMENT EQ", openInstrumentEQView)
+}
+
+// Step the selected instrument's band gains in 3dB steps
+func openInstrumentEQView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	var values []string
+	for db := -EQ_MAX_DB; db <= EQ_MAX_DB; db += 3 {
+		name := itoa(db) + "DB"
+		if db > 0 {
+			name = "+" + name
+		}
+		values = append(values, name)
+	}
+	band := func(name string, b int) settingItem {
+		return settingItem{name, values,
+			func() int { return (max(min(int(in.EQ[b]), EQ_MAX_DB), -EQ_MAX_DB) + EQ_MAX_DB) / 3 },
+			func(i int) { in.EQ[b] = int8(i*3 - EQ_MAX_DB) }}
+	}
+	openInstrumentParams("EQ "+itoa(int(slot)), in, []settingItem{
+		band("LOW", EQ_LOW), band("MID", EQ_MID), band("HIGH", EQ_HIGH),
+	}, nil)
+}
@@ -0,0 +1,74 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Callbacks a fork can hook into without touching core files. Add a new
+// file that calls registerExtension from its init function:
+//
+//	func init() {
+//		registerExtension(&Extension{Name: "blink", OnTick: blinkOnTick})
+//	}
+//
+// Every callback is optional. Callbacks run on the goroutine that fires the
+// event and must return quickly; OnTick and OnNote run on the audio path.
+type Extension struct {
+	Name string
+
+	// Called on every sequencer tick, with the ticks played since the song
+	// started. A step is TICKS_PER_STEP ticks.
+	OnTick func(tick uint32)
+
+	// Called when the sequencer starts a note on a track
+	OnNote func(track uint8, note uint8, velocity uint8)
+
+	// Called once after the core has redrawn the screen, before it is
+	// flushed. It draws straight to the panel, past the batched bands and
+	// the screen stream.
+	OnViewDraw func()
+
+	// Called for each key event before the keymap sees it. Return true to
+	// consume the event.
+	OnKey func(ev KeyEvent) bool
+}
+
+var extensions []*Extension
+
+// Add an extension, normally from an init function
+func registerExtension(e *Extension) {
+	extensions = append(extensions, e)
+}
+
+func fireTick(tick uint32) {
+	for _, e := range extensions {
+		if e.OnTick != nil {
+			e.OnTick(tick)
+		}
+	}
+}
+
+func fireNote(track, note, velocity uint8) {
+	for _, e := range extensions {
+		if e.OnNote != nil {
+			e.OnNote(track, note, velocity)
+		}
+	}
+}
+
+func fireViewDraw() {
+	for _, e := range extensions {
+		if e.OnViewDraw != nil {
+			e.OnViewDraw()
+		}
+	}
+}
+
+// Offer a key event to the extensions, reporting whether one consumed it
+func fireKey(ev KeyEvent) bool {
+	for _, e := range extensions {
+		if e.OnKey != nil && e.OnKey(ev) {
+			return true
+		}
+	}
+	return false
+}
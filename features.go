@@ -0,0 +1,31 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Optional features that can be left out with build tags to fit smaller
+// boards. Build with -tags minimal to drop all of them. See docs/features.md.
+var featureList = [...]struct {
+	name    string
+	tag     string
+	enabled bool
+	ram     func() int
+}{
+	{"reverb", "noreverb", FEATURE_REVERB, reverbFootprint},
+	{"script", "noscript", FEATURE_SCRIPT, scriptFootprint},
+}
+
+// Print which features are built in and the RAM each one reserves
+func reportFeatures() {
+	total := 0
+	for _, f := range featureList {
+		if !f.enabled {
+			println("Feature", f.name, "off (-tags", f.tag+")")
+			continue
+		}
+		ram := f.ram()
+		total += ram
+		println("Feature", f.name, "on, RAM", ram, "bytes")
+	}
+	println("Optional features RAM:", total, "bytes")
+}
@@ -0,0 +1,77 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Fills and trig conditions. A step with a T command plays only when its
+// condition holds, and is otherwise skipped whole, note, instrument and
+// commands, as if empty. Holding NAV+PLAY plays a fill on every track at
+// once: fill-only steps play and steps marked not for fills drop out. With
+// the FILL setting on LATCH, NAV+PLAY turns the fill on and off instead.
+// Fills work while the controls are locked, as bends do.
+const (
+	TRIG_FILL     = 0x00 // Only during a fill
+	TRIG_NOT_FILL = 0x01 // Only outside a fill
+)
+
+var (
+	fillActive bool   // Read by the sequencer under audioMu
+	fillButton Button // Button holding a fill, NUM_BUTTONS when none
+)
+
+func init() {
+	fillButton = NUM_BUTTONS
+	addSetting("FILL", []string{"HOLD", "LATCH"},
+		func() int { return int(boolByte(settings.FillLatch)) },
+		func(i int) { settings.FillLatch = i == 1 })
+}
+
+// Whether a step's trig condition holds, those without one always
+// playing. Conditions not known play always too.
+func stepPlays(st *Step) bool {
+	cond, ok := stepCommand(st, FX_TRIG)
+	if !ok {
+		return true
+	}
+	switch cond {
+	case TRIG_FILL:
+		return fillActive
+	case TRIG_NOT_FILL:
+		return !fillActive
+	}
+	return true
+}
+
+func setFill(on bool) {
+	audioMu.Lock()
+	fillActive = on
+	audioMu.Unlock()
+	if on {
+		showStatus("FILL", colorGreen)
+	} else {
+		showStatus("FILL OFF", colorText)
+	}
+}
+
+// Start a fill on NAV+PLAY and end it when PLAY is let go, or toggle it
+// when latching. Returns true for the events it takes.
+func fillKey(ev KeyEvent) bool {
+	if !ev.Pressed {
+		if ev.Button != fillButton {
+			return false
+		}
+		fillButton = NUM_BUTTONS
+		setFill(false)
+		return true
+	}
+	if lookupAction(ev.Mods, ev.Button) != ACTION_FILL {
+		return false
+	}
+	if settings.FillLatch {
+		setFill(!fillActive)
+		return true
+	}
+	fillButton = ev.Button
+	setFill(true)
+	return true
+}
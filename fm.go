@@ -0,0 +1,104 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Phase offset per unit of sine output times Index, giving a modulation
+// index of up to 8 radians at Index 255
+const (
+	FM_INDEX_SCALE    = 654
+	FM_FEEDBACK_SCALE = 123 // up to 1.5 radians of self-modulation
+)
+
+// Two-operator FM voice: a sine modulator with feedback driving the phase
+// of a sine carrier. Ratio is the modulator frequency in quarters of the
+// carrier frequency (4 = 1:1, 14 = 3.5:1). Index, Feedback and Level are
+// 0-255.
+type FMVoice struct {
+	Ratio    uint8
+	Index    uint8
+	Feedback uint8
+	Level    uint8
+
+	carPhase, carInc uint32
+	freq             uint32
+	modPhase         uint32
+	prev1, prev2     int32
+	velocity         uint8
+	note             uint8
+	bend             int // Cents, see Bend
+}
+
+// Settings an FM instrument starts from: a 1:1 ratio and moderate
+// modulation
+var fmDefaults = FMParams{Ratio: 4, Index: 64}
+
+// Ratios the instrument editor offers, in quarters
+var fmRatios = []uint8{1, 2, 3, 4, 6, 8, 10, 12, 14, 16, 20, 24, 28, 32}
+
+// Create an FM voice with the default settings
+func newFMVoice() *FMVoice {
+	v := new(FMVoice)
+	v.reset()
+	return v
+}
+
+// Start the voice over as new, in place
+func (v *FMVoice) reset() {
+	*v = FMVoice{Ratio: fmDefaults.Ratio, Index: fmDefaults.Index, Level: 255}
+}
+
+// Set the carrier pitch in mHz
+func (v *FMVoice) SetFrequency(milliHz uint32) {
+	v.freq = milliHz
+	v.carInc = phaseIncrement(milliHz)
+}
+
+func (v *FMVoice) Retune() { v.SetFrequency(v.freq) }
+
+func (v *FMVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	n := noteIndex(note)
+	v.freq, v.carInc, v.velocity, v.note = noteFrequencies[n], noteIncrements[n], velocity, n
+	if v.bend != 0 {
+		v.SetFrequency(noteFrequency(int(n), v.bend))
+	}
+}
+
+// Offset the pitch from the last NoteOn by cents, without starting a note
+func (v *FMVoice) Bend(cents int) {
+	v.bend = cents
+	if v.freq != 0 {
+		v.SetFrequency(noteFrequency(int(v.note), cents))
+	}
+}
+
+func (v *FMVoice) NoteOff() { v.SetFrequency(0) }
+
+func (v *FMVoice) Sounding() bool { return v.carInc != 0 }
+
+func (v *FMVoice) Render(out []int32) {
+	if v.carInc == 0 {
+		return
+	}
+	sine := &wavetables[WAVE_SINE]
+	index := int32(v.Index)
+	feedback := int32(v.Feedback)
+	level := velocityLevel(v.Level, v.velocity)
+	modInc := uint32(uint64(v.carInc) * uint64(v.Ratio) / 4)
+
+	for i := range out {
+		fb := uint32((v.prev1+v.prev2)>>1*feedback) * FM_FEEDBACK_SCALE
+		mod := int32(sine[(v.modPhase+fb)>>(32-WAVETABLE_BITS)])
+		v.prev2, v.prev1 = v.prev1, mod
+
+		offset := uint32(mod*index) * FM_INDEX_SCALE
+		out[i] += int32(sine[(v.carPhase+offset)>>(32-WAVETABLE_BITS)]) * level >> 8
+
+		v.modPhase += modInc
+		v.carPhase += v.carInc
+	}
+}
@@ -0,0 +1,156 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "strings"
+
+// Folder layout on the card: where projects, samples and renders live is
+// kept in FOLDERS_FILE, so a card shared with other gear can keep
+// everything under a folder of its own, such as /picotracker/projects.
+// Each folder is created on boot if it is missing. When a folder moves,
+// from the FOLDERS tool or by editing the file on a computer, whatever is
+// in the old place is moved into the new one, so nothing is left behind.
+const (
+	FOLDERS_FILE = "/folders.txt"
+
+	DEFAULT_PROJECTS_DIR = "/projects"
+	DEFAULT_SAMPLES_DIR  = "/samples"
+	DEFAULT_RENDERS_DIR  = "/renders"
+)
+
+var (
+	projectsDir = DEFAULT_PROJECTS_DIR
+	samplesDir  = DEFAULT_SAMPLES_DIR
+	rendersDir  = DEFAULT_RENDERS_DIR // Song renders and exports
+)
+
+// A configurable folder: its name in the file and where its path is kept
+type folder struct {
+	name string
+	path *string
+	leaf string // Name of the folder under each of folderRoots
+}
+
+var folders = []folder{
+	{"projects", &projectsDir, "projects"},
+	{"samples", &samplesDir, "samples"},
+	{"renders", &rendersDir, "renders"},
+}
+
+// Folders the FOLDERS tool offers to keep everything under, "" for the
+// top of the card
+var folderRoots = []string{"", "/picotracker", "/pt"}
+
+func init() {
+	addTool("FOLDERS", openFoldersView)
+}
+
+// Read the folder layout, ignoring unknown names and relative paths
+func loadFolders() {
+	data, err := readFile(FOLDERS_FILE)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, path, ok := strings.Cut(strings.TrimSpace(line), "=")
+		path = strings.TrimSuffix(path, "/")
+		if !ok || !strings.HasPrefix(path, "/") {
+			continue
+		}
+		for _, f := range folders {
+			if f.name == name {
+				*f.path = path
+			}
+		}
+	}
+}
+
+func saveFolders() {
+	var b strings.Builder
+	for _, f := range folders {
+		b.WriteString(f.name + "=" + *f.path + "\n")
+	}
+	if err := writeFile(FOLDERS_FILE, []byte(b.String())); err != nil {
+		println("Failed to save folders:", err.Error())
+	}
+}
+
+// Whether a path is a directory with something in it
+func folderInUse(path string) bool {
+	entries, err := storage.ReadDir(path)
+	return err == nil && len(entries) > 0
+}
+
+// Move a folder's contents to a new place. A folder already at the new
+// place is kept, and the old one left alone, so nothing is overwritten.
+func moveFolder(from, to string) error {
+	if from == to || !folderInUse(from) {
+		return mkdirAll(to)
+	}
+	if _, err := storage.Stat(to); err == nil {
+		return errExists
+	}
+	if err := mkdirAll(dirName(to)); err != nil {
+		return err
+	}
+	return storage.Rename(from, to)
+}
+
+// Create the folders on boot. A folder that is missing but still has its
+// contents at one of the other usual places was moved by hand in the
+// file, so they are brought across.
+func ensureFolders() {
+	for _, f := range folders {
+		if _, err := storage.Stat(*f.path); err != nil {
+			for _, root := range folderRoots {
+				old := root + "/" + f.leaf
+				if old != *f.path && folderInUse(old) {
+					if err := moveFolder(old, *f.path); err != nil {
+						println("Failed to move", old+":", err.Error())
+					} else {
+						println("Moved", old, "to", *f.path)
+					}
+					break
+				}
+			}
+		}
+		if err := mkdirAll(*f.path); err != nil {
+			println("Failed to create", *f.path+":", err.Error())
+		}
+	}
+}
+
+// Pick where each folder lives, moving its contents along
+func openFoldersView() {
+	var items []settingItem
+	for _, f := range folders {
+		paths := make([]string, len(folderRoots))
+		for i, root := range folderRoots {
+			paths[i] = root + "/" + f.leaf
+		}
+		current := func() int {
+			for i, p := range paths {
+				if p == *f.path {
+					return i
+				}
+			}
+			return -1
+		}
+		if current() < 0 {
+			// Set in the file to somewhere else, keep it on offer
+			paths = append(paths, *f.path)
+		}
+		items = append(items, settingItem{strings.ToUpper(f.name), paths, current,
+			func(i int) {
+				if err := moveFolder(*f.path, paths[i]); err != nil {
+					println("Failed to move", *f.path+":", err.Error())
+					showStatus("MOVE FAILED", colorRed)
+					return
+				}
+				*f.path = paths[i]
+				showStatus("NOW "+paths[i], colorGreen)
+			}})
+	}
+	openParamList("FOLDERS", items, saveFolders)
+}
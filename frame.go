@@ -0,0 +1,82 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// The UI loop aims for a steady frame rate. Each frame measures how long
+// its work took and sleeps only what is left of the budget. A frame that
+// runs over counts as dropped, and the next one leaves out redraws that
+// can wait so input and housekeeping catch up first.
+const FRAME_TIME = 32 * time.Millisecond // ~30 FPS
+
+// UI loop counters
+type FrameStats struct {
+	Frames  uint32
+	Dropped uint32 // Ran past FRAME_TIME
+	Skipped uint32 // Non-critical redraws left out to catch up
+	MaxWork time.Duration
+	MaxDraw time.Duration // Longest full screen redraw
+}
+
+var (
+	frameStats  FrameStats
+	frameStart  time.Time
+	frameBehind bool // The last frame ran over
+)
+
+func init() {
+	addTool("FRAME STATS", func() {
+		reportFrameStats()
+		showStatus("FRAMES "+itoa(int(frameStats.Frames))+" DROP "+itoa(int(frameStats.Dropped))+
+			" MAX "+itoa(int(frameStats.MaxWork.Milliseconds()))+"MS", colorText)
+	})
+}
+
+// Mark the start of a frame's work
+func beginFrame() {
+	frameStart = time.Now()
+}
+
+// Account for the frame and sleep out the rest of its budget. Over budget
+// it only yields, so the audio loop still gets a turn.
+func endFrame() {
+	work := time.Since(frameStart)
+	frameStats.Frames++
+	if work > frameStats.MaxWork {
+		frameStats.MaxWork = work
+	}
+	frameBehind = work > FRAME_TIME
+	if frameBehind {
+		frameStats.Dropped++
+		runtime.Gosched()
+		return
+	}
+	time.Sleep(FRAME_TIME - work)
+}
+
+// Whether redraws that can wait should be left out this frame
+func skipNonCritical() bool {
+	if frameBehind {
+		frameStats.Skipped++
+	}
+	return frameBehind
+}
+
+// Account for a full screen redraw
+func recordRedraw(d time.Duration) {
+	if d > frameStats.MaxDraw {
+		frameStats.MaxDraw = d
+	}
+}
+
+// Print the counters on the debug UART
+func reportFrameStats() {
+	println("Frames:", frameStats.Frames, "dropped:", frameStats.Dropped,
+		"skipped redraws:", frameStats.Skipped, "max work:", frameStats.MaxWork.Milliseconds(),
+		"ms of", FRAME_TIME.Milliseconds(), "ms, max redraw:", frameStats.MaxDraw.Milliseconds(), "ms")
+}
@@ -0,0 +1,93 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Step effect commands, shown by their letter. Params are hex, x the high
+// and y the low nibble. See docs/fx.md for how the two columns combine.
+const (
+	FX_NONE   = 0
+	FX_ARP    = 'A' // Cycle the note, +x and +y semitones each tick
+	FX_CUT    = 'C' // Stop the note after Param ticks
+	FX_DELAY  = 'D' // Play the whole step Param ticks late
+	FX_VIBRA  = 'F' // Wobble the pitch at speed x by depth y
+	FX_GLIDE  = 'G' // Slide from the note playing to the step's over Param ticks
+	FX_HOP    = 'H' // In tables only, go on from row Param
+	FX_JUMP   = 'J' // After this step, go on from song row Param
+	FX_KNOB   = 'K' // Set macro knob x+1 of the instrument to y*17
+	FX_LOOP   = 'L' // In tables only, go on from row y x times, then carry on
+	FX_MASTER = 'M' // Set the master stereo width in %
+	FX_PAN    = 'P' // Set the track pan
+	FX_RETRIG = 'R' // Restart the note every Param ticks
+	FX_SLIDE  = 'S' // Slide the volume up x or down y each tick
+	FX_TRIG   = 'T' // Play the step only under condition Param, see fill.go
+	FX_VOLUME = 'V' // Set the note volume
+	FX_WIDTH  = 'W' // Set the pulse width of an oscillator
+)
+
+// Commands a phrase step can hold, in the order editors step through them
+var stepCommands = []uint8{FX_ARP, FX_CUT, FX_DELAY, FX_VIBRA, FX_GLIDE, FX_JUMP,
+	FX_KNOB, FX_MASTER, FX_PAN, FX_RETRIG, FX_SLIDE, FX_TRIG, FX_VOLUME, FX_WIDTH}
+
+// Commands a table row can hold: those of a step but for the ones about
+// the step or song, and the table's own hop and loop
+var tableCommands = []uint8{FX_ARP, FX_CUT, FX_VIBRA, FX_HOP, FX_KNOB, FX_LOOP,
+	FX_MASTER, FX_PAN, FX_RETRIG, FX_SLIDE, FX_VOLUME, FX_WIDTH}
+
+// Order in which commands of one step apply: values are set first, then
+// the note is shaped, then slides run from the result
+func fxRank(cmd uint8) int {
+	switch cmd {
+	case FX_VOLUME, FX_PAN, FX_WIDTH, FX_KNOB, FX_MASTER:
+		return 0
+	case FX_ARP, FX_RETRIG, FX_CUT, FX_VIBRA:
+		return 1
+	}
+	return 2
+}
+
+// Effects of a step in the order to apply them and how many there are,
+// along with the delay in ticks. A delay holds back the note and every
+// column, so it is taken out of the list, as are a jump, which the song
+// takes from its phrases, see songJump, and a trig condition, which
+// decides whether the step plays at all. The same command in both
+// columns runs once, with the rightmost param.
+func stepEffects(s *Step) (fx [NUM_FX]StepFX, n int, delay uint8) {
+	for _, f := range s.FX {
+		if f.Command == FX_NONE || f.Command == FX_JUMP || f.Command == FX_TRIG {
+			continue
+		}
+		if f.Command == FX_DELAY {
+			delay = f.Param
+			continue
+		}
+		replaced := false
+		for i := range fx[:n] {
+			if fx[i].Command == f.Command {
+				fx[i].Param, replaced = f.Param, true
+			}
+		}
+		if replaced {
+			continue
+		}
+		// Insert by rank, keeping column order within a rank
+		at := n
+		for at > 0 && fxRank(fx[at-1].Command) > fxRank(f.Command) {
+			fx[at] = fx[at-1]
+			at--
+		}
+		fx[at] = f
+		n++
+	}
+	return fx, n, delay
+}
+
+// Whether a step has a command, and its rightmost param
+func stepCommand(s *Step, cmd uint8) (param uint8, ok bool) {
+	for _, f := range s.FX {
+		if f.Command == cmd {
+			param, ok = f.Param, true
+		}
+	}
+	return param, ok
+}
@@ -0,0 +1,179 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Gain staging assistant: find how loud each track and the mix get, then
+// suggest track trims that keep the mix and every track under the master
+// soft clipper's knee. Trims are saved with the project and scale a track
+// after its volume, so motions and scripts keep the full volume range.
+// Applying the suggestion can be undone from the same screen or with UNDO.
+func init() {
+	addTool("GAIN STAGING", openGainStagingView)
+}
+
+// Highest levels the mixer saw, after track volume, trim and inserts and before
+// the master volume
+type GainAnalysis struct {
+	Tracks [NUM_TRACKS]int32
+	Master int32
+}
+
+// Highest absolute sample of a stereo block and peak
+func peakOf(peak int32, left, right []int32) int32 {
+	for i := range left {
+		peak = max(peak, left[i], -left[i], right[i], -right[i])
+	}
+	return peak
+}
+
+// Track trims that bring the mix and each track down to the knee. Tracks
+// never get louder and silent ones are left alone.
+func (a *GainAnalysis) suggest(p *Project, master uint8) [NUM_TRACKS]uint8 {
+	mix := int64(a.Master) * int64(master) >> 8
+	var trims [NUM_TRACKS]uint8
+	for t, trim := range p.Trims {
+		v := int64(trim)
+		if mix > SOFT_CLIP_KNEE && a.Tracks[t] > 0 {
+			v = v * SOFT_CLIP_KNEE / mix
+		}
+		if own := int64(a.Tracks[t]) * int64(master) >> 8; own > SOFT_CLIP_KNEE {
+			v = min(v, int64(trim)*SOFT_CLIP_KNEE/own)
+		}
+		trims[t] = uint8(v)
+	}
+	return trims
+}
+
+// Push the project's track trims to the mixer
+func updateTrims() {
+	for t, v := range project.Trims {
+		if mixer.Tracks[t].Trim != v {
+			audioMu.Lock()
+			mixer.Tracks[t].Trim = v
+			audioMu.Unlock()
+		}
+	}
+}
+
+// Play the song through the mixer without output and gather its peaks.
+// Any key cancels, keeping the peaks so far.
+func analyseSong(p *Project) *GainAnalysis {
+	for !mixer.Silent() {
+		time.Sleep(time.Millisecond)
+	}
+	a := &GainAnalysis{}
+	audioMu.Lock()
+	mixer.Analysis = a
+	audioMu.Unlock()
+
+	total := max(songFrames(p), 1)
+	block := make([]uint32, BLOCK_SIZE)
+	audioMu.Lock()
+	sequencer.Start(p)
+	audioMu.Unlock()
+	mixer.FadeIn()
+	for n, done := 0, 0; done < total; n++ {
+		renderBlock(block)
+		done += len(block)
+		if n%RENDER_DRAW_EVERY == 0 {
+			drawProgress("ANALYSING", min(done, total), total)
+			if keyCancelled() {
+				break
+			}
+		}
+	}
+	stopSong()
+	mixer.FadeOut()
+	for !mixer.Silent() {
+		renderBlock(block)
+	}
+	audioMu.Lock()
+	mixer.Analysis = nil
+	audioMu.Unlock()
+	redrawView()
+	return a
+}
+
+// While playing, the first use starts gathering peaks and the second shows
+// the suggestion. While stopped the song is analysed offline.
+func openGainStagingView() {
+	if isAudioPlaying && mixer.Analysis == nil {
+		audioMu.Lock()
+		mixer.Analysis = &GainAnalysis{}
+		audioMu.Unlock()
+		showStatus("ANALYSING, OPEN AGAIN FOR RESULTS", colorGreen)
+		return
+	}
+	a := mixer.Analysis
+	if a != nil {
+		audioMu.Lock()
+		mixer.Analysis = nil
+		audioMu.Unlock()
+	} else {
+		a = analyseSong(project)
+	}
+	showGainSuggestion(a)
+}
+
+// Volume change in dB as shown in the suggestion
+func gainChange(from, to uint8) string {
+	if to == from {
+		return "OK"
+	}
+	if to == 0 || from == 0 {
+		return "MUTE"
+	}
+	return decimal1(20*math.Log10(float64(to)/float64(from))) + "DB"
+}
+
+// A line per track that played with its trim now and suggested, then
+// APPLY, or UNDO putting back just the trims from before. APPLY also saves
+// the project for the UNDO tool, and is refused when that fails.
+func showGainSuggestion(a *GainAnalysis) {
+	trims := a.suggest(project, mixer.MasterVolume)
+	applied := false
+	var previous [NUM_TRACKS]uint8
+	list := &ListView{Title: "GAIN STAGING"}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for t, from := range project.Trims {
+			if a.Tracks[t] == 0 {
+				continue
+			}
+			list.Items = append(list.Items, "TRACK "+itoa(t+1)+" "+itoa(int(from))+" > "+
+				itoa(int(trims[t]))+" "+gainChange(from, trims[t]))
+		}
+		if applied {
+			list.Items = append(list.Items, "UNDO")
+		} else {
+			list.Items = append(list.Items, "APPLY")
+		}
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		if i != len(list.Items)-1 {
+			return
+		}
+		if applied {
+			project.Trims = previous
+			showStatus("TRIMS RESTORED", colorGreen)
+		} else {
+			if err := saveUndo(project, "GAIN"); err != nil {
+				println("Failed to save undo:", err.Error())
+				showStatus("CANNOT SAVE UNDO", colorRed)
+				return
+			}
+			previous, project.Trims = project.Trims, trims
+			showStatus("TRIMS APPLIED", colorGreen)
+		}
+		applied = !applied
+		refresh()
+	}
+	pushView(list)
+}
@@ -0,0 +1,120 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Noise gate insert: a track is silenced while its level stays under the
+// threshold, cleaning the hiss and hum out of the gaps in noisy samples
+// and line-in recordings. It opens within a chunk and closes over the
+// release time, and closes only a few dB below where it opens, so a level
+// hovering at the threshold doesn't chatter.
+const GATE_HYSTERESIS_DB = 4
+
+// Threshold is in dB below full scale, 0 for off, and Release in 10ms
+// units
+type Gate struct {
+	Threshold uint8
+	Release   uint8
+
+	open bool
+	gain int32 // Gain at the end of the last chunk, GAIN_UNITY open
+}
+
+func (g *Gate) Process(left, right []int32) {
+	openAt := dbLevel(g.Threshold)
+	closeAt := dbLevel(g.Threshold + GATE_HYSTERESIS_DB)
+	fall := int32(GAIN_UNITY) * COMP_CHUNK / max(int32(g.Release)*10*int32(sampleRate)/1000, COMP_CHUNK)
+
+	for start := 0; start < len(left); start += COMP_CHUNK {
+		end := min(start+COMP_CHUNK, len(left))
+		var peak int32
+		for i := start; i < end; i++ {
+			peak = max(peak, left[i], -left[i], right[i], -right[i])
+		}
+		if peak >= openAt {
+			g.open = true
+		} else if peak < closeAt {
+			g.open = false
+		}
+		target := int32(0)
+		if g.open {
+			target = GAIN_UNITY
+		} else {
+			target = max(g.gain-fall, 0)
+		}
+		// Slide from the last chunk's gain so steps don't click
+		from, step := g.gain, (target-g.gain)>>COMP_CHUNK_SHIFT
+		if from == GAIN_UNITY && target == GAIN_UNITY {
+			continue
+		}
+		for i := start; i < end; i++ {
+			from += step
+			left[i] = left[i] * from >> GAIN_SHIFT
+			right[i] = right[i] * from >> GAIN_SHIFT
+		}
+		g.gain = target
+	}
+}
+
+func init() {
+	addTool("GATE", openGateView)
+}
+
+// Gate off, with a release suited to most material once a threshold is
+// picked
+func defaultGate() GateSettings {
+	return GateSettings{Release: 10}
+}
+
+// Gates kept per track once used
+var trackGate [NUM_TRACKS]*Gate
+
+// Follow the active project's gate settings, adding the insert ahead of a
+// track's others so they get the cleaned signal, or removing it
+func updateGates() {
+	for t := range project.Gates {
+		gs := &project.Gates[t]
+		g := trackGate[t]
+		if gs.Threshold == 0 {
+			if g != nil {
+				setInsert(t, g, false)
+			}
+			continue
+		}
+		if g == nil {
+			g = &Gate{gain: GAIN_UNITY}
+			trackGate[t] = g
+		}
+		g.Threshold, g.Release = gs.Threshold, gs.Release
+		track := &mixer.Tracks[t]
+		if len(track.Inserts) == 0 || track.Inserts[0] != Effect(g) {
+			setInsert(t, g, false)
+			audioMu.Lock()
+			track.Inserts = append([]Effect{g}, track.Inserts...)
+			mixer.Compensate()
+			audioMu.Unlock()
+		}
+	}
+}
+
+// Pick a track, then step its threshold and release
+func openGateView() {
+	list := &ListView{Title: "GATE"}
+	for t := range project.Gates {
+		list.Items = append(list.Items, "TRACK "+itoa(t+1))
+	}
+	list.OnSelect = func(t int) {
+		gs := &project.Gates[t]
+		openParamList("GATE "+itoa(t+1), []settingItem{
+			byteChoice("THRESHOLD", func() *uint8 { return &gs.Threshold }, []uint8{0, 36, 42, 48, 54, 60, 66}, func(v uint8) string {
+				if v == 0 {
+					return "OFF"
+				}
+				return "-" + itoa(int(v)) + "DB"
+			}),
+			byteChoice("RELEASE", func() *uint8 { return &gs.Release }, []uint8{2, 5, 10, 20, 50},
+				func(v uint8) string { return itoa(int(v)*10) + "MS" }),
+		}, nil)
+	}
+	pushView(list)
+}
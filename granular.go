@@ -0,0 +1,171 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Grains a granular voice plays at once; a new grain is skipped while all
+// of them are busy
+const MAX_GRAINS = 8
+
+// Plays a Sample as a cloud of short overlapping grains, each read with a
+// 32.32 fixed-point position at the note's pitch and shaped by a
+// triangular window. Size is the grain length in ms and Density how many
+// grains start per second. Position is where grains start, in 1/65536 of
+// the sample's length; moving it while a note plays scrubs through the
+// sample. Spray scatters each start by up to Spray/256 of the sample's
+// length past Position. Level is 0-255.
+type GranularVoice struct {
+	Sample   *Sample
+	Size     uint8
+	Density  uint8
+	Position uint16
+	Spray    uint8
+	Level    uint8
+
+	grains   [MAX_GRAINS]grain
+	inc      uint64
+	wait     uint32 // Frames until the next grain starts
+	playing  bool   // Starting grains
+	velocity uint8
+	rng      uint32
+
+	note, cents int
+	bend        int // Cents, see Bend
+}
+
+// One grain, silent once age reaches length
+type grain struct {
+	pos         uint64 // 32.32 frame position
+	age, length uint32
+	env, step   int32 // Window, Q16, and its change per frame
+}
+
+// Settings a granular instrument starts from: 50ms grains, 20 a second,
+// from the start
+var grainDefaults = GrainParams{Size: 50, Density: 20}
+
+// Create a granular voice with the default settings
+func newGranularVoice(s *Sample) *GranularVoice {
+	v := new(GranularVoice)
+	v.reset(s)
+	return v
+}
+
+// Start the voice over as new, in place
+func (v *GranularVoice) reset(s *Sample) {
+	*v = GranularVoice{Sample: s, Size: grainDefaults.Size, Density: grainDefaults.Density,
+		Level: 255, rng: 0x2545f491}
+}
+
+// Take the sample and grain settings of a granular instrument
+func (v *GranularVoice) setParams(in *Instrument) {
+	v.Sample = nil
+	if in.Sample < MAX_SAMPLES {
+		v.Sample = samples[in.Sample]
+	}
+	g := &in.Grain
+	v.Size, v.Density, v.Position, v.Spray = max(g.Size, 1), g.Density, uint16(g.Position)<<8, g.Spray
+}
+
+// Set the pitch grains play at as a note plus fine tune in cents
+func (v *GranularVoice) SetPitch(note int, cents int) {
+	v.note, v.cents = note, cents
+	s := v.Sample
+	if s == nil {
+		return
+	}
+	ratio := (uint64(noteFrequency(note, cents+v.bend)) << 32) / uint64(rootFrequencies[s.RootNote&(NUM_NOTES-1)])
+	v.inc = ratio * uint64(s.Rate) / uint64(sampleRate)
+}
+
+func (v *GranularVoice) Retune() { v.SetPitch(v.note, v.cents) }
+
+// Offset the pitch from the playing note by cents
+func (v *GranularVoice) Bend(cents int) {
+	v.bend = cents
+	v.SetPitch(v.note, v.cents)
+}
+
+func (v *GranularVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	v.SetPitch(int(noteIndex(note)), 0)
+	v.velocity, v.playing, v.wait = velocity, v.Sample != nil, 0
+}
+
+// Stop starting grains, letting the playing ones finish
+func (v *GranularVoice) NoteOff() { v.playing = false }
+
+// Playing, or with grains still fading out
+func (v *GranularVoice) Sounding() bool {
+	if v.Sample == nil || len(v.Sample.Data) == 0 {
+		return false
+	}
+	for i := range v.grains {
+		if v.grains[i].age < v.grains[i].length {
+			return true
+		}
+	}
+	return v.playing
+}
+
+// Start a grain at Position plus a random spray, in a free slot
+func (v *GranularVoice) spawn() {
+	n := uint32(len(v.Sample.Data))
+	length := max(uint32(v.Size)*sampleRate/1000, 2)
+	for i := range v.grains {
+		g := &v.grains[i]
+		if g.age < g.length {
+			continue
+		}
+		start := uint32(uint64(n) * uint64(v.Position) >> 16)
+		if spread := uint32(uint64(n) * uint64(v.Spray) >> 8); spread > 0 {
+			v.rng |= 1 // Xorshift never leaves 0
+			v.rng ^= v.rng << 13
+			v.rng ^= v.rng >> 17
+			v.rng ^= v.rng << 5
+			start += v.rng % spread
+		}
+		*g = grain{pos: uint64(min(start, n-1)) << 32, length: length,
+			step: int32((2 << 16) / length)}
+		return
+	}
+}
+
+func (v *GranularVoice) Render(out []int32) {
+	s := v.Sample
+	if s == nil || len(s.Data) == 0 {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	n := uint64(len(s.Data)) << 32
+	every := sampleRate / uint32(max(v.Density, 1))
+	for i := range out {
+		if v.playing {
+			if v.wait == 0 {
+				v.spawn()
+				v.wait = every
+			}
+			v.wait--
+		}
+		var sum int32
+		for j := range v.grains {
+			g := &v.grains[j]
+			if g.age >= g.length {
+				continue
+			}
+			if g.pos < n {
+				sum += int32(s.Data[g.pos>>32]) * (g.env >> 4) >> 12
+			}
+			g.pos += v.inc
+			g.age++
+			if g.age == g.length/2 {
+				g.step = -g.step
+			}
+			g.env = max(g.env+g.step, 0)
+		}
+		out[i] += sum * level >> 8
+	}
+}
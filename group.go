@@ -0,0 +1,178 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Group busses: tracks in a group are summed on the group's bus, which has
+// an insert, a level and a mute of its own, before joining the mix, so all
+// the drums can be glued, turned down or muted together. A track's send is
+// taken from the track, ahead of its group. A muted group's tracks are not
+// heard, see Mixer.audible. When the ducker's key track is in a group, the
+// whole group joins the mix after the ducking, as the key track alone
+// would. Group inserts add no latency, so the tracks stay lined up.
+const NUM_GROUPS = 2
+
+// Insert a group bus runs, with settings suited to a bus
+type GroupInsert uint8
+
+const (
+	GROUP_FX_NONE GroupInsert = iota
+	GROUP_FX_GLUE             // Gentle compression
+	GROUP_FX_CRUSH
+	GROUP_FX_CHORUS
+	NUM_GROUP_FX
+)
+
+var groupInsertNames = [NUM_GROUP_FX]string{"NONE", "GLUE", "CRUSH", "CHORUS"}
+
+// A group bus on the mixer
+type MixerGroup struct {
+	Volume uint8
+	Insert Effect
+	Mute   bool
+
+	used        bool // A track was added this block
+	left, right [BLOCK_SIZE]int32
+}
+
+func init() {
+	addTool("GROUPS", openGroupsView)
+}
+
+// Group bus settings of a new project: full level, no insert
+func defaultGroup() GroupSettings {
+	return GroupSettings{Volume: 255}
+}
+
+// Inserts made for each group once used, so switching back keeps their
+// state
+var groupInserts [NUM_GROUPS][NUM_GROUP_FX]Effect
+
+func newGroupInsert(kind GroupInsert) Effect {
+	switch kind {
+	case GROUP_FX_GLUE:
+		c := newCompressor()
+		c.Threshold, c.Ratio, c.Attack, c.Release = 12, 2, 10, 10
+		return c
+	case GROUP_FX_CRUSH:
+		return &Bitcrusher{Bits: 8, Downsample: 2}
+	case GROUP_FX_CHORUS:
+		return newChorus()
+	}
+	return nil
+}
+
+// Bring the mixer's groups in line with the project's. Called from the
+// main loop.
+func updateGroups() {
+	for g := range project.Groups {
+		gs := &project.Groups[g]
+		kind := gs.Insert % NUM_GROUP_FX
+		fx := groupInserts[g][kind]
+		if fx == nil && kind != GROUP_FX_NONE {
+			fx = newGroupInsert(kind)
+			groupInserts[g][kind] = fx
+		}
+		grp := &mixer.Groups[g]
+		if grp.Volume != gs.Volume || grp.Insert != fx {
+			audioMu.Lock()
+			grp.Volume, grp.Insert = gs.Volume, fx
+			audioMu.Unlock()
+		}
+	}
+	for t, g := range project.TrackGroups {
+		if mixer.Tracks[t].Group != g {
+			audioMu.Lock()
+			mixer.Tracks[t].Group = g
+			audioMu.Unlock()
+		}
+	}
+}
+
+// Group a track's output goes to, -1 for the mix itself
+func (m *Mixer) trackGroup(t int) int {
+	if g := int(m.Tracks[t].Group); g > 0 && g <= NUM_GROUPS {
+		return g - 1
+	}
+	return -1
+}
+
+// Add a rendered track to its group's bus, or to the mix
+func (m *Mixer) mixTrack(t int, left, right []int32) {
+	if g := m.trackGroup(t); g >= 0 {
+		grp := &m.Groups[g]
+		left, right = grp.left[:len(left)], grp.right[:len(right)]
+		grp.used = true
+	}
+	for i := range left {
+		left[i] += m.trackL[i]
+		right[i] += m.trackR[i]
+	}
+}
+
+// Run a group bus through its insert and level into the mix, then start
+// it over. A bus no track was added to costs nothing.
+func (m *Mixer) mixGroup(g int, left, right []int32) {
+	grp := &m.Groups[g]
+	if !grp.used {
+		return
+	}
+	grp.used = false
+	busL, busR := grp.left[:len(left)], grp.right[:len(right)]
+	if grp.Insert != nil {
+		grp.Insert.Process(busL, busR)
+	}
+	volume := int32(grp.Volume)
+	for i := range left {
+		left[i] += busL[i] * volume >> 8
+		right[i] += busR[i] * volume >> 8
+	}
+	if m.Meters != nil {
+		m.Meters.Groups[g].add(busL, busR, volume)
+	}
+	clear(busL)
+	clear(busR)
+}
+
+// A track's group, for lists
+func groupText(g uint8) string {
+	if g == 0 || g > NUM_GROUPS {
+		return "NONE"
+	}
+	return itoa(int(g))
+}
+
+// Pick a group, then set its level, insert and mute. Tracks join a group
+// from ROUTING.
+func openGroupsView() {
+	list := &ListView{Title: "GROUPS"}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for g := range project.Groups {
+			text := "GROUP " + itoa(g+1) + ": " + groupInsertNames[project.Groups[g].Insert%NUM_GROUP_FX]
+			if mixer.Groups[g].Mute {
+				text += " MUTE"
+			}
+			list.Items = append(list.Items, text)
+		}
+	}
+	refresh()
+	list.OnSelect = func(g int) {
+		gs, grp := &project.Groups[g], &mixer.Groups[g]
+		openParamList("GROUP "+itoa(g+1), []settingItem{
+			byteChoice("VOLUME", func() *uint8 { return &gs.Volume }, []uint8{0, 64, 128, 160, 192, 224, 255},
+				func(v uint8) string { return itoa(int(v)*100/255) + "%" }),
+			{"INSERT", groupInsertNames[:],
+				func() int { return int(gs.Insert % NUM_GROUP_FX) },
+				func(i int) { gs.Insert = GroupInsert(i) }},
+			{"MUTE", []string{"OFF", "ON"},
+				func() int { return int(boolByte(grp.Mute)) },
+				func(i int) {
+					audioMu.Lock()
+					grp.Mute = i == 1
+					audioMu.Unlock()
+				}},
+		}, refresh)
+	}
+	pushView(list)
+}
@@ -0,0 +1,188 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"machine"
+	"sync/atomic"
+	"time"
+)
+
+// Front panel buttons
+type Button uint8
+
+const (
+	BUTTON_LEFT Button = iota
+	BUTTON_DOWN
+	BUTTON_RIGHT
+	BUTTON_UP
+	BUTTON_ALT
+	BUTTON_EDIT
+	BUTTON_ENTER
+	BUTTON_NAV
+	BUTTON_PLAY
+	NUM_BUTTONS
+)
+
+// Bitmask of held buttons, bit n is Button n
+type ButtonMask uint16
+
+const (
+	MOD_NONE  ButtonMask = 0
+	MOD_ALT   ButtonMask = 1 << BUTTON_ALT
+	MOD_EDIT  ButtonMask = 1 << BUTTON_EDIT
+	MOD_ENTER ButtonMask = 1 << BUTTON_ENTER
+	MOD_NAV   ButtonMask = 1 << BUTTON_NAV
+)
+
+// Pin for each button, indexed by Button
+var buttonPins = [NUM_BUTTONS]machine.Pin{
+	BUTTON_LEFT:  INPUT_LEFT,
+	BUTTON_DOWN:  INPUT_DOWN,
+	BUTTON_RIGHT: INPUT_RIGHT,
+	BUTTON_UP:    INPUT_UP,
+	BUTTON_ALT:   INPUT_ALT,
+	BUTTON_EDIT:  INPUT_EDIT,
+	BUTTON_ENTER: INPUT_ENTER,
+	BUTTON_NAV:   INPUT_NAV,
+	BUTTON_PLAY:  INPUT_PLAY,
+}
+
+// A debounced button transition. Mods holds the other buttons that were
+// already down when the transition happened.
+type KeyEvent struct {
+	Button  Button
+	Pressed bool
+	Mods    ButtonMask
+}
+
+const KEY_QUEUE_SIZE = 16 // must be a power of two
+
+// Ring buffer of pending key events between polling and dispatch
+var (
+	keyQueue     [KEY_QUEUE_SIZE]KeyEvent
+	keyQueueHead uint8
+	keyQueueTail uint8
+	heldButtons  ButtonMask // Physical buttons, before mapButton
+)
+
+// Queue a key event, dropping it if the queue is full
+func pushKeyEvent(ev KeyEvent) bool {
+	if keyQueueHead-keyQueueTail >= KEY_QUEUE_SIZE {
+		return false
+	}
+	keyQueue[keyQueueHead%KEY_QUEUE_SIZE] = ev
+	keyQueueHead++
+	return true
+}
+
+// Take the oldest pending key event
+func popKeyEvent() (KeyEvent, bool) {
+	if keyQueueHead == keyQueueTail {
+		return KeyEvent{}, false
+	}
+	ev := keyQueue[keyQueueTail%KEY_QUEUE_SIZE]
+	keyQueueTail++
+	return ev, true
+}
+
+// Button presses are caught by pin change interrupts the moment they
+// happen and logged with their time, so presses shorter than a frame and
+// quick double taps survive however long the main loop takes. The log is
+// debounced and turned into key events when the main loop polls.
+const (
+	EDGE_QUEUE_SIZE = 64         // must be a power of two
+	DEBOUNCE_TIME   = 10_000_000 // A level counts once stable this long, in ns
+)
+
+// A raw level change on a button pin, logged by the pin interrupt
+type pinEdge struct {
+	button  Button
+	pressed bool
+	at      int64 // Nanoseconds
+}
+
+var (
+	edgeQueue [EDGE_QUEUE_SIZE]pinEdge
+	edgeHead  atomic.Uint32 // Written by the interrupt only
+	edgeTail  atomic.Uint32
+	edgeLost  bool // Set when the log overflowed
+
+	// Debouncer state per button: the accepted level, and the latest raw
+	// level with the time it was seen
+	buttonDown  [NUM_BUTTONS]bool
+	buttonRaw   [NUM_BUTTONS]bool
+	buttonRawAt [NUM_BUTTONS]int64
+)
+
+// Log every level change of the button pins
+func watchButtons() {
+	for b := Button(0); b < NUM_BUTTONS; b++ {
+		err := buttonPins[b].SetInterrupt(machine.PinToggle, func(machine.Pin) { logEdge(b) })
+		if err != nil {
+			println("Failed to watch button", b, err.Error())
+		}
+	}
+}
+
+// Pin interrupt handler, must not allocate
+func logEdge(b Button) {
+	head := edgeHead.Load()
+	if head-edgeTail.Load() >= EDGE_QUEUE_SIZE {
+		edgeLost = true
+		return
+	}
+	edgeQueue[head%EDGE_QUEUE_SIZE] = pinEdge{b, !buttonPins[b].Get(), time.Now().UnixNano()} // Pulled up, low is pressed
+	edgeHead.Store(head + 1)
+}
+
+// Feed one raw level into the debouncer. A level that was held for
+// DEBOUNCE_TIME before changing again is accepted as a key event.
+func debounce(b Button, pressed bool, at int64) {
+	if at-buttonRawAt[b] >= DEBOUNCE_TIME {
+		acceptLevel(b)
+	}
+	buttonRaw[b], buttonRawAt[b] = pressed, at
+}
+
+// Queue an event if the raw level differs from the accepted one
+func acceptLevel(b Button) {
+	pressed := buttonRaw[b]
+	if pressed == buttonDown[b] {
+		return
+	}
+	buttonDown[b] = pressed
+	bit := ButtonMask(1) << b
+	mods := heldButtons &^ bit
+	if pressed {
+		heldButtons |= bit
+	} else {
+		heldButtons &^= bit
+	}
+	pushKeyEvent(KeyEvent{Button: mapButton(b), Pressed: pressed, Mods: mapMask(mods)})
+}
+
+// Debounce the logged edges into key events, translated to the active hand
+// layout. Levels are also read directly so a lost edge can't leave a
+// button stuck.
+func pollButtons() {
+	for tail := edgeTail.Load(); tail != edgeHead.Load(); tail++ {
+		e := edgeQueue[tail%EDGE_QUEUE_SIZE]
+		debounce(e.button, e.pressed, e.at)
+		edgeTail.Store(tail + 1)
+	}
+	if edgeLost {
+		edgeLost = false
+		println("Button edges lost")
+	}
+	now := time.Now().UnixNano()
+	for b := Button(0); b < NUM_BUTTONS; b++ {
+		if pressed := !buttonPins[b].Get(); pressed != buttonRaw[b] {
+			debounce(b, pressed, now)
+		}
+		if now-buttonRawAt[b] >= DEBOUNCE_TIME {
+			acceptLevel(b)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Instrument editor: the selected instrument's engine, sample, level,
+// envelope, filter and send on one screen, a row per parameter. The arrows
+// move the cursor and EDIT+LEFT/RIGHT step the value under it, EDIT+UP/DOWN
+// by four. While stopped, each change plays the instrument, see
+// previewInstrument. It sits right of the phrase editor: NAV+RIGHT there
+// opens the instrument under the cursor, NAV+LEFT goes back, NAV+RIGHT
+// opens its table, see tableedit.go, and NAV+UP/DOWN step to the previous
+// or next instrument.
+const (
+	INSTR_NAME_COLS = 10 // Characters before a parameter's value
+	INSTR_BIG_STEP  = 4  // Values EDIT+UP/DOWN step by
+)
+
+var instrumentTypeNames = []string{"---", "SAMPLE", "WAVETABLE", "OSCILLATOR", "DRUM", "FM", "GRANULAR", "PLUCK"}
+
+// Engine choices by instrument type, for the WAVE row
+var (
+	oscShapeNames  = []string{"PULSE", "SAW", "TRIANGLE", "NOISE"}
+	wavetableNames = []string{"SINE", "SAW", "SQUARE", "TRIANGLE", "USER 1", "USER 2", "USER 3", "USER 4"}
+)
+
+func init() {
+	registerView(VIEW_INSTRUMENT, func() View { return &instrumentView{} })
+	addTool("INSTRUMENT", func() { pushView(&instrumentView{}) })
+}
+
+type instrumentView struct{}
+
+func (v *instrumentView) ID() ViewID { return VIEW_INSTRUMENT }
+
+func (v *instrumentView) state() *ViewState { return &session.Views[VIEW_INSTRUMENT] }
+
+func (v *instrumentView) instrument() *Instrument {
+	return &project.Instruments[session.Instrument%NUM_INSTRUMENTS]
+}
+
+// Parameters of an instrument, the WAVE row only for engines that have one
+func instrumentItems(in *Instrument) []settingItem {
+	percent := func(v uint8) string { return itoa(int(v)*100/255) + "%" }
+	fade := func(v uint8) string {
+		if v == 0 {
+			return "OFF"
+		}
+		return itoa(int(v)*TONE_STEP_MS) + "MS"
+	}
+	items := []settingItem{
+		{"TYPE", instrumentTypeNames,
+			func() int { return int(in.Type) % len(instrumentTypeNames) },
+			func(i int) {
+				if InstrumentType(i) != in.Type {
+					in.Type, in.Wave = InstrumentType(i), 0
+					if in.Type == INSTR_DRUM {
+						in.Drum = drumDefaults[0]
+					}
+				}
+			}},
+	}
+	levels := []uint8{0, 32, 64, 96, 128, 160, 192, 224, 255}
+	var waves []string
+	switch in.Type {
+	case INSTR_SAMPLE, INSTR_GRANULAR:
+		names := []string{"---"}
+		for i, s := range project.Samples {
+			if s != "" {
+				names = append(names, hexByte(uint8(i))+" "+baseName(s))
+			}
+		}
+		items = append(items, settingItem{"SAMPLE", names,
+			func() int {
+				n := 0
+				for i, s := range project.Samples {
+					if s != "" {
+						n++
+						if uint8(i) == in.Sample {
+							return n
+						}
+					}
+				}
+				return 0
+			},
+			func(n int) {
+				in.Sample = EMPTY
+				for i, s := range project.Samples {
+					if s != "" {
+						if n--; n == 0 {
+							in.Sample = uint8(i)
+						}
+					}
+				}
+			}})
+	case INSTR_WAVETABLE:
+		waves = wavetableNames
+	case INSTR_OSCILLATOR:
+		waves = oscShapeNames
+	case INSTR_DRUM:
+		waves = drumNames
+	case INSTR_FM:
+		items = append(items,
+			byteChoice("RATIO", func() *uint8 { return &in.FM.Ratio }, fmRatios,
+				func(v uint8) string { return itoa(int(v/4)) + [4]string{"", ".25", ".5", ".75"}[v%4] + ":1" }),
+			byteChoice("INDEX", func() *uint8 { return &in.FM.Index }, levels, percent),
+			byteChoice("FEEDBACK", func() *uint8 { return &in.FM.Feedback }, levels, percent))
+	case INSTR_PLUCK:
+		items = append(items,
+			byteChoice("DAMPING", func() *uint8 { return &in.Pluck.Damping }, levels, percent),
+			byteChoice("DECAY", func() *uint8 { return &in.Pluck.Decay }, levels, percent))
+	}
+	if in.Type == INSTR_GRANULAR {
+		items = append(items,
+			byteChoice("SIZE", func() *uint8 { return &in.Grain.Size }, []uint8{5, 10, 20, 30, 50, 80, 120, 160, 200, 250},
+				func(v uint8) string { return itoa(int(v)) + "MS" }),
+			byteChoice("DENSITY", func() *uint8 { return &in.Grain.Density }, []uint8{2, 5, 10, 20, 40, 80, 160, 250},
+				func(v uint8) string { return itoa(int(v)) + "/S" }),
+			byteChoice("POSITION", func() *uint8 { return &in.Grain.Position }, levels, percent),
+			byteChoice("SPRAY", func() *uint8 { return &in.Grain.Spray }, []uint8{0, 8, 16, 32, 64, 128, 255}, percent))
+	}
+	if waves != nil {
+		items = append(items, settingItem{"WAVE", waves,
+			func() int { return int(in.Wave) % len(waves) },
+			func(i int) {
+				in.Wave = uint8(i)
+				if in.Type == INSTR_DRUM {
+					in.Drum = drumDefaults[i]
+				}
+			}})
+	}
+	return append(items,
+		byteChoice("VOLUME", func() *uint8 { return &in.Volume }, levels, percent),
+		byteChoice("PAN", func() *uint8 { return &in.Pan }, []uint8{0, 32, 64, 96, PAN_CENTER, 160, 192, 224, 255},
+			func(v uint8) string {
+				switch {
+				case v < PAN_CENTER:
+					return "L" + itoa((PAN_CENTER-int(v))*100/PAN_CENTER)
+				case v > PAN_CENTER:
+					return "R" + itoa((int(v)-PAN_CENTER)*100/(255-PAN_CENTER))
+				}
+				return "C"
+			}),
+		byteChoice("ATTACK", func() *uint8 { return &in.Attack }, []uint8{0, 1, 2, 5, 10, 20, 50, 100, 200}, fade),
+		byteChoice("RELEASE", func() *uint8 { return &in.Release }, []uint8{0, 1, 2, 5, 10, 20, 50, 100, 200}, fade),
+		byteChoice("CUTOFF", func() *uint8 { return &in.Cutoff }, []uint8{0, 230, 200, 170, 140, 110, 80, 50, 20},
+			func(v uint8) string {
+				if v == 0 {
+					return "OPEN"
+				}
+				return itoa(cutoffHz(v)) + "HZ"
+			}),
+		byteChoice("RESONANCE", func() *uint8 { return &in.Resonance }, []uint8{0, 64, 128, 192, 240}, percent),
+		byteChoice("SEND", func() *uint8 { return &in.Send }, []uint8{0, 32, 64, 128, 192, 255},
+			func(v uint8) string {
+				if v == 0 {
+					return "TRACK"
+				}
+				return percent(v)
+			}),
+	)
+}
+
+func (v *instrumentView) Draw() {
+	st := v.state()
+	in := v.instrument()
+	items := instrumentItems(in)
+	title := "INSTR " + hexByte(session.Instrument%NUM_INSTRUMENTS)
+	if in.Name != "" {
+		title += " " + in.Name
+	}
+	drawText(0, 0, title, colorGreen)
+	first, cursor := int(st.Scroll), min(int(st.Row), len(items)-1)
+	for i := first; i < len(items) && i < first+viewRows()-1; i++ {
+		row := i - first + 1
+		it := items[i]
+		if i == cursor {
+			drawHighlight(INSTR_NAME_COLS, row, len(it.values[it.get()]), colorBlue)
+		}
+		drawText(0, row, it.name, colorText)
+		drawText(INSTR_NAME_COLS, row, it.values[it.get()], colorText)
+	}
+}
+
+func (v *instrumentView) Describe() string {
+	items := instrumentItems(v.instrument())
+	it := items[min(int(v.state().Row), len(items)-1)]
+	return "INSTR " + hexByte(session.Instrument%NUM_INSTRUMENTS) + " " + it.name + " " + it.values[it.get()]
+}
+
+func (v *instrumentView) HandleAction(a Action) {
+	st := v.state()
+	in := v.instrument()
+	items := instrumentItems(in)
+	st.Row = uint8(min(int(st.Row), len(items)-1))
+	switch a {
+	case ACTION_CURSOR_UP:
+		if st.Row > 0 {
+			st.Row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if int(st.Row) < len(items)-1 {
+			st.Row++
+		}
+	case ACTION_CURSOR_LEFT:
+		popView()
+		return
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		delta, big := editDelta(a)
+		if big {
+			delta *= INSTR_BIG_STEP
+		}
+		it := items[st.Row]
+		if i := max(min(it.get()+delta, len(it.values)-1), 0); i != it.get() {
+			it.set(i)
+			previewInstrument(in)
+		}
+	case ACTION_COPY:
+		copyInstrument(project, session.Instrument%NUM_INSTRUMENTS)
+		showStatus("COPIED INSTRUMENT "+hexByte(session.Instrument%NUM_INSTRUMENTS), colorGreen)
+	case ACTION_PASTE:
+		pasteInEditor(CLIP_INSTRUMENT, session.Instrument%NUM_INSTRUMENTS)
+	case ACTION_NAV_LEFT:
+		replaceView(&phraseView{playhead: -1})
+		return
+	case ACTION_NAV_RIGHT:
+		replaceView(&tableView{playhead: -1})
+		return
+	case ACTION_NAV_UP, ACTION_NAV_DOWN:
+		session.Instrument = uint8((int(session.Instrument) + navDelta(a) + NUM_INSTRUMENTS) % NUM_INSTRUMENTS)
+	default:
+		return
+	}
+	rows := viewRows() - 1
+	if int(st.Row) < int(st.Scroll) {
+		st.Scroll = st.Row
+	} else if int(st.Row) >= int(st.Scroll)+rows {
+		st.Scroll = st.Row - uint8(rows) + 1
+	}
+	redrawView()
+}
@@ -0,0 +1,109 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Voice playing an instrument with its engine, level, glide and vibrato,
+// or nil for an instrument without an engine
+func newInstrumentVoice(in *Instrument) Voice {
+	var v Bender
+	switch in.Type {
+	case INSTR_SAMPLE:
+		v = new(SampleVoice)
+	case INSTR_WAVETABLE:
+		v = new(WavetableVoice)
+	case INSTR_OSCILLATOR:
+		v = new(OscillatorVoice)
+	case INSTR_DRUM:
+		v = new(DrumVoice)
+	case INSTR_FM:
+		v = new(FMVoice)
+	case INSTR_GRANULAR:
+		v = new(GranularVoice)
+	case INSTR_PLUCK:
+		v = new(PluckVoice)
+	default:
+		return nil
+	}
+	p := new(PitchVoice)
+	setupVoice(p, v, in)
+	return p
+}
+
+// A voice of every engine for each track, so the sequencer starts notes
+// without allocating while it holds audioMu
+type engineVoices struct {
+	pitch  PitchVoice
+	sample SampleVoice
+	wave   WavetableVoice
+	osc    OscillatorVoice
+	drum   DrumVoice
+	fm     FMVoice
+	grain  GranularVoice
+	pluck  PluckVoice
+}
+
+var trackEngines [NUM_TRACKS]engineVoices
+
+// Track t's voice, set up afresh to play an instrument, or nil for an
+// instrument without an engine. Call with audioMu held: the voice may be
+// the one the track is playing.
+func trackInstrumentVoice(t int, in *Instrument) *PitchVoice {
+	e := &trackEngines[t]
+	var v Bender
+	switch in.Type {
+	case INSTR_SAMPLE:
+		v = &e.sample
+	case INSTR_WAVETABLE:
+		v = &e.wave
+	case INSTR_OSCILLATOR:
+		v = &e.osc
+	case INSTR_DRUM:
+		v = &e.drum
+	case INSTR_FM:
+		v = &e.fm
+	case INSTR_GRANULAR:
+		v = &e.grain
+	case INSTR_PLUCK:
+		v = &e.pluck
+	default:
+		return nil
+	}
+	setupVoice(&e.pitch, v, in)
+	return &e.pitch
+}
+
+// Reset engine v and voice p around it to play an instrument
+func setupVoice(p *PitchVoice, v Bender, in *Instrument) {
+	switch v := v.(type) {
+	case *SampleVoice:
+		*v = SampleVoice{Instrument: in, Level: in.Volume, Interpolate: in.Interpolate}
+	case *WavetableVoice:
+		*v = WavetableVoice{Table: &wavetables[in.Wave%NUM_WAVETABLES], Level: in.Volume}
+	case *OscillatorVoice:
+		v.reset(OscShape(in.Wave))
+		v.Level, v.SweepRate, v.SweepDepth = in.Volume, in.SweepRate, in.SweepDepth
+		if in.Duty != 0 {
+			v.Duty = in.Duty
+		}
+	case *DrumVoice:
+		v.reset(DrumKind(in.Wave % uint8(NUM_DRUMS)))
+		v.Level, v.DrumParams = in.Volume, in.Drum
+	case *FMVoice:
+		v.reset()
+		v.Level, v.Ratio, v.Index, v.Feedback = in.Volume, in.FM.Ratio, in.FM.Index, in.FM.Feedback
+	case *GranularVoice:
+		v.reset(nil)
+		v.Level = in.Volume
+		v.setParams(in)
+	case *PluckVoice:
+		v.reset()
+		v.Level, v.Damping, v.Decay = in.Volume, in.Pluck.Damping, in.Pluck.Decay
+	}
+	p.reset(v)
+	p.SetInstrument(in)
+	p.Wheel = int16(pitchWheel)
+	if in.hasKnobs() {
+		knobVoice(p, in)
+	}
+}
@@ -0,0 +1,210 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Checks that the card still holds what the project was saved with. The
+// project file ends with a CRC of its chunks, and the project keeps a CRC
+// of each sample's audio, taken the first time it is read. Files are
+// checked as a project opens and again, one at a time, while the device
+// sits idle, so a failing card shows up in rehearsal rather than on stage.
+const (
+	INTEGRITY_IDLE   = 30 * time.Second // Without input before idle checks start
+	INTEGRITY_PERIOD = 10 * time.Minute // Between idle passes
+	INTEGRITY_READ   = 4096             // Bytes of sample read at a time
+)
+
+var (
+	errProjectChecksum  = errors.New("project: checksum mismatch")
+	errProjectTruncated = errors.New("project: truncated")
+	errSampleChanged    = errors.New("sample: audio changed since first read")
+)
+
+// A file that failed its last check
+type integrityProblem struct {
+	what, err string
+}
+
+var (
+	integrityProblems []integrityProblem
+	integrityNext     int       // Item the idle check does next, see checkItem
+	integrityPassed   time.Time // End of the last idle pass
+)
+
+func init() {
+	addSetting("IDLE CARD CHECK", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.IdleCheck)) },
+		func(i int) { settings.IdleCheck = i == 1 })
+	addTool("CHECK CARD", openIntegrityView)
+}
+
+// Walk the chunks of a project file, checking they fit and match the
+// checksum. Files saved before checksums pass when they fit.
+func checkProjectData(data []byte) error {
+	if len(data) < 6 || string(data[:4]) != PROJECT_MAGIC {
+		return errBadProject
+	}
+	for pos := 6; pos < len(data); {
+		if pos+8 > len(data) {
+			return errProjectTruncated
+		}
+		r := &byteReader{buf: data[pos+4 : pos+8]}
+		size := int(r.u32())
+		if size > len(data)-pos-8 {
+			return errProjectTruncated
+		}
+		if string(data[pos:pos+4]) == "CSUM" {
+			c := &byteReader{buf: data[pos+8 : pos+8+size]}
+			if crc32.ChecksumIEEE(data[:pos]) != c.u32() {
+				return errProjectChecksum
+			}
+		}
+		pos += 8 + size
+	}
+	return nil
+}
+
+// CRC of a wav file's audio, reading all of it
+func sampleSum(path string) (uint32, error) {
+	f, err := storage.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := readWavInfo(f)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(info.DataStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var buf [INTEGRITY_READ]byte
+	sum := uint32(0)
+	for left := info.DataLen; left > 0; {
+		n, err := io.ReadFull(f, buf[:min(left, int64(len(buf)))])
+		sum = crc32.Update(sum, crc32.IEEETable, buf[:n])
+		if err != nil {
+			return sum, err
+		}
+		left -= int64(n)
+	}
+	return sum, nil
+}
+
+// Check a sample slot's file against the CRC the project has for it,
+// taking the CRC when there is none yet
+func checkSample(p *Project, slot int) error {
+	name := p.Samples[slot]
+	if name == "" {
+		return nil
+	}
+	sum, err := sampleSum(joinPath(samplesDir, name))
+	if err != nil {
+		return err
+	}
+	return p.matchSampleSum(slot, sum)
+}
+
+// Compare a CRC of a slot's audio with the one the project has, taking it
+// when there is none yet
+func (p *Project) matchSampleSum(slot int, sum uint32) error {
+	if p.SampleSums[slot] == 0 {
+		p.SampleSums[slot] = sum
+	} else if sum != p.SampleSums[slot] {
+		return errSampleChanged
+	}
+	return nil
+}
+
+// Check item i: 0 the project file, then the sample slots. Projects not
+// saved yet have no file to check.
+func checkItem(p *Project, i int) {
+	if i > 0 {
+		if name := p.Samples[i-1]; name != "" {
+			noteIntegrity(name, checkSample(p, i-1))
+		}
+		return
+	}
+	path := projectPath(p.Name)
+	if _, err := storage.Stat(path); err != nil {
+		return
+	}
+	data, err := readFile(path)
+	if err == nil {
+		err = checkProjectData(data)
+	}
+	noteIntegrity(baseName(path), err)
+}
+
+// Record the result of checking a file, warning when it newly fails
+func noteIntegrity(what string, err error) {
+	for i, pr := range integrityProblems {
+		if pr.what == what {
+			if err == nil {
+				integrityProblems = append(integrityProblems[:i], integrityProblems[i+1:]...)
+			} else {
+				integrityProblems[i].err = err.Error()
+			}
+			return
+		}
+	}
+	if err == nil {
+		return
+	}
+	println("Integrity check failed for", what+":", err.Error())
+	integrityProblems = append(integrityProblems, integrityProblem{what, err.Error()})
+	showStatus("CARD CHECK FAILED: "+what, colorRed)
+}
+
+// Check the next file while the device is idle and stopped. Called from
+// the main loop.
+func updateIntegrity() {
+	if !settings.IdleCheck || isAudioPlaying || time.Since(lastInputTime) < INTEGRITY_IDLE {
+		return
+	}
+	if integrityNext == 0 && !integrityPassed.IsZero() && time.Since(integrityPassed) < INTEGRITY_PERIOD {
+		return
+	}
+	checkItem(project, integrityNext)
+	if integrityNext++; integrityNext > MAX_SAMPLES {
+		integrityNext, integrityPassed = 0, time.Now()
+	}
+}
+
+// Check every file of the project now and list what failed. Samples
+// changed on purpose can be accepted, taking their CRCs again.
+func openIntegrityView() {
+	list := &ListView{Title: "CHECK CARD"}
+	refresh := func() {
+		for i := 0; i <= MAX_SAMPLES; i++ {
+			checkItem(project, i)
+		}
+		list.Items = list.Items[:0]
+		for _, pr := range integrityProblems {
+			list.Items = append(list.Items, pr.what+": "+pr.err)
+		}
+		if len(list.Items) == 0 {
+			list.Items = append(list.Items, "ALL FILES OK")
+		} else {
+			list.Items = append(list.Items, "ACCEPT CHANGED SAMPLES")
+		}
+	}
+	showStatus("CHECKING CARD", colorText)
+	refresh()
+	list.OnSelect = func(index int) {
+		if list.Items[index] != "ACCEPT CHANGED SAMPLES" {
+			return
+		}
+		project.SampleSums = [MAX_SAMPLES]uint32{}
+		refresh()
+		showStatus("SAMPLES ACCEPTED", colorGreen)
+	}
+	pushView(list)
+}
@@ -0,0 +1,102 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Maps a button pressed while the Mods buttons are held to an action
+type KeyBinding struct {
+	Mods   ButtonMask
+	Button Button
+	Action Action
+}
+
+// Default key bindings. Macro and snapshot slots 1-4 sit on the arrows
+// clockwise from UP.
+var keymap = []KeyBinding{
+	{MOD_NONE, BUTTON_UP, ACTION_CURSOR_UP},
+	{MOD_NONE, BUTTON_DOWN, ACTION_CURSOR_DOWN},
+	{MOD_NONE, BUTTON_LEFT, ACTION_CURSOR_LEFT},
+	{MOD_NONE, BUTTON_RIGHT, ACTION_CURSOR_RIGHT},
+	{MOD_NONE, BUTTON_ENTER, ACTION_ENTER},
+	{MOD_NAV, BUTTON_ENTER, ACTION_MENU},
+	{MOD_NONE, BUTTON_PLAY, ACTION_PLAY},
+	{MOD_ALT | MOD_NAV, BUTTON_ENTER, ACTION_MACRO_RECORD},
+	{MOD_ALT | MOD_NAV, BUTTON_UP, ACTION_MACRO_1},
+	{MOD_ALT | MOD_NAV, BUTTON_RIGHT, ACTION_MACRO_2},
+	{MOD_ALT | MOD_NAV, BUTTON_DOWN, ACTION_MACRO_3},
+	{MOD_ALT | MOD_NAV, BUTTON_LEFT, ACTION_MACRO_4},
+	{MOD_EDIT | MOD_NAV, BUTTON_PLAY, ACTION_LOCK},
+	{MOD_ALT | MOD_EDIT, BUTTON_NAV, ACTION_TUTORIAL_SKIP},
+	{MOD_ALT, BUTTON_UP, ACTION_BEND_UP},
+	{MOD_ALT, BUTTON_DOWN, ACTION_BEND_DOWN},
+	{MOD_ALT, BUTTON_LEFT, ACTION_COPY},
+	{MOD_ALT, BUTTON_RIGHT, ACTION_PASTE},
+	{MOD_ALT, BUTTON_ENTER, ACTION_MUTE},
+	{MOD_EDIT, BUTTON_UP, ACTION_EDIT_UP},
+	{MOD_EDIT, BUTTON_DOWN, ACTION_EDIT_DOWN},
+	{MOD_EDIT, BUTTON_LEFT, ACTION_EDIT_LEFT},
+	{MOD_EDIT, BUTTON_RIGHT, ACTION_EDIT_RIGHT},
+	{MOD_EDIT, BUTTON_ENTER, ACTION_CLEAR},
+	{MOD_ALT | MOD_EDIT, BUTTON_ENTER, ACTION_SNAPSHOT_STORE},
+	{MOD_ALT | MOD_EDIT, BUTTON_UP, ACTION_SNAPSHOT_1},
+	{MOD_ALT | MOD_EDIT, BUTTON_RIGHT, ACTION_SNAPSHOT_2},
+	{MOD_ALT | MOD_EDIT, BUTTON_DOWN, ACTION_SNAPSHOT_3},
+	{MOD_ALT | MOD_EDIT, BUTTON_LEFT, ACTION_SNAPSHOT_4},
+	{MOD_NAV, BUTTON_PLAY, ACTION_FILL},
+	{MOD_NAV, BUTTON_UP, ACTION_NAV_UP},
+	{MOD_NAV, BUTTON_DOWN, ACTION_NAV_DOWN},
+	{MOD_NAV, BUTTON_LEFT, ACTION_NAV_LEFT},
+	{MOD_NAV, BUTTON_RIGHT, ACTION_NAV_RIGHT},
+}
+
+// Left-handed layout: the arrows trade roles with the function keys facing
+// them across the panel, so modifiers sit under the left hand. PLAY stays.
+var mirroredButtons = [NUM_BUTTONS]Button{
+	BUTTON_LEFT:  BUTTON_NAV,
+	BUTTON_DOWN:  BUTTON_ALT,
+	BUTTON_RIGHT: BUTTON_ENTER,
+	BUTTON_UP:    BUTTON_EDIT,
+	BUTTON_ALT:   BUTTON_DOWN,
+	BUTTON_EDIT:  BUTTON_UP,
+	BUTTON_ENTER: BUTTON_RIGHT,
+	BUTTON_NAV:   BUTTON_LEFT,
+	BUTTON_PLAY:  BUTTON_PLAY,
+}
+
+func init() {
+	addSetting("HAND", []string{"RIGHT", "LEFT"},
+		func() int { return int(boolByte(settings.LeftHanded)) },
+		func(i int) { settings.LeftHanded = i == 1 })
+}
+
+// Role of a physical button in the active layout
+func mapButton(b Button) Button {
+	if settings.LeftHanded {
+		return mirroredButtons[b]
+	}
+	return b
+}
+
+// Roles of a set of physical buttons
+func mapMask(m ButtonMask) ButtonMask {
+	if !settings.LeftHanded {
+		return m
+	}
+	var out ButtonMask
+	for b := Button(0); b < NUM_BUTTONS; b++ {
+		if m&(1<<b) != 0 {
+			out |= 1 << mirroredButtons[b]
+		}
+	}
+	return out
+}
+
+// Find the action bound to a button chord
+func lookupAction(mods ButtonMask, b Button) Action {
+	for _, kb := range keymap {
+		if kb.Mods == mods && kb.Button == b {
+			return kb.Action
+		}
+	}
+	return ACTION_NONE
+}
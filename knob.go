@@ -0,0 +1,232 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Macro knobs: each instrument has NUM_KNOBS knobs, and each knob moves
+// one destination by its Depth, a signed percentage of the destination's
+// range, as its Value goes from 0 to 255. Several knobs can share a
+// destination and add up. Turning a knob, from the MACRO KNOBS tool, a
+// MIDI controller or the K command, changes the voices already playing
+// the instrument as well as the notes to come, so one control can sweep a
+// whole sound. Knobs add to the instrument's own settings and leave them
+// as they are.
+const (
+	NUM_KNOBS       = 4
+	KNOB_PITCH_SPAN = 1200 // Cents of pitch a full knob moves, an octave
+)
+
+// What a macro knob moves
+type KnobDest uint8
+
+const (
+	KNOB_OFF KnobDest = iota
+	KNOB_VOLUME
+	KNOB_PITCH
+	KNOB_VIBRATO
+	KNOB_WIDTH // Pulse width of an oscillator
+	KNOB_SWEEP // Sweep depth of an oscillator
+	KNOB_DECAY // Drum macros
+	KNOB_TONE
+	KNOB_SNAP
+	KNOB_CHORUS // Chorus mix of the track playing the instrument
+	NUM_KNOB_DESTS
+)
+
+var knobDestNames = [NUM_KNOB_DESTS]string{"OFF", "VOLUME", "PITCH", "VIBRATO", "WIDTH", "SWEEP",
+	"DECAY", "TONE", "SNAP", "CHORUS"}
+
+var knobDepths = []int8{-100, -50, -25, 0, 25, 50, 100}
+
+// A knob of an instrument, see knob.go. Depth is -100 to 100%.
+type MacroKnob struct {
+	Dest  KnobDest
+	Depth int8
+	Value uint8
+}
+
+// MIDI controllers the knobs can follow, the first of four in a row
+var knobCCs = []uint8{EMPTY, 16, 20, 70, 74}
+
+func init() {
+	addTool("MACRO KNOBS", openKnobView)
+	addByteSetting(byteChoice("MIDI KNOB CC", func() *uint8 { return &settings.KnobCC }, knobCCs,
+		func(v uint8) string {
+			if v == EMPTY {
+				return "OFF"
+			}
+			return itoa(int(v)) + "-" + itoa(int(v)+NUM_KNOBS-1)
+		}))
+}
+
+// Sum of what the knobs add to a destination spanning span
+func (in *Instrument) knobOffset(d KnobDest, span int) int {
+	sum := 0
+	for _, k := range in.Knobs {
+		if k.Dest == d {
+			sum += int(k.Value) * int(k.Depth) * span / (255 * 100)
+		}
+	}
+	return sum
+}
+
+// Whether any knob has a destination
+func (in *Instrument) hasKnobs() bool {
+	for _, k := range in.Knobs {
+		if k.Dest != KNOB_OFF {
+			return true
+		}
+	}
+	return false
+}
+
+// A 0-255 setting with the knobs added
+func (in *Instrument) knobByte(base uint8, d KnobDest) uint8 {
+	return clampByte(int32(int(base) + in.knobOffset(d, 255)))
+}
+
+// Apply an instrument's knobs to a voice made from it, or to each voice
+// of a pool, along with the voice's note volume and pulse width. Returns
+// whether any voice plays the instrument.
+func knobVoice(v Voice, in *Instrument) bool {
+	switch v := v.(type) {
+	case *VoicePool:
+		found := false
+		for _, pv := range v.Voices {
+			found = knobVoice(pv, in) || found
+		}
+		return found
+	case *PitchVoice:
+		if v.instrument != in {
+			return false
+		}
+		v.VibratoDepth = in.knobByte(in.VibratoDepth, KNOB_VIBRATO)
+		v.Knob = int16(in.knobOffset(KNOB_PITCH, KNOB_PITCH_SPAN))
+		level := uint8(int(in.knobByte(in.Volume, KNOB_VOLUME)) * int(v.Volume) / 255)
+		switch w := v.Voice.(type) {
+		case *SampleVoice:
+			w.Level = level
+		case *WavetableVoice:
+			w.Level = level
+		case *OscillatorVoice:
+			w.Level = level
+			duty := in.Duty
+			if v.Duty != 0 {
+				duty = v.Duty
+			} else if duty == 0 {
+				duty = DUTY_50
+			}
+			w.Duty = max(in.knobByte(duty, KNOB_WIDTH), 1)
+			w.SweepDepth = in.knobByte(in.SweepDepth, KNOB_SWEEP)
+		case *DrumVoice:
+			w.Level = level
+			w.Decay = in.knobByte(in.Drum.Decay, KNOB_DECAY)
+			w.Tone = in.knobByte(in.Drum.Tone, KNOB_TONE)
+			w.Snap = in.knobByte(in.Drum.Snap, KNOB_SNAP)
+		case *FMVoice:
+			w.Level = level
+			w.Ratio, w.Index, w.Feedback = in.FM.Ratio, in.FM.Index, in.FM.Feedback
+		case *GranularVoice:
+			w.Level = level
+			w.setParams(in)
+		case *PluckVoice:
+			w.Level = level
+			w.Damping, w.Decay = in.Pluck.Damping, in.Pluck.Decay
+		}
+		return true
+	}
+	return false
+}
+
+// Instrument a track's voice was made from, nil when unknown
+func trackInstrument(t int) *Instrument {
+	switch v := mixer.Tracks[t].Voice.(type) {
+	case *PitchVoice:
+		return v.instrument
+	case *VoicePool:
+		if len(v.Voices) > 0 {
+			if pv, ok := v.Voices[0].(*PitchVoice); ok {
+				return pv.instrument
+			}
+		}
+	}
+	return nil
+}
+
+// Apply an instrument's knobs to every voice playing it. Called with
+// audioMu held.
+func applyKnobs(in *Instrument) {
+	for t := range mixer.Tracks {
+		knobVoice(mixer.Tracks[t].Voice, in)
+	}
+}
+
+// Turn a knob of an instrument
+func setKnob(in *Instrument, k int, value uint8) {
+	audioMu.Lock()
+	in.Knobs[k].Value = value
+	applyKnobs(in)
+	audioMu.Unlock()
+}
+
+// Run a K command for an instrument: knob x+1 to y*17, so F is fully up.
+// Called with audioMu held.
+func knobFX(in *Instrument, param uint8) {
+	in.Knobs[(param>>4)%NUM_KNOBS].Value = param & 0xf * 17
+	applyKnobs(in)
+}
+
+// Turn the knobs of both MIDI parts' instruments from a control change
+func midiKnob(cc, value uint8) {
+	base := settings.KnobCC
+	if base == EMPTY || cc < base || cc >= base+NUM_KNOBS {
+		return
+	}
+	for part := range midiParts {
+		in := &project.Instruments[settings.MidiInstrument[part]%NUM_INSTRUMENTS]
+		setKnob(in, int(cc-base), value<<1|value>>6)
+	}
+}
+
+// Set the destination, depth and value of the selected instrument's knobs
+func openKnobView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	depths := make([]string, len(knobDepths))
+	for i, d := range knobDepths {
+		depths[i] = itoa(int(d)) + "%"
+		if d > 0 {
+			depths[i] = "+" + depths[i]
+		}
+	}
+	var items []settingItem
+	for k := range in.Knobs {
+		knob := &in.Knobs[k]
+		name := "KNOB " + itoa(k+1)
+		items = append(items,
+			settingItem{name, knobDestNames[:],
+				func() int { return int(knob.Dest) % int(NUM_KNOB_DESTS) },
+				func(i int) { knob.Dest = KnobDest(i) }},
+			settingItem{name + " DEPTH", depths,
+				func() int {
+					for i, d := range knobDepths {
+						if d == knob.Depth {
+							return i
+						}
+					}
+					return 0
+				},
+				func(i int) { knob.Depth = knobDepths[i] }},
+			byteChoice(name+" VALUE", func() *uint8 { return &knob.Value }, []uint8{0, 32, 64, 96, 128, 160, 192, 224, 255},
+				func(v uint8) string { return itoa(int(v)*100/255) + "%" }))
+	}
+	openInstrumentParams("KNOBS "+itoa(int(slot)), in, items, func() {
+		audioMu.Lock()
+		applyKnobs(in)
+		audioMu.Unlock()
+	})
+}
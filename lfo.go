@@ -0,0 +1,38 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Low frequency oscillators for modulating effects. They read the built-in
+// wavetables with a 32-bit phase and are stepped by whole chunks of frames,
+// so an effect can update its modulated parameter at a control rate.
+const LFO_QUARTER = 1 << 30 // Phase offset of a quarter cycle
+
+// Shape is a built-in wavetable such as WAVE_SINE and Rate is in mHz
+type LFO struct {
+	Shape uint8
+	Rate  uint32
+
+	phase uint32
+}
+
+// Value at the current phase plus offset, -32767 to 32767, interpolated
+// between table entries
+func (l *LFO) Value(offset uint32) int32 {
+	table := &wavetables[l.Shape%NUM_BUILTIN_WAVES]
+	p := l.phase + offset
+	i := p >> (32 - WAVETABLE_BITS)
+	frac := int32(p>>(24-WAVETABLE_BITS)) & 0xff
+	a, b := int32(table[i]), int32(table[(i+1)%WAVETABLE_SIZE])
+	return a + (b-a)*frac>>8
+}
+
+// Move the phase on by frames of output
+func (l *LFO) Advance(frames int) {
+	l.phase += phaseIncrement(l.Rate) * uint32(frames)
+}
+
+// Restart the cycle
+func (l *LFO) Reset() {
+	l.phase = 0
+}
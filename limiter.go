@@ -0,0 +1,95 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Lookahead brickwall limiter for bounces. Each frame's gain is the lowest
+// any frame in the lookahead window needs to stay under the ceiling,
+// released linearly and smoothed by a moving average as long as the
+// window, with the audio delayed to match. Every value the average covers
+// is at or below the gain the delayed frame needs, so the output never
+// passes the ceiling. It costs too much for live playback, where the
+// master soft clipper is used instead.
+const (
+	LIMITER_LOOKAHEAD_MS = 2
+	LIMITER_RELEASE_MS   = 100 // From full reduction back to unity
+	LIMITER_CEILING      = 32400
+	LIMITER_MAX_WINDOW   = 128 // Lookahead frames at the highest rate
+	LIMITER_UNITY        = 1 << 16
+)
+
+// Gains are Q16
+type Limiter struct {
+	Ceiling int32
+
+	window  int
+	delay   [2][LIMITER_MAX_WINDOW]int32 // Audio, window-1 frames behind
+	peaks   [LIMITER_MAX_WINDOW]int32    // Recent peaks for the window maximum
+	gains   [LIMITER_MAX_WINDOW]int32    // Released gains being averaged
+	sum     int64
+	pos     int
+	release int32 // Gain recovered per frame
+	gain    int32
+}
+
+func newLimiter() *Limiter {
+	l := &Limiter{Ceiling: LIMITER_CEILING}
+	l.Reset()
+	return l
+}
+
+// Clear the history and size the window for the current sampleRate
+func (l *Limiter) Reset() {
+	ceiling := l.Ceiling
+	*l = Limiter{Ceiling: ceiling}
+	l.window = min(max(int(sampleRate)*LIMITER_LOOKAHEAD_MS/1000, 1), LIMITER_MAX_WINDOW)
+	l.release = max(LIMITER_UNITY/(int32(sampleRate)*LIMITER_RELEASE_MS/1000), 1)
+	l.gain = LIMITER_UNITY
+	for i := range l.gains[:l.window] {
+		l.gains[i] = LIMITER_UNITY
+	}
+	l.sum = int64(LIMITER_UNITY) * int64(l.window)
+}
+
+// Frames the output lags the input by
+func (l *Limiter) Latency() int { return l.window - 1 }
+
+func (l *Limiter) Process(left, right []int32) {
+	w := l.window
+	for i := range left {
+		in := [2]int32{left[i], right[i]}
+		l.peaks[l.pos] = max(in[0], -in[0], in[1], -in[1])
+		peak := int32(0)
+		for _, p := range l.peaks[:w] {
+			peak = max(peak, p)
+		}
+		need := int32(LIMITER_UNITY)
+		if peak > l.Ceiling {
+			need = int32(int64(l.Ceiling) << 16 / int64(peak))
+		}
+		l.gain = min(l.gain+l.release, need)
+
+		l.sum += int64(l.gain - l.gains[l.pos])
+		l.gains[l.pos] = l.gain
+		g := int64(l.sum / int64(w))
+
+		// The oldest frame leaves the delay as this one enters
+		out := l.pos + 1
+		if out == w {
+			out = 0
+		}
+		if w == 1 {
+			out = l.pos
+		}
+		l.delay[0][l.pos], l.delay[1][l.pos] = in[0], in[1]
+		left[i] = int32(int64(l.delay[0][out]) * g >> 16)
+		right[i] = int32(int64(l.delay[1][out]) * g >> 16)
+		l.pos = out
+	}
+}
+
+func init() {
+	addSetting("EXPORT LIMITER", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.ExportLimiter)) },
+		func(i int) { settings.ExportLimiter = i == 1 })
+}
@@ -0,0 +1,96 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"device/rp"
+	"machine"
+	"runtime"
+)
+
+// Sampling external gear through the RP2040 ADC, no extra hardware needed
+// beyond a bias network centering the signal at half the 3.3V supply. The
+// ADC free-runs from its own 48MHz clock into its FIFO at LINE_IN_RATE, so
+// timing doesn't depend on how often the FIFO is read. The bias is tracked
+// and removed and LINE IN GAIN applied on the way out.
+const (
+	LINE_IN_PIN     = DISPLAY_SDI_PIN // Wired for SPI, but the display is never read
+	LINE_IN_CHANNEL = 2               // ADC input of LINE_IN_PIN
+	LINE_IN_RATE    = 22050
+	ADC_CLOCK_HZ    = 48_000_000
+
+	// Clock divider in 1/256 cycles; the ADC takes one sample every
+	// 1 + DIV cycles
+	LINE_IN_DIV = ADC_CLOCK_HZ*256/LINE_IN_RATE - 256
+
+	DC_TRACK_SHIFT = 10 // The offset tracker follows over about 2^n samples
+)
+
+var lineInGains = []string{"X1", "X2", "X4", "X8", "X16"}
+
+// ADC line in, an AudioInput
+type LineIn struct {
+	dc     int32 // Tracked offset, Q16 in ADC units
+	primed bool
+}
+
+func init() {
+	addSetting("LINE IN GAIN", lineInGains,
+		func() int { return int(settings.LineInGain) },
+		func(i int) { settings.LineInGain = uint8(i) })
+}
+
+func newLineIn() *LineIn {
+	machine.InitADC()
+	return &LineIn{}
+}
+
+// Take the pin, which the I2S input shares, and start free-running
+// conversions into the FIFO
+func (l *LineIn) Start() error {
+	machine.ADC{Pin: LINE_IN_PIN}.Configure(machine.ADCConfig{})
+	adc := rp.ADC
+	adc.CS.Set(rp.ADC_CS_EN | LINE_IN_CHANNEL<<rp.ADC_CS_AINSEL_Pos)
+	for !adc.CS.HasBits(rp.ADC_CS_READY) {
+	}
+	adc.DIV.Set(LINE_IN_DIV)
+	adc.FCS.Set(rp.ADC_FCS_EN | rp.ADC_FCS_OVER | rp.ADC_FCS_UNDER) // Over and under clear on write
+	for adc.FCS.Get()&rp.ADC_FCS_LEVEL_Msk != 0 {
+		adc.FIFO.Get()
+	}
+	l.primed = false
+	adc.CS.SetBits(rp.ADC_CS_START_MANY)
+	return nil
+}
+
+func (l *LineIn) Stop() {
+	rp.ADC.CS.ClearBits(rp.ADC_CS_START_MANY)
+	rp.ADC.FCS.Set(0)
+}
+
+func (l *LineIn) Rate() uint32 { return LINE_IN_RATE }
+
+// Fill dst with offset-free, amplified samples. The FIFO holds only four
+// conversions, so it overflows if not read for about 180us.
+func (l *LineIn) ReadMono(dst []int16) (stalls int) {
+	adc := rp.ADC
+	shift := settings.LineInGain
+	for i := range dst {
+		if adc.FCS.HasBits(rp.ADC_FCS_OVER) {
+			adc.FCS.SetBits(rp.ADC_FCS_OVER)
+			stalls++
+		}
+		for adc.FCS.Get()&rp.ADC_FCS_LEVEL_Msk == 0 {
+			runtime.Gosched()
+		}
+		x := int32(adc.FIFO.Get()&0xfff) << 16
+		if !l.primed {
+			l.dc, l.primed = x, true
+		}
+		l.dc += (x - l.dc) >> DC_TRACK_SHIFT
+		// 12 bit ADC units to 16 bit samples, then the gain
+		dst[i] = clip16((x - l.dc) >> 12 << shift)
+	}
+	return stalls
+}
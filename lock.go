@@ -0,0 +1,31 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// While locked only performance actions run, so nothing in the project
+// can be changed by a stray button press on stage
+var performanceLocked bool
+
+// Actions that stay live while locked. Cursor moves only change what is
+// shown, and snapshots and mutes are how a set is played.
+func performanceAction(a Action) bool {
+	switch a {
+	case ACTION_PLAY, ACTION_LOCK, ACTION_MUTE,
+		ACTION_MACRO_1, ACTION_MACRO_2, ACTION_MACRO_3, ACTION_MACRO_4,
+		ACTION_SNAPSHOT_STORE, ACTION_SNAPSHOT_1, ACTION_SNAPSHOT_2, ACTION_SNAPSHOT_3, ACTION_SNAPSHOT_4,
+		ACTION_CURSOR_UP, ACTION_CURSOR_DOWN, ACTION_CURSOR_LEFT, ACTION_CURSOR_RIGHT,
+		ACTION_NAV_UP, ACTION_NAV_DOWN, ACTION_NAV_LEFT, ACTION_NAV_RIGHT:
+		return true
+	}
+	return false
+}
+
+func toggleLock() {
+	performanceLocked = !performanceLocked
+	if performanceLocked {
+		showStatus("LOCKED", colorRed)
+	} else {
+		showStatus("UNLOCKED", colorGreen)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Loop crossfades, baked into the sample as it loads. The end of the loop
+// is faded into the audio just before the loop start, so the jump back to
+// the start continues the waveform instead of clicking. A crossfade needs
+// that much audio before the loop start, and is shortened to fit.
+const MAX_LOOP_FADE = 50 // Percent of the loop
+
+var loopFades = []uint8{0, 5, 10, 20, 30, 40, MAX_LOOP_FADE}
+
+// Crossfade the last n frames of the loop lo-hi with the n frames before lo
+func crossfadeLoop(data []int16, lo, hi, n uint32) {
+	n = min(n, lo, (hi-lo)/2)
+	for i := uint32(0); i < n; i++ {
+		a, b := int32(data[hi-n+i]), int32(data[lo-n+i])
+		data[hi-n+i] = int16(a + (b-a)*int32(i+1)/int32(n+1))
+	}
+}
+
+// Whether an instrument plays a sample slot, directly or from a zone
+func (in *Instrument) usesSample(slot uint8) bool {
+	if in.Type != INSTR_SAMPLE {
+		return false
+	}
+	if in.NumZones == 0 {
+		return in.Sample == slot
+	}
+	for _, z := range in.Zones[:in.NumZones] {
+		if z.Sample == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply the loop fades of the instruments playing a sample slot to the
+// sample just loaded into it. Instruments sharing a sample with different
+// loops each fade their own.
+func fadeLoops(p *Project, slot uint8, s *Sample) {
+	for i := range p.Instruments {
+		in := &p.Instruments[i]
+		if in.LoopFade == 0 || in.NumSlices > 0 || !in.usesSample(slot) ||
+			in.Loop == LOOP_OFF || in.Loop == LOOP_PINGPONG || in.Play == PLAY_ONESHOT {
+			continue
+		}
+		lo, hi := s.LoopStart, s.LoopEnd
+		if in.LoopEnd > 0 {
+			lo, hi = fractionFrames(s, in.LoopStart), fractionFrames(s, in.LoopEnd)
+		}
+		if lo < hi {
+			crossfadeLoop(s.Data, lo, hi, (hi-lo)*uint32(min(in.LoopFade, MAX_LOOP_FADE))/100)
+		}
+	}
+}
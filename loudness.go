@@ -0,0 +1,144 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Integrated loudness of a bounce, roughly as BS.1770 measures it: both
+// channels go through the K-weighting high shelf (the low cut is left to
+// the master DC blocker), mean square power is taken over 400ms blocks
+// every 100ms, and blocks are gated at -70 LUFS, then at 10 LU below the
+// loudness of those left. Blocks are kept in a histogram of
+// LOUDNESS_BIN_LU wide bins so long songs fit in RAM, which makes the
+// relative gate approximate. Peak is the highest sample, not true peak.
+const (
+	LOUDNESS_SHELF_HZ   = 1681
+	LOUDNESS_SHELF_DB   = 4
+	LOUDNESS_SUBBLOCKS  = 4 // 100ms steps per block
+	LOUDNESS_ABS_GATE   = -70
+	LOUDNESS_REL_GATE   = -10
+	LOUDNESS_BIN_LU     = 0.5
+	LOUDNESS_BINS       = 150 // From the absolute gate up to +5 LUFS
+	LOUDNESS_OFFSET     = -0.691
+	LOUDNESS_FULL_SCALE = 32768.0 * 32768.0
+)
+
+type LoudnessMeter struct {
+	shelf biquad
+	state [2]biquadState
+
+	power    [LOUDNESS_SUBBLOCKS]float64 // Last 100ms steps, mean square
+	steps    int
+	acc      int64
+	frames   int
+	stepLen  int
+	binCount [LOUDNESS_BINS]uint32
+	binPower [LOUDNESS_BINS]float64
+	peak     int32
+}
+
+func newLoudnessMeter() *LoudnessMeter {
+	return &LoudnessMeter{
+		shelf:   rbjBiquad(EQ_HIGH, LOUDNESS_SHELF_HZ, LOUDNESS_SHELF_DB, sampleRate),
+		stepLen: max(int(sampleRate)/10, 1),
+	}
+}
+
+// Loudness in LUFS of a mean square power
+func lufs(power float64) float64 {
+	return LOUDNESS_OFFSET + 10*math.Log10(power)
+}
+
+// Measure a frame as written to the file
+func (m *LoudnessMeter) Add(l, r int16) {
+	m.peak = max(m.peak, int32(l), -int32(l), int32(r), -int32(r))
+	wl := int64(m.shelf.process(&m.state[0], int32(l)))
+	wr := int64(m.shelf.process(&m.state[1], int32(r)))
+	m.acc += wl*wl + wr*wr
+	if m.frames++; m.frames < m.stepLen {
+		return
+	}
+	m.power[m.steps%LOUDNESS_SUBBLOCKS] = float64(m.acc) / float64(m.frames) / LOUDNESS_FULL_SCALE
+	m.acc, m.frames = 0, 0
+	if m.steps++; m.steps < LOUDNESS_SUBBLOCKS {
+		return
+	}
+	block := 0.0
+	for _, p := range m.power {
+		block += p
+	}
+	block /= LOUDNESS_SUBBLOCKS
+	if block <= 0 {
+		return
+	}
+	bin := int((lufs(block) - LOUDNESS_ABS_GATE) / LOUDNESS_BIN_LU)
+	if bin < 0 {
+		return
+	}
+	bin = min(bin, LOUDNESS_BINS-1)
+	m.binCount[bin]++
+	m.binPower[bin] += block
+}
+
+// Mean power of the blocks in bins from first up
+func (m *LoudnessMeter) gatedPower(first int) (float64, bool) {
+	var sum float64
+	var n uint32
+	for b := max(first, 0); b < LOUDNESS_BINS; b++ {
+		sum += m.binPower[b]
+		n += m.binCount[b]
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// Integrated loudness in LUFS, or false when everything is below the gate
+func (m *LoudnessMeter) Integrated() (float64, bool) {
+	power, ok := m.gatedPower(0)
+	if !ok {
+		return 0, false
+	}
+	// Some blocks are always above the mean, so the second pass has some
+	gate := lufs(power) + LOUDNESS_REL_GATE
+	power, _ = m.gatedPower(int(math.Ceil((gate - LOUDNESS_ABS_GATE) / LOUDNESS_BIN_LU)))
+	return lufs(power), true
+}
+
+// Highest sample in dBFS, at least -96
+func (m *LoudnessMeter) PeakDB() float64 {
+	if m.peak == 0 {
+		return -96
+	}
+	return max(20*math.Log10(float64(m.peak)/32768), -96)
+}
+
+// Value with one decimal, such as -14.2
+func decimal1(v float64) string {
+	tenths := int(math.Round(v * 10))
+	sign := ""
+	if tenths < 0 {
+		sign, tenths = "-", -tenths
+	}
+	return sign + itoa(tenths/10) + "." + itoa(tenths%10)
+}
+
+// Integrated loudness and peak for the export summary
+func (m *LoudnessMeter) Summary() string {
+	loud := "SILENT"
+	if v, ok := m.Integrated(); ok {
+		loud = decimal1(v) + " LUFS"
+	}
+	return loud + " PEAK " + decimal1(m.PeakDB()) + " DBFS"
+}
+
+// Text file written next to a bounce, one name=value per line
+func (m *LoudnessMeter) Report(file string) string {
+	loud := "silent"
+	if v, ok := m.Integrated(); ok {
+		loud = decimal1(v)
+	}
+	return "file=" + file + "\nintegrated_lufs=" + loud + "\npeak_dbfs=" + decimal1(m.PeakDB()) + "\n"
+}
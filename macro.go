@@ -0,0 +1,123 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	NUM_MACROS        = 4
+	MACRO_MAX_ACTIONS = 32
+)
+
+// A recorded sequence of UI actions
+type Macro struct {
+	Actions [MACRO_MAX_ACTIONS]Action
+	Length  uint8
+}
+
+var (
+	macroRecording bool
+	macroPlaying   bool
+	macroBuffer    Macro
+)
+
+// Macro control actions are never recorded into a macro
+func isMacroAction(a Action) bool {
+	return a >= ACTION_MACRO_RECORD && a <= ACTION_MACRO_4
+}
+
+// Start recording, or abandon a recording in progress
+func toggleMacroRecording() {
+	if macroRecording {
+		macroRecording = false
+		showStatus("MACRO CANCELLED", colorRed)
+		return
+	}
+	macroBuffer = Macro{}
+	macroRecording = true
+	showStatus("MACRO REC", colorRed)
+}
+
+// Append an action to the macro being recorded
+func recordMacroAction(a Action) {
+	if !macroRecording || macroPlaying || isMacroAction(a) {
+		return
+	}
+	if int(macroBuffer.Length) >= MACRO_MAX_ACTIONS {
+		println("Macro full, dropping action", a)
+		return
+	}
+	macroBuffer.Actions[macroBuffer.Length] = a
+	macroBuffer.Length++
+}
+
+// Save the recording into a slot, or play the slot back
+func macroSlotPressed(slot int) {
+	if macroRecording {
+		macroRecording = false
+		settings.Macros[slot] = macroBuffer
+		saveSettings()
+		showStatus("MACRO "+itoa(slot+1)+" SAVED: "+itoa(int(macroBuffer.Length)), colorGreen)
+		return
+	}
+	runMacro(&settings.Macros[slot])
+}
+
+// Replay a macro's actions in order
+func runMacro(m *Macro) {
+	if macroPlaying {
+		return
+	}
+	macroPlaying = true
+	for i := 0; i < int(m.Length); i++ {
+		dispatchAction(m.Actions[i])
+	}
+	macroPlaying = false
+}
+
+// Add a MACROn=action,action,... line for each recorded macro to the
+// settings file, actions by name
+func saveMacros(b *strings.Builder) {
+	for i, m := range settings.Macros {
+		if m.Length == 0 {
+			continue
+		}
+		b.WriteString("MACRO" + itoa(i+1) + "=")
+		for j, a := range m.Actions[:m.Length] {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(actionNames[a])
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// Read a macro line of the settings file, reporting whether it was one.
+// Actions this firmware doesn't have are dropped.
+func loadMacro(name, value string) bool {
+	slot, ok := strings.CutPrefix(name, "MACRO")
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(slot)
+	if err != nil || i < 1 || i > NUM_MACROS {
+		return true
+	}
+	m := Macro{}
+	for _, f := range strings.Split(value, ",") {
+		a := slices.Index(actionNames[:], f)
+		if a <= int(ACTION_NONE) || int(m.Length) >= MACRO_MAX_ACTIONS {
+			continue
+		}
+		m.Actions[m.Length] = Action(a)
+		m.Length++
+	}
+	settings.Macros[i-1] = m
+	return true
+}
@@ -7,14 +7,10 @@ import (
 	"image/color"
 	"machine"
 	"strconv"
+	"sync"
 	"time"
 
 	"tinygo.org/x/drivers/st7789"
-	"tinygo.org/x/tinyfont"
-	"tinygo.org/x/tinyfont/freemono"
-
-	pio "github.com/tinygo-org/pio/rp2-pio"
-	"github.com/tinygo-org/pio/rp2-pio/piolib"
 )
 
 // Display configuration
@@ -63,9 +59,17 @@ const (
 	AUDIO_SDATA = 17
 	AUDIO_BCLK  = 18 // BCLK and LRCLK HAVE to be consecutive
 	AUDIO_LRCLK = 19
-	NUM_SAMPLES = 32    // Number of samples in one sine wave period
 	NUM_BLOCKS  = 8     // Number of blocks to buffer
-	SAMPLE_RATE = 44100 // Standard CD quality sample rate
+	SAMPLE_RATE = 44100 // Default rate, see sampleRate
+)
+
+// Optional I2S mic or line input board, see recorder.go. No other pins
+// are free, so it shares CLOCK_IN_PIN, MIDI_RX_PIN and LINE_IN_PIN and
+// can't record while CLOCK IN or MIDI IN is on.
+const (
+	AUDIO_IN_BCLK  = 0 // BCLK and LRCLK HAVE to be consecutive
+	AUDIO_IN_LRCLK = 1
+	AUDIO_IN_SDATA = 28
 )
 
 // Battery voltage pin
@@ -77,7 +81,7 @@ const (
 	DEBUG_UART_RX = machine.Pin(25)
 )
 
-// colors
+// colors, set by the active theme
 var (
 	colorBackground = color.RGBA{0, 0, 0, 255}       // Black
 	colorGrid       = color.RGBA{50, 50, 50, 255}    // Dark gray
@@ -85,70 +89,16 @@ var (
 	colorRed        = color.RGBA{255, 0, 0, 255}     // Red
 	colorBlue       = color.RGBA{0, 0, 255, 255}     // Blue
 	colorGreen      = color.RGBA{0, 255, 0, 255}     // Green
-
-	// Input debouncing
-	lastButtonState  = make(map[machine.Pin]bool)
-	lastDebounceTime = make(map[machine.Pin]int64)
-	buttonState      = make(map[machine.Pin]bool)
 )
 
-// sine wave data
-var sine []int16 = []int16{
-	6392, 12539, 18204, 23169, 27244, 30272, 32137, 32767, 32137,
-	30272, 27244, 23169, 18204, 12539, 6392, 0, -6393, -12540,
-	-18205, -23170, -27245, -30273, -32138, -32767, -32138, -30273, -27245,
-	-23170, -18205, -12540, -6393, -1,
-}
-
-// Update display with audio status
-func updateAudioStatusDisplay() {
-	display.FillRectangle(0, 190, 319, 20, colorBackground)
-	statusText := "Audio: PLAYING"
-	statusColor := colorGreen
-	if !isAudioPlaying {
-		statusText = "Audio: STOPPED"
-		statusColor = colorRed
-	}
-	tinyfont.WriteLine(&display, &freemono.Regular9pt7b, 20, 200, statusText, statusColor)
-	display.Display()
-}
-
-// Check if a button is pressed (with debouncing)
-func isButtonPressed(pin machine.Pin) bool {
-	reading := !pin.Get() // Inverted because of pull-up resistors
-
-	// Initialize button state if not already done
-	if _, exists := lastButtonState[pin]; !exists {
-		lastButtonState[pin] = false
-		lastDebounceTime[pin] = 0
-		buttonState[pin] = false
-	}
-
-	now := time.Now().UnixNano()
-
-	// If the button state changed, reset the debounce timer
-	if reading != lastButtonState[pin] {
-		lastDebounceTime[pin] = now
-		lastButtonState[pin] = reading
-	}
-
-	// If the button state has been stable for the debounce delay
-	if (now - lastDebounceTime[pin]) > 50_000_000 { // 50ms debounce
-		// If the debounced state is different from the current state
-		if reading != buttonState[pin] {
-			buttonState[pin] = reading
-			return buttonState[pin]
-		}
-	}
-
-	return false
-}
-
 // Simple integer to string conversion
 func itoa(val int) string {
 	if val == 0 {
 		return "0"
 	}
+	if val < 0 {
+		return "-" + itoa(-val)
+	}
 
 	var result string
 	for val > 0 {
@@ -160,6 +110,12 @@ func itoa(val int) string {
 	return result
 }
 
+// Two digit hex, as trackers show values
+func hexByte(v uint8) string {
+	const digits = "0123456789ABCDEF"
+	return string([]byte{digits[v>>4], digits[v&15]})
+}
+
 // Setup debug UART
 // Setup debug UART
 func setupPTDebugUART() {
@@ -198,11 +154,16 @@ func setupDisplay() st7789.Device {
 
 	println("SPI configured successfully")
 
+	// The display is the only device on its bus, so CS stays low instead
+	// of the driver toggling it around every command
+	DISPLAY_CS_PIN.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	DISPLAY_CS_PIN.Low()
+
 	// Configure display
 	display := st7789.New(spi,
 		DISPLAY_RESET_PIN,
 		DISPLAY_DC_PIN,
-		DISPLAY_CS_PIN,
+		machine.NoPin,
 		DISPLAY_BACKLIGHT,
 	)
 
@@ -253,33 +214,41 @@ func setupButtons() {
 	INPUT_NAV.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 	INPUT_ALT.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 	INPUT_PLAY.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	watchButtons()
 }
 
-var display st7789.Device
+var display Screen
 
 func main() {
 	// Setup hardware
 	setupPTDebugUART()
 	println("PicoTracker TEST starting...")
+	reportFeatures()
+	for _, e := range extensions {
+		println("Extension:", e.Name)
+	}
 
 	// Add a startup delay to ensure system is stable
 	time.Sleep(500 * time.Millisecond)
 
-	display = setupDisplay()
+	display.Device = setupDisplay()
 	println("Display setup complete")
 
 	setupButtons()
 	println("Buttons setup complete")
 
-	// Pre-clear the screen once before entering the loop
-	display.FillScreen(colorBackground)
-	display.Display()
+	loadFolders()
+	ensureFolders()
+	loadSettings()
+	loadClipboard()
+	loadTrashIndex()
+	if !settings.TutorialDone {
+		startTutorial()
+	}
 
 	// Draw welcome message
-	tinyfont.WriteLine(&display, &freemono.Regular12pt7b, 40, 100, "picoTracker", colorText)
-	tinyfont.WriteLine(&display, &freemono.Regular9pt7b, 20, 150, "welcome from TinyGo!", colorText)
-	tinyfont.WriteLine(&display, &freemono.Regular9pt7b, 20, 180, "Press PLAY to start", colorText)
-	display.Display()
+	showView(homeView{})
+	updateView()
 
 	time.Sleep(200 * time.Millisecond)
 
@@ -287,20 +256,42 @@ func main() {
 
 	// Initialize audio state tracking
 	var lastAudioState = isAudioPlaying
-	updateAudioStatusDisplay()
 
 	initSound()
 
 	// Main loop
 	for {
+		beginFrame()
+
 		// Process button inputs first
 		processInputs()
 
 		// Update display if audio state changed
 		if isAudioPlaying != lastAudioState {
-			updateAudioStatusDisplay()
+			redrawView()
 			lastAudioState = isAudioPlaying
 		}
+		updateView()
+		updateSequencer()
+		serviceStreams()
+		updateDucker()
+		updateChorus()
+		updateReverb()
+		updateGates()
+		updateCrushers()
+		updateTrims()
+		updateRoutes()
+		updateGroups()
+		updateSoak()
+		pollMIDI()
+		pollShell()
+		updateClockSync()
+		updateIntegrity()
+		updateCompare()
+		updateAudition()
+		updateAudioStats()
+		updateQuality()
+		demoIdleCheck()
 
 		// Handle any audio state updates (non-blocking)
 		select {
@@ -311,153 +302,201 @@ func main() {
 			// No audio state changes
 		}
 
-		// Fixed frame rate delay
-		time.Sleep(32 * time.Millisecond) // ~30 FPS
+		endFrame()
 	}
 }
 
 var counter int = 0
 
-// Process all button inputs based on current game state
-func processInputs() { // Check for start button press
-	if isButtonPressed(INPUT_PLAY) {
-		println("Start button pressed!!")
-		counter++
-		// clear previous message that starts on 20,150
-		display.FillRectangle(0, 170, 319, 20, colorBackground)
-		// display message
-		message := "START PRESSED: " + strconv.Itoa(counter)
-		tinyfont.WriteLine(&display, &freemono.Regular9pt7b, 20, 180, message, colorBlue)
-		display.Display()
-
-		// Toggle audio playback
-		toggleAudio()
+// Process all pending button events
+func processInputs() {
+	pollButtons()
+	for {
+		ev, ok := popKeyEvent()
+		if !ok {
+			break
+		}
+		if soakConsumeKey(ev) {
+			continue
+		}
+		handleKeyEvent(ev)
 	}
 }
 
+// Route a key event through the hooks and the keymap
+func handleKeyEvent(ev KeyEvent) {
+	if demoConsumeKey(ev) || fireKey(ev) || bendKey(ev) || fillKey(ev) {
+		return
+	}
+	if ev.Pressed {
+		dispatchAction(lookupAction(ev.Mods, ev.Button))
+	}
+}
+
+// Handle the PLAY button
+func playPressed() {
+	println("Start button pressed!!")
+	counter++
+	showStatus("START PRESSED: "+strconv.Itoa(counter), colorBlue)
+
+	// Toggle audio playback
+	toggleAudio()
+}
+
 // Global buffer for audio data to avoid allocations
 var (
 	isAudioPlaying    = false
 	audioPlaybackChan = make(chan bool, 1)
 	audioStateChan    = make(chan bool, 1) // For non-blocking state updates
-	audioI2S          *piolib.I2S
-	audioBuffer       []uint32
+	audioOut          AudioOutput
+	audioQueue        *AudioQueue
+
+	// Held by the audio loop while it renders a block. With the audio on
+	// its own core, hold it while changing voices or mixer tracks.
+	audioMu sync.Mutex
 )
 
 // Initialize audio system
-func initSound() *piolib.I2S {
+func initSound() {
 	time.Sleep(100 * time.Millisecond) // Short delay for hardware to stabilize
 
 	// Print debug info
 	println("Initializing audio system...")
-	println("Sample rate:", SAMPLE_RATE, "Hz")
-	println("Sine wave period:", NUM_SAMPLES, "samples")
-	println("Buffer size:", NUM_SAMPLES*8, "samples")
-
-	// Initialize PIO state machine and I2S interface
-	sm, err := pio.PIO0.ClaimStateMachine()
-	if err != nil {
-		println("Failed to claim state machine:", err.Error())
-		return nil
-	}
+	println("Sample rate:", sampleRate, "Hz")
+	println("Buffer size:", BLOCK_SIZE, "samples")
 
-	// Initialize I2S with the PIO state machine
-	i2s, err := piolib.NewI2S(sm, AUDIO_SDATA, AUDIO_BCLK)
+	out, err := newAudioOutput()
 	if err != nil {
-		println("Failed to initialize I2S:", err.Error())
-		return nil
+		println("Failed to initialize", AUDIO_OUTPUT, "output:", err.Error())
+		return
 	}
+	println(AUDIO_OUTPUT, "output initialized at", sampleRate, "Hz")
 
-	// Set the sample rate with error checking
-	err = i2s.SetSampleFrequency(SAMPLE_RATE)
-	if err != nil {
-		println("Warning: Failed to set sample rate:", err.Error())
+	// Initialize the buffers only once
+	if audioQueue == nil {
+		println("Allocating", AUDIO_QUEUE_BLOCKS, "audio blocks of", BLOCK_SIZE, "samples")
+		audioQueue = newAudioQueue(AUDIO_QUEUE_BLOCKS, BLOCK_SIZE)
 	}
 
-	// Debug information
-	clockHz := uint64(machine.CPUFrequency())
-	targetBitClock := uint64(SAMPLE_RATE * 64) // 32 bits per channel * 2 channels
-
-	// The SetSampleFrequency method already calculates and sets the appropriate
-	// clock divider for the PIO state machine to achieve the desired sample rate.
-	// It uses pio.ClkDivFromFrequency internally to handle the calculation.
-	println("System clock:", clockHz/1000000, "MHz")
-	println("Target bit clock:", targetBitClock/1000, "kHz")
-	println("Sample rate:", SAMPLE_RATE, "Hz")
-
-	println("I2S initialized at", SAMPLE_RATE, "Hz")
-
-	// Sine wave data (32 samples for one period)
-	var sine = [...]int16{
-		6392, 12539, 18204, 23169, 27244, 30272, 32137, 32767, 32137,
-		30272, 27244, 23169, 18204, 12539, 6392, 0, -6393, -12540,
-		-18205, -23170, -27245, -30273, -32138, -32767, -32138, -30273, -27245,
-		-23170, -18205, -12540, -6393, -1,
+	// The reverb goes on the send bus
+	initWavetables()
+	initNoteTable()
+	if FEATURE_REVERB {
+		mixer.SendEffect = newReverb()
 	}
 
-	// Initialize the buffer only once
-	if audioBuffer == nil {
-		totalSamples := NUM_SAMPLES * 8 // 8 periods of the sine wave
-		println("Allocating audio buffer with", totalSamples, "samples")
-		audioBuffer = make([]uint32, totalSamples)
-
-		// Fill the buffer with repeated periods of the sine wave
-		for i := 0; i < totalSamples; i++ {
-			// Scale down the amplitude (volume control)
-			sample := int16((int32(sine[i%NUM_SAMPLES]) * 1) / 100) // 1% volume
-			// Pack sample into both left and right channels
-			audioBuffer[i] = uint32(uint16(sample)) | (uint32(uint16(sample)) << 16)
-		}
-
-		println("Audio buffer initialized with", len(audioBuffer), "samples")
-	}
-
-	// Store the I2S interface globally
-	audioI2S = i2s
+	// Store the output globally
+	audioOut = out
 
 	// Start the audio playback goroutine
+	if AUDIO_DEDICATED_CORE {
+		println("Audio shares both cores with the main loop")
+	}
 	go audioPlaybackLoop()
-
-	return i2s
+	go audioOutputLoop()
 }
 
-// Audio playback loop
+// Audio playback loop, rendering blocks into the queue
 func audioPlaybackLoop() {
-	// Pre-calculate buffer size
-	bufferSize := len(audioBuffer)
-	if bufferSize == 0 {
-		println("Error: Audio buffer not initialized")
-		return
-	}
-
 	for {
-		// Wait for playback to be enabled
-		if !isAudioPlaying {
-			if !<-audioPlaybackChan {
-				continue
+		// Wait for playback to be enabled, or for an audition
+		if !isAudioPlaying && !auditioning() {
+			select {
+			case on := <-audioPlaybackChan:
+				if !on {
+					continue
+				}
+			case <-auditionWake:
 			}
 		}
 
-		// Play audio as long as isAudioPlaying is true
-		for isAudioPlaying {
-			// Write the audio buffer
-			_, err := audioI2S.WriteStereo(audioBuffer)
-			if err != nil {
-				// Non-blocking error reporting
-				select {
-				case audioStateChan <- false: // Signal error state
-				default:
-				}
-				time.Sleep(time.Millisecond)
-				continue
+		// Play audio as long as isAudioPlaying is true, then until the
+		// fade out has finished, and while auditioning
+		for isAudioPlaying || !mixer.Silent() || auditioning() {
+			block := audioQueue.Acquire()
+			start := time.Now()
+			renderBlock(block)
+			mixAudition(block)
+			recordBlock(time.Since(start))
+			audioQueue.Submit(block)
+		}
+		audioQueue.Submit(nil)
+	}
+}
+
+// Write queued blocks to the output as they are rendered
+func audioOutputLoop() {
+	for {
+		block := audioQueue.Next()
+		if block == nil {
+			resetBlockClock()
+			continue
+		}
+		captureScope(block)
+		recordWrite()
+		_, err := audioOut.WriteStereo(block)
+		audioQueue.Release(block)
+		if err != nil {
+			// Non-blocking error reporting
+			select {
+			case audioStateChan <- false: // Signal error state
+			default:
 			}
+			time.Sleep(time.Millisecond)
+			continue
 		}
+		lastBlockWrite = time.Now()
+	}
+}
+
+// Render the next block of audio, live or offline, split where the
+// sequencer ticks
+func renderBlock(out []uint32) {
+	audioMu.Lock()
+	for len(out) > 0 {
+		n := sequencer.Advance(len(out))
+		mixer.Render(out[:n])
+		out = out[n:]
 	}
+	audioMu.Unlock()
 }
 
 // Toggle audio playback
 func toggleAudio() {
-	isAudioPlaying = !isAudioPlaying
-	// Send signal to audio goroutine
-	audioPlaybackChan <- isAudioPlaying
+	if isAudioPlaying {
+		isAudioPlaying = false
+		stopSong()
+		mixer.FadeOut()
+		signalPlayback(false)
+		return
+	}
+	startAudio(0)
+}
+
+// Start the audio with the song playing from a row, or move a playing song
+// there
+func startAudio(row int) {
+	if isAudioPlaying {
+		audioMu.Lock()
+		sequencer.StartAt(project, row)
+		audioMu.Unlock()
+		return
+	}
+	isAudioPlaying = true
+	mixer.FadeIn()
+	audioMu.Lock()
+	sequencer.StartAt(project, row)
+	restartCompare()
+	audioMu.Unlock()
+	signalPlayback(true)
+}
+
+// Wake the audio loop if it is waiting. It only waits while stopped and
+// not auditioning, and checks isAudioPlaying as it renders, so a signal
+// that finds the slot full or the loop busy can be dropped.
+func signalPlayback(on bool) {
+	select {
+	case audioPlaybackChan <- on:
+	default:
+	}
 }
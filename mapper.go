@@ -0,0 +1,167 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "strings"
+
+// Builds a sample instrument from a file in the samples folder. A lone
+// sample plays chromatically from the note at the end of its name, or the
+// root saved in the file. Files named alike with a note at the end, such as
+// bass_C2.wav, bass_C3.wav and bass_F#3.wav, become one instrument with a
+// key zone each, split halfway between their roots. A digit after the note,
+// as in snare_D1_1.wav and snare_D1_2.wav, marks round-robin variations.
+const MAP_NOTE_SEP = '_'
+
+func init() {
+	addTool("MAP SAMPLES", openMapperView)
+}
+
+// Pick a sample and map it into a new instrument
+func openMapperView() {
+	names := listSampleFiles("")
+	if len(names) == 0 {
+		showStatus("NO SAMPLES", colorRed)
+		return
+	}
+	pushView(&ListView{Title: "MAP SAMPLE", Items: names, OnSelect: func(i int) {
+		slot, zones, err := mapSamples(project, names[i], names)
+		if err != nil {
+			println("Failed to map samples:", err.Error())
+			showStatus("MAP FAILED", colorRed)
+			return
+		}
+		session.Instrument = slot
+		popView()
+		showStatus("INSTR "+itoa(int(slot))+": "+itoa(zones)+" ZONES", colorGreen)
+	}, OnCursor: func(i int) {
+		auditionFile(joinPath(samplesDir, names[i]))
+	}})
+}
+
+// Wav files under the samples folder, relative to it
+func listSampleFiles(dir string) []string {
+	var names []string
+	entries, _ := storage.ReadDir(joinPath(samplesDir, dir))
+	for _, e := range entries {
+		rel := e.Name
+		if dir != "" {
+			rel = joinPath(dir, e.Name)
+		}
+		if e.Dir {
+			names = append(names, listSampleFiles(rel)...)
+		} else if strings.HasSuffix(strings.ToLower(e.Name), ".wav") {
+			names = append(names, rel)
+		}
+	}
+	return names
+}
+
+// Split a sample path into what comes before the note and the note, for
+// names like bass_C3.wav and snare_D1_2.wav
+func splitNoteName(name string) (prefix string, note uint8, ok bool) {
+	stem := name[:len(name)-len(".wav")]
+	if n := len(stem); n > 2 && stem[n-2] == MAP_NOTE_SEP && stem[n-1] >= '0' && stem[n-1] <= '9' {
+		stem = stem[:n-2]
+	}
+	i := strings.LastIndexByte(stem, MAP_NOTE_SEP)
+	if i < 0 {
+		return stem, 0, false
+	}
+	if note, ok = parseNoteName(stem[i+1:]); !ok {
+		return stem, 0, false
+	}
+	return stem[:i], note, true
+}
+
+// Create an instrument in a free slot of p from the sample name and any
+// of all that share its prefix. Returns the slot and the zone count.
+func mapSamples(p *Project, name string, all []string) (uint8, int, error) {
+	slot := p.freeInstrument()
+	if slot == EMPTY {
+		return EMPTY, 0, errProjectFull
+	}
+	type zoneFile struct {
+		name string
+		root uint8
+	}
+	prefix, root, ok := splitNoteName(name)
+	files := []zoneFile{{name, EMPTY}}
+	if ok {
+		// Siblings in root order, lowest first, with up to MAX_ROBINS
+		// variations of a note
+		files = files[:0]
+		for _, other := range all {
+			pre, r, ok := splitNoteName(other)
+			if !ok || !strings.EqualFold(pre, prefix) {
+				continue
+			}
+			at := len(files)
+			for at > 0 && files[at-1].root > r {
+				at--
+			}
+			same := 0
+			for same < at && files[at-1-same].root == r {
+				same++
+			}
+			if same == MAX_ROBINS {
+				continue
+			}
+			files = append(files, zoneFile{})
+			copy(files[at+1:], files[at:])
+			files[at] = zoneFile{other, r}
+		}
+		if len(files) > MAX_ZONES {
+			files = files[:MAX_ZONES]
+		}
+		if len(files) == 0 {
+			files = append(files, zoneFile{name, root})
+		}
+	}
+
+	// Make sure every sample fits before touching the project
+	free := 0
+	needed := 0
+	for _, s := range p.Samples {
+		if s == "" {
+			free++
+		}
+	}
+	for _, f := range files {
+		if p.sampleSlot(f.name) == EMPTY {
+			needed++
+		}
+	}
+	if needed > free {
+		return EMPTY, 0, errProjectFull
+	}
+
+	in := defaultInstrument()
+	in.Name = strings.ToUpper(baseName(prefix))
+	if len(in.Name) > INSTRUMENT_NAME_LEN {
+		in.Name = in.Name[:INSTRUMENT_NAME_LEN]
+	}
+	in.Type = INSTR_SAMPLE
+	for i, f := range files {
+		s := p.sampleIndex(f.name)
+		high := uint8(NUM_NOTES - 1)
+		for _, next := range files[i+1:] {
+			if next.root != f.root {
+				high = (f.root + next.root) / 2
+				break
+			}
+		}
+		in.Zones[i] = SampleZone{Sample: s, High: high, Root: f.root}
+		if p == project && samples[s] == nil {
+			if smp, err := loadSample(joinPath(samplesDir, f.name)); err == nil {
+				samples[s] = smp
+			} else {
+				println("Failed to load sample", f.name+":", err.Error())
+			}
+		}
+	}
+	in.NumZones = uint8(len(files))
+	in.Sample = in.Zones[0].Sample
+	p.Instruments[slot] = in
+	return slot, len(files), nil
+}
@@ -0,0 +1,95 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Peak and RMS levels of each track and the master bus, gathered by the
+// mixer while metering is on, for the UI to draw meters from without
+// touching the audio buffers. Levels cover everything mixed since they
+// were last read, so no peak is missed however often the UI reads them.
+// Tracks are measured after their inserts, groups after their level and
+// the master after the master volume.
+type Level struct {
+	Peak, RMS int32 // Full scale is 32767
+}
+
+// Levels gathered since the last read
+type meterAcc struct {
+	peak   int32
+	sum    int64 // Squares, averaged over both channels
+	frames int64
+}
+
+// Track, group and master accumulators, see Mixer.Meters
+type Meters struct {
+	Tracks [NUM_TRACKS]meterAcc
+	Groups [NUM_GROUPS]meterAcc
+	Master meterAcc
+}
+
+// Add a stereo block at a Q8 gain
+func (a *meterAcc) add(left, right []int32, gain int32) {
+	peak, sum := int32(0), int64(0)
+	for i := range left {
+		l, r := int64(left[i]), int64(right[i])
+		peak = max(peak, left[i], -left[i], right[i], -right[i])
+		sum += (l*l + r*r) >> 1
+	}
+	a.peak = max(a.peak, peak*gain>>8)
+	a.sum += sum * int64(gain) * int64(gain) >> 16
+	a.frames += int64(len(left))
+}
+
+// Levels so far, starting over
+func (a *meterAcc) read() Level {
+	lv := Level{Peak: a.peak}
+	if a.frames > 0 {
+		lv.RMS = int32(math.Sqrt(float64(a.sum) / float64(a.frames)))
+	}
+	*a = meterAcc{}
+	return lv
+}
+
+// Start gathering levels
+func startMeters() {
+	audioMu.Lock()
+	if mixer.Meters == nil {
+		mixer.Meters = &Meters{}
+	}
+	audioMu.Unlock()
+}
+
+// Stop gathering levels, saving the mixer the work
+func stopMeters() {
+	audioMu.Lock()
+	mixer.Meters = nil
+	audioMu.Unlock()
+}
+
+// Levels of every track, group and the master since the last call, all
+// zero while metering is off
+func readMeters() (tracks [NUM_TRACKS]Level, groups [NUM_GROUPS]Level, master Level) {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	m := mixer.Meters
+	if m == nil {
+		return tracks, groups, master
+	}
+	for t := range tracks {
+		tracks[t] = m.Tracks[t].read()
+	}
+	for g := range groups {
+		groups[g] = m.Groups[g].read()
+	}
+	return tracks, groups, m.Master.read()
+}
+
+// Level in dB below full scale, -99 for silence
+func levelDB(v int32) int {
+	if v <= 0 {
+		return -99
+	}
+	return max(int(math.Round(20*math.Log10(float64(v)/32767))), -99)
+}
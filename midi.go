@@ -0,0 +1,209 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "machine"
+
+// MIDI in through an optocoupler on the RX pin of the spare UART. Notes
+// play live on two parts, each an instrument on a track, split at a note:
+// the lower part gets the notes below it and the upper part the rest, or
+// every note while the split is off. Clock messages go to the clock sync.
+// Notes only sound while audio is running.
+const (
+	MIDI_BAUD      = 31250
+	MIDI_RX_PIN    = machine.Pin(1) // UART0 RX
+	MIDI_POLYPHONY = 4              // Voices per part
+
+	MIDI_NOTE_OFF = 0x80
+	MIDI_NOTE_ON  = 0x90
+	MIDI_CONTROL  = 0xb0
+	MIDI_PROGRAM  = 0xc0
+	MIDI_PRESSURE = 0xd0
+	MIDI_CLOCK    = 0xf8
+	MIDI_SYSTEM   = 0xf0 // Messages from here up carry no channel
+	MIDI_REALTIME = 0xf8 // Single bytes that may come between any others
+
+	MIDI_LOWER = 0
+	MIDI_UPPER = 1
+)
+
+var midiSplits = []uint8{EMPTY, 36, 41, 48, 53, NOTE_C4, 65, 72}
+
+// An instrument played from MIDI on a track, with the pool of voices
+// built for it
+type midiPart struct {
+	pool       *VoicePool
+	instrument uint8
+	kind       InstrumentType
+	wave       uint8
+}
+
+var (
+	midiIn     midiParser
+	midiParts  [2]midiPart
+	midiActive bool // The UART is set up
+)
+
+func init() {
+	addSetting("MIDI IN", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.MidiIn)) },
+		func(i int) { settings.MidiIn = i == 1; startMIDI() })
+	addByteSetting(byteChoice("MIDI SPLIT", func() *uint8 { return &settings.MidiSplit }, midiSplits,
+		func(v uint8) string {
+			if v == EMPTY {
+				return "OFF"
+			}
+			return noteName(v)
+		}))
+	for part, name := range []string{"LOWER", "UPPER"} {
+		addByteSetting(byteChoice("MIDI "+name+" INSTR", func() *uint8 { return &settings.MidiInstrument[part] },
+			countTo(NUM_INSTRUMENTS), hexByte))
+		addByteSetting(byteChoice("MIDI "+name+" TRACK", func() *uint8 { return &settings.MidiTrack[part] },
+			countTo(NUM_TRACKS), func(v uint8) string { return itoa(int(v) + 1) }))
+	}
+}
+
+// Add a byteChoice option to the settings screen
+func addByteSetting(it settingItem) {
+	addSetting(it.name, it.values, it.get, it.set)
+}
+
+// Values 0 to n-1
+func countTo(n int) []uint8 {
+	values := make([]uint8, n)
+	for i := range values {
+		values[i] = uint8(i)
+	}
+	return values
+}
+
+// Set up the UART once MIDI IN is turned on. Its TX pin is left alone,
+// keeping GP0 free for the clock input.
+func startMIDI() {
+	if !settings.MidiIn || midiActive {
+		return
+	}
+	err := machine.UART0.Configure(machine.UARTConfig{BaudRate: MIDI_BAUD, TX: machine.NoPin, RX: MIDI_RX_PIN})
+	if err != nil {
+		println("Failed to start MIDI in:", err.Error())
+		return
+	}
+	midiActive = true
+}
+
+// Handle the MIDI received since the last call. Called from the main
+// loop, so clock pulses are counted per call rather than timed each.
+func pollMIDI() {
+	if !settings.MidiIn || !midiActive {
+		return
+	}
+	var clocks int32
+	for machine.UART0.Buffered() > 0 {
+		b, err := machine.UART0.ReadByte()
+		if err != nil {
+			break
+		}
+		if b >= MIDI_REALTIME {
+			if b == MIDI_CLOCK {
+				clocks++
+			}
+			continue
+		}
+		if msg, ok := midiIn.feed(b); ok {
+			midiMessage(msg)
+		}
+	}
+	syncPulses(SYNC_MIDI, clocks)
+}
+
+// Splits the byte stream into channel messages, following running status
+type midiParser struct {
+	status uint8
+	data   [2]uint8
+	n      int
+}
+
+// Add a byte, returning a whole note, control change or pitch bend
+// message when it completes one
+func (m *midiParser) feed(b byte) (msg [3]uint8, ok bool) {
+	if b&0x80 != 0 {
+		m.status, m.n = b, 0
+		if b >= MIDI_SYSTEM {
+			m.status = 0 // System messages are skipped and end running status
+		}
+		return msg, false
+	}
+	if m.status == 0 {
+		return msg, false
+	}
+	m.data[m.n] = b
+	m.n++
+	kind := m.status & 0xf0
+	if kind == MIDI_PROGRAM || kind == MIDI_PRESSURE {
+		m.n = 0 // One data byte, nothing to play
+		return msg, false
+	}
+	if m.n < 2 {
+		return msg, false
+	}
+	m.n = 0
+	if kind != MIDI_NOTE_ON && kind != MIDI_NOTE_OFF && kind != MIDI_CONTROL && kind != MIDI_BEND {
+		return msg, false
+	}
+	return [3]uint8{m.status, m.data[0], m.data[1]}, true
+}
+
+// Play a note message on the part the split gives it, on any channel.
+// Pitch bend moves both parts, and control changes their macro knobs.
+func midiMessage(msg [3]uint8) {
+	if msg[0]&0xf0 == MIDI_BEND {
+		midiBend(int(msg[1]) | int(msg[2])<<7)
+		return
+	}
+	if msg[0]&0xf0 == MIDI_CONTROL {
+		midiKnob(msg[1], msg[2])
+		return
+	}
+	note, velocity := msg[1], msg[2]
+	if msg[0]&0xf0 == MIDI_NOTE_OFF {
+		velocity = 0
+	}
+	part := MIDI_UPPER
+	if settings.MidiSplit != EMPTY && note < settings.MidiSplit {
+		part = MIDI_LOWER
+	}
+	track := int(settings.MidiTrack[part] % NUM_TRACKS)
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	if velocity == 0 {
+		if p := midiParts[part].pool; p != nil && mixer.Tracks[track].Voice == Voice(p) {
+			p.Release(note)
+		}
+		return
+	}
+	if p := midiPartVoice(part, track); p != nil {
+		p.NoteOn(note, velocity)
+	}
+}
+
+// The part's voices, built again and put on its track when the
+// instrument or track has changed. Called with audioMu held.
+func midiPartVoice(part, track int) *VoicePool {
+	mp := &midiParts[part]
+	slot := settings.MidiInstrument[part] % NUM_INSTRUMENTS
+	in := &project.Instruments[slot]
+	if mp.pool != nil && mixer.Tracks[track].Voice == Voice(mp.pool) &&
+		mp.instrument == slot && mp.kind == in.Type && mp.wave == in.Wave {
+		return mp.pool
+	}
+	voices := make([]Voice, MIDI_POLYPHONY)
+	for i := range voices {
+		if voices[i] = newInstrumentVoice(in); voices[i] == nil {
+			return nil
+		}
+	}
+	*mp = midiPart{pool: newVoicePool(voices, STEAL_OLDEST), instrument: slot, kind: in.Type, wave: in.Wave}
+	mixer.SetVoice(track, mp.pool)
+	return mp.pool
+}
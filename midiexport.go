@@ -0,0 +1,231 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Standard MIDI file export, for previewing a song on a computer. Each
+// mixer track becomes a file track on its own channel, with a program
+// change whenever the instrument changes; drum instruments play on the
+// General MIDI drum channel instead. Notes last until the track's next
+// note or note off.
+const (
+	SMF_PPQN       = 96
+	SMF_VELOCITY   = 100
+	SMF_DRUMS      = 9    // Channel of the General MIDI drum kit
+	MIDI_DRUMS     = 0x80 // Program map value for the drum channel
+	SMF_META       = 0xff
+	SMF_META_TEMPO = 0x51
+	SMF_META_END   = 0x2f
+)
+
+// General MIDI families, the first program of each, for the map editor
+var (
+	gmFamilies      = []uint8{EMPTY, 0, 8, 16, 24, 32, 40, 48, 56, 64, 72, 80, 88, 96, 104, 112, 120, MIDI_DRUMS}
+	gmFamilyNames   = []string{"AUTO", "PIANO", "CHROM PERC", "ORGAN", "GUITAR", "BASS", "STRINGS", "ENSEMBLE", "BRASS", "REED", "PIPE", "SYNTH LEAD", "SYNTH PAD", "SYNTH FX", "ETHNIC", "PERCUSSIVE", "SOUND FX", "DRUMS"}
+	gmDrumNotes     = [NUM_DRUMS]uint8{DRUM_KICK: 36, DRUM_SNARE: 38, DRUM_HAT: 42}
+	gmOscPrograms   = []uint8{OSC_PULSE: 80, OSC_SAW: 81, OSC_TRIANGLE: 80, OSC_NOISE: 122}
+	gmWaveProgram   = uint8(88) // New age pad
+	gmFMProgram     = uint8(5)  // Electric piano 2
+	gmGrainProgram  = uint8(94) // Halo pad
+	gmPluckProgram  = uint8(24) // Nylon guitar
+	gmSampleProgram = uint8(0)  // Acoustic grand piano
+)
+
+// Program an instrument exports as, from the map or guessed from its
+// engine, MIDI_DRUMS for the drum channel
+func (p *Project) midiProgram(slot uint8) uint8 {
+	if slot >= NUM_INSTRUMENTS {
+		return gmSampleProgram
+	}
+	if v := p.MIDIPrograms[slot]; v != EMPTY {
+		return v
+	}
+	in := &p.Instruments[slot]
+	switch in.Type {
+	case INSTR_DRUM:
+		return MIDI_DRUMS
+	case INSTR_OSCILLATOR:
+		return gmOscPrograms[int(in.Wave)%len(gmOscPrograms)]
+	case INSTR_WAVETABLE:
+		return gmWaveProgram
+	case INSTR_FM:
+		return gmFMProgram
+	case INSTR_GRANULAR:
+		return gmGrainProgram
+	case INSTR_PLUCK:
+		return gmPluckProgram
+	}
+	return gmSampleProgram
+}
+
+// Events of one file track, kept in time order
+type smfTrack struct {
+	buf  []byte
+	last int // Tick of the previous event
+}
+
+// Add an event at a tick no earlier than the previous one
+func (t *smfTrack) event(tick int, data ...byte) {
+	t.buf = appendVarLen(t.buf, uint32(tick-t.last))
+	t.buf = append(t.buf, data...)
+	t.last = tick
+}
+
+// MIDI variable length quantity, 7 bits a byte, most significant first
+func appendVarLen(b []byte, v uint32) []byte {
+	var tmp [5]byte
+	n := len(tmp) - 1
+	tmp[n] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		n--
+		tmp[n] = byte(v&0x7f) | 0x80
+	}
+	return append(b, tmp[n:]...)
+}
+
+func appendBE32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// What a track is sounding while exporting
+type smfVoice struct {
+	channel, note uint8 // note EMPTY when silent
+	instrument    uint8
+	program       uint8
+}
+
+// Encode the song as a type 1 standard MIDI file: a tempo track, then a
+// track per mixer track
+func encodeSMF(p *Project) []byte {
+	var tempo smfTrack
+	var tracks [NUM_TRACKS]smfTrack
+	var voices [NUM_TRACKS]smfVoice
+	for t := range voices {
+		voices[t] = smfVoice{note: EMPTY, instrument: EMPTY, program: EMPTY}
+	}
+	stop := func(t, tick int) {
+		if v := &voices[t]; v.note != EMPTY {
+			tracks[t].event(tick, MIDI_NOTE_OFF|v.channel, v.note, 0)
+			v.note = EMPTY
+		}
+	}
+	tick, lastTempo := 0, uint16(0)
+	p.walkSong(func(r, e, s int) {
+		bpm, groove := p.slotTiming(r, e)
+		if bpm = playedTempo(bpm); bpm != lastTempo {
+			us := uint32(60_000_000 / int(bpm))
+			tempo.event(tick, SMF_META, SMF_META_TEMPO, 3, byte(us>>16), byte(us>>8), byte(us))
+			lastTempo = bpm
+		}
+		for t, c := range p.Song[r] {
+			if c == EMPTY || int(c) >= NUM_CHAINS {
+				continue
+			}
+			entry := p.Chains[c].Entries[e]
+			if int(entry.Phrase) >= NUM_PHRASES {
+				continue
+			}
+			p.smfStep(&tracks[t], &voices[t], t, tick, &p.Phrases[entry.Phrase].Steps[s], entry.Transpose, stop)
+		}
+		tick += smfStepTicks(groove, s)
+	})
+	for t := range tracks {
+		stop(t, tick)
+	}
+
+	out := append([]byte{}, "MThd"...)
+	out = appendBE32(out, 6)
+	out = append(out, 0, 1, 0, NUM_TRACKS+1, SMF_PPQN>>8, SMF_PPQN&0xff)
+	tempo.event(tick, SMF_META, SMF_META_END, 0)
+	out = append(append(out, "MTrk"...), appendBE32(nil, uint32(len(tempo.buf)))...)
+	out = append(out, tempo.buf...)
+	for t := range tracks {
+		tracks[t].event(tick, SMF_META, SMF_META_END, 0)
+		out = append(append(out, "MTrk"...), appendBE32(nil, uint32(len(tracks[t].buf)))...)
+		out = append(out, tracks[t].buf...)
+	}
+	return out
+}
+
+// Ticks step s lasts at a groove, the MIDI side of stepLength
+func smfStepTicks(groove uint8, s int) int {
+	if groove < GROOVE_STRAIGHT || groove > GROOVE_MAX {
+		groove = GROOVE_STRAIGHT
+	}
+	pair := 2 * SMF_PPQN / STEPS_PER_BEAT
+	first := pair * int(groove) / 100
+	if s%2 == 0 {
+		return first
+	}
+	return pair - first
+}
+
+// Write the events of one step on a track
+func (p *Project) smfStep(tr *smfTrack, v *smfVoice, t, tick int, st *Step, transpose int8, stop func(t, tick int)) {
+	if st.Instrument != EMPTY {
+		v.instrument = st.Instrument
+	}
+	switch {
+	case st.Note == NOTE_OFF:
+		stop(t, tick)
+		return
+	case st.Note == EMPTY:
+		return
+	}
+	stop(t, tick)
+	note := uint8(min(max(int(st.Note)+int(transpose), 0), 127))
+	program := p.midiProgram(v.instrument)
+	v.channel = uint8(t)
+	if program == MIDI_DRUMS {
+		v.channel = SMF_DRUMS
+		if v.instrument < NUM_INSTRUMENTS && p.Instruments[v.instrument].Type == INSTR_DRUM {
+			note = gmDrumNotes[p.Instruments[v.instrument].Wave%uint8(NUM_DRUMS)]
+		}
+	} else if program != v.program {
+		tr.event(tick, MIDI_PROGRAM|v.channel, program&0x7f)
+		v.program = program
+	}
+	tr.event(tick, MIDI_NOTE_ON|v.channel, note, SMF_VELOCITY)
+	v.note = note
+}
+
+func init() {
+	addTool("EXPORT MIDI", exportMIDI)
+	addTool("MIDI EXPORT MAP", openMIDIMapView)
+}
+
+// Write the song to rendersDir as a MIDI file named after the project
+func exportMIDI() {
+	path := joinPath(rendersDir, project.Name+".mid")
+	err := mkdirAll(rendersDir)
+	if err == nil {
+		err = writeFile(path, encodeSMF(project))
+	}
+	if err != nil {
+		println("Failed to export MIDI:", err.Error())
+		showStatus("EXPORT FAILED", colorRed)
+		return
+	}
+	showStatus("SAVED "+baseName(path), colorGreen)
+}
+
+// Step the General MIDI family each instrument exports as
+func openMIDIMapView() {
+	var items []settingItem
+	for i := range project.MIDIPrograms {
+		name := project.Instruments[i].Name
+		if name == "" {
+			name = hexByte(uint8(i))
+		}
+		items = append(items, byteChoice(name, func() *uint8 { return &project.MIDIPrograms[i] }, gmFamilies,
+			func(v uint8) string {
+				for j, f := range gmFamilies {
+					if f == v {
+						return gmFamilyNames[j]
+					}
+				}
+				return ""
+			}))
+	}
+	openParamList("MIDI EXPORT MAP", items, nil)
+}
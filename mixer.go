@@ -0,0 +1,473 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Mixer configuration
+const (
+	NUM_TRACKS = 8
+	BLOCK_SIZE = 256 // Frames rendered per audio block
+
+	PAN_CENTER = 128
+
+	// Fades on start, stop and voice cuts last a few ms so they don't click
+	GAIN_SHIFT = 12
+	GAIN_UNITY = 1 << GAIN_SHIFT
+	FADE_MS    = 5
+
+	// The master bus is linear up to this level and bends smoothly
+	// towards full scale above it
+	SOFT_CLIP_KNEE = 24576
+
+	// Most insert latency, in frames, the mixer lines the tracks up for
+	MAX_LATENCY = 512
+)
+
+// Sound source played on a mixer track
+type Voice interface {
+	// Add the next len(out) mono samples into out
+	Render(out []int32)
+
+	// Start a MIDI note (0-127) at a velocity (1-127). Velocity 0 is a
+	// note off, as in MIDI.
+	NoteOn(note, velocity uint8)
+
+	// Stop the playing note
+	NoteOff()
+}
+
+// A voice that can tell when its note has finished, release and all
+type Sounder interface {
+	// Whether Render still adds anything
+	Sounding() bool
+}
+
+// Whether a voice may still be heard; voices that can't tell always may
+func sounding(v Voice) bool {
+	s, ok := v.(Sounder)
+	return !ok || s.Sounding()
+}
+
+// Level scaled by note velocity. Voices set up without NoteOn have
+// velocity 0 and play at their full Level.
+func velocityLevel(level, velocity uint8) int32 {
+	if velocity == 0 {
+		return int32(level)
+	}
+	return int32(level) * int32(velocity) / 127
+}
+
+// Stereo effect processing a block in place
+type Effect interface {
+	Process(left, right []int32)
+}
+
+// Effect whose output lags its input, such as one that looks ahead
+type LatentEffect interface {
+	Effect
+
+	// Frames of lag at the current sampleRate
+	Latency() int
+}
+
+// One mixer channel. Volume, Pan and Send are 0-255, Pan 128 is center.
+// The EQ runs before the inserts and costs nothing while flat. Tracks
+// whose inserts lag less than others are delayed to match, see
+// Mixer.Compensate. Route, Mute and Solo decide whether the track is
+// heard, see route.go. Group is the group bus it plays into, 0 for none,
+// see group.go.
+type MixerTrack struct {
+	Voice   Voice
+	Volume  uint8
+	Pan     uint8
+	Send    uint8
+	EQ      EQ
+	Inserts []Effect
+	Trim    uint8 // Gain after Volume, 255 for none
+	Route   Route
+	Mute    bool
+	Solo    bool
+	Group   uint8
+
+	fade    gainRamp
+	cutting bool // Drop the voice once faded out
+	delay   delayLine
+}
+
+// Frames the track's inserts delay it by
+func (t *MixerTrack) latency() int {
+	frames := 0
+	for _, fx := range t.Inserts {
+		if l, ok := fx.(LatentEffect); ok {
+			frames += l.Latency()
+		}
+	}
+	return frames
+}
+
+// Fixed stereo delay, empty for none
+type delayLine struct {
+	buf [2][]int32
+	pos int
+}
+
+// Change the delay, starting from silence when it does
+func (d *delayLine) resize(frames int) {
+	if len(d.buf[0]) == frames {
+		return
+	}
+	d.buf, d.pos = [2][]int32{}, 0
+	if frames > 0 {
+		d.buf = [2][]int32{make([]int32, frames), make([]int32, frames)}
+	}
+}
+
+func (d *delayLine) Process(left, right []int32) {
+	n := len(d.buf[0])
+	if n == 0 {
+		return
+	}
+	bl, br := d.buf[0], d.buf[1]
+	for i := range left {
+		left[i], bl[d.pos] = bl[d.pos], left[i]
+		right[i], br[d.pos] = br[d.pos], right[i]
+		if d.pos++; d.pos == n {
+			d.pos = 0
+		}
+	}
+}
+
+// Gain change per sample while fading, recomputed with the sample rate
+var fadeStep int32 = GAIN_UNITY/(SAMPLE_RATE*FADE_MS/1000) + 1
+
+// Gain sliding linearly towards a target, GAIN_UNITY is full level
+type gainRamp struct {
+	gain, target int32
+}
+
+// Step towards the target, returning the gain for the next sample
+func (g *gainRamp) next() int32 {
+	if g.gain < g.target {
+		g.gain = min(g.gain+fadeStep, g.target)
+	} else if g.gain > g.target {
+		g.gain = max(g.gain-fadeStep, g.target)
+	}
+	return g.gain
+}
+
+// Whether the gain has reached full level and stays there
+func (g *gainRamp) unity() bool {
+	return g.gain == GAIN_UNITY && g.target == GAIN_UNITY
+}
+
+// Sums the tracks into the master bus. Tracks feed the send effect through
+// their Send level; its wet output is added back before the master effects.
+// The Ducker, when keyed from a track, compresses everything but that track
+// by its level. The master bus ends in a DC blocker, then the soft clipper
+// or, when set, the Limiter. Width sets the stereo width after the DC
+// blocker, see width.go. The Cue bus can take the place of the mix after
+// that. Peaks are gathered into Analysis while it is set,
+// and levels into Meters. Crossfeed comes after the meters, for
+// headphones. Bypass names a bus effect to skip, see quality.go. Tracks
+// in a group are summed on its bus first, see group.go.
+type Mixer struct {
+	Tracks        [NUM_TRACKS]MixerTrack
+	Groups        [NUM_GROUPS]MixerGroup
+	MasterVolume  uint8
+	Width         uint8
+	SendEffect    Effect
+	MasterEffects []Effect
+	Ducker        *Compressor
+	Limiter       *Limiter
+	Analysis      *GainAnalysis
+	Cue           *CueBus
+	Meters        *Meters
+	Crossfeed     *Crossfeed
+	Bypass        Effect
+
+	costs []effectCost // Of the bus effects, see runEffect
+	fade  gainRamp     // Output starts silent until FadeIn
+	dc    DCBlocker
+
+	mono   [BLOCK_SIZE]int32
+	trackL [BLOCK_SIZE]int32
+	trackR [BLOCK_SIZE]int32
+	left   [BLOCK_SIZE]int32
+	right  [BLOCK_SIZE]int32
+	sendL  [BLOCK_SIZE]int32
+	sendR  [BLOCK_SIZE]int32
+}
+
+var mixer = newMixer()
+
+// Create a mixer with all tracks at full volume and centered
+func newMixer() *Mixer {
+	m := &Mixer{MasterVolume: 255, Width: WIDTH_NORMAL}
+	for i := range m.Tracks {
+		m.Tracks[i].Volume = 255
+		m.Tracks[i].Trim = 255
+		m.Tracks[i].Pan = PAN_CENTER
+		m.Tracks[i].fade = gainRamp{GAIN_UNITY, GAIN_UNITY}
+	}
+	for g := range m.Groups {
+		m.Groups[g].Volume = 255
+	}
+	return m
+}
+
+// Ramp the output up from silence
+func (m *Mixer) FadeIn() {
+	m.fade.target = GAIN_UNITY
+}
+
+// Ramp the output down to silence
+func (m *Mixer) FadeOut() {
+	m.fade.target = 0
+}
+
+// Whether the output has faded out completely
+func (m *Mixer) Silent() bool {
+	return m.fade.gain == 0 && m.fade.target == 0
+}
+
+// Fade a track's voice out and remove it
+func (m *Mixer) CutTrack(t int) {
+	m.Tracks[t].fade.target = 0
+	m.Tracks[t].cutting = true
+}
+
+// Put a voice on a track, cancelling any cut in progress
+func (m *Mixer) SetVoice(t int, v Voice) {
+	track := &m.Tracks[t]
+	track.Voice = v
+	track.cutting = false
+	track.fade = gainRamp{GAIN_UNITY, GAIN_UNITY}
+}
+
+// Delay every track to line up with the one whose inserts lag most, up to
+// MAX_LATENCY frames, so transients stay aligned in the mix. Call with
+// audioMu held whenever inserts or the sample rate change.
+func (m *Mixer) Compensate() {
+	most := 0
+	for t := range m.Tracks {
+		most = max(most, min(m.Tracks[t].latency(), MAX_LATENCY))
+	}
+	for t := range m.Tracks {
+		track := &m.Tracks[t]
+		track.delay.resize(max(most-track.latency(), 0))
+	}
+}
+
+// A track volume after its trim
+func trimmed(volume, trim uint8) uint8 {
+	return uint8(int(volume) * (int(trim) + 1) >> 8)
+}
+
+// Left and right Q8 gains for a track
+func panGains(volume, pan uint8) (int32, int32) {
+	l := 2 * (255 - int32(pan))
+	r := 2 * int32(pan)
+	if l > 255 {
+		l = 255
+	}
+	if r > 255 {
+		r = 255
+	}
+	return int32(volume) * l >> 8, int32(volume) * r >> 8
+}
+
+// Render the next block of stereo frames into out
+func (m *Mixer) Render(out []uint32) {
+	n := len(out)
+	if n > BLOCK_SIZE {
+		n = BLOCK_SIZE
+	}
+	left, right := m.left[:n], m.right[:n]
+	sendL, sendR := m.sendL[:n], m.sendR[:n]
+	clear(left)
+	clear(right)
+	clear(sendL)
+	clear(sendR)
+
+	// The Ducker's key track is mixed last, after the rest is ducked, and
+	// its group with it
+	ducker, key, keyGroup := m.Ducker, -1, -1
+	if ducker != nil && int(ducker.Key) < NUM_TRACKS {
+		key, keyGroup = int(ducker.Key), m.trackGroup(int(ducker.Key))
+	}
+	for t := range m.Tracks {
+		if t != key && m.renderTrack(t, n) {
+			m.mixTrack(t, left, right)
+		}
+	}
+	keyL, keyR := m.trackL[:n], m.trackR[:n]
+	if key >= 0 {
+		if !m.renderTrack(key, n) {
+			clear(keyL)
+			clear(keyR)
+		} else if keyGroup >= 0 {
+			m.mixTrack(key, left, right)
+		}
+	}
+	for g := range m.Groups {
+		if g != keyGroup {
+			m.mixGroup(g, left, right)
+		}
+	}
+
+	if m.SendEffect != nil && m.runEffect(m.SendEffect, sendL, sendR) {
+		for i := range left {
+			left[i] += sendL[i]
+			right[i] += sendR[i]
+		}
+	}
+
+	if key >= 0 {
+		ducker.Duck(left, right, keyL, keyR)
+		if keyGroup >= 0 {
+			m.mixGroup(keyGroup, left, right)
+		} else {
+			for i := range left {
+				left[i] += keyL[i]
+				right[i] += keyR[i]
+			}
+		}
+	}
+
+	for _, fx := range m.MasterEffects {
+		m.runEffect(fx, left, right)
+	}
+	m.dc.Process(left, right)
+	if m.Width != WIDTH_NORMAL {
+		stereoWidth(left, right, m.Width)
+	}
+	if m.Cue != nil {
+		m.Cue.Mix(left, right)
+	}
+	if m.Analysis != nil {
+		m.Analysis.Master = peakOf(m.Analysis.Master, left, right)
+	}
+	if m.Meters != nil {
+		m.Meters.Master.add(left, right, int32(m.MasterVolume))
+	}
+	if m.Crossfeed != nil {
+		m.Crossfeed.Process(left, right)
+	}
+
+	master := int32(m.MasterVolume)
+	if m.Limiter != nil {
+		for i := range left {
+			g := master * m.fade.next() >> GAIN_SHIFT
+			left[i], right[i] = left[i]*g>>8, right[i]*g>>8
+		}
+		m.Limiter.Process(left, right)
+		for i := range out[:n] {
+			out[i] = uint32(uint16(clip16(right[i]))) | uint32(uint16(clip16(left[i])))<<16
+		}
+		return
+	}
+	if m.fade.unity() {
+		for i := range out[:n] {
+			out[i] = packStereo(left[i]*master>>8, right[i]*master>>8)
+		}
+		return
+	}
+	for i := range out[:n] {
+		g := master * m.fade.next() >> GAIN_SHIFT
+		out[i] = packStereo(left[i]*g>>8, right[i]*g>>8)
+	}
+}
+
+// Render a track into trackL and trackR and add it to the send bus.
+// Returns false when the track has no voice.
+func (m *Mixer) renderTrack(t, n int) bool {
+	track := &m.Tracks[t]
+	if track.Voice == nil || track.Route != ROUTE_MIX {
+		return false
+	}
+	mono, trackL, trackR := m.mono[:n], m.trackL[:n], m.trackR[:n]
+	clear(mono)
+	track.Voice.Render(mono)
+	if !track.fade.unity() {
+		for i := range mono {
+			mono[i] = mono[i] * track.fade.next() >> GAIN_SHIFT
+		}
+		if track.cutting && track.fade.gain == 0 {
+			m.SetVoice(t, nil)
+		}
+	}
+	if !m.audible(t) {
+		// Muted, or another track soloed: the voice plays on unheard
+		return false
+	}
+
+	gl, gr := panGains(trimmed(track.Volume, track.Trim), track.Pan)
+	for i, s := range mono {
+		trackL[i] = s * gl >> 8
+		trackR[i] = s * gr >> 8
+	}
+	track.EQ.Process(trackL, trackR)
+	for _, fx := range track.Inserts {
+		fx.Process(trackL, trackR)
+	}
+	track.delay.Process(trackL, trackR)
+	if m.Analysis != nil {
+		m.Analysis.Tracks[t] = peakOf(m.Analysis.Tracks[t], trackL, trackR)
+	}
+	if m.Meters != nil {
+		m.Meters.Tracks[t].add(trackL, trackR, 256)
+	}
+
+	if send := int32(track.Send); send != 0 {
+		for i := range trackL {
+			m.sendL[i] += trackL[i] * send >> 8
+			m.sendR[i] += trackR[i] * send >> 8
+		}
+	}
+	return true
+}
+
+// Saturate a mixed sample to the int16 range
+func clip16(x int32) int16 {
+	if x > 32767 {
+		return 32767
+	}
+	if x < -32768 {
+		return -32768
+	}
+	return int16(x)
+}
+
+// Clamp a value to 0-255
+func clampByte(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// Saturate a sample to the int16 range without the hard edge of clip16.
+// Above the knee the excess is squashed by x/(x+headroom), approaching but
+// never passing full scale.
+func softClip(x int32) int16 {
+	const headroom = 32767 - SOFT_CLIP_KNEE
+	const maxOver = 1 << 17 // Keeps over*headroom in range
+	if x > SOFT_CLIP_KNEE {
+		over := min(x-SOFT_CLIP_KNEE, maxOver)
+		return int16(SOFT_CLIP_KNEE + over*headroom/(over+headroom))
+	}
+	if x < -SOFT_CLIP_KNEE {
+		over := min(-SOFT_CLIP_KNEE-x, maxOver)
+		return int16(-SOFT_CLIP_KNEE - over*headroom/(over+headroom))
+	}
+	return int16(x)
+}
+
+// Pack a frame into an I2S word through the soft clipper, left channel in
+// the upper half
+func packStereo(l, r int32) uint32 {
+	return uint32(uint16(softClip(r))) | (uint32(uint16(softClip(l))) << 16)
+}
@@ -0,0 +1,146 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "time"
+
+// Track mixer: a row per track with its volume, pan and send, and its peak
+// in dB over the last METER_INTERVAL. Edits work as in the table editor,
+// EDIT+UP/DOWN stepping by 16, and go through setTrackParam, so with
+// MOTION RECORD on they are recorded into the phrase the track is playing.
+// Values follow motions and scripts as they play. ALT+ENTER mutes the
+// track, shown by an M. The meters run while the mixer is open.
+const (
+	MIXER_COL_VOLUME = iota
+	MIXER_COL_PAN
+	MIXER_COL_SEND
+	NUM_MIXER_COLS
+)
+
+const METER_INTERVAL = 100 * time.Millisecond // Between meter reads
+
+// Motion parameter of each column
+var mixerColumnParams = [NUM_MIXER_COLS]MotionParam{MOTION_VOLUME, MOTION_PAN, MOTION_SEND}
+
+func init() {
+	addTool("TRACK MIXER", openTrackMixer)
+}
+
+type trackMixerView struct {
+	row, col int
+	shown    [NUM_TRACKS][NUM_MIXER_COLS]uint8 // Values last drawn
+	peaks    [NUM_TRACKS]int                   // dB last read
+	metered  time.Time                         // When the meters were last read
+}
+
+func openTrackMixer() {
+	v := &trackMixerView{}
+	for t := range v.peaks {
+		v.peaks[t] = levelDB(0)
+	}
+	startMeters()
+	pushView(v)
+}
+
+// A peak as three characters, dashes for silence
+func peakText(db int) string {
+	if db <= levelDB(0) {
+		return "---"
+	}
+	s := itoa(db)
+	for len(s) < 3 {
+		s = " " + s
+	}
+	return s
+}
+
+// A track's values, in column order
+func mixerRow(t int) (values [NUM_MIXER_COLS]uint8) {
+	for c, param := range mixerColumnParams {
+		values[c] = *trackParam(t, param)
+	}
+	return values
+}
+
+func (v *trackMixerView) Tick() {
+	if time.Since(v.metered) >= METER_INTERVAL {
+		v.metered = time.Now()
+		tracks, _, _ := readMeters()
+		for t := range tracks {
+			if db := levelDB(tracks[t].Peak); db != v.peaks[t] {
+				v.peaks[t] = db
+				redrawView()
+			}
+		}
+	}
+	for t := range v.shown {
+		if mixerRow(t) != v.shown[t] {
+			redrawView()
+			return
+		}
+	}
+}
+
+func (v *trackMixerView) Draw() {
+	title := "TRACK MIXER"
+	if motionRecording {
+		title += " REC"
+	}
+	drawText(0, 0, title, colorGreen)
+	drawText(3, 1, "VOL PAN SND DB", colorText)
+	for t := 0; t < NUM_TRACKS && t+2 < viewRows(); t++ {
+		row := t + 2
+		v.shown[t] = mixerRow(t)
+		if t == v.row {
+			drawHighlight(3+v.col*4, row, 2, colorBlue)
+		}
+		text := itoa(t + 1)
+		for _, value := range v.shown[t] {
+			text += "  " + hexByte(value)
+		}
+		text += " " + peakText(v.peaks[t])
+		if mixer.Tracks[t].Mute {
+			text += " M"
+		}
+		drawText(0, row, text, colorText)
+	}
+}
+
+func (v *trackMixerView) Describe() string {
+	return "TRACK " + itoa(v.row+1) + " " + motionParamNames[mixerColumnParams[v.col]] + " " +
+		hexByte(*trackParam(v.row, mixerColumnParams[v.col]))
+}
+
+func (v *trackMixerView) HandleAction(a Action) {
+	switch a {
+	case ACTION_CURSOR_UP:
+		if v.row > 0 {
+			v.row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if v.row < NUM_TRACKS-1 {
+			v.row++
+		}
+	case ACTION_CURSOR_LEFT:
+		if v.col == 0 {
+			stopMeters()
+			popView()
+			return
+		}
+		v.col--
+	case ACTION_CURSOR_RIGHT:
+		if v.col < NUM_MIXER_COLS-1 {
+			v.col++
+		}
+	case ACTION_MUTE:
+		toggleMute(v.row)
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		delta, big := editDelta(a)
+		param := mixerColumnParams[v.col]
+		setTrackParam(v.row, param, stepByte(*trackParam(v.row, param), delta, big, 16, 255))
+	default:
+		return
+	}
+	redrawView()
+}
@@ -0,0 +1,182 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Motion sequences, as on an Electribe: with MOTION RECORD on, turning a
+// track parameter in the TRACK MIXER while a phrase plays stores the value
+// at the step playing, and the phrase plays the values back on every loop.
+// Motions belong to the phrase, so they follow it onto any track.
+type MotionParam uint8
+
+const (
+	MOTION_VOLUME MotionParam = iota
+	MOTION_PAN
+	MOTION_SEND
+	NUM_MOTION_PARAMS
+)
+
+var motionParamNames = [NUM_MOTION_PARAMS]string{"VOLUME", "PAN", "SEND"}
+
+// A track's place in the song, Phrase EMPTY while it isn't playing
+type StepPos struct {
+	Phrase, Step uint8
+}
+
+var (
+	// Where each track is, for recording motions, set by the sequencer
+	trackSteps = func() (s [NUM_TRACKS]StepPos) {
+		for t := range s {
+			s[t].Phrase = EMPTY
+		}
+		return s
+	}()
+
+	motionRecording bool
+)
+
+func init() {
+	addTool("MOTION RECORD", func() {
+		motionRecording = !motionRecording
+		if motionRecording {
+			showStatus("MOTION RECORD ON", colorRed)
+		} else {
+			showStatus("MOTION RECORD OFF", colorGreen)
+		}
+	})
+	addTool("MOTION LANES", openMotionLanesView)
+}
+
+// Mixer value a motion parameter sets on a track
+func trackParam(t int, param MotionParam) *uint8 {
+	track := &mixer.Tracks[t]
+	switch param {
+	case MOTION_PAN:
+		return &track.Pan
+	case MOTION_SEND:
+		return &track.Send
+	}
+	return &track.Volume
+}
+
+// A phrase's motion for a parameter, taking a free slot for it when add
+// is set. Nil when there is none or no slot is free.
+func (p *Project) motion(phrase uint8, param MotionParam, add bool) *Motion {
+	var free *Motion
+	for i := range p.Motions {
+		m := &p.Motions[i]
+		if m.Phrase == phrase && m.Param == param {
+			return m
+		}
+		if m.Phrase == EMPTY && free == nil {
+			free = m
+		}
+	}
+	if !add || free == nil {
+		return nil
+	}
+	*free = Motion{Phrase: phrase, Param: param}
+	return free
+}
+
+// Change a track parameter by hand, recording it into the playing phrase's
+// motion while MOTION RECORD is on
+func setTrackParam(t int, param MotionParam, value uint8) {
+	*trackParam(t, param) = value
+	pos := trackSteps[t]
+	if !motionRecording || int(pos.Phrase) >= NUM_PHRASES || pos.Step >= PHRASE_STEPS {
+		return
+	}
+	if m := project.motion(pos.Phrase, param, true); m != nil {
+		m.Values[pos.Step] = value
+		m.Set |= 1 << pos.Step
+	}
+}
+
+// Play the motions of a phrase at a step on the track playing it
+func applyMotions(p *Project, t int, phrase, step uint8) {
+	for i := range p.Motions {
+		m := &p.Motions[i]
+		if m.Phrase == phrase && m.Set&(1<<step) != 0 && m.Param < NUM_MOTION_PARAMS {
+			*trackParam(t, m.Param) = m.Values[step]
+		}
+	}
+}
+
+// One line per motion; ENTER opens its lane, a value per step
+func openMotionLanesView() {
+	list := &ListView{Title: "MOTION LANES"}
+	var slots []int
+	refresh := func() {
+		list.Items, slots = list.Items[:0], slots[:0]
+		for i, m := range project.Motions {
+			if m.Phrase == EMPTY || m.Param >= NUM_MOTION_PARAMS {
+				continue
+			}
+			steps := 0
+			for s := 0; s < PHRASE_STEPS; s++ {
+				if m.Set&(1<<s) != 0 {
+					steps++
+				}
+			}
+			list.Items = append(list.Items, "PHRASE "+itoa(int(m.Phrase))+" "+
+				motionParamNames[m.Param]+" "+itoa(steps)+" STEPS")
+			slots = append(slots, i)
+		}
+		if len(list.Items) == 0 {
+			list.Items = append(list.Items, "NO MOTIONS")
+		}
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		if i >= len(slots) {
+			return
+		}
+		openMotionLane(&project.Motions[slots[i]], refresh)
+	}
+	pushView(list)
+}
+
+// Values a lane step steps through, in 16ths of the range
+const MOTION_LANE_LEVELS = 17
+
+// Step a motion's values in sixteenths of the range or clear them; a
+// motion with no values left is removed
+func openMotionLane(m *Motion, changed func()) {
+	values := []string{"--"}
+	for l := 0; l < MOTION_LANE_LEVELS; l++ {
+		values = append(values, hexByte(motionLevel(l)))
+	}
+	var items []settingItem
+	for s := 0; s < PHRASE_STEPS; s++ {
+		bit := uint16(1) << s
+		items = append(items, settingItem{"STEP " + itoa(s), values,
+			func() int {
+				if m.Set&bit == 0 {
+					return 0
+				}
+				return 1 + (int(m.Values[s])*(MOTION_LANE_LEVELS-1)+127)/255
+			},
+			func(i int) {
+				if i == 0 {
+					m.Set &^= bit
+					return
+				}
+				m.Set |= bit
+				m.Values[s] = motionLevel(i - 1)
+			}})
+	}
+	phrase := m.Phrase
+	openParamList("PHRASE "+itoa(int(phrase))+" "+motionParamNames[m.Param], items, func() {
+		m.Phrase = phrase
+		if m.Set == 0 {
+			m.Phrase = EMPTY
+		}
+		changed()
+	})
+}
+
+// Value of a lane level, 0 to 255
+func motionLevel(l int) uint8 {
+	return uint8(min(l*256/(MOTION_LANE_LEVELS-1), 255))
+}
@@ -0,0 +1,194 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Classic chip oscillator shapes
+type OscShape uint8
+
+const (
+	OSC_PULSE OscShape = iota
+	OSC_SAW
+	OSC_TRIANGLE
+	OSC_NOISE
+)
+
+// Pulse widths of the NES and Game Boy, as Duty values
+const (
+	DUTY_12 = 32
+	DUTY_25 = 64
+	DUTY_50 = 128
+	DUTY_75 = 192
+
+	DUTY_CHUNK         = 32 // Frames between pulse width updates while sweeping
+	DEFAULT_SWEEP_RATE = 10 // 1Hz
+)
+
+// Naive chip-style oscillator computed straight from the phase. Duty sets
+// the pulse width (128 is a square wave). SweepDepth sweeps the width by
+// up to that much either side of Duty along a triangle at SweepRate tenths
+// of a Hz, restarting with each note. Noise is a 15-bit LFSR clocked at
+// the oscillator frequency like the Game Boy noise channel; ShortNoise
+// switches to the metallic 7-bit sequence. Level is 0-255.
+type OscillatorVoice struct {
+	Shape      OscShape
+	Duty       uint8
+	SweepRate  uint8
+	SweepDepth uint8
+	ShortNoise bool
+	Level      uint8
+
+	phase    uint32
+	inc      uint32
+	freq     uint32
+	lfsr     uint16
+	velocity uint8
+	note     uint8
+	bend     int // Cents, see Bend
+	sweep    LFO
+}
+
+// Create an oscillator at full level with a square duty cycle
+func newOscillatorVoice(shape OscShape) *OscillatorVoice {
+	v := new(OscillatorVoice)
+	v.reset(shape)
+	return v
+}
+
+// Start the voice over as new, in place
+func (v *OscillatorVoice) reset(shape OscShape) {
+	*v = OscillatorVoice{Shape: shape, Duty: DUTY_50, Level: 255, lfsr: 0x7fff,
+		sweep: LFO{Shape: WAVE_TRIANGLE}}
+}
+
+// Pulse width with the sweep applied, which stops short of silence
+func (v *OscillatorVoice) duty() uint32 {
+	if v.SweepDepth == 0 {
+		return uint32(v.Duty)
+	}
+	d := int32(v.Duty) + v.sweep.Value(0)*int32(v.SweepDepth)>>15
+	return uint32(min(max(d, 1), 255))
+}
+
+// Set the pitch in mHz
+func (v *OscillatorVoice) SetFrequency(milliHz uint32) {
+	v.freq = milliHz
+	v.inc = phaseIncrement(milliHz)
+}
+
+func (v *OscillatorVoice) Retune() { v.SetFrequency(v.freq) }
+
+func (v *OscillatorVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	n := noteIndex(note)
+	v.freq, v.inc, v.velocity, v.note = noteFrequencies[n], noteIncrements[n], velocity, n
+	if v.bend != 0 {
+		v.SetFrequency(noteFrequency(int(n), v.bend))
+	}
+	v.sweep.Reset()
+}
+
+// Offset the pitch from the last NoteOn by cents, without starting a note
+func (v *OscillatorVoice) Bend(cents int) {
+	v.bend = cents
+	if v.freq != 0 {
+		v.SetFrequency(noteFrequency(int(v.note), cents))
+	}
+}
+
+func (v *OscillatorVoice) NoteOff() { v.SetFrequency(0) }
+
+func (v *OscillatorVoice) Sounding() bool { return v.inc != 0 }
+
+func (v *OscillatorVoice) Render(out []int32) {
+	if v.inc == 0 {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	switch v.Shape {
+	case OSC_PULSE:
+		v.sweep.Rate = uint32(v.SweepRate) * 100
+		for len(out) > 0 {
+			n := min(len(out), DUTY_CHUNK)
+			duty := v.duty() << 24
+			for i := range out[:n] {
+				s := int32(-32767)
+				if v.phase < duty {
+					s = 32767
+				}
+				out[i] += s * level >> 8
+				v.phase += v.inc
+			}
+			v.sweep.Advance(n)
+			out = out[n:]
+		}
+	case OSC_SAW:
+		for i := range out {
+			out[i] += (int32(v.phase>>16) - 32768) * level >> 8
+			v.phase += v.inc
+		}
+	case OSC_TRIANGLE:
+		for i := range out {
+			p := int32(v.phase >> 15) // 0 to 131071
+			if p >= 65536 {
+				p = 131071 - p
+			}
+			out[i] += (p - 32768) * level >> 8
+			v.phase += v.inc
+		}
+	case OSC_NOISE:
+		if v.lfsr == 0 {
+			v.lfsr = 0x7fff
+		}
+		for i := range out {
+			next := v.phase + v.inc
+			if next < v.phase {
+				v.clockNoise()
+			}
+			v.phase = next
+			s := int32(-32767)
+			if v.lfsr&1 == 0 {
+				s = 32767
+			}
+			out[i] += s * level >> 8
+		}
+	}
+}
+
+// Step the noise LFSR once
+func (v *OscillatorVoice) clockNoise() {
+	bit := (v.lfsr ^ v.lfsr>>1) & 1
+	v.lfsr = v.lfsr>>1 | bit<<14
+	if v.ShortNoise {
+		v.lfsr = v.lfsr&^(1<<6) | bit<<6
+	}
+}
+
+func init() {
+	addTool("PULSE WIDTH", openPulseView)
+}
+
+// Step the selected instrument's pulse width and its sweep
+func openPulseView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	openInstrumentParams("PULSE "+itoa(int(slot)), in, []settingItem{
+		byteChoice("WIDTH", func() *uint8 { return &in.Duty }, []uint8{DUTY_50, DUTY_12, DUTY_25, DUTY_75},
+			func(v uint8) string { return decimal1(float64(v)*100/256) + "%" }),
+		byteChoice("SWEEP", func() *uint8 { return &in.SweepDepth }, []uint8{0, 16, 32, 64, 96, 127}, func(v uint8) string {
+			if v == 0 {
+				return "OFF"
+			}
+			return "+-" + itoa(int(v)*100/256) + "%"
+		}),
+		byteChoice("SWEEP RATE", func() *uint8 { return &in.SweepRate }, []uint8{2, 5, 10, 20, 40, 80},
+			func(v uint8) string { return decimal1(float64(v)/10) + "HZ" }),
+	}, nil)
+}
@@ -0,0 +1,118 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Phrases as plain text, one step a line in tracker columns, for sharing
+// snippets and for diffing projects in version control:
+//
+//	PHRASE 0A TEMPO 140 GROOVE 60
+//	00 C-4  01 V40 ---
+//	01 ---  -- --- ---
+//	02 OFF  -- --- ---
+//
+// Columns are the step, note, instrument and the effect columns. TEMPO and
+// GROOVE only appear when the phrase overrides the song's.
+
+// Note column, tracker style: C-4, C#4, OFF or --- for none
+func noteCell(note uint8) string {
+	switch {
+	case note == EMPTY:
+		return "--- "
+	case note == NOTE_OFF:
+		return "OFF "
+	case note >= NUM_NOTES:
+		return "??? "
+	}
+	name := noteName(note)
+	if name[1] != '#' {
+		name = name[:1] + "-" + name[1:] // C-4, and C--1 an octave below 0
+	}
+	for len(name) < 4 {
+		name += " "
+	}
+	return name
+}
+
+// Text of a phrase, a line for the header and one for each step
+func phraseText(p *Project, index int) string {
+	ph := &p.Phrases[index]
+	var b strings.Builder
+	b.WriteString("PHRASE " + hexByte(uint8(index)))
+	if ph.Tempo != 0 {
+		b.WriteString(" TEMPO " + itoa(int(ph.Tempo)))
+	}
+	if ph.Groove != 0 {
+		b.WriteString(" GROOVE " + itoa(int(ph.Groove)))
+	}
+	b.WriteByte('\n')
+	for s := range ph.Steps {
+		b.WriteString(hexByte(uint8(s)) + " " + stepText(&ph.Steps[s]) + "\n")
+	}
+	return b.String()
+}
+
+// Columns of a step after the step number
+func stepText(st *Step) string {
+	text := noteCell(st.Note) + " "
+	if st.Instrument == EMPTY {
+		text += "--"
+	} else {
+		text += hexByte(st.Instrument)
+	}
+	for _, fx := range st.FX {
+		if fx.Command == 0 {
+			text += " ---"
+		} else {
+			text += " " + string(rune(fx.Command)) + hexByte(fx.Param)
+		}
+	}
+	return text
+}
+
+// Every phrase holding anything, separated by blank lines
+func phrasesText(p *Project) string {
+	var parts []string
+	for i := range p.Phrases {
+		if !p.Phrases[i].IsEmpty() {
+			parts = append(parts, phraseText(p, i))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func init() {
+	addTool("EXPORT PATTERNS", exportPatterns)
+	addCommand("phrase", "phrase XX: print phrase XX (hex)", func(args []string) {
+		if len(args) != 1 {
+			shellPrint("usage: phrase XX\n")
+			return
+		}
+		i, err := strconv.ParseUint(args[0], 16, 8)
+		if err != nil || i >= NUM_PHRASES {
+			shellPrint("no phrase " + args[0] + "\n")
+			return
+		}
+		shellPrint(phraseText(project, int(i)))
+	})
+	addCommand("phrases", "phrases: print every phrase in use", func([]string) {
+		shellPrint(phrasesText(project))
+	})
+}
+
+// Write every phrase in use to rendersDir as a text file named after the
+// project
+func exportPatterns() {
+	path := joinPath(rendersDir, project.Name+".txt")
+	if err := writeFile(path, []byte(phrasesText(project))); err != nil {
+		println("Failed to export patterns:", err.Error())
+		showStatus("EXPORT FAILED", colorRed)
+		return
+	}
+	showStatus("SAVED "+baseName(path), colorGreen)
+}
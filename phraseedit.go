@@ -0,0 +1,314 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Phrase editor: a row per step with its note, instrument and effect
+// columns. The arrows move the cursor and EDIT+arrows change the value
+// under it, LEFT and RIGHT by one, UP and DOWN by an octave or 16. Editing
+// an empty cell fills it with the last value entered in its column, and a
+// new note takes the last instrument too, which instrument tools then
+// work on. EDIT+ENTER clears a cell, or on an empty note enters a note
+// off. While stopped, each note edit is heard through the audition voice.
+// The step the song is playing in the phrase is highlighted. NAV+LEFT
+// goes to the chain editor, see chainedit.go, and NAV+RIGHT to the
+// instrument of the step under the cursor, see instedit.go. ALT+LEFT
+// copies the phrase and ALT+RIGHT pastes over it, see clipboard.go, as in
+// the chain and instrument editors. Opened on a track's scratch phrase it
+// edits that instead, see scratch.go, and NAV+UP/DOWN step through the
+// tracks' scratch phrases.
+const (
+	PHRASE_COL_NOTE = iota
+	PHRASE_COL_INSTRUMENT
+	PHRASE_COL_FX   // Command then param, for each effect column
+	NUM_PHRASE_COLS = PHRASE_COL_FX + 2*NUM_FX
+)
+
+// Where each column is drawn and how wide, in characters, matching
+// stepText after the step number
+var phraseColumns = [NUM_PHRASE_COLS]struct{ x, width int }{
+	{3, 3}, {8, 2}, {11, 1}, {12, 2}, {15, 1}, {16, 2},
+}
+
+func init() {
+	registerView(VIEW_PHRASE, func() View { return &phraseView{} })
+	addTool("PHRASE", openPhraseList)
+}
+
+type phraseView struct {
+	playhead  int  // Step being played, -1 for none
+	onScratch bool // Editing track's scratch phrase
+	track     int
+}
+
+// Last values entered in each column, for filling in empty cells
+var phraseLast = struct {
+	note, instrument, command uint8
+}{NOTE_C4, 0, FX_VOLUME}
+
+func (v *phraseView) ID() ViewID { return VIEW_PHRASE }
+
+func (v *phraseView) state() *ViewState { return &session.Views[VIEW_PHRASE] }
+
+func (v *phraseView) phrase() *Phrase {
+	if v.onScratch {
+		return &scratch[v.track]
+	}
+	return &project.Phrases[session.Phrase%NUM_PHRASES]
+}
+
+// Title of the phrase being edited
+func (v *phraseView) title() string {
+	if v.onScratch {
+		return "SCRATCH " + itoa(v.track+1)
+	}
+	return "PHRASE " + hexByte(session.Phrase)
+}
+
+// Step of the phrase the song is playing, -1 when none is
+func (v *phraseView) playingStep() int {
+	if !sequencer.Playing {
+		return -1
+	}
+	if v.onScratch {
+		if scratchOn[v.track] {
+			return sequencer.Step
+		}
+		return -1
+	}
+	for _, pos := range trackSteps {
+		if pos.Phrase == session.Phrase {
+			return int(pos.Step)
+		}
+	}
+	return -1
+}
+
+func (v *phraseView) Tick() {
+	if s := v.playingStep(); s != v.playhead {
+		v.playhead = s
+		redrawView()
+	}
+}
+
+// Steps that fit below the title
+func phraseRows() int {
+	return min(viewRows()-1, PHRASE_STEPS)
+}
+
+func (v *phraseView) Draw() {
+	st := v.state()
+	rows := phraseRows()
+	first := int(st.Scroll)
+	drawText(0, 0, v.title(), colorGreen)
+	v.playhead = v.playingStep()
+	for s := first; s < PHRASE_STEPS && s < first+rows; s++ {
+		row := s - first + 1
+		if s == v.playhead {
+			drawHighlight(0, row, 18, colorGrid)
+		}
+		if s == int(st.Row) {
+			c := phraseColumns[st.Col%NUM_PHRASE_COLS]
+			drawHighlight(c.x, row, c.width, colorBlue)
+		}
+		drawText(0, row, hexByte(uint8(s))+" "+stepText(&v.phrase().Steps[s]), colorText)
+	}
+}
+
+func (v *phraseView) Describe() string {
+	st := v.state()
+	step := &v.phrase().Steps[st.Row%PHRASE_STEPS]
+	text := v.title() + " STEP " + hexByte(st.Row)
+	switch col := int(st.Col); {
+	case col == PHRASE_COL_NOTE:
+		return text + " NOTE " + spokenNote(step.Note)
+	case col == PHRASE_COL_INSTRUMENT:
+		return text + " INSTR " + spokenByte(step.Instrument)
+	}
+	n := (int(st.Col) - PHRASE_COL_FX) / 2
+	fx := step.FX[n%NUM_FX]
+	text += " FX" + itoa(n+1)
+	switch {
+	case fx.Command == FX_NONE:
+		return text + " EMPTY"
+	case (int(st.Col)-PHRASE_COL_FX)%2 == 0:
+		return text + " " + string(rune(fx.Command))
+	}
+	return text + " PARAM " + hexByte(fx.Param)
+}
+
+func (v *phraseView) HandleAction(a Action) {
+	st := v.state()
+	switch a {
+	case ACTION_CURSOR_UP:
+		if st.Row > 0 {
+			st.Row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if st.Row < PHRASE_STEPS-1 {
+			st.Row++
+		}
+	case ACTION_CURSOR_LEFT:
+		if st.Col == 0 {
+			popView()
+			return
+		}
+		st.Col--
+	case ACTION_CURSOR_RIGHT:
+		if st.Col < NUM_PHRASE_COLS-1 {
+			st.Col++
+		}
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		v.edit(editDelta(a))
+	case ACTION_CLEAR:
+		v.clear()
+	case ACTION_COPY:
+		copyPhrase(v.phrase())
+		showStatus("COPIED "+v.title(), colorGreen)
+	case ACTION_PASTE:
+		if !v.onScratch {
+			pasteInEditor(CLIP_PHRASE, session.Phrase)
+		} else if clipboard.Kind == CLIP_PHRASE {
+			scratch[v.track] = clipboard.Phrases[0]
+			showStatus("PASTED PHRASE", colorGreen)
+		} else {
+			showStatus("CLIPBOARD HOLDS "+clipKindNames[clipboard.Kind], colorRed)
+		}
+	case ACTION_NAV_LEFT:
+		if v.onScratch {
+			popView()
+			return
+		}
+		replaceView(&chainView{playhead: -1})
+		return
+	case ACTION_NAV_RIGHT:
+		if i := v.phrase().Steps[st.Row%PHRASE_STEPS].Instrument; i < NUM_INSTRUMENTS {
+			session.Instrument = i
+		}
+		replaceView(&instrumentView{})
+		return
+	case ACTION_NAV_UP, ACTION_NAV_DOWN:
+		if v.onScratch {
+			v.track = (v.track + navDelta(a) + NUM_TRACKS) % NUM_TRACKS
+			break
+		}
+		session.Phrase = uint8((int(session.Phrase) + navDelta(a) + NUM_PHRASES) % NUM_PHRASES)
+	default:
+		return
+	}
+	rows := phraseRows()
+	if int(st.Row) < int(st.Scroll) {
+		st.Scroll = st.Row
+	} else if int(st.Row) >= int(st.Scroll)+rows {
+		st.Scroll = st.Row - uint8(rows) + 1
+	}
+	redrawView()
+}
+
+// Step a value by delta, or by delta octaves or 16s when big, filling an
+// empty cell instead
+func (v *phraseView) edit(delta int, big bool) {
+	st := v.state()
+	step := &v.phrase().Steps[st.Row%PHRASE_STEPS]
+	switch col := int(st.Col); {
+	case col == PHRASE_COL_NOTE:
+		if step.Note >= NUM_NOTES {
+			step.Note = phraseLast.note
+			if step.Instrument == EMPTY {
+				step.Instrument = phraseLast.instrument
+			}
+		} else {
+			step.Note = stepByte(step.Note, delta, big, 12, NUM_NOTES-1)
+		}
+		phraseLast.note = step.Note
+		if !isAudioPlaying && step.Instrument < NUM_INSTRUMENTS {
+			auditionNote(&project.Instruments[step.Instrument], step.Note)
+		}
+	case col == PHRASE_COL_INSTRUMENT:
+		if step.Instrument >= NUM_INSTRUMENTS {
+			step.Instrument = phraseLast.instrument
+		} else {
+			step.Instrument = stepByte(step.Instrument, delta, big, 16, NUM_INSTRUMENTS-1)
+		}
+		phraseLast.instrument = step.Instrument
+		session.Instrument = step.Instrument
+	case (col-PHRASE_COL_FX)%2 == 0:
+		fx := &step.FX[(col-PHRASE_COL_FX)/2]
+		if fx.Command == FX_NONE {
+			fx.Command = phraseLast.command
+		} else {
+			fx.Command = nextCommand(stepCommands, fx.Command, delta)
+		}
+		phraseLast.command = fx.Command
+	default:
+		fx := &step.FX[(col-PHRASE_COL_FX)/2]
+		if fx.Command == FX_NONE {
+			fx.Command = phraseLast.command
+		}
+		fx.Param = stepByte(fx.Param, delta, big, 16, 255)
+	}
+}
+
+// Empty the cell under the cursor, or put a note off in an empty note
+func (v *phraseView) clear() {
+	st := v.state()
+	step := &v.phrase().Steps[st.Row%PHRASE_STEPS]
+	switch col := int(st.Col); {
+	case col == PHRASE_COL_NOTE:
+		if step.Note == EMPTY {
+			step.Note = NOTE_OFF
+		} else {
+			step.Note = EMPTY
+		}
+	case col == PHRASE_COL_INSTRUMENT:
+		step.Instrument = EMPTY
+	default:
+		step.FX[(col-PHRASE_COL_FX)/2] = StepFX{}
+	}
+}
+
+// A value moved by delta, or delta times bigStep, held to 0-most
+func stepByte(value uint8, delta int, big bool, bigStep, most int) uint8 {
+	if big {
+		delta *= bigStep
+	}
+	return uint8(max(min(int(value)+delta, most), 0))
+}
+
+// The command delta places along a list of commands, wrapping around
+func nextCommand(cmds []uint8, cmd uint8, delta int) uint8 {
+	for i, c := range cmds {
+		if c == cmd {
+			n := len(cmds)
+			return cmds[((i+delta)%n+n)%n]
+		}
+	}
+	return cmds[0]
+}
+
+// Open the phrase editor on a phrase
+func openPhrase(index uint8) {
+	session.Phrase = index % NUM_PHRASES
+	pushView(&phraseView{playhead: -1})
+}
+
+// Open the phrase editor on a track's scratch phrase
+func openScratchPhrase(t int) {
+	pushView(&phraseView{playhead: -1, onScratch: true, track: t})
+}
+
+// Pick a phrase to edit, those in use marked
+func openPhraseList() {
+	list := &ListView{Title: "PHRASE", Cursor: int(session.Phrase % NUM_PHRASES)}
+	for i := range project.Phrases {
+		item := "PHRASE " + hexByte(uint8(i))
+		if !project.Phrases[i].IsEmpty() {
+			item += " *"
+		}
+		list.Items = append(list.Items, item)
+	}
+	list.OnSelect = func(i int) {
+		openPhrase(uint8(i))
+	}
+	pushView(list)
+}
@@ -0,0 +1,159 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Notes are numbered like MIDI, so C-4 is 60 and A-4 is 69
+const (
+	NUM_NOTES = 128
+	NOTE_C4   = 60
+	NOTE_A4   = 69
+
+	A4_MILLIHZ = 440_000
+
+	// Range of the TUNING and TRANSPOSE settings
+	MIN_TUNING    = 432 // Hz of A4
+	MAX_TUNING    = 446
+	MAX_TRANSPOSE = 12 // Semitones either way
+)
+
+// Semitone names, sharps only when printing
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Note name with octave, C4 being middle C
+func noteName(note uint8) string {
+	if note < 12 {
+		return noteNames[note] + "-1"
+	}
+	return noteNames[note%12] + itoa(int(note)/12-1)
+}
+
+// Parse a note name like C3, F#2, Eb4 or A-1, in either case
+func parseNoteName(s string) (uint8, bool) {
+	if s == "" {
+		return 0, false
+	}
+	semis := [7]int{9, 11, 0, 2, 4, 5, 7} // A to G
+	c := s[0] | 0x20
+	if c < 'a' || c > 'g' {
+		return 0, false
+	}
+	n := semis[c-'a']
+	s = s[1:]
+	if s != "" && s[0] == '#' {
+		n, s = n+1, s[1:]
+	} else if s != "" && (s[0] == 'b' || s[0] == 'B') && len(s) > 1 {
+		n, s = n-1, s[1:]
+	}
+	neg := s != "" && s[0] == '-'
+	if neg {
+		s = s[1:]
+	}
+	if len(s) != 1 || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	octave := int(s[0] - '0')
+	if neg {
+		octave = -octave
+	}
+	note := (octave+1)*12 + n
+	if note < 0 || note >= NUM_NOTES {
+		return 0, false
+	}
+	return uint8(note), true
+}
+
+// Equal-tempered frequency of every note in mHz at the tuning and
+// transpose settings, and the matching phase increment at the current
+// sample rate. Samples name their root in concert pitch, so root
+// frequencies leave the settings out.
+var (
+	noteFrequencies [NUM_NOTES]uint32
+	noteIncrements  [NUM_NOTES]uint32
+	rootFrequencies [NUM_NOTES]uint32
+)
+
+func init() {
+	var tunings []string
+	for hz := MIN_TUNING; hz <= MAX_TUNING; hz++ {
+		tunings = append(tunings, itoa(hz)+"HZ")
+	}
+	addSetting("TUNING A4", tunings,
+		func() int { return min(max(int(settings.TuningA4)-MIN_TUNING, 0), MAX_TUNING-MIN_TUNING) },
+		func(i int) { settings.TuningA4 = uint16(MIN_TUNING + i); applyTuning() })
+	var semis []string
+	for t := -MAX_TRANSPOSE; t <= MAX_TRANSPOSE; t++ {
+		name := itoa(t) + " SEMI"
+		if t > 0 {
+			name = "+" + name
+		}
+		semis = append(semis, name)
+	}
+	addSetting("TRANSPOSE", semis,
+		func() int { return int(settings.Transpose) + MAX_TRANSPOSE },
+		func(i int) { settings.Transpose = int8(i - MAX_TRANSPOSE); applyTuning() })
+}
+
+// Rebuild the note table after a tuning change. Notes already playing
+// keep their pitch; the next ones play in the new tuning. The table is
+// worked out aside and only copied in under audioMu.
+func applyTuning() {
+	var freqs, incs, roots [NUM_NOTES]uint32
+	buildNoteTable(&freqs, &incs, &roots)
+	audioMu.Lock()
+	noteFrequencies, noteIncrements, rootFrequencies = freqs, incs, roots
+	audioMu.Unlock()
+}
+
+// Fill in the note table for the tuning settings
+func initNoteTable() {
+	buildNoteTable(&noteFrequencies, &noteIncrements, &rootFrequencies)
+}
+
+// Work out note, increment and root tables for the tuning settings
+func buildNoteTable(freqs, incs, roots *[NUM_NOTES]uint32) {
+	a4 := float64(settings.TuningA4)
+	if a4 == 0 {
+		a4 = 440
+	}
+	for n := range freqs {
+		hz := a4 * math.Pow(2, float64(n+int(settings.Transpose)-NOTE_A4)/12)
+		freqs[n] = uint32(hz*1000 + 0.5)
+		incs[n] = phaseIncrement(freqs[n])
+		roots[n] = uint32(440*math.Pow(2, float64(n-NOTE_A4)/12)*1000 + 0.5)
+	}
+}
+
+// Recompute the phase increments for the current sample rate
+func initNoteIncrements() {
+	for n, f := range noteFrequencies {
+		noteIncrements[n] = phaseIncrement(f)
+	}
+}
+
+// Clamp a MIDI note number to the table
+func noteIndex(note uint8) uint8 {
+	return min(note, NUM_NOTES-1)
+}
+
+// Frequency in mHz of a note detuned by cents, which may span several
+// semitones. Fine tune is interpolated linearly between neighbouring
+// semitones.
+func noteFrequency(note int, cents int) uint32 {
+	note += cents / 100
+	cents %= 100
+	if cents < 0 {
+		note--
+		cents += 100
+	}
+	if note < 0 {
+		return noteFrequencies[0]
+	}
+	if note >= NUM_NOTES-1 {
+		return noteFrequencies[NUM_NOTES-1]
+	}
+	lo, hi := noteFrequencies[note], noteFrequencies[note+1]
+	return lo + (hi-lo)*uint32(cents)/100
+}
@@ -0,0 +1,76 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Live pitch bend of everything playing, from MIDI pitch bend or from
+// ALT+UP and ALT+DOWN, which bend by the full range while held. Bends are
+// in cents and the voices slew to them, see PitchVoice.
+const (
+	MIDI_BEND        = 0xe0
+	MIDI_BEND_CENTER = 8192
+)
+
+var bendRanges = []uint8{1, 2, 3, 5, 7, 12}
+
+var (
+	pitchWheel int    // Cents every voice is bent by
+	bendButton Button // Button holding a bend, NUM_BUTTONS when none
+)
+
+func init() {
+	bendButton = NUM_BUTTONS
+	addByteSetting(byteChoice("BEND RANGE", func() *uint8 { return &settings.BendRange }, bendRanges,
+		func(v uint8) string { return itoa(int(v)) + " SEMI" }))
+}
+
+// Bend every voice on the mixer by cents, and voices made from now on
+func setPitchWheel(cents int) {
+	pitchWheel = cents
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	for t := range mixer.Tracks {
+		wheelVoice(mixer.Tracks[t].Voice, cents)
+	}
+}
+
+// Set the wheel of a voice, or of each voice of a pool
+func wheelVoice(v Voice, cents int) {
+	switch v := v.(type) {
+	case *PitchVoice:
+		v.Wheel = int16(cents)
+	case *VoicePool:
+		for _, pv := range v.Voices {
+			wheelVoice(pv, cents)
+		}
+	}
+}
+
+// Bend from a MIDI pitch bend value, 0-16383
+func midiBend(value int) {
+	setPitchWheel((value - MIDI_BEND_CENTER) * int(settings.BendRange) * 100 / MIDI_BEND_CENTER)
+}
+
+// Bend while ALT+UP or ALT+DOWN is held, going back when the arrow is let
+// go. Returns true for the events it takes.
+func bendKey(ev KeyEvent) bool {
+	if !ev.Pressed {
+		if ev.Button != bendButton {
+			return false
+		}
+		bendButton = NUM_BUTTONS
+		setPitchWheel(0)
+		return true
+	}
+	cents := int(settings.BendRange) * 100
+	switch lookupAction(ev.Mods, ev.Button) {
+	case ACTION_BEND_UP:
+	case ACTION_BEND_DOWN:
+		cents = -cents
+	default:
+		return false
+	}
+	bendButton = ev.Button
+	setPitchWheel(cents)
+	return true
+}
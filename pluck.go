@@ -0,0 +1,146 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Longest delay a plucked string can use, in frames: a little under C1 at
+// 48kHz. Lower notes play an octave up.
+const PLUCK_MAX_DELAY = 2048
+
+const (
+	PLUCK_MIN_FILTER = 32    // Loop filter pole at Damping 0, of 256
+	PLUCK_MAX_FILTER = 224   // and at 255, short of closing entirely
+	PLUCK_RELEASE    = 64880 // Loop gain after a note off, Q16: a quick mute
+	PLUCK_SILENT     = 4     // Output level below which the string stops
+)
+
+// Karplus-Strong plucked string: a delay line one period long is filled
+// with noise and fed back through a low pass, so the noise settles into a
+// decaying tone. Damping 0-255 darkens the tone and Decay 0-255 lengthens
+// it; as on a real string, high notes die away sooner. The filter's delay
+// is taken off the line to keep the pitch in tune. Level is 0-255.
+type PluckVoice struct {
+	Damping uint8
+	Decay   uint8
+	Level   uint8
+
+	buf      [PLUCK_MAX_DELAY]int16
+	pos      int
+	delay    uint32 // 24.8 frames
+	freq     uint32
+	gain     int32 // Loop gain, Q16
+	lp       int32 // Loop filter state
+	playing  bool
+	velocity uint8
+	note     uint8
+	bend     int // Cents, see Bend
+	rng      uint32
+}
+
+// Settings a plucked instrument starts from: a moderate tone and ring
+var pluckDefaults = PluckParams{Damping: 64, Decay: 192}
+
+// Create a plucked string with the default settings
+func newPluckVoice() *PluckVoice {
+	v := new(PluckVoice)
+	v.reset()
+	return v
+}
+
+// Start the voice over as new, in place
+func (v *PluckVoice) reset() {
+	*v = PluckVoice{Damping: pluckDefaults.Damping, Decay: pluckDefaults.Decay, Level: 255, rng: 0x6d2b79f5}
+}
+
+// Set the pitch in mHz, within the delay line
+func (v *PluckVoice) SetFrequency(milliHz uint32) {
+	v.freq = milliHz
+	if milliHz == 0 {
+		return
+	}
+	delay := (uint64(sampleRate) * 1000 << 8) / uint64(milliHz)
+	for delay >= (PLUCK_MAX_DELAY-1)<<8 {
+		delay >>= 1
+	}
+	// A one-pole low pass delays low frequencies by d/(256-d) frames
+	d := uint64(v.pole())
+	delay -= min(d<<8/(256-d), delay-1<<8)
+	v.delay = uint32(delay)
+}
+
+// Loop filter pole for the damping, of 256
+func (v *PluckVoice) pole() int32 {
+	return PLUCK_MIN_FILTER + int32(v.Damping)*(PLUCK_MAX_FILTER-PLUCK_MIN_FILTER)/255
+}
+
+func (v *PluckVoice) Retune() { v.SetFrequency(v.freq) }
+
+// Offset the pitch from the last NoteOn by cents
+func (v *PluckVoice) Bend(cents int) {
+	v.bend = cents
+	v.SetFrequency(noteFrequency(int(v.note), cents))
+}
+
+// Pluck the string: fill a period of the line with noise
+func (v *PluckVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	v.note, v.velocity = noteIndex(note), velocity
+	v.SetFrequency(noteFrequency(int(v.note), v.bend))
+	loss := (255 - int32(v.Decay)) * (255 - int32(v.Decay))
+	v.gain = 65535 - loss*13107/65025 // 0.8 to nearly 1
+	n := int(v.delay>>8) + 2
+	for i := range v.buf[:n] {
+		v.rng ^= v.rng << 13
+		v.rng ^= v.rng >> 17
+		v.rng ^= v.rng << 5
+		v.buf[i] = int16(v.rng)
+	}
+	clear(v.buf[n:])
+	v.pos, v.lp, v.playing = n, 0, true
+}
+
+// Let go of the string, damping it quickly
+func (v *PluckVoice) NoteOff() {
+	v.gain = min(v.gain, PLUCK_RELEASE)
+}
+
+func (v *PluckVoice) Sounding() bool { return v.playing }
+
+func (v *PluckVoice) Render(out []int32) {
+	if !v.playing {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	damp := 256 - v.pole()
+	whole, frac := int(v.delay>>8), int32(v.delay&0xff)
+	peak := int32(0)
+	for i := range out {
+		// Read a period back, between two frames
+		r := v.pos - whole
+		if r < 0 {
+			r += PLUCK_MAX_DELAY
+		}
+		r1 := r - 1
+		if r1 < 0 {
+			r1 += PLUCK_MAX_DELAY
+		}
+		a, b := int32(v.buf[r]), int32(v.buf[r1])
+		x := a + (b-a)*frac>>8
+
+		// Dividing rounds towards zero, so the string can't hang on an offset
+		v.lp += (x - v.lp) * damp / 256
+		y := v.lp * v.gain / 65536
+		v.buf[v.pos] = int16(min(max(y, -32768), 32767))
+		if v.pos++; v.pos == PLUCK_MAX_DELAY {
+			v.pos = 0
+		}
+		out[i] += y * level >> 8
+		peak = max(peak, y, -y)
+	}
+	if peak < PLUCK_SILENT {
+		v.playing = false
+	}
+}
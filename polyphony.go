@@ -0,0 +1,161 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Voice stealing policies of a VoicePool
+const (
+	STEAL_OLDEST = iota
+	STEAL_QUIETEST
+)
+
+// Plays each note on one voice of a fixed pool, so a track can sound a
+// chord. A note goes to a voice whose note has finished, as the voice
+// tells it, else one is stolen: released voices before held ones, and
+// among those the oldest note or the quietest voice going by the loudness
+// of its last block. Voices render into a scratch block of their own to
+// measure that loudness.
+type VoicePool struct {
+	Voices []Voice
+	Steal  uint8
+
+	slots   []poolSlot
+	scratch [BLOCK_SIZE]int32
+	clock   uint32 // Counts notes, for their age
+}
+
+type poolSlot struct {
+	note    uint8
+	held    bool
+	started uint32
+	peak    int32 // Of the last block
+}
+
+func newVoicePool(voices []Voice, steal uint8) *VoicePool {
+	return &VoicePool{Voices: voices, Steal: steal, slots: make([]poolSlot, len(voices))}
+}
+
+// Whether voice i is held or still sounding
+func (p *VoicePool) busy(i int) bool {
+	return p.slots[i].held || sounding(p.Voices[i])
+}
+
+// Whether voice i is a better one to take for a new note than voice j
+func (p *VoicePool) better(i, j int) bool {
+	if p.busy(i) != p.busy(j) {
+		return !p.busy(i)
+	}
+	a, b := &p.slots[i], &p.slots[j]
+	if a.held != b.held {
+		return !a.held
+	}
+	if p.Steal == STEAL_QUIETEST && a.peak != b.peak {
+		return a.peak < b.peak
+	}
+	return a.started < b.started
+}
+
+// Voice to play a note on: the one already playing it, else the best
+// free or stolen one
+func (p *VoicePool) pick(note uint8) int {
+	best := -1
+	for i := range p.slots {
+		s := &p.slots[i]
+		if s.held && s.note == note {
+			return i
+		}
+		if best < 0 || p.better(i, best) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *VoicePool) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		p.Release(note)
+		return
+	}
+	i := p.pick(note)
+	if i < 0 {
+		return
+	}
+	p.clock++
+	// Counts as loud until it has rendered, so it isn't stolen straight away
+	p.slots[i] = poolSlot{note: note, held: true, started: p.clock, peak: 1 << 30}
+	p.Voices[i].NoteOn(note, velocity)
+}
+
+// Release the voice holding a note
+func (p *VoicePool) Release(note uint8) {
+	for i := range p.slots {
+		if s := &p.slots[i]; s.held && s.note == note {
+			s.held = false
+			p.Voices[i].NoteOff()
+		}
+	}
+}
+
+// Release every held voice
+func (p *VoicePool) NoteOff() {
+	for i := range p.slots {
+		if p.slots[i].held {
+			p.slots[i].held = false
+			p.Voices[i].NoteOff()
+		}
+	}
+}
+
+func (p *VoicePool) Render(out []int32) {
+	for len(out) > 0 {
+		n := min(len(out), BLOCK_SIZE)
+		for i, v := range p.Voices {
+			s := &p.slots[i]
+			if !p.busy(i) {
+				s.peak = 0
+				continue
+			}
+			buf := p.scratch[:n]
+			clear(buf)
+			v.Render(buf)
+			peak := int32(0)
+			for j, x := range buf {
+				out[j] += x
+				peak = max(peak, x, -x)
+			}
+			s.peak = peak
+		}
+		out = out[n:]
+	}
+}
+
+func (p *VoicePool) Retune() {
+	for _, v := range p.Voices {
+		if r, ok := v.(Retuner); ok {
+			r.Retune()
+		}
+	}
+}
+
+// Voices sounding, and the size of the pool
+func (p *VoicePool) Usage() (used, total int) {
+	for i := range p.slots {
+		if p.busy(i) {
+			used++
+		}
+	}
+	return used, len(p.slots)
+}
+
+// Pool voices sounding on all tracks, and the pools' size
+func voiceUsage() (used, total int) {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	for t := range mixer.Tracks {
+		if p, ok := mixer.Tracks[t].Voice.(*VoicePool); ok {
+			u, n := p.Usage()
+			used, total = used+u, total+n
+		}
+	}
+	return used, total
+}
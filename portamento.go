@@ -0,0 +1,186 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+const (
+	PITCH_CHUNK          = 32 // Frames between pitch updates of a PitchVoice
+	DEFAULT_VIBRATO_RATE = 55 // 5.5Hz
+	WHEEL_SLEW_SHIFT     = 3  // The wheel moves 1/8 of the way each chunk, about 5ms
+)
+
+// A voice whose pitch can be moved away from the playing note
+type Bender interface {
+	Voice
+
+	// Offset the pitch from the last NoteOn by cents, until the next Bend
+	Bend(cents int)
+}
+
+// Wraps a voice with glide and vibrato. With Glide set, each note starts
+// at the pitch of the one before and slides to its own over Glide ms.
+// Vibrato moves the pitch by up to VibratoDepth cents at VibratoRate
+// tenths of a Hz. Wheel is a pitch bend in cents, played live, which the
+// pitch follows smoothly rather than in steps. Pitch is updated every
+// PITCH_CHUNK frames, which effect commands can also drive through Glide
+// and the vibrato fields. Knob is a further bend in cents from the
+// instrument's macro knobs, followed like Wheel. Shift is a bend in cents
+// taken at once, for arpeggios and table pitches. Volume and Duty are the
+// sequencer's note volume and pulse width, see knobVoice. The instrument's
+// envelope and filter shape the output, see ToneShaper.
+type PitchVoice struct {
+	Voice        Bender
+	Glide        uint8
+	VibratoDepth uint8
+	VibratoRate  uint8
+	Wheel        int16
+	Knob         int16
+	Shift        int16
+	Volume       uint8 // 0-255
+	Duty         uint8 // 0 for the instrument's
+
+	instrument *Instrument // Made from, for the macro knobs
+	kind       InstrumentType
+	wave       uint8 // Instrument's Type and Wave when made
+	wheel      int32 // Wheel and Knob on their way to their sum, Q8
+	offset     int32 // Glide distance left in cents, Q8
+	step       int32 // Glide change per chunk
+	bent       int32 // Cents the voice is bent by
+	lfo        LFO
+	last       uint8
+	tone       ToneShaper
+}
+
+func newPitchVoice(v Bender) *PitchVoice {
+	p := new(PitchVoice)
+	p.reset(v)
+	return p
+}
+
+// Start the voice over as new around v, in place
+func (p *PitchVoice) reset(v Bender) {
+	*p = PitchVoice{Voice: v, Volume: 255, last: EMPTY, lfo: LFO{Shape: WAVE_SINE}}
+}
+
+// Take glide and vibrato from an instrument
+func (p *PitchVoice) SetInstrument(in *Instrument) {
+	p.Glide, p.VibratoDepth, p.VibratoRate = in.Glide, in.VibratoDepth, in.VibratoRate
+	p.instrument, p.kind, p.wave = in, in.Type, in.Wave
+}
+
+// Whether the voice was made for an instrument's current engine
+func (p *PitchVoice) madeFrom(in *Instrument) bool {
+	return p.instrument == in && p.kind == in.Type && p.wave == in.Wave
+}
+
+func (p *PitchVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		p.NoteOff()
+		return
+	}
+	note = noteIndex(note)
+	p.offset, p.step = 0, 0
+	if p.Glide > 0 && p.last != EMPTY && p.last != note {
+		p.offset = (int32(p.last) - int32(note)) * 100 << 8
+		chunks := max(int32(p.Glide)*int32(sampleRate)/1000/PITCH_CHUNK, 1)
+		p.step = max(abs32(p.offset)/chunks, 1)
+	}
+	p.last = note
+	p.lfo.Reset()
+	if p.instrument != nil {
+		p.tone.noteOn(p.instrument)
+	}
+	p.Voice.NoteOn(note, velocity)
+	p.bent = (p.offset+p.wheel)>>8 + int32(p.Shift)
+	p.Voice.Bend(int(p.bent))
+}
+
+func (p *PitchVoice) NoteOff() {
+	if !p.tone.noteOff() {
+		p.Voice.NoteOff()
+	}
+}
+
+func (p *PitchVoice) Sounding() bool { return sounding(p.Voice) }
+
+func (p *PitchVoice) Retune() {
+	if r, ok := p.Voice.(Retuner); ok {
+		r.Retune()
+	}
+}
+
+// Bend the voice to the glide, wheel, shift and vibrato when they have
+// changed
+func (p *PitchVoice) bend() {
+	cents := (p.offset+p.wheel)>>8 + int32(p.Shift)
+	if p.VibratoDepth > 0 {
+		cents += p.lfo.Value(0) * int32(p.VibratoDepth) >> 15
+	}
+	if cents != p.bent {
+		p.Voice.Bend(int(cents))
+		p.bent = cents
+	}
+}
+
+func (p *PitchVoice) Render(out []int32) {
+	p.lfo.Rate = uint32(p.VibratoRate) * 100
+	for len(out) > 0 {
+		n := min(len(out), PITCH_CHUNK)
+		if p.offset > 0 {
+			p.offset = max(p.offset-p.step, 0)
+		} else if p.offset < 0 {
+			p.offset = min(p.offset+p.step, 0)
+		}
+		if d := (int32(p.Wheel)+int32(p.Knob))<<8 - p.wheel; abs32(d) < 1<<8 {
+			p.wheel += d // Within a cent, land on it
+		} else {
+			p.wheel += d >> WHEEL_SLEW_SHIFT
+		}
+		p.bend()
+		if p.tone.on {
+			p.tone.render(p.Voice, out[:n])
+		} else {
+			p.Voice.Render(out[:n])
+		}
+		p.lfo.Advance(n)
+		out = out[n:]
+	}
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func init() {
+	addTool("PITCH", openPitchView)
+}
+
+// Step the selected instrument's glide and vibrato
+func openPitchView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	openInstrumentParams("PITCH "+itoa(int(slot)), in, []settingItem{
+		byteChoice("GLIDE", func() *uint8 { return &in.Glide }, []uint8{0, 20, 50, 100, 200, 255}, func(v uint8) string {
+			if v == 0 {
+				return "OFF"
+			}
+			return itoa(int(v)) + "MS"
+		}),
+		byteChoice("VIBRATO", func() *uint8 { return &in.VibratoDepth }, []uint8{0, 5, 10, 25, 50, 100}, func(v uint8) string {
+			if v == 0 {
+				return "OFF"
+			}
+			return itoa(int(v)) + " CENTS"
+		}),
+		byteChoice("RATE", func() *uint8 { return &in.VibratoRate }, []uint8{20, 40, 55, 70, 100}, func(v uint8) string {
+			return itoa(int(v)/10) + "." + itoa(int(v)%10) + "HZ"
+		}),
+	}, nil)
+}
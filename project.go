@@ -0,0 +1,544 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Project layout
+const (
+	PHRASE_STEPS    = 16
+	CHAIN_LENGTH    = 16
+	SONG_ROWS       = 128
+	NUM_CHAINS      = 128
+	NUM_PHRASES     = 128
+	NUM_INSTRUMENTS = 32
+	MAX_SAMPLES     = 32
+	MAX_ZONES       = 8  // Key zones per sample instrument
+	MAX_ROBINS      = 4  // Round-robin variations of one key range
+	MAX_SLICES      = 16 // Slices of a sample instrument's sample
+	TABLE_ROWS      = 16 // Rows of an instrument table
+	NUM_MOTIONS     = 32 // Motion sequences shared by all phrases
+	NUM_FX          = 2  // Effect columns per step
+
+	DEFAULT_TEMPO  = 120
+	STEPS_PER_BEAT = 4 // Phrase steps are 16th notes
+)
+
+// Markers for unused cells
+const (
+	EMPTY    = 0xFF // no chain, phrase, instrument or sample
+	NOTE_OFF = 0xFE // stops the track's voice
+)
+
+// One row of a phrase. Note is a MIDI note, or EMPTY / NOTE_OFF. The
+// effect columns combine as described in docs/fx.md.
+type Step struct {
+	Note       uint8
+	Instrument uint8
+	FX         [NUM_FX]StepFX
+}
+
+// An effect command and its parameter, Command 0 for none
+type StepFX struct {
+	Command uint8
+	Param   uint8
+}
+
+// 16 steps of notes for one track. Tempo and Groove override the song's
+// while the phrase plays, 0 keeps the song's.
+type Phrase struct {
+	Steps  [PHRASE_STEPS]Step
+	Tempo  uint16
+	Groove uint8
+}
+
+// Phrase played by a chain row, transposed in semitones
+type ChainEntry struct {
+	Phrase    uint8
+	Transpose int8
+}
+
+// Sequence of phrases for one track
+type Chain struct {
+	Entries [CHAIN_LENGTH]ChainEntry
+}
+
+// Sound engines an instrument can use
+type InstrumentType uint8
+
+const (
+	INSTR_NONE InstrumentType = iota
+	INSTR_SAMPLE
+	INSTR_WAVETABLE
+	INSTR_OSCILLATOR
+	INSTR_DRUM
+	INSTR_FM
+	INSTR_GRANULAR
+	INSTR_PLUCK
+)
+
+// Sound settings triggered by a step. Sample indexes Project.Samples,
+// Wave picks the wavetable, OscShape or DrumKind. Volume and Pan are 0-255.
+type Instrument struct {
+	Name   string
+	Type   InstrumentType
+	Sample uint8
+	Wave   uint8
+	Volume uint8
+	Pan    uint8
+	Fine   int8 // Tuning in cents
+
+	// Read samples with linear interpolation instead of nearest neighbour
+	Interpolate bool
+
+	// Gains in dB the track EQ takes while the instrument plays, by EQ band
+	EQ [NUM_EQ_BANDS]int8
+
+	// Sample playback, see SampleVoice. The loop points are fractions of
+	// the sample's length in 1/65536, LoopEnd 0 for the sample's own loop.
+	Loop      LoopMode
+	Play      PlayMode
+	Reverse   bool
+	LoopStart uint16
+	LoopEnd   uint16
+
+	// Crossfade baked into the loop end, in % of the loop, see fadeLoops
+	LoopFade uint8
+
+	// With any zones, each note plays the sample of the first zone that
+	// reaches up to it instead of Sample. Zones are sorted by High. Zones
+	// sharing a High are round-robin variations, played in turn.
+	Zones    [MAX_ZONES]SampleZone
+	NumZones uint8
+
+	// With any slices, each note plays one slice of Sample at its own
+	// pitch instead of using the zones, see sliceFor. Slices are start
+	// offsets in 1/65536 of the sample's length, ascending.
+	Slices    [MAX_SLICES]uint16
+	NumSlices uint8
+
+	// Steps every note through volume, pitch and commands, see TablePlayer
+	Table Table
+
+	// Pitch movement, see PitchVoice. Glide is in ms, VibratoDepth in
+	// cents and VibratoRate in 0.1Hz.
+	Glide        uint8
+	VibratoDepth uint8
+	VibratoRate  uint8
+
+	// Macros of a drum instrument, see DrumVoice
+	Drum DrumParams
+
+	// Operators of an FM instrument, see FMVoice
+	FM FMParams
+
+	// Grains a granular instrument plays its Sample as, see GranularVoice
+	Grain GrainParams
+
+	// String of a plucked instrument, see PluckVoice
+	Pluck PluckParams
+
+	// Pulse width of an oscillator instrument and its sweep, see
+	// OscillatorVoice
+	Duty       uint8
+	SweepRate  uint8
+	SweepDepth uint8
+
+	// Amp envelope and low pass filter, see ToneShaper. Attack and
+	// Release are in 10ms, Cutoff 0 leaves the filter open.
+	Attack    uint8
+	Release   uint8
+	Cutoff    uint8
+	Resonance uint8
+
+	// Level into the send effect the track takes when it changes to the
+	// instrument, 0 leaving the track's as it is
+	Send uint8
+
+	// Controls moving several of the above at once, see knob.go
+	Knobs [NUM_KNOBS]MacroKnob
+
+	robin uint8 // Next round-robin variation, see nextZone
+}
+
+// Macro parameters of a drum instrument, 0-255
+type DrumParams struct {
+	Decay, Tone, Snap uint8
+}
+
+// Operator settings of an FM instrument, as in FMVoice
+type FMParams struct {
+	Ratio, Index, Feedback uint8
+}
+
+// Grain settings of a granular instrument, as in GranularVoice except
+// that Position is in 1/256 of the sample's length
+type GrainParams struct {
+	Size, Density, Position, Spray uint8
+}
+
+// Tone and ring of a plucked instrument, 0-255
+type PluckParams struct {
+	Damping, Decay uint8
+}
+
+// A key range of a sample instrument, from the zone below it up to High
+type SampleZone struct {
+	Sample uint8
+	High   uint8
+	Root   uint8 // Note that plays the sample at its own pitch, EMPTY for the sample's own
+	Fine   int8  // Tuning in cents, added to the instrument's
+}
+
+// Rows an instrument steps through while a note plays, one every Rate
+// ticks, looping at the end. Rate 0 turns the table off.
+type Table struct {
+	Rows [TABLE_ROWS]TableRow
+	Rate uint8
+}
+
+// Volume is the note level from the row on, 0 keeping the previous
+// row's. Pitch is in semitones from the played note. FX runs like a step
+// command, FX_HOP jumping to another row.
+type TableRow struct {
+	Volume uint8
+	Pitch  int8
+	FX     StepFX
+}
+
+// Zone playing a note as the given round-robin variation, and how many
+// variations its key range has. Without zones, or above the last, that is
+// Sample at its own root.
+func (in *Instrument) zoneFor(note, robin uint8) (SampleZone, int) {
+	zones := in.Zones[:min(in.NumZones, MAX_ZONES)]
+	for i, z := range zones {
+		if note > z.High {
+			continue
+		}
+		n := 1
+		for n < MAX_ROBINS && i+n < len(zones) && zones[i+n].High == z.High {
+			n++
+		}
+		return zones[i+int(robin)%n], n
+	}
+	return SampleZone{Sample: in.Sample, High: NUM_NOTES - 1, Root: EMPTY}, 1
+}
+
+// Zone for the next hit of a note, stepping the instrument's round-robin
+// counter when its key range has variations. The counter is shared by all
+// notes of the instrument, so a render that starts from resetRoundRobin
+// always picks the same variations.
+func (in *Instrument) nextZone(note uint8) SampleZone {
+	z, n := in.zoneFor(note, in.robin)
+	if n > 1 {
+		in.robin++
+	}
+	return z
+}
+
+// Start and end of the slice a note plays, in 1/65536 of the sample's
+// length, end 0 for the end of the sample. SLICE_BASE_NOTE plays the
+// first slice, the notes above it the next ones, wrapping around.
+func (in *Instrument) sliceFor(note uint8) (start, end uint16) {
+	n := int(min(in.NumSlices, MAX_SLICES))
+	i := ((int(note)-SLICE_BASE_NOTE)%n + n) % n
+	if i+1 < n {
+		end = in.Slices[i+1]
+	}
+	return in.Slices[i], end
+}
+
+// Start every instrument's round-robin from its first variation
+func (p *Project) resetRoundRobin() {
+	for i := range p.Instruments {
+		p.Instruments[i].robin = 0
+	}
+}
+
+// Sample slots the instrument plays
+func (in *Instrument) usedSamples() []uint8 {
+	used := []uint8{in.Sample}
+	for _, z := range in.Zones[:min(in.NumZones, MAX_ZONES)] {
+		used = append(used, z.Sample)
+	}
+	return used
+}
+
+// Ducking of the mix by one track, see Compressor for the units. Key is
+// EMPTY when off.
+type Sidechain struct {
+	Key       uint8
+	Threshold uint8
+	Ratio     uint8
+	Attack    uint8
+	Release   uint8
+}
+
+// Chorus insert of a track, see Chorus for the units. Mix 0 is off.
+type ChorusSettings struct {
+	Rate  uint8
+	Depth uint8
+	Mix   uint8
+}
+
+// Send reverb, see Reverb for the units
+type ReverbSettings struct {
+	RoomSize uint8
+	Damping  uint8
+	Mix      uint8
+}
+
+// Noise gate insert of a track, see Gate for the units. Threshold 0 is
+// off.
+type GateSettings struct {
+	Threshold uint8
+	Release   uint8
+}
+
+// Bitcrusher insert of a track, see Bitcrusher. 16 bits and Downsample 1
+// is off.
+type CrushSettings struct {
+	Bits       uint8
+	Downsample uint8
+}
+
+// Group bus of the mixer, see group.go. Volume is 0-255.
+type GroupSettings struct {
+	Volume uint8
+	Insert GroupInsert
+}
+
+// Values of a parameter a phrase plays step by step, see motion.go. Set
+// has a bit per step holding a value. Phrase EMPTY marks a free slot.
+type Motion struct {
+	Phrase uint8
+	Param  MotionParam
+	Set    uint16
+	Values [PHRASE_STEPS]uint8
+}
+
+// A whole song: the song grid holds a chain per track per row, chains list
+// phrases and phrases hold the notes. Samples are paths relative to the
+// samples folder so projects can share them.
+type Project struct {
+	Name        string
+	Tempo       uint16
+	Groove      uint8 // Swing, see stepLength
+	Song        [SONG_ROWS][NUM_TRACKS]uint8
+	Chains      [NUM_CHAINS]Chain
+	Phrases     [NUM_PHRASES]Phrase
+	Instruments [NUM_INSTRUMENTS]Instrument
+	Samples     [MAX_SAMPLES]string
+	SampleEdits [MAX_SAMPLES]SampleEdit // Applied as the samples load
+	SampleSums  [MAX_SAMPLES]uint32     // CRCs of the samples' audio, 0 until read, see integrity.go
+	Sidechain   Sidechain
+	Width       uint8 // Of the master bus in %, see width.go
+	Reverb      ReverbSettings
+	Chorus      [NUM_TRACKS]ChorusSettings
+	Gates       [NUM_TRACKS]GateSettings
+	Crush       [NUM_TRACKS]CrushSettings
+	Trims       [NUM_TRACKS]uint8 // Track gain after volume, 255 for none, see gainstaging.go
+	Routes      [NUM_TRACKS]Route
+	TrackGroups [NUM_TRACKS]uint8 // Group bus of each track, 0 for none
+	Groups      [NUM_GROUPS]GroupSettings
+	Motions     [NUM_MOTIONS]Motion
+
+	// General MIDI program each instrument exports as, EMPTY to guess
+	// from the instrument or MIDI_DRUMS for the drum channel, see
+	// midiexport.go
+	MIDIPrograms [NUM_INSTRUMENTS]uint8
+}
+
+// The project being edited
+var project = newProject("UNTITLED")
+
+// Create an empty project
+func newProject(name string) *Project {
+	p := &Project{Name: name, Tempo: DEFAULT_TEMPO}
+	p.Clear()
+	return p
+}
+
+// Reset every cell to empty
+func (p *Project) Clear() {
+	for r := range p.Song {
+		for t := range p.Song[r] {
+			p.Song[r][t] = EMPTY
+		}
+	}
+	for c := range p.Chains {
+		p.Chains[c] = emptyChain()
+	}
+	for i := range p.Phrases {
+		p.Phrases[i] = emptyPhrase()
+	}
+	for i := range p.Instruments {
+		p.Instruments[i] = defaultInstrument()
+	}
+	for i := range p.Samples {
+		p.Samples[i], p.SampleEdits[i], p.SampleSums[i] = "", SampleEdit{}, 0
+	}
+	p.Sidechain = defaultSidechain()
+	p.Width = WIDTH_NORMAL
+	p.Reverb = defaultReverb()
+	for t := range p.Chorus {
+		p.Chorus[t] = defaultChorus()
+		p.Gates[t] = defaultGate()
+		p.Crush[t] = defaultCrush()
+		p.Trims[t] = 255
+	}
+	p.TrackGroups = [NUM_TRACKS]uint8{}
+	for g := range p.Groups {
+		p.Groups[g] = defaultGroup()
+	}
+	for i := range p.Motions {
+		p.Motions[i] = Motion{Phrase: EMPTY}
+	}
+	for i := range p.MIDIPrograms {
+		p.MIDIPrograms[i] = EMPTY
+	}
+}
+
+func emptyChain() Chain {
+	var c Chain
+	for i := range c.Entries {
+		c.Entries[i] = ChainEntry{Phrase: EMPTY}
+	}
+	return c
+}
+
+func emptyPhrase() Phrase {
+	var ph Phrase
+	for i := range ph.Steps {
+		ph.Steps[i] = Step{Note: EMPTY, Instrument: EMPTY}
+	}
+	return ph
+}
+
+func defaultInstrument() Instrument {
+	return Instrument{Sample: EMPTY, Volume: 255, Pan: PAN_CENTER, VibratoRate: DEFAULT_VIBRATO_RATE,
+		Duty: DUTY_50, SweepRate: DEFAULT_SWEEP_RATE, FM: fmDefaults,
+		Grain: grainDefaults, Pluck: pluckDefaults}
+}
+
+// Whether a phrase holds no notes, commands or timing overrides
+func (ph *Phrase) IsEmpty() bool {
+	if ph.Tempo != 0 || ph.Groove != 0 {
+		return false
+	}
+	for _, s := range ph.Steps {
+		if s.Note != EMPTY || s.Instrument != EMPTY || s.FX != [NUM_FX]StepFX{} {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether a chain lists no phrases
+func (c *Chain) IsEmpty() bool {
+	for _, e := range c.Entries {
+		if e.Phrase != EMPTY {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether any chain plays a phrase
+func (p *Project) phraseUsed(index uint8) bool {
+	for c := range p.Chains {
+		for _, e := range p.Chains[c].Entries {
+			if e.Phrase == index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether the song grid uses a chain
+func (p *Project) chainUsed(index uint8) bool {
+	for r := range p.Song {
+		for _, c := range p.Song[r] {
+			if c == index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Chain entries a song row plays, 0 for an empty row. A row lasts as long
+// as its longest chain, and a chain ends at its first empty entry.
+func (p *Project) rowEntries(row int) int {
+	longest := 0
+	for _, c := range p.Song[row] {
+		if c == EMPTY || int(c) >= NUM_CHAINS {
+			continue
+		}
+		n := 0
+		for n < CHAIN_LENGTH && p.Chains[c].Entries[n].Phrase != EMPTY {
+			n++
+		}
+		longest = max(longest, n)
+	}
+	return longest
+}
+
+// First unused empty phrase, or EMPTY if none is left
+func (p *Project) freePhrase() uint8 {
+	for i := range p.Phrases {
+		if p.Phrases[i].IsEmpty() && !p.phraseUsed(uint8(i)) {
+			return uint8(i)
+		}
+	}
+	return EMPTY
+}
+
+// First unused empty chain, or EMPTY if none is left
+func (p *Project) freeChain() uint8 {
+	for i := range p.Chains {
+		if p.Chains[i].IsEmpty() && !p.chainUsed(uint8(i)) {
+			return uint8(i)
+		}
+	}
+	return EMPTY
+}
+
+// First unused default instrument, or EMPTY if none is left
+func (p *Project) freeInstrument() uint8 {
+	for i := range p.Instruments {
+		if p.Instruments[i].Type == INSTR_NONE && p.Instruments[i].Name == "" {
+			return uint8(i)
+		}
+	}
+	return EMPTY
+}
+
+// Index of a sample path in the sample list, or EMPTY if it isn't there
+func (p *Project) sampleSlot(path string) uint8 {
+	for i, s := range p.Samples {
+		if s == path {
+			return uint8(i)
+		}
+	}
+	return EMPTY
+}
+
+// Index of a sample path, adding it to the sample list if needed.
+// Returns EMPTY when the list is full.
+func (p *Project) sampleIndex(path string) uint8 {
+	free := -1
+	for i, s := range p.Samples {
+		if s == path {
+			return uint8(i)
+		}
+		if s == "" && free < 0 {
+			free = i
+		}
+	}
+	if free < 0 {
+		return EMPTY
+	}
+	p.Samples[free], p.SampleEdits[free], p.SampleSums[free] = path, SampleEdit{}, 0
+	return uint8(free)
+}
@@ -0,0 +1,267 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Differences between two versions of a project, a line for each changed
+// phrase, chain, instrument, sample or song setting. The on-device view
+// shows the summary against the saved file or another project; the diff
+// shell command adds the steps and instrument parts that changed, for
+// comparing versions from a computer.
+
+// Parts of an instrument compared separately, so a diff can say which
+// changed
+var instrumentParts = []struct {
+	name string
+	same func(a, b *Instrument) bool
+}{
+	{"NAME", func(a, b *Instrument) bool { return a.Name == b.Name }},
+	{"TYPE", func(a, b *Instrument) bool { return a.Type == b.Type }},
+	{"SOUND", func(a, b *Instrument) bool {
+		return a.Sample == b.Sample && a.Wave == b.Wave && a.Interpolate == b.Interpolate
+	}},
+	{"LEVEL", func(a, b *Instrument) bool { return a.Volume == b.Volume && a.Pan == b.Pan }},
+	{"TUNING", func(a, b *Instrument) bool { return a.Fine == b.Fine }},
+	{"EQ", func(a, b *Instrument) bool { return a.EQ == b.EQ }},
+	{"LOOP", func(a, b *Instrument) bool {
+		return a.Loop == b.Loop && a.Play == b.Play && a.Reverse == b.Reverse &&
+			a.LoopStart == b.LoopStart && a.LoopEnd == b.LoopEnd && a.LoopFade == b.LoopFade
+	}},
+	{"ZONES", func(a, b *Instrument) bool { return a.Zones == b.Zones && a.NumZones == b.NumZones }},
+	{"SLICES", func(a, b *Instrument) bool { return a.Slices == b.Slices && a.NumSlices == b.NumSlices }},
+	{"TABLE", func(a, b *Instrument) bool { return a.Table == b.Table }},
+	{"PITCH", func(a, b *Instrument) bool {
+		return a.Glide == b.Glide && a.VibratoDepth == b.VibratoDepth && a.VibratoRate == b.VibratoRate
+	}},
+	{"DRUM", func(a, b *Instrument) bool { return a.Drum == b.Drum }},
+	{"FM", func(a, b *Instrument) bool { return a.FM == b.FM }},
+	{"GRAIN", func(a, b *Instrument) bool { return a.Grain == b.Grain }},
+	{"PLUCK", func(a, b *Instrument) bool { return a.Pluck == b.Pluck }},
+	{"OSCILLATOR", func(a, b *Instrument) bool {
+		return a.Duty == b.Duty && a.SweepRate == b.SweepRate && a.SweepDepth == b.SweepDepth
+	}},
+	{"KNOBS", func(a, b *Instrument) bool { return a.Knobs == b.Knobs }},
+	{"TONE", func(a, b *Instrument) bool {
+		return a.Attack == b.Attack && a.Release == b.Release && a.Cutoff == b.Cutoff && a.Resonance == b.Resonance
+	}},
+	{"SEND", func(a, b *Instrument) bool { return a.Send == b.Send }},
+}
+
+// Changes from project a to project b. With detail, changed phrases list
+// their steps and changed instruments the parts that differ.
+func diffProjects(a, b *Project, detail bool) []string {
+	var lines []string
+	if a.Tempo != b.Tempo {
+		lines = append(lines, "TEMPO "+itoa(int(a.Tempo))+" > "+itoa(int(b.Tempo)))
+	}
+	if a.Groove != b.Groove {
+		lines = append(lines, "GROOVE "+itoa(int(a.Groove))+" > "+itoa(int(b.Groove)))
+	}
+	cells := 0
+	for r := range a.Song {
+		for t := range a.Song[r] {
+			if a.Song[r][t] != b.Song[r][t] {
+				cells++
+			}
+		}
+	}
+	if cells > 0 {
+		lines = append(lines, "SONG: "+itoa(cells)+" CELLS")
+	}
+	for i := range a.Chains {
+		if a.Chains[i] != b.Chains[i] {
+			lines = append(lines, "CHAIN "+hexByte(uint8(i))+changeKind(a.Chains[i].IsEmpty(), b.Chains[i].IsEmpty()))
+		}
+	}
+	for i := range a.Phrases {
+		lines = append(lines, diffPhrase(&a.Phrases[i], &b.Phrases[i], uint8(i), detail)...)
+	}
+	for i := range a.Instruments {
+		lines = append(lines, diffInstrument(&a.Instruments[i], &b.Instruments[i], uint8(i), detail)...)
+	}
+	for i := range a.Samples {
+		if a.Samples[i] != b.Samples[i] {
+			lines = append(lines, "SAMPLE "+hexByte(uint8(i))+": "+orNone(a.Samples[i])+" > "+orNone(b.Samples[i]))
+		} else if a.SampleEdits[i] != b.SampleEdits[i] {
+			lines = append(lines, "SAMPLE "+hexByte(uint8(i))+": EDIT")
+		}
+	}
+	if a.Sidechain != b.Sidechain {
+		lines = append(lines, "SIDECHAIN")
+	}
+	if a.Width != b.Width {
+		lines = append(lines, "WIDTH "+itoa(int(a.Width))+" > "+itoa(int(b.Width)))
+	}
+	if a.Reverb != b.Reverb {
+		lines = append(lines, "REVERB")
+	}
+	for t := range a.Chorus {
+		if a.Chorus[t] != b.Chorus[t] {
+			lines = append(lines, "CHORUS TRACK "+itoa(t+1))
+		}
+		if a.Gates[t] != b.Gates[t] {
+			lines = append(lines, "GATE TRACK "+itoa(t+1))
+		}
+		if a.Crush[t] != b.Crush[t] {
+			lines = append(lines, "CRUSH TRACK "+itoa(t+1))
+		}
+		if a.Trims[t] != b.Trims[t] {
+			lines = append(lines, "TRIM TRACK "+itoa(t+1)+": "+itoa(int(b.Trims[t])))
+		}
+		if a.Routes[t] != b.Routes[t] {
+			lines = append(lines, "ROUTE TRACK "+itoa(t+1)+": "+routeNames[b.Routes[t]%NUM_ROUTES])
+		}
+		if a.TrackGroups[t] != b.TrackGroups[t] {
+			lines = append(lines, "GROUP TRACK "+itoa(t+1)+": "+groupText(b.TrackGroups[t]))
+		}
+	}
+	for g := range a.Groups {
+		if a.Groups[g] != b.Groups[g] {
+			lines = append(lines, "GROUP "+itoa(g+1))
+		}
+	}
+	motions := 0
+	for i := range a.Motions {
+		if a.Motions[i] != b.Motions[i] {
+			motions++
+		}
+	}
+	if motions > 0 {
+		lines = append(lines, "MOTIONS: "+itoa(motions))
+	}
+	if a.MIDIPrograms != b.MIDIPrograms {
+		lines = append(lines, "MIDI PROGRAMS")
+	}
+	return lines
+}
+
+// What became of something empty or not in a and b, after its name
+func changeKind(aEmpty, bEmpty bool) string {
+	switch {
+	case aEmpty:
+		return ": NEW"
+	case bEmpty:
+		return ": REMOVED"
+	}
+	return ""
+}
+
+// A sample name, or NONE for an empty slot
+func orNone(name string) string {
+	if name == "" {
+		return "NONE"
+	}
+	return name
+}
+
+// Lines for a changed phrase, none when it is the same
+func diffPhrase(a, b *Phrase, index uint8, detail bool) []string {
+	if *a == *b {
+		return nil
+	}
+	kind := changeKind(a.IsEmpty(), b.IsEmpty())
+	line := "PHRASE " + hexByte(index) + kind
+	var steps []string
+	for s := range a.Steps {
+		if a.Steps[s] != b.Steps[s] {
+			steps = append(steps, "  "+hexByte(uint8(s))+" "+stepText(&a.Steps[s])+" > "+stepText(&b.Steps[s]))
+		}
+	}
+	if kind == "" && len(steps) > 0 {
+		line += ": " + itoa(len(steps)) + " STEPS"
+	}
+	if a.Tempo != b.Tempo {
+		line += " TEMPO"
+	}
+	if a.Groove != b.Groove {
+		line += " GROOVE"
+	}
+	if !detail {
+		return []string{line}
+	}
+	return append([]string{line}, steps...)
+}
+
+// Line for a changed instrument, none when it is the same. robin is play
+// state, not part of the instrument.
+func diffInstrument(a, b *Instrument, index uint8, detail bool) []string {
+	ca, cb := *a, *b
+	ca.robin, cb.robin = 0, 0
+	if ca == cb {
+		return nil
+	}
+	line := "INSTRUMENT " + hexByte(index)
+	if b.Name != "" {
+		line += " " + b.Name
+	}
+	if kind := changeKind(a.Type == INSTR_NONE, b.Type == INSTR_NONE); kind != "" || !detail {
+		return []string{line + kind}
+	}
+	line += ":"
+	for _, part := range instrumentParts {
+		if !part.same(a, b) {
+			line += " " + part.name
+		}
+	}
+	return []string{line}
+}
+
+func init() {
+	addTool("DIFF PROJECT", openDiffView)
+	addCommand("diff", "diff A [B]: changes from project A to B, or to the open project", func(args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			shellPrint("usage: diff A [B]\n")
+			return
+		}
+		a := newProject(args[0])
+		if err := loadProject(args[0], a); err != nil {
+			shellPrint("can't load " + args[0] + ": " + err.Error() + "\n")
+			return
+		}
+		b := project
+		if len(args) == 2 {
+			b = newProject(args[1])
+			if err := loadProject(args[1], b); err != nil {
+				shellPrint("can't load " + args[1] + ": " + err.Error() + "\n")
+				return
+			}
+		}
+		lines := diffProjects(a, b, true)
+		if len(lines) == 0 {
+			shellPrint("no differences\n")
+		}
+		for _, line := range lines {
+			shellPrint(line + "\n")
+		}
+	})
+}
+
+// Pick the saved version of the open project or another project, then
+// list what the open project changes from it
+func openDiffView() {
+	names := []string{"SAVED VERSION"}
+	entries, _ := storage.ReadDir(projectsDir)
+	for _, e := range entries {
+		if e.Dir && e.Name != project.Name {
+			names = append(names, e.Name)
+		}
+	}
+	pushView(&ListView{Title: "DIFF WITH", Items: names, OnSelect: func(i int) {
+		name := names[i]
+		if i == 0 {
+			name = project.Name
+		}
+		other := newProject(name)
+		if err := loadProject(name, other); err != nil {
+			println("Failed to load project:", err.Error())
+			showStatus("LOAD FAILED", colorRed)
+			return
+		}
+		lines := diffProjects(other, project, false)
+		if len(lines) == 0 {
+			lines = append(lines, "NO DIFFERENCES")
+		}
+		popView()
+		pushView(&ListView{Title: "CHANGES FROM " + name, Items: lines})
+	}})
+}
@@ -0,0 +1,684 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"hash/crc32"
+)
+
+// Project files start with a magic and version followed by chunks of
+// [4]byte id, uint32 length and payload, all little endian. Readers skip
+// chunks they don't know, and records carry their size so fields added at
+// the end of a record read back as zero from older files.
+const (
+	PROJECT_MAGIC   = "PTPJ"
+	PROJECT_VERSION = 1
+
+	INSTRUMENT_NAME_LEN = 12
+	STEP_RECORD_SIZE    = 2 + 2*NUM_FX
+)
+
+var errBadProject = errors.New("project: not a project file")
+
+// Little endian byte builder
+type byteWriter struct {
+	buf []byte
+}
+
+func (w *byteWriter) u8(v uint8) { w.buf = append(w.buf, v) }
+
+func (w *byteWriter) flag(b bool) {
+	if b {
+		w.u8(1)
+	} else {
+		w.u8(0)
+	}
+}
+
+func (w *byteWriter) u16(v uint16) { w.buf = append(w.buf, byte(v), byte(v>>8)) }
+
+func (w *byteWriter) u32(v uint32) {
+	w.buf = append(w.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// Length-prefixed string, truncated to 255 bytes
+func (w *byteWriter) str(s string) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	w.u8(uint8(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// String padded or truncated to n bytes
+func (w *byteWriter) fixedStr(s string, n int) {
+	for i := 0; i < n; i++ {
+		if i < len(s) {
+			w.u8(s[i])
+		} else {
+			w.u8(0)
+		}
+	}
+}
+
+// Start a chunk, returning the offset to pass to endChunk
+func (w *byteWriter) beginChunk(id string) int {
+	w.buf = append(w.buf, id...)
+	w.u32(0)
+	return len(w.buf)
+}
+
+// Patch the length of the chunk started at start
+func (w *byteWriter) endChunk(start int) {
+	n := uint32(len(w.buf) - start)
+	w.buf[start-4] = byte(n)
+	w.buf[start-3] = byte(n >> 8)
+	w.buf[start-2] = byte(n >> 16)
+	w.buf[start-1] = byte(n >> 24)
+}
+
+// Little endian reader; reading past the end yields zeros
+type byteReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *byteReader) u8() uint8 {
+	if r.pos >= len(r.buf) {
+		r.pos++
+		return 0
+	}
+	v := r.buf[r.pos]
+	r.pos++
+	return v
+}
+
+func (r *byteReader) flag() bool { return r.u8() != 0 }
+
+func (r *byteReader) u16() uint16 { return uint16(r.u8()) | uint16(r.u8())<<8 }
+
+func (r *byteReader) u32() uint32 { return uint32(r.u16()) | uint32(r.u16())<<16 }
+
+func (r *byteReader) str() string {
+	n := int(r.u8())
+	return r.fixedStr(n)
+}
+
+func (r *byteReader) fixedStr(n int) string {
+	b := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if c := r.u8(); c != 0 {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// Reader over the next size bytes; r skips past them
+func (r *byteReader) sub(size int) byteReader {
+	start := r.pos
+	r.pos += size
+	if start > len(r.buf) {
+		start = len(r.buf)
+	}
+	end := min(r.pos, len(r.buf))
+	return byteReader{buf: r.buf[start:end]}
+}
+
+func (r *byteReader) done() bool { return r.pos >= len(r.buf) }
+
+// Serialize a project
+func encodeProject(p *Project) []byte {
+	w := &byteWriter{}
+	w.buf = append(w.buf, PROJECT_MAGIC...)
+	w.u16(PROJECT_VERSION)
+
+	c := w.beginChunk("INFO")
+	w.str(p.Name)
+	w.u16(p.Tempo)
+	w.u8(p.Groove)
+	w.endChunk(c)
+
+	c = w.beginChunk("SONG")
+	w.u16(SONG_ROWS)
+	w.u8(NUM_TRACKS)
+	for r := range p.Song {
+		for _, chain := range p.Song[r] {
+			w.u8(chain)
+		}
+	}
+	w.endChunk(c)
+
+	// Chains and phrases are stored sparsely with their index
+	c = w.beginChunk("CHNS")
+	w.u8(CHAIN_LENGTH)
+	for i := range p.Chains {
+		if p.Chains[i].IsEmpty() {
+			continue
+		}
+		w.u8(uint8(i))
+		for _, e := range p.Chains[i].Entries {
+			w.u8(e.Phrase)
+			w.u8(uint8(e.Transpose))
+		}
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("PHRS")
+	w.u8(PHRASE_STEPS)
+	w.u8(STEP_RECORD_SIZE)
+	for i := range p.Phrases {
+		if p.Phrases[i].IsEmpty() {
+			continue
+		}
+		w.u8(uint8(i))
+		for _, s := range p.Phrases[i].Steps {
+			encodeStep(w, &s)
+		}
+	}
+	w.endChunk(c)
+
+	// Phrase tempo and groove overrides, sparsely
+	c = w.beginChunk("PHTG")
+	for i := range p.Phrases {
+		ph := &p.Phrases[i]
+		if ph.Tempo == 0 && ph.Groove == 0 {
+			continue
+		}
+		w.u8(uint8(i))
+		w.u16(ph.Tempo)
+		w.u8(ph.Groove)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("INST")
+	rec := &byteWriter{}
+	encodeInstrument(rec, &p.Instruments[0])
+	w.u8(NUM_INSTRUMENTS)
+	w.u16(uint16(len(rec.buf)))
+	for i := range p.Instruments {
+		encodeInstrument(w, &p.Instruments[i])
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("SMPL")
+	w.u8(MAX_SAMPLES)
+	for _, s := range p.Samples {
+		w.str(s)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("DUCK")
+	sc := &p.Sidechain
+	w.u8(sc.Key)
+	w.u8(sc.Threshold)
+	w.u8(sc.Ratio)
+	w.u8(sc.Attack)
+	w.u8(sc.Release)
+	w.endChunk(c)
+
+	c = w.beginChunk("MSTR")
+	w.u8(p.Width)
+	w.endChunk(c)
+
+	c = w.beginChunk("CHOR")
+	w.u8(NUM_TRACKS)
+	for _, cs := range p.Chorus {
+		w.u8(cs.Rate)
+		w.u8(cs.Depth)
+		w.u8(cs.Mix)
+	}
+	w.endChunk(c)
+
+	// Motion sequences, sparsely
+	c = w.beginChunk("MOTN")
+	w.u8(PHRASE_STEPS)
+	for _, m := range p.Motions {
+		if m.Phrase == EMPTY {
+			continue
+		}
+		w.u8(m.Phrase)
+		w.u8(uint8(m.Param))
+		w.u16(m.Set)
+		for _, v := range m.Values {
+			w.u8(v)
+		}
+	}
+	w.endChunk(c)
+
+	// MIDI export map, one byte per instrument
+	c = w.beginChunk("GMAP")
+	w.buf = append(w.buf, p.MIDIPrograms[:]...)
+	w.endChunk(c)
+
+	// Sample edits, sparsely
+	c = w.beginChunk("SEDT")
+	for i, e := range p.SampleEdits {
+		if e == (SampleEdit{}) {
+			continue
+		}
+		w.u8(uint8(i))
+		w.u16(e.Start)
+		w.u16(e.End)
+		w.u8(boolByte(e.Normalize) | boolByte(e.Reverse)<<1)
+	}
+	w.endChunk(c)
+
+	// Sample CRCs, sparsely
+	c = w.beginChunk("SSUM")
+	for i, sum := range p.SampleSums {
+		if sum != 0 {
+			w.u8(uint8(i))
+			w.u32(sum)
+		}
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("GATE")
+	w.u8(NUM_TRACKS)
+	for _, gs := range p.Gates {
+		w.u8(gs.Threshold)
+		w.u8(gs.Release)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("CRSH")
+	w.u8(NUM_TRACKS)
+	for _, cs := range p.Crush {
+		w.u8(cs.Bits)
+		w.u8(cs.Downsample)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("TRIM")
+	w.u8(NUM_TRACKS)
+	for _, v := range p.Trims {
+		w.u8(v)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("ROUT")
+	w.u8(NUM_TRACKS)
+	for _, r := range p.Routes {
+		w.u8(uint8(r))
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("GRPS")
+	w.u8(NUM_GROUPS)
+	for _, gs := range p.Groups {
+		w.u8(gs.Volume)
+		w.u8(uint8(gs.Insert))
+	}
+	w.u8(NUM_TRACKS)
+	for _, g := range p.TrackGroups {
+		w.u8(g)
+	}
+	w.endChunk(c)
+
+	c = w.beginChunk("REVB")
+	w.u8(p.Reverb.RoomSize)
+	w.u8(p.Reverb.Damping)
+	w.u8(p.Reverb.Mix)
+	w.endChunk(c)
+
+	// CRC of everything before it, see checkProjectData. Keep it last.
+	sum := crc32.ChecksumIEEE(w.buf)
+	c = w.beginChunk("CSUM")
+	w.u32(sum)
+	w.endChunk(c)
+
+	return w.buf
+}
+
+func encodeStep(w *byteWriter, s *Step) {
+	w.u8(s.Note)
+	w.u8(s.Instrument)
+	for _, fx := range s.FX {
+		w.u8(fx.Command)
+		w.u8(fx.Param)
+	}
+}
+
+func decodeStep(r *byteReader, s *Step) {
+	s.Note = r.u8()
+	s.Instrument = r.u8()
+	for i := range s.FX {
+		s.FX[i] = StepFX{r.u8(), r.u8()}
+	}
+}
+
+func encodeInstrument(w *byteWriter, in *Instrument) {
+	w.fixedStr(in.Name, INSTRUMENT_NAME_LEN)
+	w.u8(uint8(in.Type))
+	w.u8(in.Sample)
+	w.u8(in.Wave)
+	w.u8(in.Volume)
+	w.u8(in.Pan)
+	w.u8(uint8(in.Fine))
+	w.flag(in.Interpolate)
+	w.u8(in.NumZones)
+	for _, z := range in.Zones {
+		w.u8(z.Sample)
+		w.u8(z.High)
+		w.u8(z.Root)
+	}
+	for _, z := range in.Zones {
+		w.u8(uint8(z.Fine))
+	}
+	for _, db := range in.EQ {
+		w.u8(uint8(db))
+	}
+	w.u8(uint8(in.Loop))
+	w.u8(uint8(in.Play))
+	w.flag(in.Reverse)
+	w.u16(in.LoopStart)
+	w.u16(in.LoopEnd)
+	w.u8(in.NumSlices)
+	for _, o := range in.Slices {
+		w.u16(o)
+	}
+	w.u8(in.Table.Rate)
+	for _, row := range in.Table.Rows {
+		w.u8(row.Volume)
+		w.u8(uint8(row.Pitch))
+		w.u8(row.FX.Command)
+		w.u8(row.FX.Param)
+	}
+	w.u8(in.Glide)
+	w.u8(in.VibratoDepth)
+	w.u8(in.VibratoRate)
+	w.u8(in.Drum.Decay)
+	w.u8(in.Drum.Tone)
+	w.u8(in.Drum.Snap)
+	w.u8(in.Duty)
+	w.u8(in.SweepRate)
+	w.u8(in.SweepDepth)
+	w.u8(in.LoopFade)
+	for _, k := range in.Knobs {
+		w.u8(uint8(k.Dest))
+		w.u8(uint8(k.Depth))
+		w.u8(k.Value)
+	}
+	w.u8(in.Attack)
+	w.u8(in.Release)
+	w.u8(in.Cutoff)
+	w.u8(in.Resonance)
+	w.u8(in.Send)
+	w.u8(in.FM.Ratio)
+	w.u8(in.FM.Index)
+	w.u8(in.FM.Feedback)
+	w.u8(in.Grain.Size)
+	w.u8(in.Grain.Density)
+	w.u8(in.Grain.Position)
+	w.u8(in.Grain.Spray)
+	w.u8(in.Pluck.Damping)
+	w.u8(in.Pluck.Decay)
+}
+
+func decodeInstrument(r *byteReader, in *Instrument) {
+	in.Name = r.fixedStr(INSTRUMENT_NAME_LEN)
+	in.Type = InstrumentType(r.u8())
+	in.Sample = r.u8()
+	in.Wave = r.u8()
+	in.Volume = r.u8()
+	in.Pan = r.u8()
+	in.Fine = int8(r.u8())
+	in.Interpolate = r.flag()
+	in.NumZones = min(r.u8(), MAX_ZONES)
+	for i := range in.Zones {
+		in.Zones[i] = SampleZone{Sample: r.u8(), High: r.u8(), Root: r.u8()}
+	}
+	for i := range in.Zones {
+		in.Zones[i].Fine = int8(r.u8())
+	}
+	for b := range in.EQ {
+		in.EQ[b] = int8(r.u8())
+	}
+	in.Loop = LoopMode(r.u8())
+	in.Play = PlayMode(r.u8())
+	in.Reverse = r.flag()
+	in.LoopStart = r.u16()
+	in.LoopEnd = r.u16()
+	in.NumSlices = min(r.u8(), MAX_SLICES)
+	for i := range in.Slices {
+		in.Slices[i] = r.u16()
+	}
+	in.Table.Rate = r.u8()
+	for i := range in.Table.Rows {
+		in.Table.Rows[i] = TableRow{Volume: r.u8(), Pitch: int8(r.u8()),
+			FX: StepFX{r.u8(), r.u8()}}
+	}
+	in.Glide = r.u8()
+	in.VibratoDepth = r.u8()
+	if in.VibratoRate = r.u8(); in.VibratoRate == 0 {
+		in.VibratoRate = DEFAULT_VIBRATO_RATE // Saved before vibrato
+	}
+	in.Drum = DrumParams{r.u8(), r.u8(), r.u8()}
+	if in.Duty = r.u8(); in.Duty == 0 {
+		in.Duty = DUTY_50 // Saved before pulse widths
+	}
+	if in.SweepRate = r.u8(); in.SweepRate == 0 {
+		in.SweepRate = DEFAULT_SWEEP_RATE
+	}
+	in.SweepDepth = r.u8()
+	in.LoopFade = r.u8()
+	for i := range in.Knobs {
+		in.Knobs[i] = MacroKnob{KnobDest(r.u8()), int8(r.u8()), r.u8()}
+	}
+	in.Attack = r.u8()
+	in.Release = r.u8()
+	in.Cutoff = r.u8()
+	in.Resonance = r.u8()
+	in.Send = r.u8()
+	if in.FM = (FMParams{r.u8(), r.u8(), r.u8()}); in.FM.Ratio == 0 {
+		in.FM = fmDefaults // Saved before FM instruments
+	}
+	if in.Grain = (GrainParams{r.u8(), r.u8(), r.u8(), r.u8()}); in.Grain.Size == 0 {
+		in.Grain = grainDefaults // Saved before granular instruments
+	}
+	if r.done() {
+		in.Pluck = pluckDefaults // Saved before plucked instruments
+	} else {
+		in.Pluck = PluckParams{r.u8(), r.u8()}
+	}
+}
+
+// Parse a project file into p
+func decodeProject(data []byte, p *Project) error {
+	if len(data) < 6 || string(data[:4]) != PROJECT_MAGIC {
+		return errBadProject
+	}
+	r := &byteReader{buf: data, pos: 6}
+	p.Clear()
+	p.Tempo = DEFAULT_TEMPO
+
+	for !r.done() {
+		id := string(r.sub(4).buf)
+		size := int(r.u32())
+		c := r.sub(size)
+		switch id {
+		case "INFO":
+			p.Name = c.str()
+			p.Tempo = c.u16()
+			p.Groove = c.u8()
+		case "SONG":
+			rows, tracks := int(c.u16()), int(c.u8())
+			for row := 0; row < rows; row++ {
+				for t := 0; t < tracks; t++ {
+					v := c.u8()
+					if row < SONG_ROWS && t < NUM_TRACKS {
+						p.Song[row][t] = v
+					}
+				}
+			}
+		case "CHNS":
+			length := int(c.u8())
+			for !c.done() {
+				index := c.u8()
+				for e := 0; e < length; e++ {
+					phrase, transpose := c.u8(), int8(c.u8())
+					if int(index) < NUM_CHAINS && e < CHAIN_LENGTH {
+						p.Chains[index].Entries[e] = ChainEntry{phrase, transpose}
+					}
+				}
+			}
+		case "PHRS":
+			steps, stepSize := int(c.u8()), int(c.u8())
+			for !c.done() {
+				index := c.u8()
+				for s := 0; s < steps; s++ {
+					rec := c.sub(stepSize)
+					if int(index) < NUM_PHRASES && s < PHRASE_STEPS {
+						decodeStep(&rec, &p.Phrases[index].Steps[s])
+					}
+				}
+			}
+		case "PHTG":
+			for !c.done() {
+				index, tempo, groove := c.u8(), c.u16(), c.u8()
+				if int(index) < NUM_PHRASES {
+					p.Phrases[index].Tempo, p.Phrases[index].Groove = tempo, groove
+				}
+			}
+		case "INST":
+			count, size := int(c.u8()), int(c.u16())
+			for i := 0; i < count; i++ {
+				rec := c.sub(size)
+				if i < NUM_INSTRUMENTS {
+					decodeInstrument(&rec, &p.Instruments[i])
+				}
+			}
+		case "SMPL":
+			count := int(c.u8())
+			for i := 0; i < count; i++ {
+				s := c.str()
+				if i < MAX_SAMPLES {
+					p.Samples[i] = s
+				}
+			}
+		case "DUCK":
+			p.Sidechain = Sidechain{c.u8(), c.u8(), c.u8(), c.u8(), c.u8()}
+		case "MSTR":
+			p.Width = c.u8()
+		case "REVB":
+			p.Reverb = ReverbSettings{c.u8(), c.u8(), c.u8()}
+		case "CHOR":
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				cs := ChorusSettings{c.u8(), c.u8(), c.u8()}
+				if t < NUM_TRACKS {
+					p.Chorus[t] = cs
+				}
+			}
+		case "GATE":
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				gs := GateSettings{c.u8(), c.u8()}
+				if t < NUM_TRACKS {
+					p.Gates[t] = gs
+				}
+			}
+		case "CRSH":
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				cs := CrushSettings{c.u8(), c.u8()}
+				if t < NUM_TRACKS {
+					p.Crush[t] = cs
+				}
+			}
+		case "TRIM":
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				v := c.u8()
+				if t < NUM_TRACKS {
+					p.Trims[t] = v
+				}
+			}
+		case "ROUT":
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				r := Route(c.u8())
+				if t < NUM_TRACKS && r < NUM_ROUTES {
+					p.Routes[t] = r
+				}
+			}
+		case "GRPS":
+			groups := int(c.u8())
+			for g := 0; g < groups; g++ {
+				gs := GroupSettings{c.u8(), GroupInsert(c.u8())}
+				if g < NUM_GROUPS && gs.Insert < NUM_GROUP_FX {
+					p.Groups[g] = gs
+				}
+			}
+			tracks := int(c.u8())
+			for t := 0; t < tracks; t++ {
+				g := c.u8()
+				if t < NUM_TRACKS && g <= NUM_GROUPS {
+					p.TrackGroups[t] = g
+				}
+			}
+		case "MOTN":
+			steps := int(c.u8())
+			for i := 0; !c.done(); i++ {
+				m := Motion{Phrase: c.u8(), Param: MotionParam(c.u8()), Set: c.u16()}
+				for s := 0; s < steps; s++ {
+					v := c.u8()
+					if s < PHRASE_STEPS {
+						m.Values[s] = v
+					}
+				}
+				if i < NUM_MOTIONS {
+					p.Motions[i] = m
+				}
+			}
+		case "GMAP":
+			for i := 0; !c.done(); i++ {
+				v := c.u8()
+				if i < NUM_INSTRUMENTS {
+					p.MIDIPrograms[i] = v
+				}
+			}
+		case "SEDT":
+			for !c.done() {
+				index, start, end, flags := c.u8(), c.u16(), c.u16(), c.u8()
+				if int(index) < MAX_SAMPLES {
+					p.SampleEdits[index] = SampleEdit{start, end, flags&1 != 0, flags&2 != 0}
+				}
+			}
+		case "SSUM":
+			for !c.done() {
+				index, sum := c.u8(), c.u32()
+				if int(index) < MAX_SAMPLES {
+					p.SampleSums[index] = sum
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Write a project to its folder, along with the UI state when it is the
+// active project
+func saveProject(p *Project) error {
+	if err := writeFile(projectPath(p.Name), encodeProject(p)); err != nil {
+		return err
+	}
+	if p == project {
+		saveSession(p)
+	}
+	return nil
+}
+
+// Read a project by name into p
+func loadProject(name string, p *Project) error {
+	data, err := readFile(projectPath(name))
+	if err != nil {
+		return err
+	}
+	// A damaged file still loads as far as it can, with a warning
+	noteIntegrity(baseName(projectPath(name)), checkProjectData(data))
+	return decodeProject(data, p)
+}
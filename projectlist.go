@@ -0,0 +1,104 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Project list: SAVE writes the open project to its folder, and every
+// project on the card below it opens with ENTER. Opening over changes
+// that aren't saved asks for ENTER a second time. DELETE turns the
+// entries into DELETE ones, and the project picked goes to the trash.
+func init() {
+	addTool("PROJECTS", openProjectList)
+}
+
+// Whether the open project differs from its saved version, or was never
+// saved
+func projectChanged() bool {
+	saved := newProject(project.Name)
+	if err := loadProject(project.Name, saved); err != nil {
+		return true
+	}
+	return len(diffProjects(saved, project, false)) > 0
+}
+
+func openProjectList() {
+	list := &ListView{Title: "PROJECTS"}
+	var names []string
+	armed := -1 // Project to open on a second ENTER
+	deleting := false
+	refresh := func() {
+		list.Items = append(list.Items[:0], "SAVE "+project.Name)
+		if deleting {
+			list.Items = append(list.Items, "CANCEL DELETE")
+		} else {
+			list.Items = append(list.Items, "DELETE")
+		}
+		names = names[:0]
+		entries, _ := storage.ReadDir(projectsDir)
+		for _, e := range entries {
+			if e.Dir {
+				item := "OPEN " + e.Name
+				if deleting {
+					item = "DELETE " + e.Name
+				}
+				if e.Name == project.Name {
+					item += " *"
+				}
+				list.Items = append(list.Items, item)
+				names = append(names, e.Name)
+			}
+		}
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		switch {
+		case i == 0:
+			armed = -1
+			if err := saveProject(project); err != nil {
+				println("Failed to save project:", err.Error())
+				showStatus("SAVE FAILED", colorRed)
+				return
+			}
+			showStatus("SAVED "+project.Name, colorGreen)
+			refresh()
+			return
+		case i == 1:
+			armed, deleting = -1, !deleting
+			refresh()
+			return
+		case deleting:
+			deleteProject(names[i-2])
+			deleting = false
+			refresh()
+			return
+		}
+		name := names[i-2]
+		if armed != i && projectChanged() {
+			armed = i
+			showStatus("NOT SAVED, ENTER AGAIN TO OPEN", colorRed)
+			return
+		}
+		armed = -1
+		if err := openProject(name); err != nil {
+			println("Failed to open project:", err.Error())
+			showStatus("OPEN FAILED", colorRed)
+			return
+		}
+		showStatus("OPENED "+name, colorGreen)
+	}
+	pushView(list)
+}
+
+// Move a project's folder to the trash, unless it is the one open
+func deleteProject(name string) {
+	if name == project.Name {
+		showStatus("PROJECT IS OPEN", colorRed)
+		return
+	}
+	if err := deleteFile(joinPath(projectsDir, name)); err != nil {
+		println("Failed to delete project:", err.Error())
+		showStatus("DELETE FAILED", colorRed)
+		return
+	}
+	showStatus("DELETED "+name+", SEE TRASH", colorGreen)
+}
@@ -0,0 +1,143 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "time"
+
+// Automatic quality: when blocks keep coming in late, the engine gives up
+// quality rather than let the output run dry. The first step reads every
+// sample nearest neighbour; the next also bypasses whichever bus effect
+// has been costing the most. LOQ shows in the status bar while either is
+// in force, and quality comes back a step at a time once there is
+// headroom again.
+const (
+	QUALITY_FULL    = iota
+	QUALITY_NEAREST // Samples read without interpolation
+	QUALITY_BYPASS  // And the dearest bus effect is bypassed
+
+	QUALITY_WINDOW           = time.Second // Load is judged over windows this long
+	QUALITY_OVERLOAD_PERCENT = 5           // Late blocks in a window that step quality down
+	QUALITY_HEADROOM_PERCENT = 50          // Slowest block of a window, of its playing time, that counts as calm
+	QUALITY_CALM_WINDOWS     = 5           // Calm windows in a row before a step back up
+	EFFECT_COST_SHIFT        = 3           // Smoothing of the effect costs, in blocks
+)
+
+var (
+	qualityLevel  int
+	nearestOnly   bool          // Sample voices ignore Interpolate, see SampleVoice
+	qualityPeak   time.Duration // Slowest block of the window so far, from recordBlock
+	qualityStart  time.Time
+	qualityBlocks AudioStats // Counters at the start of the window
+	qualityCalm   int
+)
+
+func init() {
+	addSetting("AUTO QUALITY", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.AutoQuality)) },
+		func(i int) {
+			settings.AutoQuality = i == 1
+			if !settings.AutoQuality {
+				setQuality(QUALITY_FULL)
+			}
+		})
+}
+
+// Cost of a bus effect, see Mixer.runEffect
+type effectCost struct {
+	fx   Effect
+	cost time.Duration // Smoothed
+}
+
+// Process a bus effect unless it is bypassed, keeping track of what it
+// costs. Returns whether it ran.
+func (m *Mixer) runEffect(fx Effect, left, right []int32) bool {
+	if fx == m.Bypass {
+		return false
+	}
+	start := time.Now()
+	fx.Process(left, right)
+	took := time.Since(start)
+	for i := range m.costs {
+		if m.costs[i].fx == fx {
+			m.costs[i].cost += (took - m.costs[i].cost) >> EFFECT_COST_SHIFT
+			return true
+		}
+	}
+	m.costs = append(m.costs, effectCost{fx, took})
+	return true
+}
+
+// The bus effect costing the most, nil when there is none
+func (m *Mixer) dearestEffect() Effect {
+	var dearest Effect
+	most := time.Duration(-1)
+	for _, c := range m.costs {
+		inUse := c.fx == m.SendEffect
+		for _, fx := range m.MasterEffects {
+			inUse = inUse || c.fx == fx
+		}
+		if inUse && c.cost > most {
+			dearest, most = c.fx, c.cost
+		}
+	}
+	return dearest
+}
+
+// Take the render time of a block into the current window. Called from
+// the audio loop.
+func noteQualityLoad(render time.Duration) {
+	qualityPeak = max(qualityPeak, render)
+}
+
+// Go to a quality level, bypassing or restoring the dearest effect
+func setQuality(level int) {
+	if level == qualityLevel {
+		return
+	}
+	audioMu.Lock()
+	nearestOnly = level >= QUALITY_NEAREST
+	mixer.Bypass = nil
+	if level >= QUALITY_BYPASS {
+		mixer.Bypass = mixer.dearestEffect()
+	}
+	audioMu.Unlock()
+	println("Audio quality level", level)
+	qualityLevel = level
+	refreshStatusBar()
+}
+
+// Judge the load at the end of each window, stepping quality down on
+// overload and back up after a run of calm windows. Called from the main
+// loop.
+func updateQuality() {
+	now := time.Now()
+	if now.Sub(qualityStart) < QUALITY_WINDOW {
+		return
+	}
+	blocks := audioStats.Blocks - qualityBlocks.Blocks
+	late := audioStats.Late - qualityBlocks.Late + audioStats.Underruns - qualityBlocks.Underruns
+	peak := qualityPeak
+	qualityStart, qualityBlocks, qualityPeak = now, audioStats, 0
+	if !settings.AutoQuality || blocks == 0 {
+		qualityCalm = 0
+		return
+	}
+	switch {
+	case late*100 > blocks*QUALITY_OVERLOAD_PERCENT:
+		qualityCalm = 0
+		setQuality(min(qualityLevel+1, QUALITY_BYPASS))
+	case peak < blockPeriod()*QUALITY_HEADROOM_PERCENT/100:
+		if qualityCalm++; qualityCalm >= QUALITY_CALM_WINDOWS && qualityLevel > QUALITY_FULL {
+			qualityCalm = 0
+			setQuality(qualityLevel - 1)
+		}
+	default:
+		qualityCalm = 0
+	}
+}
+
+// Whether the status bar should show the reduced quality indicator
+func qualityReduced() bool {
+	return qualityLevel != QUALITY_FULL
+}
@@ -0,0 +1,429 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"io"
+	"machine"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// On-device sampling, from an I2S mic or line input board on the AUDIO_IN
+// pins or from the ADC line in (see linein.go). For I2S a second PIO state
+// machine drives the input as I2S master with 32 bit slots and the top 16
+// bits of the left slot are kept, which is where mono mics with L/R tied
+// low put their data. A capture goroutine moves frames from the input into
+// a ring of blocks that the recorder drains into RAM or straight to the
+// card.
+const (
+	RECORD_RING_BLOCKS  = 8  // must be a power of two
+	RECORD_RAM_KB       = 96 // Longest take kept in RAM, about a second, if the card has room
+	RECORD_FLUSH_BLOCKS = 4  // Blocks gathered per card write
+	RECORD_PREFIX       = "REC"
+)
+
+var (
+	errRecordFull = errors.New("record: no free sample slot")
+	errPinsInUse  = errors.New("record: I2S input pins in use by CLOCK IN or MIDI IN")
+)
+
+// Source of mono audio for the recorder
+type AudioInput interface {
+	Start() error
+	Stop()
+	Rate() uint32 // Frames per second since Start
+
+	// Fill dst, returning how many times input was lost because it was not
+	// read in time
+	ReadMono(dst []int16) (stalls int)
+}
+
+// Inputs selectable with the RECORD INPUT setting
+const (
+	RECORD_INPUT_I2S = iota
+	RECORD_INPUT_LINE
+)
+
+// i2s_in, laid out the way pioasm would. Side-set bit 1 is LRCLK and bit 0
+// BCLK. Each bit is read as BCLK rises, 32 per slot, and LRCLK changes one
+// bit early so every slot starts with the LSB of the one before.
+const (
+	i2sInWrapTarget   = 0
+	i2sInWrap         = 7
+	i2sInEntryPoint   = 3
+	i2sInCyclesPerBit = 2
+)
+
+var i2sInInstructions = []uint16{
+	//     .wrap_target
+	0x5801, //  0: in     pins, 1         side 3
+	0x1040, //  1: jmp    x--, 0          side 2
+	0x5801, //  2: in     pins, 1         side 3
+	0xe03e, //  3: set    x, 30           side 0
+	0x4801, //  4: in     pins, 1         side 1
+	0x0044, //  5: jmp    x--, 4          side 0
+	0x4801, //  6: in     pins, 1         side 1
+	0xf03e, //  7: set    x, 30           side 2
+	//     .wrap
+}
+
+// I2S receiver on a PIO state machine
+type I2SIn struct {
+	sm          pio.StateMachine
+	offset      uint8
+	rate        uint32
+	data, clock machine.Pin
+}
+
+// Load the input program. The state machine starts disabled and takes
+// the pins on Start.
+func newI2SIn(sm pio.StateMachine, data, clockAndNext machine.Pin) (*I2SIn, error) {
+	sm.TryClaim()
+	Pio := sm.PIO()
+	offset, err := Pio.AddProgram(i2sInInstructions, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := pio.DefaultStateMachineConfig()
+	cfg.SetWrap(offset+i2sInWrapTarget, offset+i2sInWrap)
+	cfg.SetSidesetParams(2, false, false)
+	cfg.SetSidesetPins(clockAndNext)
+	cfg.SetInPins(data)
+	cfg.SetInShift(false, true, 32) // MSB first, a FIFO word per slot
+	cfg.SetFIFOJoin(pio.FifoJoinRx)
+	sm.Init(offset+i2sInEntryPoint, cfg)
+
+	clockMask := uint32(0b11 << clockAndNext)
+	sm.SetPindirsMasked(clockMask, clockMask|uint32(1<<data))
+	sm.SetPinsMasked(0, clockMask)
+	return &I2SIn{sm: sm, offset: offset, data: data, clock: clockAndNext}, nil
+}
+
+// Set the frame rate of the input clocks
+func (in *I2SIn) SetSampleFrequency(freq uint32) error {
+	whole, frac, err := pio.ClkDivFromFrequency(freq*64*i2sInCyclesPerBit, machine.CPUFrequency())
+	if err != nil {
+		return err
+	}
+	in.sm.SetClkDiv(whole, frac)
+	return nil
+}
+
+// Start or stop the clocks, starting over from the left slot
+func (in *I2SIn) Enable(enabled bool) {
+	if enabled {
+		in.sm.ClearFIFOs()
+		in.sm.Restart()
+		in.sm.Exec(pio.EncodeJmp(in.offset+i2sInEntryPoint, pio.JmpAlways))
+	}
+	in.sm.SetEnabled(enabled)
+}
+
+// Take the pins from the clock and MIDI inputs and the line in, then
+// start the clocks at the playback rate
+func (in *I2SIn) Start() error {
+	if settings.MidiIn || settings.ClockSource == SYNC_CLOCK_IN {
+		return errPinsInUse
+	}
+	pinCfg := machine.PinConfig{Mode: in.sm.PIO().PinMode()}
+	in.data.Configure(pinCfg)
+	in.clock.Configure(pinCfg)
+	(in.clock + 1).Configure(pinCfg)
+	midiActive = false // MIDI IN sets the UART up again when turned on
+	in.rate = sampleRate
+	if err := in.SetSampleFrequency(in.rate); err != nil {
+		return err
+	}
+	in.Enable(true)
+	return nil
+}
+
+func (in *I2SIn) Stop()        { in.Enable(false) }
+func (in *I2SIn) Rate() uint32 { return in.rate }
+
+// Fill dst with left slot samples. A full FIFO stalls the input, leaving a
+// gap in the take.
+func (in *I2SIn) ReadMono(dst []int16) (stalls int) {
+	for i := range dst {
+		if in.sm.IsRxFIFOFull() {
+			stalls++
+		}
+		left := in.read()
+		in.read() // Right slot
+		dst[i] = int16(left >> 15)
+	}
+	return stalls
+}
+
+func (in *I2SIn) read() uint32 {
+	for in.sm.IsRxFIFOEmpty() {
+		runtime.Gosched()
+	}
+	return in.sm.RxGet()
+}
+
+// Capture state shared between the recorder and the capture goroutine
+var (
+	audioIn      *I2SIn
+	lineIn       *LineIn
+	captureInput AudioInput
+
+	captureRing    [RECORD_RING_BLOCKS][BLOCK_SIZE]int16
+	captureScratch [BLOCK_SIZE]int16 // Read into when the ring is full
+	captureHead    atomic.Uint32
+	captureTail    atomic.Uint32
+	captureRunning atomic.Bool
+	captureDone    = make(chan struct{}, 1)
+
+	captureStalls  atomic.Uint32 // FIFO overflows
+	captureDropped atomic.Uint32 // Blocks lost to a full ring
+	takeFilledCard bool          // The last take ended when the card filled up
+)
+
+func init() {
+	addSetting("RECORD INPUT", []string{"I2S", "LINE IN"},
+		func() int { return int(settings.RecordInput) },
+		func(i int) { settings.RecordInput = uint8(i) })
+	addTool("RECORD SAMPLE", func() { recordTool(false) })
+	addTool("RECORD TO CARD", func() {
+		if !needsCard() {
+			recordTool(true)
+		}
+	})
+}
+
+func recordTool(toCard bool) {
+	name, err := recordTake(project, toCard)
+	if err == errPinsInUse {
+		showStatus("TURN OFF CLOCK IN AND MIDI IN", colorRed)
+		return
+	}
+	if err == errFull {
+		showStatus("CARD FULL", colorRed)
+		return
+	}
+	if err != nil {
+		println("Failed to record:", err.Error())
+		showStatus("RECORD FAILED", colorRed)
+		return
+	}
+	if n := captureStalls.Load() + captureDropped.Load(); n > 0 {
+		println("Recording", name, "has", n, "gaps")
+		showStatus("SAVED "+name+" WITH GAPS", colorRed)
+		return
+	}
+	if takeFilledCard {
+		showStatus("SAVED "+name+", CARD FULL", colorRed)
+		return
+	}
+	showStatus("SAVED "+name, colorGreen)
+}
+
+// The input chosen in the settings, set up the first time it is used
+func recordInput() (AudioInput, error) {
+	if settings.RecordInput == RECORD_INPUT_LINE {
+		if lineIn == nil {
+			lineIn = newLineIn()
+		}
+		return lineIn, nil
+	}
+	if audioIn != nil {
+		return audioIn, nil
+	}
+	sm, err := pio.PIO0.ClaimStateMachine()
+	if err != nil {
+		return nil, err
+	}
+	in, err := newI2SIn(sm, AUDIO_IN_SDATA, AUDIO_IN_BCLK)
+	if err != nil {
+		sm.Unclaim()
+		return nil, err
+	}
+	audioIn = in
+	return in, nil
+}
+
+// Move blocks from the input into the ring until captureRunning is cleared
+func captureLoop() {
+	for captureRunning.Load() {
+		head := captureHead.Load()
+		if head-captureTail.Load() >= RECORD_RING_BLOCKS {
+			captureStalls.Add(uint32(captureInput.ReadMono(captureScratch[:])))
+			captureDropped.Add(1)
+			continue
+		}
+		captureStalls.Add(uint32(captureInput.ReadMono(captureRing[head%RECORD_RING_BLOCKS][:])))
+		captureHead.Store(head + 1)
+	}
+	captureDone <- struct{}{}
+}
+
+// Save a take kept in RAM as a mono wav, a few blocks per card write
+func writeTake(path string, rate uint32, data []int16) error {
+	f, err := storage.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(wavHeader(rate, 1, uint32(len(data)*2))); err != nil {
+		return err
+	}
+	w := &byteWriter{buf: make([]byte, 0, BLOCK_SIZE*2*RECORD_FLUSH_BLOCKS)}
+	for i, s := range data {
+		w.u16(uint16(s))
+		if len(w.buf) == cap(w.buf) || i == len(data)-1 {
+			if _, err := f.Write(w.buf); err != nil {
+				return err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return nil
+}
+
+// First REC name not taken in the samples folder
+func nextTakeName() string {
+	for n := 1; ; n++ {
+		digits := itoa(n)
+		for len(digits) < 3 {
+			digits = "0" + digits
+		}
+		name := RECORD_PREFIX + digits + ".wav"
+		if _, err := storage.Stat(joinPath(samplesDir, name)); err != nil {
+			return name
+		}
+	}
+}
+
+// Record a take into the samples folder and a free sample slot of p until
+// a key is pressed, returning its name. With toCard the take streams to the
+// card as it comes in and ends by itself when the card is full; otherwise
+// it stays in RAM, up to RECORD_RAM_KB, and is saved after recording stops
+// so the card is not written during capture.
+func recordTake(p *Project, toCard bool) (string, error) {
+	in, err := recordInput()
+	if err != nil {
+		return "", err
+	}
+	if err := mkdirAll(samplesDir); err != nil {
+		return "", err
+	}
+	name := nextTakeName()
+	path := joinPath(samplesDir, name)
+	full := true
+	for _, s := range p.Samples {
+		full = full && s != ""
+	}
+	if full {
+		return "", errRecordFull
+	}
+
+	var f File
+	var data []int16
+	w := &byteWriter{}
+	if toCard {
+		if err := checkFree(WAV_HEADER_SIZE); err != nil {
+			return "", err
+		}
+		if f, err = storage.Create(path); err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := f.Write(wavHeader(0, 1, 0)); err != nil {
+			return "", err
+		}
+		w.buf = make([]byte, 0, BLOCK_SIZE*2*RECORD_FLUSH_BLOCKS)
+	} else {
+		// The take has to fit on the card once recording stops
+		room := min(RECORD_RAM_KB*1024, storage.Free()-WAV_HEADER_SIZE) / 2
+		if room < BLOCK_SIZE {
+			return "", errFull
+		}
+		data = make([]int16, 0, room)
+	}
+
+	showStatus("RECORDING, ANY KEY STOPS", colorRed)
+	captureHead.Store(0)
+	captureTail.Store(0)
+	captureStalls.Store(0)
+	captureDropped.Store(0)
+	if err := in.Start(); err != nil {
+		return "", err
+	}
+	captureInput = in
+	captureRunning.Store(true)
+	go captureLoop()
+
+	frames := 0
+	var werr error
+	takeFilledCard = false
+	for !keyCancelled() && werr == nil && !takeFilledCard && (toCard || len(data) < cap(data)) {
+		for tail := captureTail.Load(); tail != captureHead.Load(); tail++ {
+			block := captureRing[tail%RECORD_RING_BLOCKS][:]
+			if !toCard {
+				data = append(data, block[:min(len(block), cap(data)-len(data))]...)
+			} else if werr == nil {
+				// Nothing is written between flushes, so a block that fits
+				// now still fits when it is flushed
+				if checkFree(int64(len(w.buf)+2*len(block))) != nil {
+					takeFilledCard = true
+					break
+				}
+				for _, s := range block {
+					w.u16(uint16(s))
+				}
+				if len(w.buf) == cap(w.buf) {
+					_, werr = f.Write(w.buf)
+					w.buf = w.buf[:0]
+				}
+			}
+			frames += len(block)
+			captureTail.Store(tail + 1)
+		}
+		time.Sleep(time.Millisecond) // Let the capture goroutine run
+	}
+	captureRunning.Store(false)
+	<-captureDone
+	in.Stop()
+	if werr != nil {
+		return "", werr
+	}
+	if takeFilledCard && frames == 0 {
+		storage.Remove(path)
+		return "", errFull
+	}
+
+	if toCard {
+		if _, err := f.Write(w.buf); err != nil {
+			return "", err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := f.Write(wavHeader(in.Rate(), 1, uint32(frames*2))); err != nil {
+			return "", err
+		}
+	} else if err := writeTake(path, in.Rate(), data); err != nil {
+		return "", err
+	}
+
+	// Takes that fit in RAM are ready to play, longer ones are left on the
+	// card for streaming
+	slot := p.sampleIndex(name)
+	if data != nil {
+		samples[slot] = &Sample{Name: name, Data: data, Rate: in.Rate(), RootNote: NOTE_C4}
+	} else if frames*2 <= RECORD_RAM_KB*1024 {
+		if s, err := loadSample(path); err == nil {
+			samples[slot] = s
+		}
+	}
+	redrawView()
+	return name, nil
+}
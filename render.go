@@ -0,0 +1,209 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Offline bounce: the mixer runs as fast as it can with the I2S output
+// stopped and the result goes to rendersDir as 16-bit stereo wav, with
+// its loudness and peak in a text file of the same name
+const (
+	RENDER_FLUSH_BLOCKS = 8 // Blocks gathered per card write
+	RENDER_DRAW_EVERY   = 32
+	WAV_HEADER_SIZE     = 44
+)
+
+func init() {
+	addTool("RENDER TO WAV", func() {
+		if needsCard() {
+			return
+		}
+		path, meter, err := renderSong(project)
+		if err == errFull {
+			showStatus("NOT ENOUGH SPACE TO RENDER", colorRed)
+			return
+		}
+		if err != nil {
+			println("Failed to render:", err.Error())
+			showStatus("RENDER FAILED", colorRed)
+			return
+		}
+		report := meter.Report(baseName(path))
+		if err := writeFile(strings.TrimSuffix(path, ".wav")+".txt", []byte(report)); err != nil {
+			println("Failed to save loudness report:", err.Error())
+		}
+		showStatus(meter.Summary(), colorGreen)
+	})
+}
+
+// Frames of audio one pass of the song lasts, following jumps and phrase
+// tempo and groove overrides
+func songFrames(p *Project) int {
+	frames := 0
+	var clock TempoClock
+	p.walkSong(func(r, e, s int) {
+		tempo, groove := p.slotTiming(r, e)
+		frames += clock.Next(tempo, groove, s)
+	})
+	return frames
+}
+
+// Canonical 44 byte header for 16-bit PCM of dataLen bytes
+func wavHeader(rate uint32, channels uint16, dataLen uint32) []byte {
+	w := &byteWriter{}
+	w.buf = append(w.buf, "RIFF"...)
+	w.u32(dataLen + WAV_HEADER_SIZE - 8)
+	w.buf = append(w.buf, "WAVE"...)
+	c := w.beginChunk("fmt ")
+	w.u16(1) // PCM
+	w.u16(channels)
+	w.u32(rate)
+	w.u32(rate * 2 * uint32(channels))
+	w.u16(2 * channels)
+	w.u16(16)
+	w.endChunk(c)
+	w.buf = append(w.buf, "data"...)
+	w.u32(dataLen)
+	return w.buf
+}
+
+// Bounce the song to a wav file named after the project, returning its
+// path and the measured loudness. Any key cancels and leaves what was
+// rendered so far. The render is refused with errFull when the song won't
+// fit on the card, and stops with it when the tail runs out of space,
+// leaving no partial file.
+func renderSong(p *Project) (string, *LoudnessMeter, error) {
+	// Let live playback fade out and stop first
+	if isAudioPlaying {
+		toggleAudio()
+	}
+	for !mixer.Silent() {
+		time.Sleep(time.Millisecond)
+	}
+	// The bounce may be the file about to be written, and must not be
+	// mixed into it
+	stopCompare()
+
+	path := joinPath(rendersDir, p.Name+".wav")
+	if err := mkdirAll(rendersDir); err != nil {
+		return "", nil, err
+	}
+	// The old bounce of the same name makes way for the new one
+	total := max(songFrames(p), 1)
+	if err := checkFree(WAV_HEADER_SIZE + int64(total)*4 - pathSize(path)); err != nil {
+		return "", nil, err
+	}
+	f, err := storage.Create(path)
+	if err != nil {
+		return "", nil, err
+	}
+	finished := false
+	defer func() {
+		f.Close()
+		if !finished {
+			storage.Remove(path)
+		}
+	}()
+	write := func(b []byte) error {
+		if err := checkFree(int64(len(b))); err != nil {
+			return err
+		}
+		_, err := f.Write(b)
+		return err
+	}
+	if err := write(wavHeader(sampleRate, 2, 0)); err != nil {
+		return "", nil, err
+	}
+
+	// Crossfeed is for listening on headphones, not for the file
+	audioMu.Lock()
+	crossfeed := mixer.Crossfeed
+	mixer.Crossfeed = nil
+	audioMu.Unlock()
+	defer func() {
+		audioMu.Lock()
+		mixer.Crossfeed = crossfeed
+		audioMu.Unlock()
+	}()
+
+	if settings.ExportLimiter {
+		audioMu.Lock()
+		mixer.Limiter = newLimiter()
+		audioMu.Unlock()
+		defer func() {
+			audioMu.Lock()
+			mixer.Limiter = nil
+			audioMu.Unlock()
+		}()
+	}
+
+	setQuality(QUALITY_FULL) // A bounce has all the time it needs
+	meter := newLoudnessMeter()
+	block := make([]uint32, BLOCK_SIZE)
+	w := &byteWriter{buf: make([]byte, 0, BLOCK_SIZE*4*RENDER_FLUSH_BLOCKS)}
+	written := 0
+	audioMu.Lock()
+	sequencer.Start(p)
+	audioMu.Unlock()
+	defer stopSong()
+	mixer.FadeIn()
+	for n := 0; written < total || !mixer.Silent(); n++ {
+		if written >= total && sequencer.Playing {
+			stopSong()
+			mixer.FadeOut() // Last block fades out cleanly
+		}
+		renderBlock(block)
+		for _, frame := range block {
+			// I2S words hold the left channel in the upper half
+			w.u16(uint16(frame >> 16))
+			w.u16(uint16(frame))
+			meter.Add(int16(frame>>16), int16(frame))
+		}
+		written += len(block)
+
+		if len(w.buf) == cap(w.buf) {
+			if err := write(w.buf); err != nil {
+				return "", nil, err
+			}
+			w.buf = w.buf[:0]
+		}
+		if n%RENDER_DRAW_EVERY == 0 {
+			drawProgress("RENDERING", min(written, total), total)
+			if keyCancelled() {
+				break
+			}
+		}
+	}
+	if err := write(w.buf); err != nil {
+		return "", nil, err
+	}
+
+	// Patch in the final sizes
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	if _, err := f.Write(wavHeader(sampleRate, 2, uint32(written*4))); err != nil {
+		return "", nil, err
+	}
+	finished = true
+	redrawView()
+	return path, meter, nil
+}
+
+// Whether a key was pressed since the last check, for cancelling long jobs
+func keyCancelled() bool {
+	pollButtons()
+	cancelled := false
+	for {
+		ev, ok := popKeyEvent()
+		if !ok {
+			return cancelled
+		}
+		cancelled = cancelled || ev.Pressed
+	}
+}
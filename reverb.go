@@ -0,0 +1,113 @@
+//go:build tinygo && !noreverb && !minimal
+// +build tinygo,!noreverb,!minimal
+
+package main
+
+import "unsafe"
+
+const FEATURE_REVERB = true
+
+// Freeverb delay lengths at 44.1kHz, halved to fit the RP2040's RAM
+var (
+	reverbCombLengths    = [...]int{558, 594, 638, 678}
+	reverbAllpassLengths = [...]int{278, 220}
+)
+
+const REVERB_STEREO_SPREAD = 12 // Extra samples on the right channel lines
+
+// Lowpass-damped feedback comb filter
+type combFilter struct {
+	buf   []int16
+	pos   int
+	store int32
+}
+
+func (c *combFilter) process(in, feedback, damp int32) int32 {
+	out := int32(c.buf[c.pos])
+	c.store = (out*(32768-damp) + c.store*damp) >> 15
+	c.buf[c.pos] = clip16(in + c.store*feedback>>15)
+	c.pos++
+	if c.pos == len(c.buf) {
+		c.pos = 0
+	}
+	return out
+}
+
+// Schroeder allpass diffuser with a fixed 0.5 feedback
+type allpassFilter struct {
+	buf []int16
+	pos int
+}
+
+func (a *allpassFilter) process(in int32) int32 {
+	delayed := int32(a.buf[a.pos])
+	a.buf[a.pos] = clip16(in + delayed>>1)
+	a.pos++
+	if a.pos == len(a.buf) {
+		a.pos = 0
+	}
+	return delayed - in
+}
+
+// Small freeverb-style stereo reverb. RoomSize, Damping and Mix are 0-255.
+// Use Mix 255 when running as a send effect so only the wet signal returns.
+type Reverb struct {
+	RoomSize uint8
+	Damping  uint8
+	Mix      uint8
+
+	combL, combR       [len(reverbCombLengths)]combFilter
+	allpassL, allpassR [len(reverbAllpassLengths)]allpassFilter
+}
+
+// Allocate a reverb with its delay lines
+func newReverb() *Reverb {
+	rs := defaultReverb()
+	r := &Reverb{RoomSize: rs.RoomSize, Damping: rs.Damping, Mix: rs.Mix}
+	for i, n := range reverbCombLengths {
+		r.combL[i].buf = make([]int16, n)
+		r.combR[i].buf = make([]int16, n+REVERB_STEREO_SPREAD)
+	}
+	for i, n := range reverbAllpassLengths {
+		r.allpassL[i].buf = make([]int16, n)
+		r.allpassR[i].buf = make([]int16, n+REVERB_STEREO_SPREAD)
+	}
+	return r
+}
+
+func (r *Reverb) Process(left, right []int32) {
+	// Freeverb maps room size to 0.7-0.98 feedback and damping to 0-0.4
+	feedback := 22938 + int32(r.RoomSize)*9175/255
+	damp := int32(r.Damping) * 13107 / 255
+	wet := int32(r.Mix)
+	dry := 255 - wet
+
+	for i := range left {
+		in := (left[i] + right[i]) >> 6 // mono input, scaled to keep the combs in range
+
+		var outL, outR int32
+		for c := range r.combL {
+			outL += r.combL[c].process(in, feedback, damp)
+			outR += r.combR[c].process(in, feedback, damp)
+		}
+		for a := range r.allpassL {
+			outL = r.allpassL[a].process(outL)
+			outR = r.allpassR[a].process(outR)
+		}
+
+		left[i] = (left[i]*dry + outL*wet) >> 8
+		right[i] = (right[i]*dry + outR*wet) >> 8
+	}
+}
+
+// RAM used by one reverb and its delay lines
+func reverbFootprint() int {
+	n := 0
+	for _, l := range reverbCombLengths {
+		n += 2*l + REVERB_STEREO_SPREAD
+	}
+	for _, l := range reverbAllpassLengths {
+		n += 2*l + REVERB_STEREO_SPREAD
+	}
+	return n*2 + int(unsafe.Sizeof(Reverb{}))
+}
@@ -0,0 +1,18 @@
+//go:build tinygo && (noreverb || minimal)
+// +build tinygo
+// +build noreverb minimal
+
+package main
+
+const FEATURE_REVERB = false
+
+// Stand-in so settings code still compiles; newReverb never returns one
+type Reverb struct {
+	RoomSize uint8
+	Damping  uint8
+	Mix      uint8
+}
+
+func newReverb() *Reverb                      { return nil }
+func (r *Reverb) Process(left, right []int32) {}
+func reverbFootprint() int                    { return 0 }
@@ -0,0 +1,50 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Send reverb settings of the project, pushed to the reverb on the send
+// bus when it is built in. The tool only shows then.
+func init() {
+	if FEATURE_REVERB {
+		addTool("REVERB", openReverbView)
+	}
+}
+
+func defaultReverb() ReverbSettings {
+	return ReverbSettings{RoomSize: 160, Damping: 128, Mix: 255}
+}
+
+// Bring the send reverb in line with the project. Called from the main
+// loop.
+func updateReverb() {
+	r, ok := mixer.SendEffect.(*Reverb)
+	if !ok || r == nil {
+		return
+	}
+	rs := &project.Reverb
+	if r.RoomSize != rs.RoomSize || r.Damping != rs.Damping || r.Mix != rs.Mix {
+		audioMu.Lock()
+		r.RoomSize, r.Damping, r.Mix = rs.RoomSize, rs.Damping, rs.Mix
+		audioMu.Unlock()
+	}
+}
+
+// A 0-255 value in %
+func bytePercent(v uint8) string { return itoa(int(v)*100/255) + "%" }
+
+// Room size, damping and wet mix. At 100% only the reverb returns from
+// the send.
+func openReverbView() {
+	rs := &project.Reverb
+	openParamList("REVERB", []settingItem{
+		byteChoice("ROOM", func() *uint8 { return &rs.RoomSize }, []uint8{0, 64, 128, 160, 192, 224, 255}, bytePercent),
+		byteChoice("DAMPING", func() *uint8 { return &rs.Damping }, []uint8{0, 64, 128, 192, 255}, bytePercent),
+		byteChoice("MIX", func() *uint8 { return &rs.Mix }, []uint8{0, 64, 128, 192, 255}, func(v uint8) string {
+			if v == 0 {
+				return "OFF"
+			}
+			return bytePercent(v)
+		}),
+	}, nil)
+}
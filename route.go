@@ -0,0 +1,125 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Track routing: a track plays into the mix, or is routed off, in which
+// case the mixer leaves it out altogether and spends nothing rendering it
+// while the sequencer still runs its steps. Mute and solo are live and not
+// saved. A track is heard when it is routed to the mix, not muted nor in a
+// muted group, and either soloed or no track in the mix is, so soloing a
+// track routed off silences nothing. A track that isn't heard reads silent on the meters
+// and in gain staging, adds nothing to the send, and keys no ducking.
+type Route uint8
+
+const (
+	ROUTE_MIX Route = iota
+	ROUTE_OFF       // Not rendered
+	NUM_ROUTES
+)
+
+var routeNames = [NUM_ROUTES]string{"MIX", "OFF"}
+
+func init() {
+	addTool("ROUTING", openRoutingView)
+}
+
+// Whether a track is heard, see route.go
+func (m *Mixer) audible(t int) bool {
+	track := &m.Tracks[t]
+	if g := m.trackGroup(t); g >= 0 && m.Groups[g].Mute {
+		return false
+	}
+	return track.Route == ROUTE_MIX && !track.Mute && (track.Solo || !m.soloing())
+}
+
+// Whether any track in the mix is soloed
+func (m *Mixer) soloing() bool {
+	for t := range m.Tracks {
+		if m.Tracks[t].Solo && m.Tracks[t].Route == ROUTE_MIX {
+			return true
+		}
+	}
+	return false
+}
+
+// Mute or unmute a track at once. ALT+ENTER does it for the track under
+// the cursor in the song and track mixer screens, locked or not.
+func toggleMute(t int) {
+	audioMu.Lock()
+	track := &mixer.Tracks[t]
+	track.Mute = !track.Mute
+	muted := track.Mute
+	audioMu.Unlock()
+	if muted {
+		showStatus("TRACK "+itoa(t+1)+" MUTED", colorRed)
+	} else {
+		showStatus("TRACK "+itoa(t+1)+" UNMUTED", colorGreen)
+	}
+}
+
+// Bring the mixer's routes in line with the project's. Called from the
+// main loop.
+func updateRoutes() {
+	for t, r := range project.Routes {
+		if mixer.Tracks[t].Route != r {
+			audioMu.Lock()
+			mixer.Tracks[t].Route = r
+			audioMu.Unlock()
+		}
+	}
+}
+
+// A track's routing, its group, and MUTE and SOLO when they are on
+func routeText(t int) string {
+	track := &mixer.Tracks[t]
+	s := routeNames[project.Routes[t]%NUM_ROUTES]
+	if g := project.TrackGroups[t]; g != 0 {
+		s += " G" + groupText(g)
+	}
+	if track.Mute {
+		s += " MUTE"
+	}
+	if track.Solo {
+		s += " SOLO"
+	}
+	return s
+}
+
+// Pick a track, then set its route, group, mute and solo
+func openRoutingView() {
+	list := &ListView{Title: "ROUTING"}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for t := range project.Routes {
+			list.Items = append(list.Items, "TRACK "+itoa(t+1)+": "+routeText(t))
+		}
+	}
+	refresh()
+	list.OnSelect = func(t int) {
+		track := &mixer.Tracks[t]
+		openParamList("TRACK "+itoa(t+1), []settingItem{
+			{"ROUTE", routeNames[:],
+				func() int { return int(project.Routes[t] % NUM_ROUTES) },
+				func(i int) { project.Routes[t] = Route(i) }},
+			{"GROUP", []string{groupText(0), groupText(1), groupText(2)},
+				func() int { return int(project.TrackGroups[t] % (NUM_GROUPS + 1)) },
+				func(i int) { project.TrackGroups[t] = uint8(i) }},
+			{"MUTE", []string{"OFF", "ON"},
+				func() int { return int(boolByte(track.Mute)) },
+				func(i int) {
+					audioMu.Lock()
+					track.Mute = i == 1
+					audioMu.Unlock()
+				}},
+			{"SOLO", []string{"OFF", "ON"},
+				func() int { return int(boolByte(track.Solo)) },
+				func(i int) {
+					audioMu.Lock()
+					track.Solo = i == 1
+					audioMu.Unlock()
+				}},
+		}, refresh)
+	}
+	pushView(list)
+}
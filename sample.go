@@ -0,0 +1,472 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+// Mono 16-bit sample data in RAM. LoopEnd of 0 plays it once.
+type Sample struct {
+	Name     string
+	Data     []int16
+	Rate     uint32 // Rate the sample was recorded at
+	RootNote uint8  // Note that plays it at its own pitch
+	Sum      uint32 // CRC of the audio as read from the file
+
+	LoopStart, LoopEnd uint32
+}
+
+// Samples of the loaded project, by project sample slot
+var samples [MAX_SAMPLES]*Sample
+
+// Load every sample the project references, with its edit and loop fades
+func loadProjectSamples(p *Project) {
+	for i := range p.Samples {
+		reloadSample(p, uint8(i))
+	}
+}
+
+// Read a wav file, mixing stereo down to mono. The root note and first
+// loop come from the smpl chunk when there is one.
+func loadSample(path string) (*Sample, error) {
+	f, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := readWavInfo(f)
+	if err != nil {
+		return nil, err
+	}
+	// A corrupt header can claim more data than the file holds
+	stat, err := storage.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	pcm := make([]byte, max(min(info.DataLen, stat.Size-info.DataStart), 0))
+	if _, err := f.Seek(info.DataStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	n, _ := io.ReadFull(f, pcm)
+
+	s := &Sample{Name: baseName(path), Rate: info.Rate, RootNote: info.RootNote,
+		LoopStart: info.LoopStart, LoopEnd: info.LoopEnd}
+	s.Data = make([]int16, n/info.frameSize())
+	decodePCM(s.Data, pcm[:n], info.Channels, info.Bits)
+	s.Sum = crc32.ChecksumIEEE(pcm[:n])
+	if s.LoopEnd > uint32(len(s.Data)) || s.LoopStart >= s.LoopEnd {
+		s.LoopStart, s.LoopEnd = 0, 0
+	}
+	return s, nil
+}
+
+// How a sample voice loops. LOOP_SAMPLE follows the loop saved in the
+// wav, the other modes use the voice's loop points or the whole sample.
+type LoopMode uint8
+
+const (
+	LOOP_SAMPLE LoopMode = iota
+	LOOP_OFF
+	LOOP_FORWARD
+	LOOP_PINGPONG // Back and forth between the loop points
+)
+
+// What a note off does to a sample voice
+type PlayMode uint8
+
+const (
+	PLAY_GATE    PlayMode = iota // Stop at once
+	PLAY_ONESHOT                 // Nothing; the sample plays through once without looping
+	PLAY_SUSTAIN                 // Leave the loop and play on to the end
+)
+
+// Plays a Sample at any pitch by stepping through it with a 32.32
+// fixed-point position. The fractional part is dropped when reading unless
+// Interpolate is set, which blends neighbouring samples to cut aliasing at
+// about twice the cost, and nearestOnly isn't. Level is 0-255. With an Instrument, NoteOn picks
+// the sample, root, tuning and playback modes of the note's key zone.
+// LoopStart and LoopEnd, in frames, replace the sample's own loop points
+// when LoopEnd is set. Start and End limit playback to a region, such as a
+// slice, End 0 being the end of the sample. Reverse plays from the end of
+// the region towards its start.
+type SampleVoice struct {
+	Sample      *Sample
+	Level       uint8
+	Interpolate bool
+	Instrument  *Instrument
+
+	Loop               LoopMode
+	Play               PlayMode
+	Reverse            bool
+	LoopStart, LoopEnd uint32
+	Start, End         uint32
+
+	pos      uint32
+	frac     uint32
+	inc      uint64
+	playing  bool
+	velocity uint8
+	backward bool   // Moving towards the start
+	looping  bool   // Wrapping between lo and hi
+	lo, hi   uint32 // Loop region of this note
+	first    uint32 // Region of this note
+	last     uint32
+
+	note, cents int
+	bend        int   // Cents, see Bend
+	root        uint8 // Zone root, EMPTY for the sample's own
+}
+
+// Set the pitch as a note plus fine tune in cents
+func (v *SampleVoice) SetPitch(note int, cents int) {
+	v.note, v.cents = note, cents
+	s := v.Sample
+	if s == nil {
+		return
+	}
+	root := s.RootNote
+	if v.Instrument != nil && v.root != EMPTY {
+		root = v.root
+	}
+	// Ratio of the target to the root pitch, scaled by the recording rate
+	ratio := (uint64(noteFrequency(note, cents+v.bend)) << 32) / uint64(rootFrequencies[root&(NUM_NOTES-1)])
+	v.inc = ratio * uint64(s.Rate) / uint64(sampleRate)
+}
+
+func (v *SampleVoice) Retune() { v.SetPitch(v.note, v.cents) }
+
+// Offset the pitch from the playing note by cents
+func (v *SampleVoice) Bend(cents int) {
+	v.bend = cents
+	v.SetPitch(v.note, v.cents)
+}
+
+// Loop region for the next note by the loop mode, if it loops at all
+func (v *SampleVoice) loopRegion() (lo, hi uint32, ok bool) {
+	s := v.Sample
+	switch {
+	case v.Loop == LOOP_OFF || v.Play == PLAY_ONESHOT:
+		return 0, 0, false
+	case v.LoopEnd > 0:
+		lo, hi = v.LoopStart, min(v.LoopEnd, v.last)
+	case s.LoopEnd > 0:
+		lo, hi = s.LoopStart, min(s.LoopEnd, v.last)
+	case v.Loop != LOOP_SAMPLE:
+		lo, hi = v.first, v.last
+	}
+	return lo, hi, lo < hi
+}
+
+// Start the region from the beginning, or the end when reversed, at a
+// pitch
+func (v *SampleVoice) Trigger(note int, cents int) {
+	v.SetPitch(note, cents)
+	v.frac = 0
+	v.playing = false
+	if v.Sample == nil {
+		return
+	}
+	n := uint32(len(v.Sample.Data))
+	v.first, v.last = min(v.Start, n), n
+	if v.End > 0 {
+		v.last = min(v.End, n)
+	}
+	if v.first >= v.last {
+		return
+	}
+	v.playing = true
+	v.lo, v.hi, v.looping = v.loopRegion()
+	v.backward = v.Reverse
+	v.pos = v.first
+	if v.Reverse {
+		v.pos = v.last - 1
+	}
+}
+
+func (v *SampleVoice) Stop() {
+	v.playing = false
+}
+
+func (v *SampleVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	v.velocity = velocity
+	in := v.Instrument
+	if in == nil {
+		v.Trigger(int(noteIndex(note)), 0)
+		return
+	}
+	v.Loop, v.Play, v.Reverse = in.Loop, in.Play, in.Reverse
+	v.LoopStart, v.LoopEnd, v.Start, v.End = 0, 0, 0, 0
+	if in.NumSlices > 0 {
+		v.noteOnSlice(in, note)
+		return
+	}
+	z := in.nextZone(note)
+	v.Sample, v.root = nil, z.Root
+	if z.Sample < MAX_SAMPLES {
+		v.Sample = samples[z.Sample]
+	}
+	if s := v.Sample; s != nil && in.LoopEnd > 0 {
+		v.LoopStart, v.LoopEnd = fractionFrames(s, in.LoopStart), fractionFrames(s, in.LoopEnd)
+	}
+	v.Trigger(int(noteIndex(note)), int(in.Fine)+int(z.Fine))
+}
+
+// Play the slice of the instrument's sample a note picks, at the sample's
+// own pitch. Forward and ping-pong loops loop the slice; the sample's own
+// loop is not used.
+func (v *SampleVoice) noteOnSlice(in *Instrument, note uint8) {
+	v.Sample, v.root = nil, EMPTY
+	if in.Sample < MAX_SAMPLES {
+		v.Sample = samples[in.Sample]
+	}
+	s := v.Sample
+	if s == nil {
+		v.Stop()
+		return
+	}
+	start, end := in.sliceFor(note)
+	v.Start, v.End = fractionFrames(s, start), uint32(len(s.Data))
+	if end > 0 {
+		v.End = fractionFrames(s, end)
+	}
+	if v.Loop == LOOP_SAMPLE {
+		v.Loop = LOOP_OFF
+	}
+	v.Trigger(int(s.RootNote), int(in.Fine))
+}
+
+// Frame at a fraction of a sample's length in 1/65536
+func fractionFrames(s *Sample, f uint16) uint32 {
+	return uint32(uint64(len(s.Data)) * uint64(f) >> 16)
+}
+
+func (v *SampleVoice) NoteOff() {
+	switch v.Play {
+	case PLAY_ONESHOT:
+	case PLAY_SUSTAIN:
+		v.looping = false
+	default:
+		v.Stop()
+	}
+}
+
+func (v *SampleVoice) Sounding() bool { return v.playing }
+
+func (v *SampleVoice) Render(out []int32) {
+	if !v.playing {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	step, stepFrac := uint32(v.inc>>32), uint32(v.inc)
+	if v.backward || (v.looping && v.Loop == LOOP_PINGPONG) {
+		v.renderAny(out, level, step, stepFrac)
+		return
+	}
+
+	data := v.Sample.Data
+	end := v.last
+	var loopLen uint32
+	if v.looping {
+		end, loopLen = v.hi, v.hi-v.lo
+	}
+
+	if v.Interpolate && !nearestOnly {
+		v.renderLinear(out, end, loopLen, level, step, stepFrac)
+		return
+	}
+	for i := range out {
+		if v.pos >= end {
+			if loopLen == 0 {
+				v.playing = false
+				return
+			}
+			v.pos = v.lo + (v.pos-end)%loopLen
+		}
+		out[i] += int32(data[v.pos]) * level >> 8
+
+		f := v.frac + stepFrac
+		if f < v.frac {
+			v.pos++
+		}
+		v.frac = f
+		v.pos += step
+	}
+}
+
+// Render reading between samples with linear interpolation
+func (v *SampleVoice) renderLinear(out []int32, end, loopLen uint32, level int32, step, stepFrac uint32) {
+	data := v.Sample.Data
+	for i := range out {
+		if v.pos >= end {
+			if loopLen == 0 {
+				v.playing = false
+				return
+			}
+			v.pos = v.lo + (v.pos-end)%loopLen
+		}
+		// The sample after the last one is the loop start, or silence
+		a := int32(data[v.pos])
+		var b int32
+		if next := v.pos + 1; next < end {
+			b = int32(data[next])
+		} else if loopLen > 0 {
+			b = int32(data[v.lo])
+		}
+		a += (b - a) * int32(v.frac>>17) >> 15
+		out[i] += a * level >> 8
+
+		f := v.frac + stepFrac
+		if f < v.frac {
+			v.pos++
+		}
+		v.frac = f
+		v.pos += step
+	}
+}
+
+// Render in reverse or ping-pong, slower than the forward loops as every
+// frame checks the direction
+func (v *SampleVoice) renderAny(out []int32, level int32, step, stepFrac uint32) {
+	data := v.Sample.Data
+	for i := range out {
+		a := int32(data[v.pos])
+		if v.Interpolate && !nearestOnly && v.pos+1 < v.last {
+			a += (int32(data[v.pos+1]) - a) * int32(v.frac>>17) >> 15
+		}
+		out[i] += a * level >> 8
+		if !v.advance(step, stepFrac) {
+			v.playing = false
+			return
+		}
+	}
+}
+
+// Step the position in the current direction, bouncing or wrapping at the
+// loop points. Returns false past either end of the region.
+func (v *SampleVoice) advance(step, stepFrac uint32) bool {
+	if !v.backward {
+		f := v.frac + stepFrac
+		if f < v.frac {
+			v.pos++
+		}
+		v.frac = f
+		v.pos += step
+		hi := v.last
+		if v.looping {
+			hi = v.hi
+		}
+		if v.pos < hi {
+			return true
+		}
+		if !v.looping {
+			return false
+		}
+		over := v.pos - hi
+		if v.Loop == LOOP_PINGPONG {
+			v.backward = true
+			v.pos = hi - 1 - min(over, hi-1-v.lo)
+		} else {
+			v.pos = v.lo + over%(v.hi-v.lo)
+		}
+		return true
+	}
+
+	back := step
+	f := v.frac - stepFrac
+	if f > v.frac {
+		back++
+	}
+	v.frac = f
+	lo := v.first
+	if v.looping {
+		lo = v.lo
+	}
+	if v.pos >= lo+back {
+		v.pos -= back
+		return true
+	}
+	if !v.looping {
+		return false
+	}
+	under := lo + back - v.pos - 1 // Frames below lo, less one
+	if v.Loop == LOOP_PINGPONG {
+		v.backward = false
+		v.pos = lo + min(under, v.hi-1-lo)
+	} else {
+		v.pos = v.hi - 1 - under%(v.hi-lo)
+	}
+	return true
+}
+
+func init() {
+	addTool("SAMPLE PLAYBACK", openSamplePlaybackView)
+}
+
+// Loop points are stepped in 5% of the sample's length
+const LOOP_POINT_STEPS = 20
+
+// Step the loop and note off modes, direction and loop points of the
+// selected instrument
+func openSamplePlaybackView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	percents := func(from, to int) []string {
+		var names []string
+		for i := from; i <= to; i++ {
+			names = append(names, itoa(i*100/LOOP_POINT_STEPS)+"%")
+		}
+		return names
+	}
+	point := func(v uint16) int { return (int(v)*LOOP_POINT_STEPS + 32768) >> 16 }
+	faded := in.LoopFade != 0
+	openInstrumentParams("PLAYBACK "+itoa(int(slot)), in, []settingItem{
+		{"LOOP", []string{"SAMPLE", "OFF", "FORWARD", "PINGPONG"},
+			func() int { return int(in.Loop) % 4 },
+			func(i int) { in.Loop = LoopMode(i) }},
+		{"NOTE OFF", []string{"STOP", "ONE SHOT", "SUSTAIN"},
+			func() int { return int(in.Play) % 3 },
+			func(i int) { in.Play = PlayMode(i) }},
+		{"REVERSE", []string{"OFF", "ON"},
+			func() int { return int(boolByte(in.Reverse)) },
+			func(i int) { in.Reverse = i == 1 }},
+		{"LOOP START", percents(0, LOOP_POINT_STEPS-1),
+			func() int { return min(point(in.LoopStart), LOOP_POINT_STEPS-1) },
+			func(i int) { in.LoopStart = uint16(i * 65536 / LOOP_POINT_STEPS) }},
+		{"LOOP END", append([]string{"SAMPLE"}, percents(1, LOOP_POINT_STEPS)...),
+			func() int {
+				if in.LoopEnd == 0 {
+					return 0
+				}
+				return max(point(in.LoopEnd), 1)
+			},
+			func(i int) { in.LoopEnd = uint16(min(i*65536/LOOP_POINT_STEPS, 65535)) }},
+		byteChoice("LOOP FADE", func() *uint8 { return &in.LoopFade }, loopFades,
+			func(v uint8) string {
+				if v == 0 {
+					return "OFF"
+				}
+				return itoa(int(v)) + "%"
+			}),
+	}, func() {
+		// Fades are baked in, so load the samples again to redo them
+		if in.LoopFade != 0 || faded {
+			for s := range project.Samples {
+				if in.usesSample(uint8(s)) {
+					reloadSample(project, uint8(s))
+				}
+			}
+		}
+		faded = in.LoopFade != 0
+	})
+}
@@ -0,0 +1,255 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+var errSampleMissing = errors.New("sample: not loaded")
+
+// Sample edits are kept in the project rather than written over the wav:
+// each sample slot has a trim, normalize and reverse that are applied as
+// the sample loads, so the file on the card stays as recorded and an edit
+// can be taken back at any time, even after saving. COMMIT writes the
+// edited sample to a new file and points the slot at it.
+type SampleEdit struct {
+	Start, End uint16 // Region kept, in 1/65536 of the file's length, End 0 the end
+	Normalize  bool
+	Reverse    bool
+}
+
+// Steps of the trim points, in 1/65536
+const SAMPLE_TRIM_STEP = 65536 / 20
+
+// Apply an edit to a sample just loaded: trim, then reverse, then
+// normalize. Loop points follow the trim, or are dropped when cut.
+func applySampleEdit(s *Sample, e SampleEdit) {
+	if e == (SampleEdit{}) {
+		return
+	}
+	lo, hi := fractionFrames(s, e.Start), uint32(len(s.Data))
+	if e.End > 0 {
+		hi = fractionFrames(s, e.End)
+	}
+	if lo < hi && hi-lo < uint32(len(s.Data)) {
+		s.Data = append([]int16(nil), s.Data[lo:hi]...) // Lets the rest be freed
+		if s.LoopStart < lo || s.LoopEnd > hi {
+			s.LoopStart, s.LoopEnd = 0, 0
+		} else if s.LoopEnd > 0 {
+			s.LoopStart, s.LoopEnd = s.LoopStart-lo, s.LoopEnd-lo
+		}
+	}
+	n := uint32(len(s.Data))
+	if e.Reverse {
+		for i, j := 0, len(s.Data)-1; i < j; i, j = i+1, j-1 {
+			s.Data[i], s.Data[j] = s.Data[j], s.Data[i]
+		}
+		if s.LoopEnd > 0 {
+			s.LoopStart, s.LoopEnd = n-s.LoopEnd, n-s.LoopStart
+		}
+	}
+	if e.Normalize {
+		peak := int32(0)
+		for _, x := range s.Data {
+			peak = max(peak, int32(x), -int32(x))
+		}
+		if peak > 0 && peak < 32767 {
+			for i, x := range s.Data {
+				s.Data[i] = int16(min(int32(x)*32767/peak, 32767))
+			}
+		}
+	}
+}
+
+// Encode a sample as a mono 16-bit wav, with a smpl chunk keeping its
+// root note and loop
+func encodeSampleWav(s *Sample) []byte {
+	w := &byteWriter{}
+	w.buf = append(w.buf, wavHeader(s.Rate, 1, uint32(len(s.Data)*2))...)
+	for _, x := range s.Data {
+		w.u16(uint16(x))
+	}
+	c := w.beginChunk("smpl")
+	w.buf = append(w.buf, make([]byte, 12)...) // Manufacturer, product, period
+	w.u32(uint32(s.RootNote))
+	w.buf = append(w.buf, make([]byte, 12)...) // Pitch fraction, SMPTE
+	if s.LoopEnd == 0 {
+		w.u32(0)
+		w.u32(0)
+	} else {
+		w.u32(1)
+		w.u32(0)
+		w.u32(0) // Cue point
+		w.u32(0) // Forward loop
+		w.u32(s.LoopStart)
+		w.u32(s.LoopEnd - 1) // The last sample played
+		w.u32(0)
+		w.u32(0) // Loop forever
+	}
+	w.endChunk(c)
+	r := &byteWriter{}
+	r.u32(uint32(len(w.buf) - 8))
+	copy(w.buf[4:], r.buf) // RIFF size, now with the smpl chunk
+	return w.buf
+}
+
+// First name not taken in the samples folder for an edit of a file
+func editedSampleName(name string) string {
+	stem := strings.TrimSuffix(name, ".wav")
+	if i := strings.LastIndexByte(stem, '~'); i > 0 {
+		stem = stem[:i] // Edits of edits count on from the original
+	}
+	for n := 1; ; n++ {
+		name := stem + "~" + itoa(n) + ".wav"
+		if _, err := storage.Stat(joinPath(samplesDir, name)); err != nil {
+			return name
+		}
+	}
+}
+
+// Load a project sample slot again from its file, applying its edit and
+// loop fades
+func reloadSample(p *Project, slot uint8) {
+	name := p.Samples[slot]
+	samples[slot] = nil
+	if name == "" {
+		return
+	}
+	s, err := loadSample(joinPath(samplesDir, name))
+	if err != nil {
+		println("Failed to load sample", name+":", err.Error())
+		return
+	}
+	noteIntegrity(name, p.matchSampleSum(int(slot), s.Sum))
+	applySampleEdit(s, p.SampleEdits[slot])
+	fadeLoops(p, slot, s)
+	samples[slot] = s
+}
+
+// Write a slot's edited sample to a new file and use that in its place.
+// The file is read again so loop fades, which stay with the instruments,
+// aren't written into it.
+func commitSampleEdit(p *Project, slot uint8) error {
+	if samples[slot] == nil {
+		return errSampleMissing
+	}
+	s, err := loadSample(joinPath(samplesDir, p.Samples[slot]))
+	if err != nil {
+		return err
+	}
+	applySampleEdit(s, p.SampleEdits[slot])
+	name := editedSampleName(p.Samples[slot])
+	if err := writeFile(joinPath(samplesDir, name), encodeSampleWav(s)); err != nil {
+		return err
+	}
+	p.Samples[slot], p.SampleEdits[slot], p.SampleSums[slot] = name, SampleEdit{}, 0
+	samples[slot].Name = name
+	return nil
+}
+
+func init() {
+	addTool("SAMPLE EDIT", openSampleEditView)
+	addTool("REVERT SAMPLE", revertSampleEdit)
+	addTool("COMMIT SAMPLE", commitSampleTool)
+}
+
+// Sample slot of the selected instrument, showing why when there is none
+func editSampleSlot() (uint8, bool) {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return 0, false
+	}
+	si := project.Instruments[slot].Sample
+	if si >= MAX_SAMPLES || project.Samples[si] == "" {
+		showStatus("NO SAMPLE", colorRed)
+		return 0, false
+	}
+	return si, true
+}
+
+// Change a slot's edit, saving undo first, and load the sample again
+func changeSampleEdit(si uint8, label string, change func(e *SampleEdit)) {
+	if err := saveUndo(project, label); err != nil {
+		println("Failed to save undo:", err.Error())
+	}
+	change(&project.SampleEdits[si])
+	reloadSample(project, si)
+}
+
+// Step the trim, normalize and reverse of the selected instrument's sample
+func openSampleEditView() {
+	si, ok := editSampleSlot()
+	if !ok {
+		return
+	}
+	var percents []string
+	for i := 0; i <= 20; i++ {
+		percents = append(percents, itoa(i*5)+"%")
+	}
+	// 0 is the start for TRIM START and the end for TRIM END
+	trim := func(name string, field func(e *SampleEdit) *uint16, zero int) settingItem {
+		return settingItem{name, percents,
+			func() int {
+				v := int(*field(&project.SampleEdits[si]))
+				if v == 0 {
+					return zero
+				}
+				return (v + SAMPLE_TRIM_STEP/2) / SAMPLE_TRIM_STEP
+			},
+			func(i int) {
+				changeSampleEdit(si, "TRIM", func(e *SampleEdit) {
+					// At least 1 elsewhere, as 0 means the start or end
+					*field(e) = uint16(min(max(i*SAMPLE_TRIM_STEP, 1), 65535))
+					if i == zero {
+						*field(e) = 0
+					}
+				})
+			}}
+	}
+	toggle := func(name string, field func(e *SampleEdit) *bool) settingItem {
+		return settingItem{name, []string{"OFF", "ON"},
+			func() int { return int(boolByte(*field(&project.SampleEdits[si]))) },
+			func(i int) { changeSampleEdit(si, name, func(e *SampleEdit) { *field(e) = i == 1 }) }}
+	}
+	openParamList("EDIT "+project.Samples[si], []settingItem{
+		trim("TRIM START", func(e *SampleEdit) *uint16 { return &e.Start }, 0),
+		trim("TRIM END", func(e *SampleEdit) *uint16 { return &e.End }, 20),
+		toggle("NORMALIZE", func(e *SampleEdit) *bool { return &e.Normalize }),
+		toggle("REVERSE", func(e *SampleEdit) *bool { return &e.Reverse }),
+	}, nil)
+}
+
+// Drop every edit of the selected instrument's sample
+func revertSampleEdit() {
+	si, ok := editSampleSlot()
+	if !ok {
+		return
+	}
+	changeSampleEdit(si, "REVERT", func(e *SampleEdit) { *e = SampleEdit{} })
+	showStatus("REVERTED "+project.Samples[si], colorGreen)
+}
+
+// Write the selected instrument's edited sample to a new file
+func commitSampleTool() {
+	si, ok := editSampleSlot()
+	if !ok {
+		return
+	}
+	if project.SampleEdits[si] == (SampleEdit{}) {
+		showStatus("NO EDITS", colorRed)
+		return
+	}
+	if err := saveUndo(project, "COMMIT"); err != nil {
+		println("Failed to save undo:", err.Error())
+	}
+	if err := commitSampleEdit(project, si); err != nil {
+		println("Failed to commit sample edit:", err.Error())
+		showStatus("COMMIT FAILED", colorRed)
+		return
+	}
+	showStatus("SAVED "+project.Samples[si], colorGreen)
+}
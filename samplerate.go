@@ -0,0 +1,63 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Output rates the I2S clock can be switched between. Lower rates leave
+// more CPU time per sample for voices and effects.
+var sampleRates = []uint32{22050, 32000, 44100, 48000}
+
+// Current output rate, SAMPLE_RATE until the setting changes it
+var sampleRate uint32 = SAMPLE_RATE
+
+// A voice whose phase increments depend on the output rate
+type Retuner interface {
+	// Recompute increments for the current sampleRate
+	Retune()
+}
+
+func init() {
+	names := make([]string, len(sampleRates))
+	for i, r := range sampleRates {
+		names[i] = itoa(int(r))
+	}
+	addSetting("SAMPLE RATE", names,
+		func() int {
+			for i, r := range sampleRates {
+				if r == settings.SampleRate {
+					return i
+				}
+			}
+			return 0
+		},
+		func(i int) {
+			settings.SampleRate = sampleRates[i]
+			setSampleRate(sampleRates[i])
+		})
+}
+
+// Switch the output rate, reclocking the output and retuning playing
+// voices. It all happens under audioMu, so no block renders with the rate,
+// note table and voices out of step.
+func setSampleRate(rate uint32) {
+	if rate == sampleRate {
+		return
+	}
+	audioMu.Lock()
+	sampleRate = rate
+	fadeStep = GAIN_UNITY/(int32(rate)*FADE_MS/1000) + 1
+	initNoteIncrements()
+	if audioOut != nil {
+		if err := audioOut.SetSampleFrequency(rate); err != nil {
+			println("Failed to set sample rate:", err.Error())
+		}
+	}
+	for t := range mixer.Tracks {
+		if v, ok := mixer.Tracks[t].Voice.(Retuner); ok {
+			v.Retune()
+		}
+	}
+	mixer.Compensate()
+	audioMu.Unlock()
+	println("Sample rate:", rate, "Hz")
+}
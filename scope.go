@@ -0,0 +1,34 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "image/color"
+
+// Oscilloscope of the master output for visualizers. The audio loop keeps
+// a decimated copy of the latest block.
+const SCOPE_POINTS = SCREEN_WIDTH / 2
+
+var scope [SCOPE_POINTS]int16
+
+// Keep a mono copy of a rendered block
+func captureScope(block []uint32) {
+	for i := range scope {
+		w := block[i*len(block)/SCOPE_POINTS]
+		scope[i] = int16((int32(int16(w>>16)) + int32(int16(w))) >> 1)
+	}
+}
+
+// Draw the scope as a line across the screen, centered on y and reaching
+// height/2 above and below it
+func drawScope(y, height int, c color.RGBA) {
+	prev := int16(y)
+	for i, s := range scope {
+		cur := int16(y - int(s)*height/65536)
+		lo, hi := min(prev, cur), max(prev, cur)
+		x := int16(i * 2)
+		display.DrawFastVLine(x, lo, hi, c)
+		display.DrawFastVLine(x+1, cur, cur, c)
+		prev = cur
+	}
+}
@@ -0,0 +1,138 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "errors"
+
+var errSongFull = errors.New("project: no free song row")
+
+// Scratch phrases, one per track, for trying out ideas over the song while
+// it plays. They belong to no project, so they are never saved and play
+// in no chain: a track with its scratch on plays it on a loop in place of
+// the song until it is turned off or promoted, and an idea can be carried
+// from one project to the next. PROMOTE copies a scratch phrase into a
+// free phrase and chain and puts the chain at the end of the track's part
+// of the song.
+var (
+	scratch = func() (s [NUM_TRACKS]Phrase) {
+		for t := range s {
+			s[t] = emptyPhrase()
+		}
+		return s
+	}()
+	scratchOn [NUM_TRACKS]bool
+)
+
+// The scratch step a track plays in place of the song, nil when its
+// scratch is off
+func scratchStep(t int, step uint8) *Step {
+	if !scratchOn[t] {
+		return nil
+	}
+	return &scratch[t].Steps[step%PHRASE_STEPS]
+}
+
+// Copy a track's scratch phrase into p, in a new chain on the first song
+// row after the track's last. Returns the row.
+func promoteScratch(p *Project, t int) (int, error) {
+	row := 0
+	for r := range p.Song {
+		if p.Song[r][t] != EMPTY {
+			row = r + 1
+		}
+	}
+	if row >= SONG_ROWS {
+		return 0, errSongFull
+	}
+	ph, c := p.freePhrase(), p.freeChain()
+	if ph == EMPTY || c == EMPTY {
+		return 0, errProjectFull
+	}
+	p.Phrases[ph] = scratch[t]
+	p.Chains[c] = emptyChain()
+	p.Chains[c].Entries[0].Phrase = ph
+	p.Song[row][t] = c
+	return row, nil
+}
+
+func init() {
+	addTool("SCRATCHPAD", openScratchView)
+}
+
+// Pick a track, then play, edit, fill, clear or promote its scratch phrase
+func openScratchView() {
+	list := &ListView{Title: "SCRATCHPAD"}
+	for t := range scratch {
+		list.Items = append(list.Items, "TRACK "+itoa(t+1))
+	}
+	list.OnSelect = func(t int) {
+		pushScratchTrackView(t)
+	}
+	pushView(list)
+}
+
+// Actions on one track's scratch phrase
+func pushScratchTrackView(t int) {
+	list := &ListView{Title: "SCRATCH " + itoa(t+1)}
+	refresh := func() {
+		play := "PLAY: SONG"
+		if scratchOn[t] {
+			play = "PLAY: SCRATCH"
+		}
+		list.Items = append(list.Items[:0], play, "EDIT", "COPY FROM PHRASE", "CLEAR", "PROMOTE TO SONG")
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		switch i {
+		case 0:
+			scratchOn[t] = !scratchOn[t]
+		case 1:
+			openScratchPhrase(t)
+		case 2:
+			pushScratchCopyView(t)
+		case 3:
+			scratch[t] = emptyPhrase()
+			showStatus("SCRATCH CLEARED", colorGreen)
+		case 4:
+			if scratch[t].IsEmpty() {
+				showStatus("SCRATCH EMPTY", colorRed)
+				return
+			}
+			if err := saveUndo(project, "PROMOTE"); err != nil {
+				println("Failed to save undo:", err.Error())
+			}
+			row, err := promoteScratch(project, t)
+			if err != nil {
+				println("Failed to promote scratch:", err.Error())
+				showStatus("PROMOTE FAILED", colorRed)
+				return
+			}
+			scratchOn[t] = false
+			showStatus("ADDED AT ROW "+hexByte(uint8(row)), colorGreen)
+		}
+		refresh()
+	}
+	pushView(list)
+}
+
+// Start a track's scratch phrase from a copy of a phrase in the song
+func pushScratchCopyView(t int) {
+	var phrases []uint8
+	var names []string
+	for i := range project.Phrases {
+		if !project.Phrases[i].IsEmpty() {
+			phrases = append(phrases, uint8(i))
+			names = append(names, "PHRASE "+hexByte(uint8(i)))
+		}
+	}
+	if len(names) == 0 {
+		showStatus("NO PHRASES", colorRed)
+		return
+	}
+	pushView(&ListView{Title: "COPY TO SCRATCH", Items: names, OnSelect: func(i int) {
+		scratch[t] = project.Phrases[phrases[i]]
+		popView()
+		showStatus("COPIED "+names[i], colorGreen)
+	}})
+}
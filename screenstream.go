@@ -0,0 +1,121 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "machine"
+
+// Screen mirroring and screenshots over the debug UART, see
+// docs/screen-stream.md. Rows are taken from the bands of drawBatched as
+// they go to the panel. Each row is run-length encoded, and while
+// mirroring only rows whose hash changed since they were last sent go out,
+// so a typical UI update is a few hundred bytes.
+const (
+	SCREEN_PKT_MARK  = 0x00 // Starts every packet; debug text never contains it
+	SCREEN_PKT_FRAME = 'F'
+	SCREEN_PKT_RLE   = 'R'
+	SCREEN_PKT_RAW   = 'P' // Rows that don't compress
+	SCREEN_PKT_END   = 'E'
+
+	SCREEN_RUN_MAX = 255
+)
+
+var (
+	screenFull      bool // Send every row of the next redraw
+	screenSending   bool // A frame packet is open
+	screenRowHashes [SCREEN_HEIGHT]uint32
+	screenPacket    = &byteWriter{buf: make([]byte, 0, 8+SCREEN_WIDTH*3)}
+)
+
+func init() {
+	addSetting("SCREEN MIRROR", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.ScreenMirror)) },
+		func(i int) {
+			settings.ScreenMirror = i == 1
+			screenFull = true
+		})
+	addTool("SCREENSHOT", func() {
+		screenFull = true
+		redrawView()
+	})
+}
+
+// Hash of a row of RGB565 pixels, FNV-1a
+func rowHash(row []uint8) uint32 {
+	h := uint32(2166136261)
+	for _, b := range row {
+		h = (h ^ uint32(b)) * 16777619
+	}
+	return h
+}
+
+// Send the changed rows of a band that was just drawn at top
+func streamBand(top int16, band []uint8, rows int16) {
+	if !settings.ScreenMirror && !screenFull {
+		return
+	}
+	for r := int16(0); r < rows; r++ {
+		y := top + r
+		row := band[int(r)*SCREEN_WIDTH*2 : int(r+1)*SCREEN_WIDTH*2]
+		h := rowHash(row)
+		if h == screenRowHashes[y] && !screenFull {
+			continue
+		}
+		screenRowHashes[y] = h
+		if !screenSending {
+			screenSending = true
+			sendScreenPacket(SCREEN_PKT_FRAME, func(w *byteWriter) {
+				w.u16(SCREEN_WIDTH)
+				w.u16(SCREEN_HEIGHT)
+			})
+		}
+		sendRow(y, row)
+	}
+}
+
+// Close the frame after a batched draw, if any rows were sent
+func endScreenFrame(full bool) {
+	if screenSending {
+		sendScreenPacket(SCREEN_PKT_END, func(w *byteWriter) {})
+		screenSending = false
+	}
+	if full {
+		screenFull = false
+	}
+}
+
+// Encode one row as runs of a count and a pixel, falling back to the raw
+// pixels when that is no shorter
+func sendRow(y int16, row []uint8) {
+	w := screenPacket
+	w.buf = append(w.buf[:0], SCREEN_PKT_MARK, SCREEN_PKT_RLE)
+	w.u16(uint16(y))
+	lenAt := len(w.buf)
+	w.u16(0)
+	for i := 0; i < len(row); {
+		hi, lo := row[i], row[i+1]
+		n := 1
+		for i+n*2 < len(row) && n < SCREEN_RUN_MAX && row[i+n*2] == hi && row[i+n*2+1] == lo {
+			n++
+		}
+		w.buf = append(w.buf, uint8(n), hi, lo)
+		i += n * 2
+	}
+	size := len(w.buf) - lenAt - 2
+	if size >= len(row) {
+		w.buf = append(w.buf[:0], SCREEN_PKT_MARK, SCREEN_PKT_RAW)
+		w.u16(uint16(y))
+		w.u16(uint16(len(row)))
+		w.buf = append(w.buf, row...)
+	} else {
+		w.buf[lenAt], w.buf[lenAt+1] = uint8(size), uint8(size>>8)
+	}
+	machine.Serial.Write(w.buf)
+}
+
+func sendScreenPacket(kind uint8, body func(w *byteWriter)) {
+	w := screenPacket
+	w.buf = append(w.buf[:0], SCREEN_PKT_MARK, kind)
+	body(w)
+	machine.Serial.Write(w.buf)
+}
@@ -0,0 +1,607 @@
+//go:build tinygo && !noscript && !minimal
+// +build tinygo,!noscript,!minimal
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const FEATURE_SCRIPT = true
+
+// Tiny expression language for generative hooks. Expressions are compiled
+// once into a fixed-size stack program; running one never allocates and
+// always takes the same path, so playback stays deterministic.
+//
+//	step, bar, note     current sequencer position and track note
+//	x                   this script's previous result
+//	rand(n)             repeatable pseudo-random number in 0..n-1
+//	min(a,b) max(a,b)   smaller / larger value
+//	c ? a : b           select
+//
+// Operators follow C precedence: * / % + - << >> < <= > >= == != & ^ |
+//
+// Hooks are added with the script command over the debug UART, or from
+// SCRIPT_FILE in the project's folder when the project opens, one hook a
+// line in the command's form: TRACK TARGET TRIGGER EXPR, for example
+// "3 pan step 96+rand(64)".
+const (
+	SCRIPT_MAX_CODE   = 48
+	SCRIPT_STACK_SIZE = 8
+	MAX_SCRIPT_HOOKS  = 8
+	SCRIPT_FILE       = "scripts.txt"
+)
+
+const (
+	sopPush uint8 = iota
+	sopStep
+	sopBar
+	sopNote
+	sopLast
+	sopRand
+	sopMin
+	sopMax
+	sopNeg
+	sopSelect
+	sopMul
+	sopDiv
+	sopMod
+	sopAdd
+	sopSub
+	sopShl
+	sopShr
+	sopLt
+	sopLe
+	sopGt
+	sopGe
+	sopEq
+	sopNe
+	sopAnd
+	sopXor
+	sopOr
+)
+
+var (
+	errScriptSyntax  = errors.New("script: syntax error")
+	errScriptTooLong = errors.New("script: program too long")
+	errScriptTooDeep = errors.New("script: expression too deep")
+	errScriptLiteral = errors.New("script: number out of range")
+	errScriptUnknown = errors.New("script: unknown name")
+	errScriptNoHook  = errors.New("script: no free hook")
+	errScriptHook    = errors.New("script: want TRACK TARGET TRIGGER EXPR")
+)
+
+// Binary operators with their precedence, higher binds tighter
+var scriptBinaryOps = [...]struct {
+	token string
+	prec  uint8
+	op    uint8
+}{
+	{"<<", 6, sopShl}, {">>", 6, sopShr}, {"<=", 5, sopLe}, {">=", 5, sopGe},
+	{"==", 4, sopEq}, {"!=", 4, sopNe},
+	{"*", 8, sopMul}, {"/", 8, sopDiv}, {"%", 8, sopMod},
+	{"+", 7, sopAdd}, {"-", 7, sopSub},
+	{"<", 5, sopLt}, {">", 5, sopGt},
+	{"&", 3, sopAnd}, {"^", 2, sopXor}, {"|", 1, sopOr},
+}
+
+type scriptInstr struct {
+	op  uint8
+	arg int16
+}
+
+// Values a script can read while running
+type ScriptContext struct {
+	Step int32
+	Bar  int32
+	Note int32
+}
+
+// A compiled expression
+type Script struct {
+	code  [SCRIPT_MAX_CODE]scriptInstr
+	len   uint8
+	last  int32
+	seed  uint32
+	stack [SCRIPT_STACK_SIZE]int32
+}
+
+// Compile an expression into s
+func (s *Script) Compile(src string) error {
+	c := scriptCompiler{src: src, script: s}
+	s.len = 0
+	if err := c.expr(); err != nil {
+		return err
+	}
+	c.skipSpace()
+	if c.pos != len(c.src) {
+		return errScriptSyntax
+	}
+	s.Reset()
+	return nil
+}
+
+// Rewind the random generator and previous result
+func (s *Script) Reset() {
+	s.last = 0
+	s.seed = 0x2545f491
+}
+
+// Evaluate the program
+func (s *Script) Run(ctx *ScriptContext) int32 {
+	sp := 0
+	stack := &s.stack
+	for _, in := range s.code[:s.len] {
+		switch in.op {
+		case sopPush:
+			stack[sp] = int32(in.arg)
+			sp++
+		case sopStep:
+			stack[sp] = ctx.Step
+			sp++
+		case sopBar:
+			stack[sp] = ctx.Bar
+			sp++
+		case sopNote:
+			stack[sp] = ctx.Note
+			sp++
+		case sopLast:
+			stack[sp] = s.last
+			sp++
+		case sopRand:
+			s.seed = s.seed*1664525 + 1013904223
+			n := stack[sp-1]
+			if n > 0 {
+				stack[sp-1] = int32((s.seed >> 8) % uint32(n))
+			} else {
+				stack[sp-1] = 0
+			}
+		case sopNeg:
+			stack[sp-1] = -stack[sp-1]
+		case sopSelect:
+			sp -= 2
+			if stack[sp-1] != 0 {
+				stack[sp-1] = stack[sp]
+			} else {
+				stack[sp-1] = stack[sp+1]
+			}
+		default:
+			sp--
+			stack[sp-1] = scriptBinary(in.op, stack[sp-1], stack[sp])
+		}
+	}
+	if sp > 0 {
+		s.last = stack[sp-1]
+	}
+	return s.last
+}
+
+func scriptBinary(op uint8, a, b int32) int32 {
+	switch op {
+	case sopMin:
+		return min(a, b)
+	case sopMax:
+		return max(a, b)
+	case sopMul:
+		return a * b
+	case sopDiv:
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	case sopMod:
+		if b == 0 {
+			return 0
+		}
+		return a % b
+	case sopAdd:
+		return a + b
+	case sopSub:
+		return a - b
+	case sopShl:
+		return a << uint32(b&31)
+	case sopShr:
+		return a >> uint32(b&31)
+	case sopAnd:
+		return a & b
+	case sopXor:
+		return a ^ b
+	case sopOr:
+		return a | b
+	}
+	var r bool
+	switch op {
+	case sopLt:
+		r = a < b
+	case sopLe:
+		r = a <= b
+	case sopGt:
+		r = a > b
+	case sopGe:
+		r = a >= b
+	case sopEq:
+		r = a == b
+	case sopNe:
+		r = a != b
+	}
+	if r {
+		return 1
+	}
+	return 0
+}
+
+// Recursive descent compiler emitting stack code
+type scriptCompiler struct {
+	src    string
+	pos    int
+	depth  int
+	script *Script
+}
+
+func (c *scriptCompiler) emit(op uint8, arg int16) error {
+	s := c.script
+	if int(s.len) >= SCRIPT_MAX_CODE {
+		return errScriptTooLong
+	}
+	s.code[s.len] = scriptInstr{op, arg}
+	s.len++
+	switch {
+	case op <= sopLast:
+		c.depth++
+	case op == sopSelect:
+		c.depth -= 2
+	case op >= sopMin && op != sopNeg && op != sopRand:
+		c.depth--
+	}
+	if c.depth > SCRIPT_STACK_SIZE {
+		return errScriptTooDeep
+	}
+	return nil
+}
+
+func (c *scriptCompiler) skipSpace() {
+	for c.pos < len(c.src) && c.src[c.pos] == ' ' {
+		c.pos++
+	}
+}
+
+// Consume tok if it is next in the input
+func (c *scriptCompiler) accept(tok string) bool {
+	c.skipSpace()
+	if len(c.src)-c.pos >= len(tok) && c.src[c.pos:c.pos+len(tok)] == tok {
+		c.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (c *scriptCompiler) expr() error {
+	if err := c.binary(1); err != nil {
+		return err
+	}
+	if !c.accept("?") {
+		return nil
+	}
+	if err := c.expr(); err != nil {
+		return err
+	}
+	if !c.accept(":") {
+		return errScriptSyntax
+	}
+	if err := c.expr(); err != nil {
+		return err
+	}
+	return c.emit(sopSelect, 0)
+}
+
+// Parse operators of at least minPrec by precedence climbing
+func (c *scriptCompiler) binary(minPrec uint8) error {
+	if err := c.unary(); err != nil {
+		return err
+	}
+	for {
+		c.skipSpace()
+		found := false
+		for _, b := range scriptBinaryOps {
+			if b.prec < minPrec || !c.accept(b.token) {
+				continue
+			}
+			if err := c.binary(b.prec + 1); err != nil {
+				return err
+			}
+			if err := c.emit(b.op, 0); err != nil {
+				return err
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+func (c *scriptCompiler) unary() error {
+	if c.accept("-") {
+		if err := c.unary(); err != nil {
+			return err
+		}
+		return c.emit(sopNeg, 0)
+	}
+	return c.primary()
+}
+
+func (c *scriptCompiler) primary() error {
+	c.skipSpace()
+	if c.accept("(") {
+		if err := c.expr(); err != nil {
+			return err
+		}
+		if !c.accept(")") {
+			return errScriptSyntax
+		}
+		return nil
+	}
+	if c.pos >= len(c.src) {
+		return errScriptSyntax
+	}
+	if ch := c.src[c.pos]; ch >= '0' && ch <= '9' {
+		return c.number()
+	}
+
+	start := c.pos
+	for c.pos < len(c.src) && c.src[c.pos] >= 'a' && c.src[c.pos] <= 'z' {
+		c.pos++
+	}
+	switch c.src[start:c.pos] {
+	case "step":
+		return c.emit(sopStep, 0)
+	case "bar":
+		return c.emit(sopBar, 0)
+	case "note":
+		return c.emit(sopNote, 0)
+	case "x":
+		return c.emit(sopLast, 0)
+	case "rand":
+		return c.call(sopRand, 1)
+	case "min":
+		return c.call(sopMin, 2)
+	case "max":
+		return c.call(sopMax, 2)
+	case "":
+		return errScriptSyntax
+	}
+	return errScriptUnknown
+}
+
+// Parse a parenthesised argument list followed by op
+func (c *scriptCompiler) call(op uint8, args int) error {
+	if !c.accept("(") {
+		return errScriptSyntax
+	}
+	for i := 0; i < args; i++ {
+		if i > 0 && !c.accept(",") {
+			return errScriptSyntax
+		}
+		if err := c.expr(); err != nil {
+			return err
+		}
+	}
+	if !c.accept(")") {
+		return errScriptSyntax
+	}
+	return c.emit(op, 0)
+}
+
+// Parse a decimal or 0x hex literal
+func (c *scriptCompiler) number() error {
+	base := int32(10)
+	if c.accept("0x") {
+		base = 16
+	}
+	var v int32
+	digits := 0
+	for ; c.pos < len(c.src); c.pos++ {
+		ch := c.src[c.pos]
+		var d int32
+		switch {
+		case ch >= '0' && ch <= '9':
+			d = int32(ch - '0')
+		case base == 16 && ch >= 'a' && ch <= 'f':
+			d = int32(ch-'a') + 10
+		case base == 16 && ch >= 'A' && ch <= 'F':
+			d = int32(ch-'A') + 10
+		default:
+			d = -1
+		}
+		if d < 0 {
+			break
+		}
+		v = v*base + d
+		digits++
+		if v > 32767 {
+			return errScriptLiteral
+		}
+	}
+	if digits == 0 {
+		return errScriptSyntax
+	}
+	return c.emit(sopPush, int16(v))
+}
+
+// When a hook runs
+type ScriptTrigger uint8
+
+const (
+	SCRIPT_EVERY_STEP ScriptTrigger = iota
+	SCRIPT_EVERY_BAR
+	NUM_SCRIPT_TRIGGERS
+)
+
+var scriptTriggerNames = [NUM_SCRIPT_TRIGGERS]string{"step", "bar"}
+
+// What a hook's result drives
+type ScriptTarget uint8
+
+const (
+	SCRIPT_TARGET_NOTE ScriptTarget = iota
+	SCRIPT_TARGET_VOLUME
+	SCRIPT_TARGET_PAN
+	SCRIPT_TARGET_SEND
+	NUM_SCRIPT_TARGETS
+)
+
+var scriptTargetNames = [NUM_SCRIPT_TARGETS]string{"note", "volume", "pan", "send"}
+
+// A script bound to a track parameter
+type ScriptHook struct {
+	Script  Script
+	Trigger ScriptTrigger
+	Track   uint8
+	Target  ScriptTarget
+	Active  bool
+}
+
+var (
+	scriptHooks [MAX_SCRIPT_HOOKS]ScriptHook
+
+	// Notes generated by SCRIPT_TARGET_NOTE hooks for the sequencer,
+	// -1 when the hook produced no note this step
+	scriptNotes [NUM_TRACKS]int16
+)
+
+// Compile src into a free hook slot
+func addScriptHook(src string, trigger ScriptTrigger, track uint8, target ScriptTarget) (int, error) {
+	for i := range scriptHooks {
+		h := &scriptHooks[i]
+		if h.Active {
+			continue
+		}
+		if err := h.Script.Compile(src); err != nil {
+			return -1, err
+		}
+		h.Trigger, h.Track, h.Target, h.Active = trigger, track%NUM_TRACKS, target, true
+		return i, nil
+	}
+	return -1, errScriptNoHook
+}
+
+// Free a hook slot
+func removeScriptHook(id int) {
+	scriptHooks[id] = ScriptHook{}
+}
+
+// Add a hook from the words of a script line: a track from 1, a target
+// and a trigger by name, and the expression
+func parseScriptHook(words []string) (int, error) {
+	if len(words) < 4 {
+		return -1, errScriptHook
+	}
+	track, err := strconv.Atoi(words[0])
+	target := slices.Index(scriptTargetNames[:], words[1])
+	trigger := slices.Index(scriptTriggerNames[:], words[2])
+	if err != nil || track < 1 || track > NUM_TRACKS || target < 0 || trigger < 0 {
+		return -1, errScriptHook
+	}
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	return addScriptHook(strings.Join(words[3:], " "), ScriptTrigger(trigger), uint8(track-1), ScriptTarget(target))
+}
+
+// Replace the hooks with those in a project's SCRIPT_FILE, if it has one.
+// Lines that don't compile are reported on the UART and skipped.
+func loadScriptHooks(name string) {
+	audioMu.Lock()
+	for i := range scriptHooks {
+		removeScriptHook(i)
+	}
+	audioMu.Unlock()
+	data, err := readFile(joinPath(projectsDir, name, SCRIPT_FILE))
+	if err != nil {
+		return
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		if _, err := parseScriptHook(words); err != nil {
+			println("Script line", n+1, "skipped:", err.Error())
+		}
+	}
+}
+
+func init() {
+	addCommand("script", "script [TRACK TARGET TRIGGER EXPR | rm N]: list, add or remove hooks; targets note volume pan send, triggers step bar", func(args []string) {
+		switch {
+		case len(args) == 0:
+			for i := range scriptHooks {
+				if h := &scriptHooks[i]; h.Active {
+					shellPrint(itoa(i) + ": track " + itoa(int(h.Track)+1) + " " +
+						scriptTargetNames[h.Target] + " " + scriptTriggerNames[h.Trigger] + "\n")
+				}
+			}
+		case args[0] == "rm" && len(args) == 2:
+			id, err := strconv.Atoi(args[1])
+			if err != nil || id < 0 || id >= MAX_SCRIPT_HOOKS {
+				shellPrint("no hook " + args[1] + "\n")
+				return
+			}
+			audioMu.Lock()
+			removeScriptHook(id)
+			audioMu.Unlock()
+		default:
+			id, err := parseScriptHook(args)
+			if err != nil {
+				shellPrint(err.Error() + "\n")
+				return
+			}
+			shellPrint("hook " + itoa(id) + "\n")
+		}
+	})
+}
+
+// Rewind every hook so a replay produces the same values
+func resetScriptHooks() {
+	for i := range scriptHooks {
+		scriptHooks[i].Script.Reset()
+	}
+}
+
+// Run the hooks due on a sequencer step; bar hooks fire on step 0.
+// notes holds the current note of each track.
+func runScriptHooks(step, bar int, notes *[NUM_TRACKS]int16) {
+	for i := range scriptNotes {
+		scriptNotes[i] = -1
+	}
+	for i := range scriptHooks {
+		h := &scriptHooks[i]
+		if !h.Active || (h.Trigger == SCRIPT_EVERY_BAR && step != 0) {
+			continue
+		}
+		ctx := ScriptContext{Step: int32(step), Bar: int32(bar), Note: int32(notes[h.Track])}
+		v := h.Script.Run(&ctx)
+		track := &mixer.Tracks[h.Track]
+		switch h.Target {
+		case SCRIPT_TARGET_NOTE:
+			if v >= 0 && v < 128 {
+				scriptNotes[h.Track] = int16(v)
+			}
+		case SCRIPT_TARGET_VOLUME:
+			track.Volume = clampByte(v)
+		case SCRIPT_TARGET_PAN:
+			track.Pan = clampByte(v)
+		case SCRIPT_TARGET_SEND:
+			track.Send = clampByte(v)
+		}
+	}
+}
+
+// RAM reserved for script hooks
+func scriptFootprint() int {
+	return int(unsafe.Sizeof(scriptHooks) + unsafe.Sizeof(scriptNotes))
+}
@@ -0,0 +1,42 @@
+//go:build tinygo && (noscript || minimal)
+// +build tinygo
+// +build noscript minimal
+
+package main
+
+import "errors"
+
+const FEATURE_SCRIPT = false
+
+type ScriptTrigger uint8
+
+const (
+	SCRIPT_EVERY_STEP ScriptTrigger = iota
+	SCRIPT_EVERY_BAR
+)
+
+type ScriptTarget uint8
+
+const (
+	SCRIPT_TARGET_NOTE ScriptTarget = iota
+	SCRIPT_TARGET_VOLUME
+	SCRIPT_TARGET_PAN
+	SCRIPT_TARGET_SEND
+)
+
+var (
+	errScriptDisabled = errors.New("script: not in this build")
+
+	// Always empty without scripting
+	scriptNotes = [NUM_TRACKS]int16{-1, -1, -1, -1, -1, -1, -1, -1}
+)
+
+func addScriptHook(src string, trigger ScriptTrigger, track uint8, target ScriptTarget) (int, error) {
+	return -1, errScriptDisabled
+}
+
+func removeScriptHook(id int)                                {}
+func loadScriptHooks(name string)                            {}
+func resetScriptHooks()                                      {}
+func runScriptHooks(step, bar int, notes *[NUM_TRACKS]int16) {}
+func scriptFootprint() int                                   { return 0 }
@@ -0,0 +1,445 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// The sequencer plays the song grid: each song row plays its chains side
+// by side, one chain entry at a time, and each entry plays its phrase's
+// 16 steps on the track, transposed. All tracks move together, a row
+// lasting as long as its longest chain, and the song loops back to the top
+// after its last row, unless a J command sends it to another row. Each step is split into TICKS_PER_STEP ticks, on
+// which effect commands and instrument tables run. The sequencer runs
+// inside renderBlock and counts its steps in frames with a TempoClock, so
+// notes land on the frame their tick starts, live or offline, and the song
+// never drifts against the output.
+const (
+	TICKS_PER_STEP = 6
+	FX_SLIDE_UNIT  = 4       // Volume a slide of 1 moves each tick
+	FX_VIBRA_UNIT  = 5       // Cents of vibrato depth 1
+	FX_VIBRA_SPEED = 1 << 26 // Phase a vibrato speed of 1 moves each tick, 64 ticks a cycle
+)
+
+// What a track is playing
+type trackPlayer struct {
+	step       Step // The step playing, or waiting out its delay
+	transpose  int8
+	fx         [NUM_FX]StepFX
+	numFX      int
+	delay      uint8
+	since      int   // Ticks since the step fired, -1 until it has
+	instrument uint8 // Last one played, EMPTY for none
+	note       uint8 // Playing, EMPTY for none
+	base       uint8 // Note the voice was started on, which glides bend away from
+	glide      int32 // Cents left to glide to note
+	glideStep  int32 // Cents a glide moves each tick
+	vibPhase   uint32
+	vibrato    int32 // Cents
+	volume     int32 // Note volume, 0-255
+	duty       uint8 // Pulse width set by W, 0 for the instrument's
+	arp        int8  // Semitones the arpeggio adds
+	table      TablePlayer
+	tableFX    StepFX // Command of the table row playing
+	tableSince int    // Ticks since the table entered its row
+}
+
+// Playback position and state, see sequencer.go. Song is the project
+// playing, which is the one being edited except during a bounce.
+type Sequencer struct {
+	Song    *Project
+	Playing bool
+	Row     int
+	Entry   int
+	Step    int
+
+	clock  TempoClock
+	tick   int
+	left   int // Frames until the next tick
+	frames int // Of the step playing
+	steps  int // Played since the start, for scripts' bar count
+	tracks [NUM_TRACKS]trackPlayer
+}
+
+var sequencer Sequencer
+
+// Play a project from the top. Called with audioMu held.
+func (s *Sequencer) Start(p *Project) {
+	*s = Sequencer{Song: p, Playing: true}
+	mixer.Width = p.Width
+	for t := range s.tracks {
+		tp := &s.tracks[t]
+		tp.instrument, tp.note, tp.volume = EMPTY, EMPTY, 255
+		tp.table.Start(nil)
+		if mixer.Tracks[t].Voice != nil {
+			mixer.CutTrack(t)
+		}
+	}
+	p.resetRoundRobin()
+	resetScriptHooks()
+}
+
+// Play a project from a song row, or from the top when the row is empty.
+// Called with audioMu held.
+func (s *Sequencer) StartAt(p *Project, row int) {
+	s.Start(p)
+	if row >= 0 && row < SONG_ROWS && p.rowEntries(row) > 0 {
+		s.Row = row
+	}
+}
+
+// Stop starting notes and release the ones playing. Called with audioMu
+// held.
+func (s *Sequencer) Stop() {
+	s.Playing = false
+	for t := range s.tracks {
+		if v := mixer.Tracks[t].Voice; v != nil && s.tracks[t].note != EMPTY {
+			v.NoteOff()
+		}
+		s.tracks[t].note = EMPTY
+		trackSteps[t].Phrase = EMPTY
+	}
+}
+
+// Run the ticks due now and return how many of n frames can be rendered
+// before the next. Called with audioMu held.
+func (s *Sequencer) Advance(n int) int {
+	if !s.Playing {
+		return n
+	}
+	if s.left == 0 {
+		s.runTick()
+	}
+	n = min(n, s.left)
+	s.left -= n
+	return n
+}
+
+func (s *Sequencer) runTick() {
+	if s.tick == 0 {
+		s.startStep()
+	}
+	for t := range s.tracks {
+		s.tickTrack(t)
+	}
+	fireTick(uint32(s.steps*TICKS_PER_STEP + s.tick))
+	// Spread the step's frames over its ticks
+	s.left = s.frames*(s.tick+1)/TICKS_PER_STEP - s.frames*s.tick/TICKS_PER_STEP
+	if s.tick++; s.tick < TICKS_PER_STEP {
+		return
+	}
+	s.tick = 0
+	s.steps++
+	s.Row, s.Entry, s.Step = s.Song.nextStep(s.Row, s.Entry, s.Step)
+}
+
+// Time the step, run the scripts and motions, and take each track's step
+func (s *Sequencer) startStep() {
+	p := s.Song
+	tempo, groove := p.slotTiming(s.Row, s.Entry)
+	if bpm, ok := clockSync.Tempo(); ok {
+		tempo = bpm
+	}
+	s.frames = s.clock.Next(tempo, groove, s.Step)
+
+	var notes [NUM_TRACKS]int16
+	for t := range notes {
+		notes[t] = -1
+		if n := s.tracks[t].note; n != EMPTY {
+			notes[t] = int16(n)
+		}
+	}
+	runScriptHooks(s.Step, s.steps/PHRASE_STEPS, &notes)
+
+	for t := range s.tracks {
+		step := uint8(s.Step)
+		st, transpose := Step{Note: EMPTY, Instrument: EMPTY}, int8(0)
+		trackSteps[t].Phrase = EMPTY
+		if sc := scratchStep(t, step); sc != nil {
+			st = *sc
+		} else if e, ok := p.songEntry(s.Row, s.Entry, t); ok {
+			st, transpose = p.Phrases[e.Phrase].Steps[step], e.Transpose
+			trackSteps[t] = StepPos{e.Phrase, step}
+			applyMotions(p, t, e.Phrase, step)
+		}
+		if !stepPlays(&st) {
+			st = Step{Note: EMPTY, Instrument: EMPTY}
+		}
+		if n := scriptNotes[t]; n >= 0 {
+			st.Note, transpose = uint8(n), 0
+		}
+		tp := &s.tracks[t]
+		tp.step, tp.transpose = st, transpose
+		tp.fx, tp.numFX, tp.delay = stepEffects(&st)
+		tp.since, tp.arp, tp.vibrato = -1, 0, 0
+	}
+}
+
+// Chain entry a track plays at a position in the song, if any. A chain
+// ends at its first empty entry.
+func (p *Project) songEntry(row, entry, t int) (ChainEntry, bool) {
+	c := p.Song[row][t]
+	if c == EMPTY || int(c) >= NUM_CHAINS || entry >= CHAIN_LENGTH {
+		return ChainEntry{}, false
+	}
+	entries := &p.Chains[c].Entries
+	for i := 0; i <= entry; i++ {
+		if int(entries[i].Phrase) >= NUM_PHRASES {
+			return ChainEntry{}, false
+		}
+	}
+	return entries[entry], true
+}
+
+// Song row a step jumps to once it has played, -1 for none. The leftmost
+// track with a jump sets it.
+func (p *Project) songJump(row, entry, step int) int {
+	for t := range p.Song[row] {
+		if e, ok := p.songEntry(row, entry, t); ok {
+			st := &p.Phrases[e.Phrase].Steps[step]
+			if param, ok := stepCommand(st, FX_JUMP); ok && stepPlays(st) {
+				return int(param)
+			}
+		}
+	}
+	return -1
+}
+
+// Position the song goes on to after a step: the next step, entry or row,
+// or the top of the row a jump names. After its last row the song loops to
+// the top, as does a jump to an empty row.
+func (p *Project) nextStep(row, entry, step int) (int, int, int) {
+	if j := p.songJump(row, entry, step); j >= 0 {
+		if j >= SONG_ROWS || p.rowEntries(j) == 0 {
+			j = 0
+		}
+		return j, 0, 0
+	}
+	if step++; step < PHRASE_STEPS {
+		return row, entry, step
+	}
+	if entry++; entry < p.rowEntries(row) {
+		return row, entry, 0
+	}
+	if row++; row >= SONG_ROWS || p.rowEntries(row) == 0 {
+		row = 0
+	}
+	return row, 0, 0
+}
+
+// Go through the song once, step by step, following jumps. The pass ends
+// where the song loops: back at a row already played, from its last row or
+// a jump.
+func (p *Project) walkSong(f func(row, entry, step int)) {
+	if p.rowEntries(0) == 0 {
+		return
+	}
+	var played [SONG_ROWS]bool
+	row, entry, step := 0, 0, 0
+	for {
+		played[row] = true
+		f(row, entry, step)
+		row, entry, step = p.nextStep(row, entry, step)
+		if entry == 0 && step == 0 && played[row] {
+			return
+		}
+	}
+}
+
+// Fire the track's step once its delay is over, then run its effects and
+// table for the tick
+func (s *Sequencer) tickTrack(t int) {
+	tp := &s.tracks[t]
+	if tp.since < 0 && s.tick >= int(tp.delay) {
+		tp.since = 0
+		s.fire(t)
+	}
+	if tp.since >= 0 {
+		for _, f := range tp.fx[:tp.numFX] {
+			s.runFX(t, f, tp.since)
+		}
+		tp.since++
+	}
+	if tp.glide > 0 {
+		tp.glide = max(tp.glide-tp.glideStep, 0)
+	} else if tp.glide < 0 {
+		tp.glide = min(tp.glide+tp.glideStep, 0)
+	}
+	if fx, ok := tp.table.Tick(); ok {
+		tp.tableFX, tp.tableSince = fx, 0
+	}
+	if tp.tableFX.Command != FX_NONE && tp.note != EMPTY {
+		s.runFX(t, tp.tableFX, tp.tableSince)
+		tp.tableSince++
+	}
+	s.shapeVoice(t)
+}
+
+// Instrument a track last played, nil for none
+func (s *Sequencer) instrument(t int) *Instrument {
+	if i := s.tracks[t].instrument; i < NUM_INSTRUMENTS {
+		return &s.Song.Instruments[i]
+	}
+	return nil
+}
+
+// Play a track's step: take its instrument, then start, glide to or stop
+// its note
+func (s *Sequencer) fire(t int) {
+	tp := &s.tracks[t]
+	st := &tp.step
+	if st.Instrument < NUM_INSTRUMENTS {
+		in := &s.Song.Instruments[st.Instrument]
+		if st.Instrument != tp.instrument {
+			tp.instrument = st.Instrument
+			setTrackEQ(t, in.EQ)
+			if in.Send != 0 {
+				mixer.Tracks[t].Send = in.Send
+			}
+		}
+		mixer.Tracks[t].Pan = in.Pan
+	}
+	switch {
+	case st.Note == NOTE_OFF:
+		s.noteOff(t)
+	case st.Note < NUM_NOTES:
+		note := uint8(max(min(int(st.Note)+int(tp.transpose), NUM_NOTES-1), 0))
+		if ticks, ok := stepCommand(st, FX_GLIDE); ok && ticks > 0 && tp.note != EMPTY {
+			s.glideTo(t, note, ticks)
+			return
+		}
+		s.noteOn(t, note)
+	}
+}
+
+// Slide the note playing on a track to another over some ticks, without
+// starting it again
+func (s *Sequencer) glideTo(t int, note, ticks uint8) {
+	tp := &s.tracks[t]
+	tp.glide += (int32(tp.note) - int32(note)) * 100
+	tp.glideStep = max(abs32(tp.glide)/int32(ticks), 1)
+	tp.note = note
+}
+
+// Start a note on a track's voice, setting up its preallocated voice first
+// when the track has none for its instrument and engine. Tracks routed off
+// get no voice.
+func (s *Sequencer) noteOn(t int, note uint8) {
+	tp := &s.tracks[t]
+	in := s.instrument(t)
+	if in == nil || mixer.Tracks[t].Route != ROUTE_MIX {
+		return
+	}
+	v, ok := mixer.Tracks[t].Voice.(*PitchVoice)
+	if !ok || !v.madeFrom(in) {
+		if v = trackInstrumentVoice(t, in); v == nil {
+			return
+		}
+	}
+	mixer.SetVoice(t, v)
+	tp.note, tp.volume, tp.duty, tp.arp = note, 255, 0, 0
+	tp.base, tp.glide, tp.vibPhase = note, 0, 0
+	tp.tableFX = StepFX{}
+	tp.table.Start(&in.Table)
+	v.Volume, v.Duty, v.Shift = 255, 0, 0
+	knobVoice(v, in)
+	v.NoteOn(note, 127)
+	fireNote(uint8(t), note, 127)
+}
+
+func (s *Sequencer) noteOff(t int) {
+	tp := &s.tracks[t]
+	if v := mixer.Tracks[t].Voice; v != nil && tp.note != EMPTY {
+		v.NoteOff()
+	}
+	tp.note = EMPTY
+	tp.table.Stop()
+}
+
+// Run an effect command on a track, since ticks after it started. Values
+// are set on its first tick, the rest runs tick by tick, see docs/fx.md.
+func (s *Sequencer) runFX(t int, f StepFX, since int) {
+	tp := &s.tracks[t]
+	x, y := int32(f.Param>>4), int32(f.Param&0xf)
+	switch f.Command {
+	case FX_VOLUME:
+		if since == 0 {
+			tp.volume = int32(f.Param)
+		}
+	case FX_PAN:
+		if since == 0 {
+			mixer.Tracks[t].Pan = f.Param
+		}
+	case FX_WIDTH:
+		if since == 0 {
+			tp.duty = f.Param
+		}
+	case FX_MASTER:
+		if since == 0 {
+			mixer.Width = min(f.Param, WIDTH_MAX)
+		}
+	case FX_KNOB:
+		if in := s.instrument(t); in != nil && since == 0 {
+			knobFX(in, f.Param)
+		}
+	case FX_ARP:
+		tp.arp = [3]int8{0, int8(x), int8(y)}[since%3]
+	case FX_RETRIG:
+		if f.Param > 0 && since > 0 && since%int(f.Param) == 0 && tp.note != EMPTY {
+			if v := mixer.Tracks[t].Voice; v != nil {
+				v.NoteOn(tp.note, 127)
+				tp.base, tp.glide = tp.note, 0
+			}
+		}
+	case FX_CUT:
+		if since == int(f.Param) {
+			s.noteOff(t)
+		}
+	case FX_VIBRA:
+		tp.vibPhase += uint32(x) * FX_VIBRA_SPEED
+		sine := int32(wavetables[WAVE_SINE][tp.vibPhase>>(32-WAVETABLE_BITS)])
+		tp.vibrato = sine * y * FX_VIBRA_UNIT >> 15
+	case FX_SLIDE:
+		if since > 0 {
+			tp.volume = max(min(tp.volume+(x-y)*FX_SLIDE_UNIT, 255), 0)
+		}
+	}
+}
+
+// Put the track's note volume, pulse width and pitch offsets on its voice.
+// The voice plays the note it was started on, so the pitch is bent from
+// there to the note, then by the glide left, the vibrato, the arpeggio and
+// the table.
+func (s *Sequencer) shapeVoice(t int) {
+	tp := &s.tracks[t]
+	v, ok := mixer.Tracks[t].Voice.(*PitchVoice)
+	in := s.instrument(t)
+	if !ok || in == nil || v.instrument != in {
+		return
+	}
+	v.Volume = uint8(tp.volume * int32(tp.table.Volume) / 255)
+	v.Duty = tp.duty
+	cents := (int32(tp.note)-int32(tp.base))*100 + tp.glide + tp.vibrato
+	v.Shift = int16(cents + (int32(tp.arp)+int32(tp.table.Pitch))*100)
+	knobVoice(v, in)
+}
+
+// Start the song from the top with the project being edited, live
+func playSong() {
+	audioMu.Lock()
+	sequencer.Start(project)
+	audioMu.Unlock()
+}
+
+func stopSong() {
+	audioMu.Lock()
+	sequencer.Stop()
+	audioMu.Unlock()
+}
+
+// Follow a switch of project while playing, such as opening another or
+// the demo, by playing the new one from the top. Called from the main
+// loop.
+func updateSequencer() {
+	if isAudioPlaying && sequencer.Song != project {
+		playSong()
+	}
+}
@@ -0,0 +1,146 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Per-project UI state, saved next to the project file so reopening it
+// returns to the same screen and cursor
+const (
+	SESSION_FILE    = "session.bin"
+	SESSION_VERSION = 1
+)
+
+// Screens that can be restored
+type ViewID uint8
+
+const (
+	VIEW_HOME ViewID = iota
+	VIEW_PHRASE
+	VIEW_SONG
+	VIEW_CHAIN
+	VIEW_INSTRUMENT
+	VIEW_TABLE
+	MAX_VIEWS = 16
+)
+
+// Saved position within one screen
+type ViewState struct {
+	Row, Col uint8
+	Scroll   uint8 // First row shown
+	Zoom     uint8
+}
+
+type Session struct {
+	View       ViewID
+	Views      [MAX_VIEWS]ViewState
+	Instrument uint8 // Selected instrument
+	Phrase     uint8 // Phrase the phrase editor shows
+	Chain      uint8 // Chain the chain editor shows
+}
+
+// A view that keeps its state in the session
+type SessionView interface {
+	View
+	ID() ViewID
+}
+
+var (
+	session Session
+
+	// Constructors for restorable views, by ID
+	sessionViews [MAX_VIEWS]func() View
+)
+
+func init() {
+	registerView(VIEW_HOME, func() View { return homeView{} })
+}
+
+// Make a view restorable
+func registerView(id ViewID, open func() View) {
+	sessionViews[id] = open
+}
+
+// Path of a project's session file
+func sessionPath(name string) string {
+	return joinPath(projectsDir, name, SESSION_FILE)
+}
+
+// Remember the top-most restorable view of the stack, so a menu
+// open on top of an editor restores the editor
+func saveSession(p *Project) {
+	for i := len(viewStack) - 1; i >= 0; i-- {
+		if v, ok := viewStack[i].(SessionView); ok {
+			session.View = v.ID()
+			break
+		}
+	}
+	w := &byteWriter{}
+	w.u8(SESSION_VERSION)
+	w.u8(uint8(session.View))
+	w.u8(session.Instrument)
+	w.u8(MAX_VIEWS)
+	for _, s := range session.Views {
+		w.u8(s.Row)
+		w.u8(s.Col)
+		w.u8(s.Scroll)
+		w.u8(s.Zoom)
+	}
+	w.u8(session.Phrase)
+	w.u8(session.Chain)
+	if err := writeFile(sessionPath(p.Name), w.buf); err != nil {
+		println("Failed to save session:", err.Error())
+	}
+}
+
+// Read a project's session, starting fresh when there is none
+func loadSession(p *Project) {
+	session = Session{}
+	data, err := readFile(sessionPath(p.Name))
+	if err != nil {
+		return
+	}
+	r := &byteReader{buf: data}
+	if r.u8() != SESSION_VERSION {
+		return
+	}
+	session.View = ViewID(r.u8())
+	session.Instrument = r.u8()
+	count := int(r.u8())
+	for i := 0; i < count; i++ {
+		s := ViewState{r.u8(), r.u8(), r.u8(), r.u8()}
+		if i < MAX_VIEWS {
+			session.Views[i] = s
+		}
+	}
+	if !r.done() {
+		session.Phrase = r.u8() % NUM_PHRASES
+	}
+	if !r.done() {
+		session.Chain = r.u8() % NUM_CHAINS
+	}
+}
+
+// Show the view the session was left on
+func restoreSessionView() {
+	open := sessionViews[VIEW_HOME]
+	if int(session.View) < MAX_VIEWS && sessionViews[session.View] != nil {
+		open = sessionViews[session.View]
+	}
+	showView(open())
+}
+
+// Make a saved project the active one, with its samples and UI state
+func openProject(name string) error {
+	p := newProject(name)
+	integrityProblems, integrityNext = nil, 0
+	if err := loadProject(name, p); err != nil {
+		return err
+	}
+	project = p
+	loadProjectSamples(p)
+	loadScriptHooks(name)
+	loadUserWavetables(name)
+	loadSession(p)
+	restoreSessionView()
+	return nil
+}
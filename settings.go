@@ -0,0 +1,228 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Settings are saved as NAME=value lines, value being the index of the
+// chosen option, so options can be added without breaking old files.
+// Macros follow as MACROn lines, see saveMacros.
+const SETTINGS_FILE = "/settings.txt"
+
+// User settings, shared by all projects
+type Settings struct {
+	Macros [NUM_MACROS]Macro
+
+	// Oldest deleted files are purged once the trash grows past this, 0
+	// for a TRASH_SHARE of the storage, see trashLimit
+	TrashLimitKB uint32
+
+	Theme      uint8
+	TextSize   uint8
+	SampleRate uint32
+
+	// Flash XRUN in the status bar when the audio output runs dry
+	UnderrunFlash bool
+
+	// Swap the arrows and function keys, see mirroredButtons
+	LeftHanded bool
+
+	// The first boot tutorial has been completed or skipped
+	TutorialDone bool
+
+	// Start the demo after this long without input, see demoIdleDelays
+	DemoIdle uint8
+
+	// Recorder source and ADC line in boost, see linein.go
+	RecordInput uint8
+	LineInGain  uint8
+
+	// Stream screen updates over the debug UART, see screenstream.go
+	ScreenMirror bool
+	// Describe the cursor over the debug UART, see speech.go
+	Speak bool
+
+	// Bounce through the lookahead limiter, see limiter.go
+	ExportLimiter bool
+
+	// External clock, see clocksync.go. PPQN and rate are option indexes.
+	ClockSource uint8
+	ClockPPQN   uint8
+	ClockRate   uint8
+
+	// Playing from MIDI in, see midi.go. MidiSplit is a note, EMPTY for
+	// no split; the arrays are by part, lower first.
+	MidiIn         bool
+	MidiSplit      uint8
+	MidiInstrument [2]uint8
+	MidiTrack      [2]uint8
+
+	// Check the project's files while idle, see integrity.go
+	IdleCheck bool
+
+	// Semitones of a full pitch bend, see pitchbend.go
+	BendRange uint8
+
+	// Reference pitch in Hz and transpose in semitones, see initNoteTable
+	TuningA4  uint16
+	Transpose int8
+
+	// First of the MIDI controllers turning the macro knobs, EMPTY for
+	// none, see knob.go
+	KnobCC uint8
+
+	// Trade quality for time under load, see quality.go
+	AutoQuality bool
+
+	// Play what the cursor moves onto in browsers, see audition.go
+	Audition bool
+	// Length of the note previewing instrument edits, see audition.go
+	Preview uint8
+	// Headphone crossfeed on the master output, see crossfeed.go
+	Crossfeed bool
+	// NAV+PLAY toggles fills rather than holding them, see fill.go
+	FillLatch bool
+}
+
+var settings = defaultSettings()
+
+func defaultSettings() Settings {
+	return Settings{
+		SampleRate: SAMPLE_RATE,
+		ClockPPQN:  1, // 2, as Pocket Operators send
+		ClockRate:  CLOCK_RATE_X1,
+
+		MidiSplit:      EMPTY,
+		MidiInstrument: [2]uint8{0, 1},
+		MidiTrack:      [2]uint8{NUM_TRACKS - 2, NUM_TRACKS - 1},
+
+		IdleCheck: true,
+		BendRange: 2,
+		TuningA4:  440,
+		KnobCC:    EMPTY,
+
+		AutoQuality: true,
+		Audition:    true,
+		Preview:     2, // 300ms
+	}
+}
+
+// Option index of an OFF/ON setting
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// An option on the settings screen
+type settingItem struct {
+	name   string
+	values []string
+	get    func() int
+	set    func(int)
+}
+
+var settingItems []settingItem
+
+func init() {
+	addTool("SETTINGS", openSettingsView)
+}
+
+// Add an option to the settings screen. get returns the index of the
+// current value in values and set applies a new one.
+func addSetting(name string, values []string, get func() int, set func(int)) {
+	settingItems = append(settingItems, settingItem{name, values, get, set})
+}
+
+// Read the saved settings and apply them, ignoring unknown names
+func loadSettings() {
+	data, err := readFile(SETTINGS_FILE)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || loadMacro(name, value) {
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		for _, it := range settingItems {
+			if it.name == name && v >= 0 && v < len(it.values) {
+				it.set(v)
+			}
+		}
+	}
+}
+
+// Apply every setting again from the settings struct
+func applySettings() {
+	for _, it := range settingItems {
+		it.set(it.get())
+	}
+}
+
+func saveSettings() {
+	var b strings.Builder
+	for _, it := range settingItems {
+		b.WriteString(it.name + "=" + itoa(it.get()) + "\n")
+	}
+	saveMacros(&b)
+	if err := writeFile(SETTINGS_FILE, []byte(b.String())); err != nil {
+		println("Failed to save settings:", err.Error())
+	}
+}
+
+// One line per option; ENTER steps to the next value and saves
+func openSettingsView() {
+	openParamList("SETTINGS", settingItems, saveSettings)
+}
+
+// List of options where ENTER steps the selected one to its next value,
+// then calls changed if it is set. Also used for project and instrument
+// parameters.
+func openParamList(title string, items []settingItem, changed func()) {
+	list := &ListView{Title: title}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for _, it := range items {
+			list.Items = append(list.Items, it.name+": "+it.values[it.get()])
+		}
+	}
+	refresh()
+	list.OnSelect = func(index int) {
+		it := items[index]
+		it.set((it.get() + 1) % len(it.values))
+		if changed != nil {
+			changed()
+		}
+		refresh()
+	}
+	pushView(list)
+}
+
+// Option stepping the byte at field through values, shown by show. A value
+// not in the list shows as the first one.
+func byteChoice(name string, field func() *uint8, values []uint8, show func(v uint8) string) settingItem {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = show(v)
+	}
+	return settingItem{name, names,
+		func() int {
+			for i, v := range values {
+				if v == *field() {
+					return i
+				}
+			}
+			return 0
+		},
+		func(i int) { *field() = values[i] }}
+}
@@ -0,0 +1,76 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"machine"
+	"strings"
+)
+
+// Line commands typed over the debug UART, one a line, words split by
+// spaces. help lists them.
+const SHELL_LINE_MAX = 80
+
+// A shell command and its line for help
+type shellCommand struct {
+	name, help string
+	run        func(args []string)
+}
+
+var (
+	shellCommands []shellCommand
+	shellLine     []byte
+)
+
+func init() {
+	addCommand("help", "help: list commands", func([]string) {
+		for _, c := range shellCommands {
+			shellPrint(c.help + "\n")
+		}
+	})
+}
+
+// Register a shell command
+func addCommand(name, help string, run func(args []string)) {
+	shellCommands = append(shellCommands, shellCommand{name, help, run})
+}
+
+// Send text to the debug UART
+func shellPrint(s string) {
+	machine.Serial.Write([]byte(s))
+}
+
+// Read what has arrived and run each whole line. Called from the main
+// loop.
+func pollShell() {
+	for machine.Serial.Buffered() > 0 {
+		b, err := machine.Serial.ReadByte()
+		if err != nil {
+			return
+		}
+		switch {
+		case b == '\r' || b == '\n':
+			line := string(shellLine)
+			shellLine = shellLine[:0]
+			runCommand(line)
+		case len(shellLine) < SHELL_LINE_MAX:
+			shellLine = append(shellLine, b)
+		}
+	}
+}
+
+// Run a command line, ignoring empty ones
+func runCommand(line string) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return
+	}
+	for _, c := range shellCommands {
+		if c.name == words[0] {
+			c.run(words[1:])
+			return
+		}
+	}
+	shellPrint("unknown command " + words[0] + ", try help\n")
+}
@@ -0,0 +1,50 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// The project's sidechain settings drive the mixer's Ducker, edited with
+// the SIDECHAIN tool
+func init() {
+	addTool("SIDECHAIN", openSidechainView)
+}
+
+// Ducking off, with settings suited to a kick once a key is picked
+func defaultSidechain() Sidechain {
+	return Sidechain{Key: EMPTY, Threshold: 18, Ratio: 4, Attack: 5, Release: 20}
+}
+
+// Follow the active project's sidechain settings
+func updateDucker() {
+	sc := &project.Sidechain
+	if sc.Key == EMPTY {
+		mixer.Ducker = nil
+		return
+	}
+	d := mixer.Ducker
+	if d == nil {
+		d = newCompressor()
+	}
+	d.Threshold, d.Ratio, d.Attack, d.Release = sc.Threshold, sc.Ratio, sc.Attack, sc.Release
+	d.Key = sc.Key
+	mixer.Ducker = d
+}
+
+func openSidechainView() {
+	openParamList("SIDECHAIN", []settingItem{
+		byteChoice("KEY", func() *uint8 { return &project.Sidechain.Key }, []uint8{EMPTY, 0, 1, 2, 3, 4, 5, 6, 7}, func(v uint8) string {
+			if v == EMPTY {
+				return "OFF"
+			}
+			return "TRACK " + itoa(int(v)+1)
+		}),
+		byteChoice("THRESHOLD", func() *uint8 { return &project.Sidechain.Threshold }, []uint8{6, 12, 18, 24, 30, 36},
+			func(v uint8) string { return "-" + itoa(int(v)) + "DB" }),
+		byteChoice("RATIO", func() *uint8 { return &project.Sidechain.Ratio }, []uint8{2, 4, 8, 20},
+			func(v uint8) string { return itoa(int(v)) + ":1" }),
+		byteChoice("ATTACK", func() *uint8 { return &project.Sidechain.Attack }, []uint8{1, 5, 10, 30},
+			func(v uint8) string { return itoa(int(v)) + "MS" }),
+		byteChoice("RELEASE", func() *uint8 { return &project.Sidechain.Release }, []uint8{5, 10, 20, 40, 80},
+			func(v uint8) string { return itoa(int(v)*10) + "MS" }),
+	}, nil)
+}
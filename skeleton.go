@@ -0,0 +1,153 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "errors"
+
+// Song skeleton: a starter arrangement built from the chains of the first
+// song row, added after the last used row. Tracks are taken in order, so
+// the first playing track is treated as the beat and the last as the lead.
+//
+//	INTRO   the beat alone
+//	VERSE   everything but the lead, the last row with fills
+//	CHORUS  everything, the last row with fills
+//	OUTRO   everything but the beat
+//
+// A fill chain plays its source chain with the last phrase ending in a
+// roll of the track's last note.
+const (
+	SKELETON_INTRO_ROWS  = 2
+	SKELETON_VERSE_ROWS  = 4
+	SKELETON_CHORUS_ROWS = 4
+	SKELETON_OUTRO_ROWS  = 2
+	SKELETON_FILL_STEPS  = 4 // Steps at the end of a phrase the roll covers
+)
+
+var errSongEmpty = errors.New("song: empty")
+
+func init() {
+	addTool("SONG SKELETON", func() {
+		row, err := buildSkeleton(project)
+		if err != nil {
+			println("Failed to build song skeleton:", err.Error())
+			showStatus("NO SKELETON: "+err.Error(), colorRed)
+			return
+		}
+		showStatus("SKELETON FROM ROW "+itoa(row), colorGreen)
+	})
+}
+
+// Copy of a phrase ending in a roll of the last note before the fill
+func fillPhrase(ph Phrase) Phrase {
+	note, instrument := uint8(EMPTY), uint8(EMPTY)
+	for i, s := range ph.Steps {
+		if i >= PHRASE_STEPS-SKELETON_FILL_STEPS {
+			if s.Note == EMPTY && note != EMPTY {
+				ph.Steps[i].Note, ph.Steps[i].Instrument = note, instrument
+			}
+			continue
+		}
+		if s.Note < NUM_NOTES {
+			note, instrument = s.Note, s.Instrument
+		}
+	}
+	return ph
+}
+
+// Chain like c whose last phrase is replaced by its fill, or EMPTY when
+// the project has no room or the chain has nothing to fill
+func (p *Project) fillChain(c uint8) uint8 {
+	chain := p.Chains[c]
+	last := -1
+	for i, e := range chain.Entries {
+		if e.Phrase != EMPTY {
+			last = i
+		}
+	}
+	if last < 0 {
+		return EMPTY
+	}
+	fill := fillPhrase(p.Phrases[chain.Entries[last].Phrase])
+	if fill == p.Phrases[chain.Entries[last].Phrase] {
+		return EMPTY
+	}
+	ph := p.freePhrase()
+	if ph == EMPTY {
+		return EMPTY
+	}
+	p.Phrases[ph] = fill
+	nc := p.freeChain()
+	if nc == EMPTY {
+		p.Phrases[ph] = emptyPhrase()
+		return EMPTY
+	}
+	chain.Entries[last].Phrase = ph
+	p.Chains[nc] = chain
+	return nc
+}
+
+// Build the skeleton, saving the project for UNDO first. Returns the
+// first row written.
+func buildSkeleton(p *Project) (int, error) {
+	source := -1
+	for r := range p.Song {
+		if p.rowEntries(r) > 0 {
+			source = r
+			break
+		}
+	}
+	if source < 0 {
+		return 0, errSongEmpty
+	}
+	var active []int
+	for t, c := range p.Song[source] {
+		if c != EMPTY && int(c) < NUM_CHAINS {
+			active = append(active, t)
+		}
+	}
+	start := 0
+	for r := range p.Song {
+		if p.rowEntries(r) > 0 {
+			start = r + 1
+		}
+	}
+	rows := SKELETON_INTRO_ROWS + SKELETON_VERSE_ROWS + SKELETON_CHORUS_ROWS + SKELETON_OUTRO_ROWS
+	if start+rows > SONG_ROWS {
+		return 0, errProjectFull
+	}
+	if err := saveUndo(p, "SKELETON"); err != nil {
+		return 0, err
+	}
+
+	beat, lead := active[0], active[len(active)-1]
+	var fills [NUM_TRACKS]uint8
+	for t, c := range p.Song[source] {
+		fills[t] = EMPTY
+		if c != EMPTY && int(c) < NUM_CHAINS {
+			fills[t] = p.fillChain(c)
+		}
+	}
+	row := start
+	section := func(n int, fill bool, plays func(t int) bool) {
+		for i := 0; i < n; i++ {
+			for t, c := range p.Song[source] {
+				switch {
+				case !plays(t):
+					c = EMPTY
+				case fill && i == n-1 && fills[t] != EMPTY:
+					c = fills[t]
+				}
+				p.Song[row][t] = c
+			}
+			row++
+		}
+	}
+	// With a single track, every section plays it
+	single := len(active) == 1
+	section(SKELETON_INTRO_ROWS, false, func(t int) bool { return t == beat })
+	section(SKELETON_VERSE_ROWS, true, func(t int) bool { return t != lead || single })
+	section(SKELETON_CHORUS_ROWS, true, func(t int) bool { return true })
+	section(SKELETON_OUTRO_ROWS, false, func(t int) bool { return t != beat || single })
+	return start, nil
+}
@@ -0,0 +1,114 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Slicing a sample instrument's sample, such as a breakbeat, so each note
+// plays one part of it. Auto slicing starts a slice at every transient:
+// a window much louder than the ones before it.
+const (
+	SLICE_BASE_NOTE = NOTE_C4 // Note that plays the first slice
+
+	SLICE_WINDOW     = 256 // Frames per energy window
+	SLICE_ONSET_RISE = 2   // Times the recent energy a window must reach
+	SLICE_FLOOR      = 300 // Mean level below which nothing is a transient
+	SLICE_MIN_GAP_MS = 60  // Shortest slice auto slicing makes
+	SLICE_HISTORY    = 8   // Windows the recent energy is averaged over
+)
+
+// Offsets of n even slices in 1/65536 of the sample's length
+func evenSlices(n int) []uint16 {
+	offsets := make([]uint16, n)
+	for i := range offsets {
+		offsets[i] = uint16(i * 65536 / n)
+	}
+	return offsets
+}
+
+// Offsets in 1/65536 of the sample's length of up to MAX_SLICES
+// transients, the strongest ones when there are more. The first slice
+// always starts at the beginning.
+func transientSlices(s *Sample) []uint16 {
+	n := len(s.Data)
+	if n < 2*SLICE_WINDOW {
+		return []uint16{0}
+	}
+	gap := int(s.Rate) * SLICE_MIN_GAP_MS / 1000 / SLICE_WINDOW
+	type onset struct {
+		window, rise int
+	}
+	var onsets []onset
+	var history [SLICE_HISTORY]int
+	last := 0
+	for w := 0; w < n/SLICE_WINDOW; w++ {
+		sum := 0
+		for _, v := range s.Data[w*SLICE_WINDOW : (w+1)*SLICE_WINDOW] {
+			sum += max(int(v), -int(v))
+		}
+		level := sum / SLICE_WINDOW
+		recent := 0
+		for _, h := range history {
+			recent += h
+		}
+		recent /= SLICE_HISTORY
+		if w > 0 && w-last >= gap && level > SLICE_FLOOR && level > SLICE_ONSET_RISE*recent {
+			onsets = append(onsets, onset{w, level - recent})
+			last = w
+		}
+		history[w%SLICE_HISTORY] = level
+	}
+	// Keep the strongest, leaving room for the slice at the start
+	for len(onsets) > MAX_SLICES-1 {
+		weakest := 0
+		for i, o := range onsets {
+			if o.rise < onsets[weakest].rise {
+				weakest = i
+			}
+		}
+		onsets = append(onsets[:weakest], onsets[weakest+1:]...)
+	}
+	offsets := []uint16{0}
+	for _, o := range onsets {
+		offsets = append(offsets, uint16(uint64(o.window*SLICE_WINDOW)<<16/uint64(n)))
+	}
+	return offsets
+}
+
+func init() {
+	addTool("SLICE SAMPLE", openSliceView)
+}
+
+// Slice the selected instrument's sample at its transients or evenly, or
+// go back to playing it whole
+func openSliceView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS {
+		showStatus("NO INSTRUMENT", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	list := &ListView{Title: "SLICE " + itoa(int(slot)),
+		Items: []string{"AUTO", "EVEN 4", "EVEN 8", "EVEN 16", "CLEAR"}}
+	list.OnSelect = func(i int) {
+		var offsets []uint16
+		switch i {
+		case 0:
+			if in.Sample >= MAX_SAMPLES || samples[in.Sample] == nil {
+				showStatus("NO SAMPLE", colorRed)
+				return
+			}
+			offsets = transientSlices(samples[in.Sample])
+		case 1, 2, 3:
+			offsets = evenSlices(4 << (i - 1))
+		}
+		in.Slices = [MAX_SLICES]uint16{}
+		in.NumSlices = uint8(copy(in.Slices[:], offsets))
+		popView()
+		if in.NumSlices == 0 {
+			showStatus("SLICES CLEARED", colorGreen)
+			return
+		}
+		showStatus(itoa(int(in.NumSlices))+" SLICES FROM "+noteName(SLICE_BASE_NOTE), colorGreen)
+	}
+	pushView(list)
+}
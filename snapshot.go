@@ -0,0 +1,86 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "errors"
+
+// Snapshots: four slots holding the whole project in RAM, stored and
+// recalled in an instant, as a safety net for risky edits while
+// performing. ALT+EDIT+ENTER arms a store and ALT+EDIT+arrow then stores
+// into that slot; ALT+EDIT+arrow alone recalls it. A recall while playing
+// carries on from the same place in the song. Slots are lost on power off
+// and only recall into the project they were taken from; saving to the
+// card is still what keeps a project.
+const NUM_SNAPSHOTS = 4
+
+var errSnapshotEmpty = errors.New("snapshot: empty slot")
+
+// A stored project, encoded as in its file to keep it small
+type snapshot struct {
+	project string // Name of the project it was taken from
+	data    []byte
+}
+
+var (
+	snapshots     [NUM_SNAPSHOTS]snapshot
+	snapshotArmed bool
+)
+
+// Make the next snapshot slot pressed store rather than recall, or cancel
+func armSnapshotStore() {
+	snapshotArmed = !snapshotArmed
+	if snapshotArmed {
+		showStatus("STORE SNAPSHOT", colorRed)
+	} else {
+		showStatus("SNAPSHOT CANCELLED", colorRed)
+	}
+}
+
+// Store the project into a slot when armed, else recall the slot
+func snapshotSlotPressed(slot int) {
+	if snapshotArmed {
+		snapshotArmed = false
+		snapshots[slot] = snapshot{project.Name, encodeProject(project)}
+		showStatus("SNAPSHOT "+itoa(slot+1)+" STORED", colorGreen)
+		return
+	}
+	if err := recallSnapshot(slot); err != nil {
+		showStatus("SNAPSHOT "+itoa(slot+1)+" EMPTY", colorRed)
+		return
+	}
+	showStatus("SNAPSHOT "+itoa(slot+1), colorGreen)
+}
+
+// Hand the mixer the project's settings that it holds copies of, for when
+// the project is swapped whole. Called with audioMu held.
+func applyProjectMixer(p *Project) {
+	mixer.Width = p.Width
+	for t, trim := range p.Trims {
+		mixer.Tracks[t].Trim = trim
+	}
+}
+
+// Put the project back as a slot holds it, reloading samples only when
+// they differ
+func recallSnapshot(slot int) error {
+	s := &snapshots[slot]
+	if s.data == nil || s.project != project.Name {
+		return errSnapshotEmpty
+	}
+	old := newProject(project.Name)
+	if err := decodeProject(s.data, old); err != nil {
+		println("Failed to recall snapshot:", err.Error())
+		return err
+	}
+	reload := old.Samples != project.Samples || old.SampleEdits != project.SampleEdits
+	audioMu.Lock()
+	*project = *old
+	applyProjectMixer(project)
+	audioMu.Unlock()
+	if reload {
+		loadProjectSamples(project)
+	}
+	redrawView()
+	return nil
+}
@@ -0,0 +1,171 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// Reliability test for pre-release builds: presses random keys, switches
+// between the projects on the card and logs memory and audio timing to
+// the card until a real key is pressed. Deleting files and the tools that
+// write to the card are refused while it runs, and the project and
+// settings are put back afterwards.
+const (
+	SOAK_LOG_FILE      = "/soak.log"
+	SOAK_KEY_INTERVAL  = 150 * time.Millisecond
+	SOAK_LOG_INTERVAL  = time.Minute
+	SOAK_PROJECT_TIME  = 10 * time.Minute
+	SOAK_SETTLE_PERIOD = 2 * time.Second // Real keys are ignored this long after starting
+)
+
+var (
+	soakRunning  bool
+	soakStarted  time.Time
+	soakNextKey  time.Time
+	soakNextLog  time.Time
+	soakNextProj time.Time
+	soakSeed     uint32
+	soakKeys     uint32
+	soakSettings Settings
+	soakProject  *Project
+
+	// Modifier chords to press keys with, plain presses most often
+	soakMods = []ButtonMask{MOD_NONE, MOD_NONE, MOD_NONE, MOD_NONE, MOD_ALT, MOD_EDIT, MOD_NAV}
+
+	// Tools the random keys must not reach: they write or move files on
+	// the card, or would start the test again over its saved state
+	soakBlockedTools = []string{"SOAK TEST", "FOLDERS", "COMMIT SAMPLE", "RENDER TO WAV", "RECORD SAMPLE",
+		"RECORD TO CARD", "EXPORT MIDI", "EXPORT PATTERNS", "SCREENSHOT", "CLEAN UP PROJECT", "TRASH",
+		"BENCHMARK", "CHECK CARD", "PROJECTS"}
+)
+
+func init() {
+	addTool("SOAK TEST", startSoak)
+}
+
+// Pseudo-random number in 0..n-1
+func soakRand(n int) int {
+	soakSeed = soakSeed*1664525 + 1013904223
+	return int((soakSeed >> 8) % uint32(n))
+}
+
+func startSoak() {
+	if soakRunning {
+		return
+	}
+	soakRunning = true
+	soakSettings = settings
+	soakProject = project
+	soakSeed = uint32(time.Now().UnixNano())
+	soakKeys = 0
+	soakStarted = time.Now()
+	soakNextKey, soakNextLog, soakNextProj = soakStarted, soakStarted, soakStarted
+	appendFile(SOAK_LOG_FILE, []byte("# soak start: seconds heap_kb allocs blocks late underruns max_render_us dropped_frames keys project\n"))
+	println("Soak test started")
+}
+
+func stopSoak() {
+	soakRunning = false
+	logSoak()
+	if demoActive {
+		stopDemo()
+	}
+	settings = soakSettings
+	applySettings()
+	saveSettings()
+	project = soakProject
+	loadProjectSamples(project)
+	showView(homeView{})
+	println("Soak test stopped")
+	showStatus("SOAK TEST STOPPED", colorGreen)
+}
+
+// Whether a tool is refused while the test runs
+func soakBlocksTool(name string) bool {
+	if !soakRunning {
+		return false
+	}
+	for _, n := range soakBlockedTools {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// A real key press ends the test once it has settled
+func soakConsumeKey(ev KeyEvent) bool {
+	if !soakRunning {
+		return false
+	}
+	if ev.Pressed && time.Since(soakStarted) > SOAK_SETTLE_PERIOD {
+		stopSoak()
+	}
+	return true
+}
+
+// Called every frame: inject keys, rotate projects and write the log
+func updateSoak() {
+	if !soakRunning {
+		return
+	}
+	now := time.Now()
+	if now.After(soakNextKey) {
+		soakNextKey = now.Add(SOAK_KEY_INTERVAL)
+		b := Button(soakRand(int(NUM_BUTTONS)))
+		mods := soakMods[soakRand(len(soakMods))] &^ (1 << b)
+		handleKeyEvent(KeyEvent{Button: b, Pressed: true, Mods: mods})
+		handleKeyEvent(KeyEvent{Button: b, Pressed: false, Mods: mods})
+		soakKeys++
+	}
+	if now.After(soakNextProj) {
+		soakNextProj = now.Add(SOAK_PROJECT_TIME)
+		soakOpenRandomProject()
+	}
+	if now.After(soakNextLog) {
+		soakNextLog = now.Add(SOAK_LOG_INTERVAL)
+		logSoak()
+	}
+}
+
+// Switch to a random project from the card, or the demo song if there are
+// none, and make sure it plays
+func soakOpenRandomProject() {
+	var names []string
+	entries, _ := storage.ReadDir(projectsDir)
+	for _, e := range entries {
+		if e.Dir {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		project = newDemoProject()
+	} else if err := openProject(names[soakRand(len(names))]); err != nil {
+		println("Soak: failed to open project:", err.Error())
+	}
+	if !isAudioPlaying {
+		toggleAudio()
+	}
+}
+
+// Append one line of metrics to the log
+func logSoak() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	line := itoa(int(time.Since(soakStarted)/time.Second)) + " " +
+		itoa(int(m.HeapInuse/1024)) + " " +
+		itoa(int(m.Mallocs-m.Frees)) + " " +
+		itoa(int(audioStats.Blocks)) + " " +
+		itoa(int(audioStats.Late)) + " " +
+		itoa(int(audioStats.Underruns)) + " " +
+		itoa(int(audioStats.MaxRender.Microseconds())) + " " +
+		itoa(int(frameStats.Dropped)) + " " +
+		itoa(int(soakKeys)) + " " + project.Name + "\n"
+	if err := appendFile(SOAK_LOG_FILE, []byte(line)); err != nil {
+		println("Failed to write soak log:", err.Error())
+	}
+	print("Soak: ", line)
+}
@@ -0,0 +1,228 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Song screen: the arrangement, a row per song row and a column per track
+// holding the chain it plays. The arrows move the cursor, EDIT+arrows
+// change the chain under it as in the phrase editor, and EDIT+ENTER clears
+// it. ENTER opens the row's menu: play from the row, or insert, delete or
+// clone it, rows below moving to make room. ALT+ENTER mutes the track.
+// The row the song is playing is highlighted. Tracks that don't fit across
+// the screen scroll into view with the cursor. NAV+RIGHT opens the chain under it, see chainedit.go,
+// and NAV+UP/DOWN move it a screen of rows at a time. The whole song shows
+// in a minimap below the rows, see songmap.go.
+const SONG_CELL = 3 // Characters of a chain and its gap
+
+func init() {
+	registerView(VIEW_SONG, func() View { return &songView{playhead: -1} })
+	addTool("SONG", func() { pushView(&songView{playhead: -1}) })
+}
+
+type songView struct {
+	playhead int // Row being played, -1 for none
+
+	// Rows the song loops over, for the minimap, found again on each
+	// redraw but those for the playhead moving
+	loopFirst, loopLast int
+	ticked              bool
+}
+
+// Last chain entered, for filling in empty cells
+var songLastChain uint8
+
+func (v *songView) ID() ViewID { return VIEW_SONG }
+
+func (v *songView) state() *ViewState { return &session.Views[VIEW_SONG] }
+
+func (v *songView) playingRow() int {
+	if !sequencer.Playing || sequencer.Song != project {
+		return -1
+	}
+	return sequencer.Row
+}
+
+func (v *songView) Tick() {
+	if r := v.playingRow(); r != v.playhead {
+		v.playhead = r
+		v.ticked = true
+		redrawView()
+	}
+}
+
+// Song rows and tracks that fit between the title and the minimap, and
+// after the row number
+func songRows() int { return viewRows() - 2 }
+
+func songTracks() int { return min((viewCols()-SONG_CELL)/SONG_CELL, NUM_TRACKS) }
+
+// First track shown, keeping the cursor's on screen
+func (v *songView) firstTrack() int {
+	return max(int(v.state().Col)-songTracks()+1, 0)
+}
+
+func (v *songView) Draw() {
+	st := v.state()
+	first, left := int(st.Scroll), v.firstTrack()
+	tracks := songTracks()
+	drawText(0, 0, "SONG", colorGreen)
+	v.playhead = v.playingRow()
+	for r := first; r < SONG_ROWS && r < first+songRows(); r++ {
+		row := r - first + 1
+		if r == v.playhead {
+			drawHighlight(0, row, SONG_CELL*(tracks+1), colorGrid)
+		}
+		if r == int(st.Row) {
+			drawHighlight(SONG_CELL*(int(st.Col)-left+1), row, 2, colorBlue)
+		}
+		text := hexByte(uint8(r))
+		for t := left; t < left+tracks; t++ {
+			if c := project.Song[r][t]; c == EMPTY {
+				text += " --"
+			} else {
+				text += " " + hexByte(c)
+			}
+		}
+		drawText(0, row, text, colorText)
+	}
+	if !v.ticked {
+		v.loopFirst, v.loopLast = project.songLoop()
+	}
+	v.ticked = false
+	drawSongMap((viewRows()-1)*layout.LineHeight+SONG_MAP_GAP, int(st.Row), v.playhead, v.loopFirst, v.loopLast)
+}
+
+func (v *songView) Describe() string {
+	st := v.state()
+	return "ROW " + hexByte(st.Row) + " TRACK " + itoa(int(st.Col)+1) +
+		" CHAIN " + spokenByte(project.Song[st.Row%SONG_ROWS][st.Col%NUM_TRACKS])
+}
+
+func (v *songView) HandleAction(a Action) {
+	st := v.state()
+	cell := &project.Song[st.Row%SONG_ROWS][st.Col%NUM_TRACKS]
+	switch a {
+	case ACTION_CURSOR_UP:
+		if st.Row > 0 {
+			st.Row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if st.Row < SONG_ROWS-1 {
+			st.Row++
+		}
+	case ACTION_CURSOR_LEFT:
+		if st.Col == 0 {
+			popView()
+			return
+		}
+		st.Col--
+	case ACTION_CURSOR_RIGHT:
+		if st.Col < NUM_TRACKS-1 {
+			st.Col++
+		}
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		if *cell >= NUM_CHAINS {
+			*cell = songLastChain
+		} else {
+			delta, big := editDelta(a)
+			*cell = stepByte(*cell, delta, big, 16, NUM_CHAINS-1)
+		}
+		songLastChain = *cell
+	case ACTION_CLEAR:
+		*cell = EMPTY
+	case ACTION_MUTE:
+		toggleMute(int(st.Col % NUM_TRACKS))
+	case ACTION_ENTER:
+		v.openRowMenu(int(st.Row))
+		return
+	case ACTION_NAV_RIGHT:
+		if *cell >= NUM_CHAINS {
+			showStatus("NO CHAIN", colorRed)
+			return
+		}
+		session.Chain = *cell
+		replaceView(&chainView{playhead: -1})
+		return
+	case ACTION_NAV_UP:
+		st.Row = uint8(max(int(st.Row)-songRows(), 0))
+	case ACTION_NAV_DOWN:
+		st.Row = uint8(min(int(st.Row)+songRows(), SONG_ROWS-1))
+	default:
+		return
+	}
+	rows := songRows()
+	if int(st.Row) < int(st.Scroll) {
+		st.Scroll = st.Row
+	} else if int(st.Row) >= int(st.Scroll)+rows {
+		st.Scroll = st.Row - uint8(rows) + 1
+	}
+	redrawView()
+}
+
+// Play from a row, or insert, delete or clone it
+func (v *songView) openRowMenu(row int) {
+	menu := &ListView{Title: "ROW " + hexByte(uint8(row)),
+		Items: []string{"PLAY FROM HERE", "INSERT ROW", "DELETE ROW", "CLONE ROW"}}
+	menu.OnSelect = func(i int) {
+		popView()
+		if i == 0 {
+			startAudio(row)
+			return
+		}
+		audioMu.Lock()
+		ok := true
+		switch i {
+		case 1:
+			ok = project.insertSongRow(row)
+		case 2:
+			project.deleteSongRow(row)
+		case 3:
+			ok = project.cloneSongRow(row)
+		}
+		audioMu.Unlock()
+		if !ok {
+			showStatus("SONG FULL", colorRed)
+		}
+	}
+	pushView(menu)
+}
+
+// Move the rows from row down by one, leaving it empty. Fails when the
+// last row is in use.
+func (p *Project) insertSongRow(row int) bool {
+	if p.rowUsed(SONG_ROWS - 1) {
+		return false
+	}
+	copy(p.Song[row+1:], p.Song[row:SONG_ROWS-1])
+	for t := range p.Song[row] {
+		p.Song[row][t] = EMPTY
+	}
+	return true
+}
+
+// Remove a row, moving those below up by one
+func (p *Project) deleteSongRow(row int) {
+	copy(p.Song[row:], p.Song[row+1:])
+	for t := range p.Song[SONG_ROWS-1] {
+		p.Song[SONG_ROWS-1][t] = EMPTY
+	}
+}
+
+// Insert a copy of a row below it
+func (p *Project) cloneSongRow(row int) bool {
+	if row == SONG_ROWS-1 || !p.insertSongRow(row+1) {
+		return false
+	}
+	p.Song[row+1] = p.Song[row]
+	return true
+}
+
+// Whether a song row has any chain in it
+func (p *Project) rowUsed(row int) bool {
+	for _, c := range p.Song[row] {
+		if c != EMPTY {
+			return true
+		}
+	}
+	return false
+}
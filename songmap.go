@@ -0,0 +1,56 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Minimap of the song along the bottom of the song screen: a pixel column
+// per song row and a pixel per track in it, lit where the track plays a
+// chain. The row the song is playing is marked across the map, the cursor
+// above it, and the rows the song loops over once it has played through
+// them below it.
+const (
+	SONG_MAP_TRACK = 1 // Pixels high of a track
+	SONG_MAP_MARK  = 2 // Pixels high of the cursor and loop marks
+	SONG_MAP_GAP   = 1 // Pixels between the map and the marks
+)
+
+// Rows the song keeps playing once it has looped: from the row it goes
+// back to through the last row played before it does, -1s for an empty
+// song. Loops made by jumps may leave rows in between unplayed.
+func (p *Project) songLoop() (first, last int) {
+	end := [3]int{-1, 0, 0}
+	p.walkSong(func(row, entry, step int) {
+		end = [3]int{row, entry, step}
+	})
+	if end[0] < 0 {
+		return -1, -1
+	}
+	first, _, _ = p.nextStep(end[0], end[1], end[2])
+	return first, end[0]
+}
+
+// Draw the map with its top at y. Negative rows go unmarked.
+func drawSongMap(y, cursor, playhead, loopFirst, loopLast int) {
+	mapY := y + SONG_MAP_MARK + SONG_MAP_GAP
+	height := NUM_TRACKS * SONG_MAP_TRACK
+	for r := 0; r < SONG_ROWS; r++ {
+		x := int16(TEXT_LEFT + r)
+		if r == playhead {
+			display.FillRectangle(x, int16(mapY), 1, int16(height), colorRed)
+		} else {
+			for t, c := range project.Song[r] {
+				if c != EMPTY {
+					display.FillRectangle(x, int16(mapY+t*SONG_MAP_TRACK), 1, SONG_MAP_TRACK, colorGreen)
+				}
+			}
+		}
+		if r == cursor {
+			display.FillRectangle(x, int16(y), 1, SONG_MAP_MARK, colorText)
+		}
+	}
+	if loopFirst >= 0 {
+		lo, hi := min(loopFirst, loopLast), max(loopFirst, loopLast)
+		display.FillRectangle(int16(TEXT_LEFT+lo), int16(mapY+height+SONG_MAP_GAP),
+			int16(hi-lo+1), SONG_MAP_MARK, colorBlue)
+	}
+}
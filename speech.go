@@ -0,0 +1,70 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Screen reader output: with SPEAK on, a line saying what is under the
+// cursor goes out on the debug UART whenever the cursor moves or the value
+// under it changes, and each status message follows, for a host-side
+// bridge to a screen reader. See docs/screen-reader.md.
+const SPEECH_MARK = "\x1e" // Starts every line; debug text never contains it
+
+// A view that can say what is under its cursor
+type SpokenView interface {
+	View
+	Describe() string
+}
+
+// The last description sent, so only changes are spoken
+var lastSpoken string
+
+func init() {
+	addSetting("SPEAK", []string{"OFF", "ON"},
+		func() int { return int(boolByte(settings.Speak)) },
+		func(i int) {
+			settings.Speak = i == 1
+			lastSpoken = ""
+		})
+}
+
+// Send a line to the screen reader
+func speak(s string) {
+	if settings.Speak && s != "" {
+		shellPrint(SPEECH_MARK + s + "\n")
+	}
+}
+
+// Say what is under the cursor of the view on screen, if that changed.
+// Called after each action.
+func speakFocus() {
+	if !settings.Speak {
+		return
+	}
+	if v, ok := currentView().(SpokenView); ok {
+		if d := v.Describe(); d != lastSpoken {
+			lastSpoken = d
+			speak(d)
+		}
+	}
+}
+
+// A note as spoken
+func spokenNote(note uint8) string {
+	switch {
+	case note == EMPTY:
+		return "EMPTY"
+	case note == NOTE_OFF:
+		return "OFF"
+	case note >= NUM_NOTES:
+		return "?"
+	}
+	return noteName(note)
+}
+
+// A hex byte as spoken, EMPTY for none
+func spokenByte(v uint8) string {
+	if v == EMPTY {
+		return "EMPTY"
+	}
+	return hexByte(v)
+}
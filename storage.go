@@ -0,0 +1,404 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	// Main file in each project's folder
+	PROJECT_FILE = "project.ptp"
+
+	// RAM the files of memStorage may take between them
+	MEM_STORAGE_KB = 64
+)
+
+var (
+	errNotFound = errors.New("storage: file not found")
+	errExists   = errors.New("storage: file exists")
+	errReadOnly = errors.New("storage: file is read-only")
+	errFull     = errors.New("storage: no space left")
+)
+
+// An open file
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// Directory entry
+type FileInfo struct {
+	Name string
+	Size int64
+	Dir  bool
+}
+
+// Filesystem holding projects, samples and settings. Paths are absolute
+// and use / separators.
+type Storage interface {
+	// Open an existing file for reading
+	Open(path string) (File, error)
+	// Create or truncate a file for writing
+	Create(path string) (File, error)
+	// Open a file for writing at its end, creating it if needed
+	Append(path string) (File, error)
+	Remove(path string) error
+	Rename(from, to string) error
+	Mkdir(path string) error
+	Stat(path string) (FileInfo, error)
+	// List the entries directly inside a directory, sorted by name
+	ReadDir(path string) ([]FileInfo, error)
+	// Bytes left for file data
+	Free() int64
+	// Bytes for file data in all
+	Capacity() int64
+	// Whether files survive power off
+	Persistent() bool
+}
+
+// Until a card driver for the SDIO pins is available, files live in RAM,
+// up to MEM_STORAGE_KB, and are lost at power off. Projects, samples,
+// undo, trash, settings, folders and the card checks all work on it as
+// on a card, but only until power off; tools whose files can't fit in it
+// at all ask for a card, see needsCard.
+var storage Storage = newMemStorage(MEM_STORAGE_KB * 1024)
+
+// Whether storage is RAM only, saying a card is needed when it is. Tools
+// that write or stream audio files longer than a moment check it first.
+func needsCard() bool {
+	if storage.Persistent() {
+		return false
+	}
+	showStatus("NEEDS SD CARD", colorRed)
+	return true
+}
+
+// Join path elements with /
+func joinPath(elem ...string) string {
+	return strings.Join(elem, "/")
+}
+
+// Path of a project's main file
+func projectPath(name string) string {
+	return joinPath(projectsDir, name, PROJECT_FILE)
+}
+
+// Final element of a path
+func baseName(path string) string {
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
+// Everything before the final element of a path
+func dirName(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Create a directory and any missing parents
+func mkdirAll(path string) error {
+	if path == "/" || path == "" {
+		return nil
+	}
+	if info, err := storage.Stat(path); err == nil && info.Dir {
+		return nil
+	}
+	if err := mkdirAll(dirName(path)); err != nil {
+		return err
+	}
+	return storage.Mkdir(path)
+}
+
+// Remove a file, or a directory and everything in it
+func removeAll(path string) error {
+	info, err := storage.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Dir {
+		entries, err := storage.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := removeAll(joinPath(path, e.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return storage.Remove(path)
+}
+
+// Total size of a file, or of everything in a directory
+func pathSize(path string) int64 {
+	info, err := storage.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.Dir {
+		return info.Size
+	}
+	entries, _ := storage.ReadDir(path)
+	var total int64
+	for _, e := range entries {
+		total += pathSize(joinPath(path, e.Name))
+	}
+	return total
+}
+
+// errFull unless n more bytes fit
+func checkFree(n int64) error {
+	if n > storage.Free() {
+		return errFull
+	}
+	return nil
+}
+
+// Read a whole file into memory
+func readFile(path string) ([]byte, error) {
+	f, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Add data to the end of a file, creating it if needed
+func appendFile(path string, data []byte) error {
+	f, err := storage.Append(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write data to a file, creating its directory if needed
+func writeFile(path string, data []byte) error {
+	if err := mkdirAll(dirName(path)); err != nil {
+		return err
+	}
+	f, err := storage.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RAM-backed Storage holding up to size bytes of file data. Writes past
+// that fail with errFull.
+type memStorage struct {
+	files map[string]*[]byte
+	dirs  map[string]bool
+	size  int64
+	used  int64
+}
+
+func newMemStorage(size int64) *memStorage {
+	return &memStorage{
+		files: make(map[string]*[]byte),
+		dirs:  map[string]bool{"/": true},
+		size:  size,
+	}
+}
+
+// Handle on a memStorage file
+type memFile struct {
+	s        *memStorage
+	data     *[]byte
+	pos      int64
+	writable bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.pos >= int64(len(*f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, (*f.data)[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, errReadOnly
+	}
+	end := f.pos + int64(len(p))
+	if grow := end - int64(len(*f.data)); grow > 0 {
+		if grow > f.s.Free() {
+			return 0, errFull
+		}
+		f.s.used += grow
+		grown := make([]byte, end)
+		copy(grown, *f.data)
+		*f.data = grown
+	}
+	copy((*f.data)[f.pos:], p)
+	f.pos = end
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(len(*f.data))
+	}
+	if offset < 0 {
+		return f.pos, errors.New("storage: negative seek")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error { return nil }
+
+func (s *memStorage) Open(path string) (File, error) {
+	data, ok := s.files[path]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &memFile{s: s, data: data}, nil
+}
+
+func (s *memStorage) Create(path string) (File, error) {
+	if !s.dirs[dirName(path)] {
+		return nil, errNotFound
+	}
+	if old, ok := s.files[path]; ok {
+		s.used -= int64(len(*old))
+	}
+	data := new([]byte)
+	s.files[path] = data
+	return &memFile{s: s, data: data, writable: true}, nil
+}
+
+func (s *memStorage) Append(path string) (File, error) {
+	data, ok := s.files[path]
+	if !ok {
+		return s.Create(path)
+	}
+	return &memFile{s: s, data: data, pos: int64(len(*data)), writable: true}, nil
+}
+
+func (s *memStorage) Remove(path string) error {
+	if data, ok := s.files[path]; ok {
+		s.used -= int64(len(*data))
+		delete(s.files, path)
+		return nil
+	}
+	if !s.dirs[path] {
+		return errNotFound
+	}
+	prefix := path + "/"
+	for p := range s.files {
+		if strings.HasPrefix(p, prefix) {
+			return errExists
+		}
+	}
+	for d := range s.dirs {
+		if strings.HasPrefix(d, prefix) {
+			return errExists
+		}
+	}
+	delete(s.dirs, path)
+	return nil
+}
+
+func (s *memStorage) Rename(from, to string) error {
+	if _, err := s.Stat(to); err == nil {
+		return errExists
+	}
+	if data, ok := s.files[from]; ok {
+		if !s.dirs[dirName(to)] {
+			return errNotFound
+		}
+		delete(s.files, from)
+		s.files[to] = data
+		return nil
+	}
+	if !s.dirs[from] {
+		return errNotFound
+	}
+	// Move the directory and everything below it
+	prefix := from + "/"
+	for p, data := range s.files {
+		if strings.HasPrefix(p, prefix) {
+			delete(s.files, p)
+			s.files[to+p[len(from):]] = data
+		}
+	}
+	for d := range s.dirs {
+		if d == from || strings.HasPrefix(d, prefix) {
+			delete(s.dirs, d)
+			s.dirs[to+d[len(from):]] = true
+		}
+	}
+	return nil
+}
+
+func (s *memStorage) Mkdir(path string) error {
+	if _, err := s.Stat(path); err == nil {
+		return errExists
+	}
+	if !s.dirs[dirName(path)] {
+		return errNotFound
+	}
+	s.dirs[path] = true
+	return nil
+}
+
+func (s *memStorage) Stat(path string) (FileInfo, error) {
+	if data, ok := s.files[path]; ok {
+		return FileInfo{Name: baseName(path), Size: int64(len(*data))}, nil
+	}
+	if s.dirs[path] {
+		return FileInfo{Name: baseName(path), Dir: true}, nil
+	}
+	return FileInfo{}, errNotFound
+}
+
+func (s *memStorage) ReadDir(path string) ([]FileInfo, error) {
+	if !s.dirs[path] {
+		return nil, errNotFound
+	}
+	var list []FileInfo
+	for p, data := range s.files {
+		if dirName(p) == path {
+			list = append(list, FileInfo{Name: baseName(p), Size: int64(len(*data))})
+		}
+	}
+	for d := range s.dirs {
+		if d != "/" && dirName(d) == path {
+			list = append(list, FileInfo{Name: baseName(d), Dir: true})
+		}
+	}
+	slices.SortFunc(list, func(a, b FileInfo) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+func (s *memStorage) Free() int64 {
+	return s.size - s.used
+}
+
+func (s *memStorage) Capacity() int64 { return s.size }
+
+func (s *memStorage) Persistent() bool { return false }
@@ -0,0 +1,257 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// Streaming buffers, in mono samples. Each stream's ring is sized when it
+// opens from the measured card read time, see streamRingSize; before the
+// card has been measured every ring is STREAM_RING_SIZE.
+const (
+	STREAM_RING_SIZE = 8192  // must be a power of two
+	STREAM_RING_MIN  = 4096  // Smallest sized ring, a power of two
+	STREAM_RING_MAX  = 16384 // Largest sized ring, a power of two
+	STREAM_CHUNK     = 1024  // Read from the card per refill
+
+	STREAM_COVER_FRAMES = 2  // UI frames a ring rides out, one of them slow
+	STREAM_MAX_SPEED    = 2  // Playing an octave up drains a ring twice as fast
+	STREAM_CARD_SHARE   = 25 // Percent of the UI loop's time streams may spend reading
+)
+
+// Plays a wav file straight from the card, for samples too long to load
+// into RAM. The main loop reads ahead into a ring buffer with
+// serviceStreams and the audio loop consumes it, so card access never
+// happens on the audio path. Only the reader moves head and only the
+// audio loop moves tail. Level is 0-255. A Fixed stream plays at its own
+// rate whatever the note and tuning.
+type StreamVoice struct {
+	Level uint8
+	Fixed bool
+
+	file File
+	info wavInfo
+	read int64 // Bytes of PCM data read so far
+
+	ring []int16
+	mask uint32 // len(ring)-1
+	head uint32 // Samples written into ring
+	tail uint32 // Samples played from ring
+	frac uint32
+	inc  uint64
+	eof  bool
+
+	playing     bool
+	velocity    uint8
+	note, cents int
+	pending     bool // NoteOn waiting for serviceStreams to restart the file
+
+	Underruns uint32 // Blocks that ran out of buffered data
+}
+
+// Streams with an open file, refilled by serviceStreams
+var streams []*StreamVoice
+
+var streamChunk [STREAM_CHUNK * 4]byte // Up to 16-bit stereo
+
+// Open a wav file for streaming; call Trigger to start it
+func openStream(path string) (*StreamVoice, error) {
+	f, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readWavInfo(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	n := len(streams) + 1
+	if most := streamsSustained(); most > 0 && n > most {
+		println("Warning: the card keeps up with", most, "streams, opening", n)
+		showStatus("CARD TOO SLOW FOR "+itoa(n)+" STREAMS", colorRed)
+	}
+	size := streamRingSize(n)
+	v := &StreamVoice{Level: 255, file: f, info: info, ring: make([]int16, size), mask: uint32(size - 1)}
+	streams = append(streams, v)
+	return v, nil
+}
+
+// Microseconds the card takes to deliver a frame's worth of one stream,
+// 0 until measured
+func streamCardTime() int {
+	chunks := int(sampleRate) * int(FRAME_TIME/time.Microsecond) / 1_000_000 / STREAM_CHUNK
+	return (chunks + 1) * cpuCosts[COST_CARD_READ]
+}
+
+// Ring size for one of n streams: enough to play through STREAM_COVER_FRAMES
+// UI frames and the card reads of every stream, at STREAM_MAX_SPEED
+func streamRingSize(n int) int {
+	loadCostTable()
+	card := streamCardTime()
+	if card == 0 {
+		return STREAM_RING_SIZE
+	}
+	us := STREAM_COVER_FRAMES*int(FRAME_TIME/time.Microsecond) + n*card
+	need := us * int(sampleRate) / 1_000_000 * STREAM_MAX_SPEED
+	size := STREAM_RING_MIN
+	for size < need && size < STREAM_RING_MAX {
+		size <<= 1
+	}
+	return size
+}
+
+// Streams the card can keep filled within STREAM_CARD_SHARE of each UI
+// frame, 0 until measured
+func streamsSustained() int {
+	loadCostTable()
+	card := streamCardTime()
+	if card == 0 {
+		return 0
+	}
+	return int(FRAME_TIME/time.Microsecond) * STREAM_CARD_SHARE / 100 / card
+}
+
+// Stop streaming and release the file
+func (v *StreamVoice) Close() {
+	v.playing = false
+	v.file.Close()
+	for i, s := range streams {
+		if s == v {
+			streams = append(streams[:i], streams[i+1:]...)
+			break
+		}
+	}
+}
+
+// Set the pitch as a note plus fine tune in cents
+func (v *StreamVoice) SetPitch(note int, cents int) {
+	v.note, v.cents = note, cents
+	if v.Fixed {
+		v.inc = (uint64(v.info.Rate) << 32) / uint64(sampleRate)
+		return
+	}
+	ratio := (uint64(noteFrequency(note, cents)) << 32) / uint64(rootFrequencies[v.info.RootNote&(NUM_NOTES-1)])
+	v.inc = ratio * uint64(v.info.Rate) / uint64(sampleRate)
+}
+
+func (v *StreamVoice) Retune() { v.SetPitch(v.note, v.cents) }
+
+// Restart from the top of the file and fill the buffer before playing
+func (v *StreamVoice) Trigger(note int, cents int) {
+	v.playing = false
+	v.SetPitch(note, cents)
+	v.head, v.tail, v.frac = 0, 0, 0
+	v.read = 0
+	v.eof = false
+	v.fill(len(v.ring))
+	v.playing = true
+}
+
+func (v *StreamVoice) Stop() {
+	v.playing = false
+	v.pending = false
+}
+
+// Restarting reads the card, so it is left to serviceStreams and the note
+// starts on the next frame rather than on the audio path
+func (v *StreamVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.Stop()
+		return
+	}
+	v.playing = false
+	v.note, v.cents, v.velocity = int(noteIndex(note)), 0, velocity
+	v.pending = true
+}
+
+func (v *StreamVoice) NoteOff() { v.Stop() }
+
+func (v *StreamVoice) Sounding() bool { return v.playing || v.pending }
+
+// Space left in the ring. Playing fast can step tail past head, which
+// leaves the ring empty.
+func (v *StreamVoice) free() int {
+	used := int32(v.head - v.tail)
+	if used < 0 {
+		used = 0
+	}
+	return len(v.ring) - int(used)
+}
+
+// Read up to max samples into the free part of the ring
+func (v *StreamVoice) fill(max int) {
+	frame := v.info.frameSize()
+	for !v.eof && max > 0 {
+		n := min(v.free(), max, STREAM_CHUNK, int(v.info.DataLen-v.read)/frame)
+		if n <= 0 {
+			v.eof = v.read+int64(frame) > v.info.DataLen
+			return
+		}
+		if _, err := v.file.Seek(v.info.DataStart+v.read, io.SeekStart); err != nil {
+			v.eof = true
+			return
+		}
+		got, _ := io.ReadFull(v.file, streamChunk[:n*frame])
+		if got < n*frame {
+			v.eof = true
+			n = got / frame
+		}
+		// Decode into place, split where the ring wraps
+		start := v.head & v.mask
+		first := min(n, len(v.ring)-int(start))
+		decodePCM(v.ring[start:start+uint32(first)], streamChunk[:first*frame], v.info.Channels, v.info.Bits)
+		decodePCM(v.ring[:n-first], streamChunk[first*frame:n*frame], v.info.Channels, v.info.Bits)
+		v.read += int64(n * frame)
+		v.head += uint32(n)
+		max -= n
+	}
+}
+
+// Top up every open stream; called from the main loop
+func serviceStreams() {
+	for _, v := range streams {
+		if v.pending {
+			// The restart moves head and tail under Render, and a note off
+			// may land meanwhile, so it runs whole under the lock
+			audioMu.Lock()
+			if v.pending {
+				v.pending = false
+				v.Trigger(v.note, v.cents)
+			}
+			audioMu.Unlock()
+		}
+		if v.playing && v.free() >= STREAM_CHUNK {
+			v.fill(len(v.ring))
+		}
+	}
+}
+
+func (v *StreamVoice) Render(out []int32) {
+	if !v.playing {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	step, stepFrac := uint32(v.inc>>32), uint32(v.inc)
+	head := v.head
+	for i := range out {
+		if v.tail >= head {
+			if v.eof {
+				v.playing = false
+			} else {
+				v.Underruns++
+			}
+			return
+		}
+		out[i] += int32(v.ring[v.tail&v.mask]) * level >> 8
+
+		f := v.frac + stepFrac
+		if f < v.frac {
+			v.tail++
+		}
+		v.frac = f
+		v.tail += step
+	}
+}
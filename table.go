@@ -0,0 +1,71 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Steps through an instrument's table on sequencer ticks. Volume and Pitch
+// hold what the rows have set so far, for the sequencer to apply to the
+// track's voice on top of the step's note and volume. One loop counts its
+// repeats at a time: a loop command on another row starts counting anew.
+type TablePlayer struct {
+	Volume uint8 // 0-255
+	Pitch  int8  // Semitones
+
+	table   *Table
+	row     uint8
+	next    uint8
+	tick    uint8
+	running bool
+
+	loopRow   uint8 // Row of the loop counting, EMPTY for none
+	loopsLeft uint8
+}
+
+// Restart from the first row with a new note
+func (tp *TablePlayer) Start(t *Table) {
+	*tp = TablePlayer{Volume: 255, table: t, running: t != nil && t.Rate > 0, loopRow: EMPTY}
+}
+
+func (tp *TablePlayer) Stop() { tp.running = false }
+
+// Advance one tick. On a tick that enters a row, returns the row's
+// command for the sequencer to run; hops and loops are handled here.
+func (tp *TablePlayer) Tick() (fx StepFX, ok bool) {
+	if !tp.running {
+		return StepFX{}, false
+	}
+	if tp.tick == 0 {
+		row := &tp.table.Rows[tp.row]
+		if row.Volume != 0 {
+			tp.Volume = row.Volume
+		}
+		tp.Pitch = row.Pitch
+		tp.next = (tp.row + 1) % TABLE_ROWS
+		switch row.FX.Command {
+		case FX_NONE:
+		case FX_HOP:
+			tp.next = row.FX.Param % TABLE_ROWS
+		case FX_LOOP:
+			if tp.loopRow != tp.row {
+				tp.loopRow, tp.loopsLeft = tp.row, row.FX.Param>>4
+			}
+			if tp.loopsLeft > 0 {
+				tp.loopsLeft--
+				tp.next = (row.FX.Param & 0xF) % TABLE_ROWS
+			} else {
+				tp.loopRow = EMPTY
+			}
+		default:
+			fx, ok = row.FX, true
+		}
+	}
+	if tp.tick++; tp.tick >= tp.table.Rate {
+		tp.tick, tp.row = 0, tp.next
+	}
+	return fx, ok
+}
+
+// Row the table is on, for editors to show
+func (tp *TablePlayer) Row() (uint8, bool) {
+	return tp.row, tp.running
+}
@@ -0,0 +1,238 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Table editor: the selected instrument's table, a row per table row with
+// its volume, pitch and command, then the rate it steps at. Editing works
+// as in the phrase editor, EDIT+UP/DOWN moving a pitch by an octave and a
+// volume, param or rate by 16. Commands step through tableCommands, which
+// hold the table's hop and loop. A volume of 00 keeps the previous row's.
+// The row a playing track's table is on is highlighted. It sits right of
+// the instrument editor: NAV+LEFT goes back to it and NAV+UP/DOWN step to
+// the previous or next instrument's table.
+const (
+	TABLE_COL_VOLUME = iota
+	TABLE_COL_PITCH
+	TABLE_COL_COMMAND
+	TABLE_COL_PARAM
+	NUM_TABLE_COLS
+
+	TABLE_RATE_ROW  = TABLE_ROWS // Cursor row of the rate
+	MAX_TABLE_PITCH = 48         // Semitones either way
+)
+
+// Where each column is drawn and how wide, in characters
+var tableColumns = [NUM_TABLE_COLS]struct{ x, width int }{{3, 2}, {6, 3}, {10, 1}, {11, 2}}
+
+func init() {
+	registerView(VIEW_TABLE, func() View { return &tableView{playhead: -1} })
+	addTool("TABLE", func() { pushView(&tableView{playhead: -1}) })
+}
+
+type tableView struct {
+	playhead int // Row being played, -1 for none
+}
+
+// Last command entered, for filling in empty rows
+var tableLastCommand uint8 = FX_VOLUME
+
+func (v *tableView) ID() ViewID { return VIEW_TABLE }
+
+func (v *tableView) state() *ViewState { return &session.Views[VIEW_TABLE] }
+
+func (v *tableView) table() *Table {
+	return &project.Instruments[session.Instrument%NUM_INSTRUMENTS].Table
+}
+
+// Row of the table a track playing the instrument is on, -1 when none is
+func (v *tableView) playingRow() int {
+	if !sequencer.Playing {
+		return -1
+	}
+	for t := range sequencer.tracks {
+		tp := &sequencer.tracks[t]
+		if tp.instrument != session.Instrument%NUM_INSTRUMENTS {
+			continue
+		}
+		if row, ok := tp.table.Row(); ok {
+			return int(row)
+		}
+	}
+	return -1
+}
+
+func (v *tableView) Tick() {
+	if r := v.playingRow(); r != v.playhead {
+		v.playhead = r
+		redrawView()
+	}
+}
+
+// Table rows and the rate row that fit below the title
+func tableRows() int {
+	return min(viewRows()-1, TABLE_ROWS+1)
+}
+
+func (v *tableView) Draw() {
+	st := v.state()
+	tb := v.table()
+	drawText(0, 0, "TABLE "+hexByte(session.Instrument%NUM_INSTRUMENTS), colorGreen)
+	v.playhead = v.playingRow()
+	first := int(st.Scroll)
+	for r := first; r <= TABLE_RATE_ROW && r < first+tableRows(); r++ {
+		row := r - first + 1
+		if r == TABLE_RATE_ROW {
+			if r == int(st.Row) {
+				drawHighlight(5, row, 2, colorBlue)
+			}
+			rate := "RATE " + hexByte(tb.Rate)
+			if tb.Rate == 0 {
+				rate += " OFF"
+			}
+			drawText(0, row, rate, colorText)
+			continue
+		}
+		if r == v.playhead {
+			drawHighlight(0, row, 13, colorGrid)
+		}
+		if r == int(st.Row) {
+			c := tableColumns[st.Col%NUM_TABLE_COLS]
+			drawHighlight(c.x, row, c.width, colorBlue)
+		}
+		drawText(0, row, hexByte(uint8(r))+" "+tableRowText(&tb.Rows[r]), colorText)
+	}
+}
+
+// Columns of a table row after the row number
+func tableRowText(row *TableRow) string {
+	text := "--"
+	if row.Volume != 0 {
+		text = hexByte(row.Volume)
+	}
+	text += " " + transposeText(row.Pitch) + " "
+	if row.FX.Command == FX_NONE {
+		return text + "---"
+	}
+	return text + string(rune(row.FX.Command)) + hexByte(row.FX.Param)
+}
+
+func (v *tableView) Describe() string {
+	st := v.state()
+	text := "TABLE " + hexByte(session.Instrument%NUM_INSTRUMENTS)
+	if st.Row >= TABLE_RATE_ROW {
+		return text + " RATE " + hexByte(v.table().Rate)
+	}
+	row := &v.table().Rows[st.Row%TABLE_ROWS]
+	text += " ROW " + hexByte(st.Row)
+	switch st.Col {
+	case TABLE_COL_VOLUME:
+		if row.Volume == 0 {
+			return text + " VOLUME KEEP"
+		}
+		return text + " VOLUME " + hexByte(row.Volume)
+	case TABLE_COL_PITCH:
+		return text + " PITCH " + transposeText(row.Pitch)
+	}
+	if row.FX.Command == FX_NONE {
+		return text + " COMMAND EMPTY"
+	}
+	if st.Col == TABLE_COL_COMMAND {
+		return text + " COMMAND " + string(rune(row.FX.Command))
+	}
+	return text + " PARAM " + hexByte(row.FX.Param)
+}
+
+func (v *tableView) HandleAction(a Action) {
+	st := v.state()
+	switch a {
+	case ACTION_CURSOR_UP:
+		if st.Row > 0 {
+			st.Row--
+		}
+	case ACTION_CURSOR_DOWN:
+		if st.Row < TABLE_RATE_ROW {
+			st.Row++
+		}
+	case ACTION_CURSOR_LEFT:
+		if st.Col == 0 || st.Row == TABLE_RATE_ROW {
+			popView()
+			return
+		}
+		st.Col--
+	case ACTION_CURSOR_RIGHT:
+		if st.Col < NUM_TABLE_COLS-1 {
+			st.Col++
+		}
+	case ACTION_EDIT_UP, ACTION_EDIT_DOWN, ACTION_EDIT_LEFT, ACTION_EDIT_RIGHT:
+		v.edit(editDelta(a))
+	case ACTION_CLEAR:
+		v.clear()
+	case ACTION_NAV_LEFT:
+		replaceView(&instrumentView{})
+		return
+	case ACTION_NAV_UP, ACTION_NAV_DOWN:
+		session.Instrument = uint8((int(session.Instrument) + navDelta(a) + NUM_INSTRUMENTS) % NUM_INSTRUMENTS)
+	default:
+		return
+	}
+	rows := tableRows()
+	if int(st.Row) < int(st.Scroll) {
+		st.Scroll = st.Row
+	} else if int(st.Row) >= int(st.Scroll)+rows {
+		st.Scroll = st.Row - uint8(rows) + 1
+	}
+	redrawView()
+}
+
+// Step the value under the cursor by delta, or by delta octaves or 16s
+// when big, filling an empty command instead
+func (v *tableView) edit(delta int, big bool) {
+	st := v.state()
+	tb := v.table()
+	if st.Row >= TABLE_RATE_ROW {
+		tb.Rate = stepByte(tb.Rate, delta, big, 16, 255)
+		return
+	}
+	row := &tb.Rows[st.Row%TABLE_ROWS]
+	switch st.Col {
+	case TABLE_COL_VOLUME:
+		row.Volume = stepByte(row.Volume, delta, big, 16, 255)
+	case TABLE_COL_PITCH:
+		if big {
+			delta *= 12
+		}
+		row.Pitch = int8(max(min(int(row.Pitch)+delta, MAX_TABLE_PITCH), -MAX_TABLE_PITCH))
+	case TABLE_COL_COMMAND:
+		if row.FX.Command == FX_NONE {
+			row.FX.Command = tableLastCommand
+		} else {
+			row.FX.Command = nextCommand(tableCommands, row.FX.Command, delta)
+		}
+		tableLastCommand = row.FX.Command
+	default:
+		if row.FX.Command == FX_NONE {
+			row.FX.Command = tableLastCommand
+		}
+		row.FX.Param = stepByte(row.FX.Param, delta, big, 16, 255)
+	}
+}
+
+// Empty the cell under the cursor, or turn the table off on the rate
+func (v *tableView) clear() {
+	st := v.state()
+	tb := v.table()
+	if st.Row >= TABLE_RATE_ROW {
+		tb.Rate = 0
+		return
+	}
+	row := &tb.Rows[st.Row%TABLE_ROWS]
+	switch st.Col {
+	case TABLE_COL_VOLUME:
+		row.Volume = 0
+	case TABLE_COL_PITCH:
+		row.Pitch = 0
+	default:
+		row.FX = StepFX{}
+	}
+}
@@ -0,0 +1,101 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "image/color"
+
+// UI palette. Views draw with the color variables, which the active theme
+// sets: Warning is colorRed, Accent colorGreen and Highlight colorBlue.
+type Theme struct {
+	Name       string
+	Background color.RGBA
+	Grid       color.RGBA
+	Text       color.RGBA
+	Warning    color.RGBA
+	Accent     color.RGBA
+	Highlight  color.RGBA
+
+	// Draw the cursor as an outline this many pixels wide instead of a
+	// filled box
+	CursorOutline int16
+}
+
+const (
+	THEME_DEFAULT = iota
+	THEME_DEUTERANOPIA
+	THEME_PROTANOPIA
+	THEME_HIGH_CONTRAST
+)
+
+// The color-blind palettes avoid telling states apart by red against
+// green, using the Okabe-Ito orange, yellow and blues instead
+var themes = []Theme{
+	THEME_DEFAULT: {
+		Name:       "DEFAULT",
+		Background: color.RGBA{0, 0, 0, 255},
+		Grid:       color.RGBA{50, 50, 50, 255},
+		Text:       color.RGBA{255, 255, 255, 255},
+		Warning:    color.RGBA{255, 0, 0, 255},
+		Accent:     color.RGBA{0, 255, 0, 255},
+		Highlight:  color.RGBA{0, 0, 255, 255},
+	},
+	THEME_DEUTERANOPIA: {
+		Name:       "DEUTERANOPIA",
+		Background: color.RGBA{0, 0, 0, 255},
+		Grid:       color.RGBA{50, 50, 50, 255},
+		Text:       color.RGBA{255, 255, 255, 255},
+		Warning:    color.RGBA{230, 159, 0, 255},
+		Accent:     color.RGBA{86, 180, 233, 255},
+		Highlight:  color.RGBA{0, 90, 160, 255},
+	},
+	THEME_PROTANOPIA: {
+		Name:       "PROTANOPIA",
+		Background: color.RGBA{0, 0, 0, 255},
+		Grid:       color.RGBA{50, 50, 50, 255},
+		Text:       color.RGBA{255, 255, 255, 255},
+		Warning:    color.RGBA{240, 228, 66, 255},
+		Accent:     color.RGBA{86, 180, 233, 255},
+		Highlight:  color.RGBA{0, 90, 160, 255},
+	},
+	THEME_HIGH_CONTRAST: {
+		Name:          "HIGH CONTRAST",
+		Background:    color.RGBA{0, 0, 0, 255},
+		Grid:          color.RGBA{110, 110, 110, 255},
+		Text:          color.RGBA{255, 255, 255, 255},
+		Warning:       color.RGBA{255, 255, 0, 255},
+		Accent:        color.RGBA{0, 255, 255, 255},
+		Highlight:     color.RGBA{255, 255, 255, 255},
+		CursorOutline: 3,
+	},
+}
+
+var theme = &themes[THEME_DEFAULT]
+
+func init() {
+	names := make([]string, len(themes))
+	for i, t := range themes {
+		names[i] = t.Name
+	}
+	addSetting("THEME", names,
+		func() int { return int(settings.Theme) },
+		func(i int) {
+			settings.Theme = uint8(i)
+			applyTheme(i)
+		})
+}
+
+// Switch the UI colors to a theme
+func applyTheme(i int) {
+	if i < 0 || i >= len(themes) {
+		i = THEME_DEFAULT
+	}
+	theme = &themes[i]
+	colorBackground = theme.Background
+	colorGrid = theme.Grid
+	colorText = theme.Text
+	colorRed = theme.Warning
+	colorGreen = theme.Accent
+	colorBlue = theme.Highlight
+	redrawView()
+}
@@ -0,0 +1,194 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Song timing. Groove is swing: the percentage of each pair of steps given
+// to the first one, GROOVE_STRAIGHT or 0 for even steps. It is shown as
+// the swing, how late the even steps land in percent of a step, which is
+// twice the groove over GROOVE_STRAIGHT. A phrase can set
+// its own tempo and groove for as long as it plays; when phrases on several
+// tracks play together, the leftmost track with an override sets it, and
+// the song's timing returns once no playing phrase overrides it.
+const (
+	GROOVE_STRAIGHT = 50
+	GROOVE_MAX      = 75
+	TEMPO_MIN       = 40
+	TEMPO_MAX       = 300
+)
+
+// Tempo and groove while a song row plays chain entry e
+func (p *Project) slotTiming(row, e int) (tempo uint16, groove uint8) {
+	for _, c := range p.Song[row] {
+		if c == EMPTY || int(c) >= NUM_CHAINS || e >= CHAIN_LENGTH {
+			continue
+		}
+		ph := p.Chains[c].Entries[e].Phrase
+		if int(ph) >= NUM_PHRASES {
+			continue
+		}
+		if tempo == 0 {
+			tempo = p.Phrases[ph].Tempo
+		}
+		if groove == 0 {
+			groove = p.Phrases[ph].Groove
+		}
+	}
+	if tempo == 0 {
+		tempo = p.Tempo
+	}
+	if groove == 0 {
+		groove = p.Groove
+	}
+	return tempo, groove
+}
+
+// The tempo played: 0 is DEFAULT_TEMPO, others are held to
+// TEMPO_MIN-TEMPO_MAX
+func playedTempo(tempo uint16) uint16 {
+	if tempo == 0 {
+		return DEFAULT_TEMPO
+	}
+	return min(max(tempo, TEMPO_MIN), TEMPO_MAX)
+}
+
+// Length of step s of a phrase at a tempo and groove, in 1/65536 frames,
+// the tempo taken as playedTempo
+func stepLength(tempo uint16, groove uint8, s int) uint64 {
+	tempo = playedTempo(tempo)
+	if groove < GROOVE_STRAIGHT || groove > GROOVE_MAX {
+		groove = GROOVE_STRAIGHT
+	}
+	pair := uint64(sampleRate) * 60 * 2 << 16 / uint64(int(tempo)*STEPS_PER_BEAT)
+	first := pair * uint64(groove) / 100
+	if s%2 == 0 {
+		return first
+	}
+	return pair - first
+}
+
+// How late a groove puts the even steps, in percent of a step
+func swingOf(groove uint8) int {
+	if groove < GROOVE_STRAIGHT || groove > GROOVE_MAX {
+		return 0
+	}
+	return int(groove-GROOVE_STRAIGHT) * 2
+}
+
+// Groove for a swing in percent of a step, rounded down to what the
+// groove can hold
+func grooveOf(swing int) uint8 {
+	swing = max(min(swing, swingOf(GROOVE_MAX)), 0)
+	return uint8(GROOVE_STRAIGHT + swing/2)
+}
+
+// Counts steps out in frames of audio rather than wall time, so the song
+// keeps time with the output exactly. Steps that aren't a whole number of
+// frames long carry the fraction on to the next, so the tempo holds on
+// average and never drifts.
+type TempoClock struct {
+	frac uint64 // Of a frame carried over, in 1/65536
+}
+
+// Frames the next step lasts, step s of a phrase at a tempo and groove
+func (c *TempoClock) Next(tempo uint16, groove uint8, s int) int {
+	total := c.frac + stepLength(tempo, groove, s)
+	c.frac = total & 0xffff
+	return int(total >> 16)
+}
+
+func init() {
+	addTool("TIMING", openTimingView)
+	addCommand("tempo", "tempo [BPM]: print or set the song tempo, 40-300", func(args []string) {
+		if len(args) == 0 {
+			shellPrint(itoa(int(project.Tempo)) + " BPM\n")
+			return
+		}
+		bpm, err := strconv.Atoi(args[0])
+		if err != nil || bpm < TEMPO_MIN || bpm > TEMPO_MAX {
+			shellPrint("tempo is 40-300 BPM\n")
+			return
+		}
+		project.Tempo = uint16(bpm)
+	})
+	addCommand("swing", "swing [PCT]: print or set how late the song's even steps land, 0-50% of a step", func(args []string) {
+		if len(args) == 0 {
+			shellPrint(itoa(swingOf(project.Groove)) + "%\n")
+			return
+		}
+		pct, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+		if err != nil || pct < 0 || pct > swingOf(GROOVE_MAX) {
+			shellPrint("swing is 0-50%\n")
+			return
+		}
+		project.Groove = grooveOf(pct)
+	})
+}
+
+// Tempo and groove choices, the first one being inherit for a phrase
+func timingItems(tempo *uint16, groove *uint8, inherit string) []settingItem {
+	tempos := []string{}
+	if inherit != "" {
+		tempos = append(tempos, inherit)
+	}
+	for t := TEMPO_MIN; t <= TEMPO_MAX; t += 10 {
+		tempos = append(tempos, itoa(t)+" BPM")
+	}
+	first := 0
+	if inherit != "" {
+		first = 1
+	}
+	grooves := []uint8{0, 50, 54, 58, 62, 66, 70, 75}
+	if inherit == "" {
+		grooves = grooves[1:]
+	}
+	return []settingItem{
+		{"TEMPO", tempos,
+			func() int {
+				if *tempo == 0 && inherit != "" {
+					return 0
+				}
+				t := max(min(int(*tempo), TEMPO_MAX), TEMPO_MIN)
+				return first + (t-TEMPO_MIN+5)/10
+			},
+			func(i int) {
+				if i < first {
+					*tempo = 0
+					return
+				}
+				*tempo = uint16(TEMPO_MIN + (i-first)*10)
+			}},
+		byteChoice("SWING", func() *uint8 { return groove }, grooves, func(v uint8) string {
+			if v == 0 {
+				return inherit
+			}
+			return itoa(swingOf(v)) + "%"
+		}),
+	}
+}
+
+// The song's timing, then a line per phrase with notes
+func openTimingView() {
+	list := &ListView{Title: "TIMING", Items: []string{"SONG"}}
+	var phrases []int
+	for i := range project.Phrases {
+		if !project.Phrases[i].IsEmpty() {
+			phrases = append(phrases, i)
+			list.Items = append(list.Items, "PHRASE "+itoa(i))
+		}
+	}
+	list.OnSelect = func(i int) {
+		if i == 0 {
+			openParamList("SONG TIMING", timingItems(&project.Tempo, &project.Groove, ""), nil)
+			return
+		}
+		ph := &project.Phrases[phrases[i-1]]
+		openParamList("PHRASE "+itoa(phrases[i-1]), timingItems(&ph.Tempo, &ph.Groove, "SONG"), nil)
+	}
+	pushView(list)
+}
@@ -0,0 +1,112 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Amp envelope and low pass filter of an instrument's voice, run by its
+// PitchVoice. Attack fades each note in and Release fades it out after its
+// note off, which reaches the voice once the fade is done. Cutoff 1-255
+// sets the filter from 20Hz to 20kHz, an octave every 25.5, and Resonance
+// peaks it there. An instrument with none of them set costs nothing.
+const (
+	TONE_UNITY      = 1 << 16 // Envelope gain at full level
+	TONE_MIN_HZ     = 20      // Cutoff 1
+	TONE_MAX_DAMP   = 8192    // Q12 filter damping without resonance
+	TONE_RESONANCE  = 90      // % of the damping full Resonance takes away
+	TONE_STEP_MS    = 10      // Attack and Release unit
+	TONE_MAX_CUTOFF = 6       // Highest cutoff as a fraction of the rate
+)
+
+type ToneShaper struct {
+	on        bool
+	attack    int32 // Gain steps per frame, TONE_UNITY for at once
+	release   int32
+	gain      int32
+	releasing bool
+	ended     bool // The voice was stopped after the release
+
+	cutoff, resonance uint8  // Filter coefficients were made for
+	rate              uint32 // Sample rate coef was made for
+	coef, damp        int32  // Q12
+	low, band         int32
+
+	buf [PITCH_CHUNK]int32
+}
+
+// Cutoff frequency of a filter setting, 0 for open
+func cutoffHz(c uint8) int {
+	if c == 0 {
+		return 0
+	}
+	return int(TONE_MIN_HZ * math.Pow(2, float64(c)/25.5))
+}
+
+// Gain step per frame of a fade lasting steps of TONE_STEP_MS
+func fadeRate(steps uint8) int32 {
+	frames := int32(steps) * TONE_STEP_MS * int32(sampleRate) / 1000
+	return max(TONE_UNITY/max(frames, 1), 1)
+}
+
+// Take the instrument's envelope and filter for a new note
+func (t *ToneShaper) noteOn(in *Instrument) {
+	t.on = in.Attack != 0 || in.Release != 0 || in.Cutoff != 0
+	if !t.on {
+		return
+	}
+	t.attack, t.release = TONE_UNITY, TONE_UNITY
+	if in.Attack != 0 {
+		t.attack = fadeRate(in.Attack)
+	}
+	if in.Release != 0 {
+		t.release = fadeRate(in.Release)
+	}
+	t.gain, t.releasing, t.ended = 0, false, false
+	if in.Cutoff != t.cutoff || in.Resonance != t.resonance || sampleRate != t.rate {
+		t.cutoff, t.resonance, t.rate = in.Cutoff, in.Resonance, sampleRate
+		hz := min(float64(cutoffHz(in.Cutoff)), float64(sampleRate)/TONE_MAX_CUTOFF)
+		t.coef = int32(2 * math.Sin(math.Pi*hz/float64(sampleRate)) * 4096)
+		t.damp = TONE_MAX_DAMP - int32(in.Resonance)*TONE_MAX_DAMP*TONE_RESONANCE/100/255
+		t.low, t.band = 0, 0
+	}
+}
+
+// Start the release, returning false when the voice should stop at once.
+// Without a Release the voice stops as it would on its own.
+func (t *ToneShaper) noteOff() bool {
+	if !t.on || t.release == TONE_UNITY {
+		return false
+	}
+	t.releasing = true
+	t.ended = t.gain == 0
+	return !t.ended
+}
+
+// Render a chunk of v through the envelope and filter, adding it into out.
+// Stops v when its release has faded out.
+func (t *ToneShaper) render(v Voice, out []int32) {
+	buf := t.buf[:len(out)]
+	clear(buf)
+	v.Render(buf)
+	gain, low, band := t.gain, t.low, t.band
+	for i, x := range buf {
+		if t.releasing {
+			gain = max(gain-t.release, 0)
+		} else {
+			gain = min(gain+t.attack, TONE_UNITY)
+		}
+		x = x * (gain >> 8) >> 8
+		if t.cutoff != 0 {
+			low += t.coef * band >> 12
+			band += t.coef * (x - low - t.damp*band>>12) >> 12
+			x = low
+		}
+		out[i] += x
+	}
+	t.gain, t.low, t.band = gain, low, band
+	if t.releasing && gain == 0 && !t.ended {
+		t.ended = true
+		v.NoteOff()
+	}
+}
@@ -0,0 +1,153 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Deleted files are moved here so they can be restored. The index keeps
+// one "name<TAB>original path<TAB>size" line per entry, oldest first.
+const (
+	TRASH_DIR   = "/.trash"
+	TRASH_INDEX = TRASH_DIR + "/index.txt"
+	TRASH_SHARE = 4 // The trash keeps up to 1/TRASH_SHARE of the storage
+)
+
+// A file or folder in the trash
+type TrashEntry struct {
+	Name     string
+	Original string
+	Size     int64
+}
+
+var (
+	trashEntries []TrashEntry
+	trashSeq     int
+)
+
+func init() {
+	addTool("TRASH", openTrashView)
+}
+
+// Read the trash index from the card
+func loadTrashIndex() {
+	trashEntries = trashEntries[:0]
+	data, err := readFile(TRASH_INDEX)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		trashEntries = append(trashEntries, TrashEntry{fields[0], fields[1], size})
+		// Continue numbering after the newest entry
+		if i := strings.IndexByte(fields[0], '_'); i > 0 {
+			if seq, err := strconv.Atoi(fields[0][:i]); err == nil && seq >= trashSeq {
+				trashSeq = seq + 1
+			}
+		}
+	}
+}
+
+func saveTrashIndex() {
+	var b strings.Builder
+	for _, e := range trashEntries {
+		b.WriteString(e.Name + "\t" + e.Original + "\t" + strconv.FormatInt(e.Size, 10) + "\n")
+	}
+	if err := writeFile(TRASH_INDEX, []byte(b.String())); err != nil {
+		println("Failed to save trash index:", err.Error())
+	}
+}
+
+// Delete a sample or project by moving it to the trash
+func deleteFile(path string) error {
+	if soakRunning {
+		return errReadOnly
+	}
+	if err := mkdirAll(TRASH_DIR); err != nil {
+		return err
+	}
+	size := pathSize(path)
+	name := itoa(trashSeq) + "_" + baseName(path)
+	if err := storage.Rename(path, joinPath(TRASH_DIR, name)); err != nil {
+		return err
+	}
+	trashSeq++
+	trashEntries = append(trashEntries, TrashEntry{name, path, size})
+	purgeTrash(trashLimit())
+	saveTrashIndex()
+	return nil
+}
+
+// Bytes the trash may hold before the oldest entries go
+func trashLimit() int64 {
+	if settings.TrashLimitKB != 0 {
+		return int64(settings.TrashLimitKB) * 1024
+	}
+	return storage.Capacity() / TRASH_SHARE
+}
+
+// Move an entry back to where it was deleted from
+func restoreFromTrash(i int) error {
+	e := trashEntries[i]
+	if err := mkdirAll(dirName(e.Original)); err != nil {
+		return err
+	}
+	if err := storage.Rename(joinPath(TRASH_DIR, e.Name), e.Original); err != nil {
+		return err
+	}
+	trashEntries = append(trashEntries[:i], trashEntries[i+1:]...)
+	saveTrashIndex()
+	return nil
+}
+
+// Permanently remove the oldest entries until the trash fits in limit bytes
+func purgeTrash(limit int64) {
+	var total int64
+	for _, e := range trashEntries {
+		total += e.Size
+	}
+	for len(trashEntries) > 0 && total > limit {
+		e := trashEntries[0]
+		if err := removeAll(joinPath(TRASH_DIR, e.Name)); err != nil {
+			println("Failed to purge", e.Name+":", err.Error())
+		}
+		total -= e.Size
+		trashEntries = trashEntries[1:]
+	}
+}
+
+// List the trash newest first; ENTER restores an entry
+func openTrashView() {
+	list := &ListView{Title: "TRASH"}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for i := len(trashEntries) - 1; i >= 0; i-- {
+			e := trashEntries[i]
+			list.Items = append(list.Items, e.Original+" "+itoa(int((e.Size+1023)/1024))+"K")
+		}
+		if len(trashEntries) > 0 {
+			list.Items = append(list.Items, "EMPTY TRASH")
+		}
+	}
+	refresh()
+	list.OnSelect = func(index int) {
+		if index == len(trashEntries) {
+			purgeTrash(0)
+			saveTrashIndex()
+			showStatus("TRASH EMPTIED", colorGreen)
+		} else if err := restoreFromTrash(len(trashEntries) - 1 - index); err != nil {
+			showStatus("RESTORE FAILED", colorRed)
+		} else {
+			showStatus("RESTORED", colorGreen)
+		}
+		refresh()
+	}
+	pushView(list)
+}
@@ -0,0 +1,139 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Guided tour shown on first boot. Each step shows two lines of help above
+// the status bar and is checked after every action; it can be skipped at
+// any time and run again from settings.
+type tutorialStep struct {
+	text  [2]string
+	start func()
+	done  func(a Action) bool
+}
+
+var (
+	tutorialSteps = []tutorialStep{
+		{
+			text: [2]string{"WELCOME! PRESS ENTER", "ALT+EDIT+NAV: SKIP"},
+			done: func(a Action) bool { return a == ACTION_ENTER },
+		},
+		{
+			text: [2]string{"OPEN A PHRASE AND", "ENTER A NOTE"},
+			done: func(Action) bool { return noteInstruments() >= 0 },
+		},
+		{
+			text:  [2]string{"NOW CHANGE THE", "NOTE'S INSTRUMENT"},
+			start: func() { tutorialMark = noteInstruments() },
+			done:  func(Action) bool { return noteInstruments() != tutorialMark },
+		},
+		{
+			text: [2]string{"PRESS PLAY TO", "HEAR YOUR SONG"},
+			done: func(a Action) bool { return a == ACTION_PLAY },
+		},
+	}
+
+	tutorialActive bool
+	tutorialStepAt int
+	tutorialMark   int
+
+	// Don't count the ENTER that restarted the tour from settings
+	tutorialIgnoreNext bool
+)
+
+func init() {
+	addSetting("TUTORIAL", []string{"PENDING", "DONE"},
+		func() int { return int(boolByte(settings.TutorialDone)) },
+		func(i int) {
+			if i == 0 {
+				settings.TutorialDone = false
+				// Restarted from the settings screen; at boot main starts it
+				if currentView() != nil {
+					startTutorial()
+					tutorialIgnoreNext = true
+				}
+			} else {
+				settings.TutorialDone = true
+				tutorialActive = false
+				redrawView()
+			}
+		})
+}
+
+// Sum over all notes of their instruments, -1 when there are no notes, so
+// a change of any note's instrument changes the result
+func noteInstruments() int {
+	sum := -1
+	for p := range project.Phrases {
+		for i, s := range project.Phrases[p].Steps {
+			if s.Note == EMPTY || s.Note == NOTE_OFF {
+				continue
+			}
+			if sum < 0 {
+				sum = 0
+			}
+			sum += (p*PHRASE_STEPS + i + 1) * int(s.Instrument)
+		}
+	}
+	return sum
+}
+
+func startTutorial() {
+	settings.TutorialDone = false
+	tutorialActive = true
+	tutorialStepAt = 0
+	beginTutorialStep()
+}
+
+func beginTutorialStep() {
+	if s := tutorialSteps[tutorialStepAt]; s.start != nil {
+		s.start()
+	}
+	redrawView()
+}
+
+// Leave the tour for good, until it is run again from settings
+func endTutorial() {
+	tutorialActive = false
+	settings.TutorialDone = true
+	saveSettings()
+	redrawView()
+}
+
+// Check the current step after an action has run
+func tutorialAfterAction(a Action) {
+	if !tutorialActive {
+		return
+	}
+	if tutorialIgnoreNext {
+		tutorialIgnoreNext = false
+		return
+	}
+	if a == ACTION_TUTORIAL_SKIP {
+		endTutorial()
+		return
+	}
+	if !tutorialSteps[tutorialStepAt].done(a) {
+		return
+	}
+	tutorialStepAt++
+	if tutorialStepAt == len(tutorialSteps) {
+		endTutorial()
+		showStatus("TUTORIAL COMPLETE", colorGreen)
+		return
+	}
+	beginTutorialStep()
+}
+
+// Draw the current step over the bottom of the view
+func drawTutorial() {
+	if !tutorialActive {
+		return
+	}
+	row := viewRows() - 2
+	drawHighlight(0, row, viewCols(), colorBlue)
+	drawHighlight(0, row+1, viewCols(), colorBlue)
+	for i, line := range tutorialSteps[tutorialStepAt].text {
+		drawText(0, row+i, line, colorText)
+	}
+}
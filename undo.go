@@ -0,0 +1,63 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "errors"
+
+// One level of undo for operations that rewrite much of a project: the
+// project is saved to UNDO_FILE before the change, costing no RAM, and the
+// UNDO tool reads it back
+const UNDO_FILE = "/undo.bin"
+
+var errNothingToUndo = errors.New("undo: nothing to undo")
+
+var (
+	undoLabel   string // What UNDO reverts, empty when nothing
+	undoProject string // Project it was saved from
+)
+
+func init() {
+	addTool("UNDO", func() {
+		label := undoLabel
+		if err := undo(project); err != nil {
+			showStatus("NOTHING TO UNDO", colorRed)
+			return
+		}
+		showStatus("UNDID "+label, colorGreen)
+	})
+}
+
+// Save p before an operation named label changes it
+func saveUndo(p *Project, label string) error {
+	if err := writeFile(UNDO_FILE, encodeProject(p)); err != nil {
+		return err
+	}
+	undoLabel, undoProject = label, p.Name
+	return nil
+}
+
+// Put p back as it was before the last saved operation
+func undo(p *Project) error {
+	if undoLabel == "" || undoProject != p.Name {
+		return errNothingToUndo
+	}
+	data, err := readFile(UNDO_FILE)
+	if err != nil {
+		return err
+	}
+	old := newProject(p.Name)
+	if err := decodeProject(data, old); err != nil {
+		return err
+	}
+	reload := old.Samples != p.Samples || old.SampleEdits != p.SampleEdits
+	audioMu.Lock()
+	*p = *old
+	applyProjectMixer(p)
+	audioMu.Unlock()
+	if reload {
+		loadProjectSamples(p)
+	}
+	undoLabel = ""
+	return nil
+}
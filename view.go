@@ -0,0 +1,354 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"image/color"
+	"time"
+
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/freemono"
+)
+
+// The 320x240 landscape screen
+const (
+	SCREEN_WIDTH  = DISPLAY_HEIGHT
+	SCREEN_HEIGHT = DISPLAY_WIDTH
+
+	TEXT_LEFT = 4
+)
+
+// Text grid views lay themselves out on. Large text trades rows and
+// columns for a bigger font.
+type TextLayout struct {
+	Font       tinyfont.Fonter
+	LineHeight int
+	CharWidth  int
+}
+
+const (
+	TEXT_NORMAL = iota
+	TEXT_LARGE
+)
+
+var (
+	textLayouts = [...]TextLayout{
+		TEXT_NORMAL: {&freemono.Regular9pt7b, 18, 11},
+		TEXT_LARGE:  {&freemono.Regular12pt7b, 24, 14},
+	}
+	layout = &textLayouts[TEXT_NORMAL]
+)
+
+func init() {
+	addSetting("TEXT SIZE", []string{"NORMAL", "LARGE"},
+		func() int { return int(settings.TextSize) },
+		func(i int) {
+			settings.TextSize = uint8(i)
+			layout = &textLayouts[i]
+			redrawView()
+		})
+}
+
+// Top of the status bar
+func statusBarY() int {
+	return SCREEN_HEIGHT - layout.LineHeight - 2
+}
+
+// Text rows above the status bar
+func viewRows() int {
+	return statusBarY() / layout.LineHeight
+}
+
+// Characters that fit across the screen
+func viewCols() int {
+	return (SCREEN_WIDTH - TEXT_LEFT) / layout.CharWidth
+}
+
+// A full screen of the UI
+type View interface {
+	// Draw the whole view onto a cleared screen
+	Draw()
+	// Handle an action the global bindings didn't consume
+	HandleAction(a Action)
+}
+
+// A view that animates, asked every frame whether to redraw. Frames that
+// are catching up after running over budget skip it.
+type AnimatedView interface {
+	View
+	Tick()
+}
+
+var (
+	// Open views, the current one last
+	viewStack []View
+	viewDirty bool
+
+	statusMessage      string
+	statusMessageColor = colorText
+)
+
+// The view on screen
+func currentView() View {
+	if len(viewStack) == 0 {
+		return nil
+	}
+	return viewStack[len(viewStack)-1]
+}
+
+// Replace all open views with v
+func showView(v View) {
+	viewStack = append(viewStack[:0], v)
+	redrawView()
+}
+
+// Open v on top of the current view
+func pushView(v View) {
+	viewStack = append(viewStack, v)
+	redrawView()
+}
+
+// Swap the current view for v, as when moving between screens
+func replaceView(v View) {
+	if len(viewStack) == 0 {
+		showView(v)
+		return
+	}
+	viewStack[len(viewStack)-1] = v
+	redrawView()
+}
+
+// Close the current view, returning to the one below it
+func popView() {
+	if len(viewStack) > 1 {
+		viewStack = viewStack[:len(viewStack)-1]
+		redrawView()
+	}
+}
+
+// Schedule a full redraw on the next frame
+func redrawView() {
+	viewDirty = true
+}
+
+// Redraw the screen if anything changed
+func updateView() {
+	v := currentView()
+	if a, ok := v.(AnimatedView); ok && !skipNonCritical() {
+		a.Tick()
+	}
+	if !viewDirty || v == nil {
+		return
+	}
+	viewDirty = false
+	start := time.Now()
+	drawBatched(0, SCREEN_HEIGHT, func() {
+		display.FillScreen(colorBackground)
+		v.Draw()
+		drawTutorial()
+		drawStatusBar()
+	})
+	// Once, over the whole screen: drawBatched runs its function per band
+	fireViewDraw()
+	display.Display()
+	recordRedraw(time.Since(start))
+}
+
+// Draw text with its baseline in the middle of a grid row
+func drawText(col, row int, s string, c color.RGBA) {
+	tinyfont.WriteLine(&display, layout.Font,
+		int16(TEXT_LEFT+col*layout.CharWidth), int16((row+1)*layout.LineHeight-4), s, c)
+}
+
+// Fill the background of a span of grid cells, or outline it when the
+// theme asks for cursor outlines
+func drawHighlight(col, row, width int, c color.RGBA) {
+	x, y := int16(TEXT_LEFT+col*layout.CharWidth), int16(row*layout.LineHeight)
+	w, h := int16(width*layout.CharWidth), int16(layout.LineHeight)
+	t := theme.CursorOutline
+	if t == 0 {
+		display.FillRectangle(x, y, w, h, c)
+		return
+	}
+	display.FillRectangle(x, y, w, t, c)
+	display.FillRectangle(x, y+h-t, w, t, c)
+	display.FillRectangle(x, y, t, h, c)
+	display.FillRectangle(x+w-t, y, t, h, c)
+}
+
+func drawStatusBar() {
+	y := int16(statusBarY())
+	display.FillRectangle(0, y, SCREEN_WIDTH, SCREEN_HEIGHT-y, colorGrid)
+	tinyfont.WriteLine(&display, layout.Font,
+		TEXT_LEFT, SCREEN_HEIGHT-5, statusMessage, statusMessageColor)
+	if performanceLocked {
+		tinyfont.WriteLine(&display, layout.Font,
+			int16(SCREEN_WIDTH-5*layout.CharWidth), SCREEN_HEIGHT-5, "LOCK", colorRed)
+	}
+	if qualityReduced() {
+		tinyfont.WriteLine(&display, layout.Font,
+			int16(SCREEN_WIDTH-15*layout.CharWidth), SCREEN_HEIGHT-5, "LOQ", colorBlue)
+	}
+	if underrunFlashing() {
+		tinyfont.WriteLine(&display, layout.Font,
+			int16(SCREEN_WIDTH-10*layout.CharWidth), SCREEN_HEIGHT-5, "XRUN", colorRed)
+	}
+}
+
+// Redraw just the status bar and flush it
+func refreshStatusBar() {
+	y := int16(statusBarY())
+	drawBatched(y, SCREEN_HEIGHT-y, drawStatusBar)
+	display.Display()
+}
+
+// Show a progress bar with a title in the status bar and flush it
+func drawProgress(title string, done, total int) {
+	y := int16(statusBarY())
+	h := int16(SCREEN_HEIGHT) - y
+	drawBatched(y, h, func() {
+		display.FillRectangle(0, y, SCREEN_WIDTH, h, colorGrid)
+		display.FillRectangle(0, y, int16(SCREEN_WIDTH*done/max(total, 1)), h, colorBlue)
+		tinyfont.WriteLine(&display, layout.Font, TEXT_LEFT, SCREEN_HEIGHT-5,
+			title+" "+itoa(done*100/max(total, 1))+"%", colorText)
+	})
+	display.Display()
+}
+
+// Show a one-line message in the status bar
+func showStatus(message string, c color.RGBA) {
+	statusMessage, statusMessageColor = message, c
+	refreshStatusBar()
+	speak(message)
+}
+
+// Scrollable list of items picked with the arrows and ENTER. LEFT closes
+// it. OnSelect may change Items and Cursor. OnCursor, when set, follows
+// the cursor as it moves. Lists longer than the screen show which page the
+// cursor is on.
+type ListView struct {
+	Title    string
+	Items    []string
+	Cursor   int
+	OnSelect func(index int)
+	OnCursor func(index int)
+}
+
+func (l *ListView) Draw() {
+	rows := viewRows() - 1
+	title := l.Title
+	first := 0
+	if len(l.Items) > rows {
+		page := l.Cursor / rows
+		first = page * rows
+		title += " " + itoa(page+1) + "/" + itoa((len(l.Items)+rows-1)/rows)
+	}
+	drawText(0, 0, title, colorGreen)
+	for i := first; i < len(l.Items) && i < first+rows; i++ {
+		row := i - first + 1
+		if i == l.Cursor {
+			drawHighlight(0, row, viewCols(), colorBlue)
+		}
+		drawText(0, row, l.Items[i], colorText)
+	}
+	if len(l.Items) == 0 {
+		drawText(0, 1, "(empty)", colorGrid)
+	}
+}
+
+func (l *ListView) Describe() string {
+	if len(l.Items) == 0 {
+		return l.Title + ", EMPTY"
+	}
+	return l.Title + ", " + l.Items[min(max(l.Cursor, 0), len(l.Items)-1)]
+}
+
+func (l *ListView) HandleAction(a Action) {
+	switch a {
+	case ACTION_CURSOR_UP:
+		if l.Cursor > 0 {
+			l.Cursor--
+			l.moved()
+		}
+	case ACTION_CURSOR_DOWN:
+		if l.Cursor < len(l.Items)-1 {
+			l.Cursor++
+			l.moved()
+		}
+	case ACTION_CURSOR_LEFT:
+		popView()
+	case ACTION_ENTER:
+		if l.OnSelect != nil && l.Cursor < len(l.Items) {
+			l.OnSelect(l.Cursor)
+			if l.Cursor >= len(l.Items) {
+				l.Cursor = max(len(l.Items)-1, 0)
+			}
+			redrawView()
+		}
+	}
+}
+
+// Redraw after a cursor move and tell OnCursor
+func (l *ListView) moved() {
+	redrawView()
+	if l.OnCursor != nil {
+		l.OnCursor(l.Cursor)
+	}
+}
+
+// Entries of the tools menu, opened with NAV+ENTER from anywhere
+var toolsMenuEntries []struct {
+	name string
+	open func()
+}
+
+// Add an entry to the tools menu
+func addTool(name string, open func()) {
+	toolsMenuEntries = append(toolsMenuEntries, struct {
+		name string
+		open func()
+	}{name, open})
+}
+
+func openToolsMenu() {
+	menu := &ListView{Title: "TOOLS"}
+	for _, t := range toolsMenuEntries {
+		menu.Items = append(menu.Items, t.name)
+	}
+	menu.OnSelect = func(i int) {
+		if soakBlocksTool(toolsMenuEntries[i].name) {
+			showStatus("NOT DURING SOAK TEST", colorRed)
+			return
+		}
+		toolsMenuEntries[i].open()
+	}
+	pushView(menu)
+}
+
+// Start screen
+type homeView struct{}
+
+func (homeView) Draw() {
+	title := tinyfont.Fonter(&freemono.Regular12pt7b)
+	if layout == &textLayouts[TEXT_LARGE] {
+		title = &freemono.Regular18pt7b
+	}
+	tinyfont.WriteLine(&display, title, 40, 100, "picoTracker", colorText)
+	tinyfont.WriteLine(&display, layout.Font, 20, 150, "welcome from TinyGo!", colorText)
+	tinyfont.WriteLine(&display, layout.Font, 20, 180, "Press PLAY to start", colorText)
+
+	statusText := "Audio: PLAYING"
+	statusColor := colorGreen
+	if !isAudioPlaying {
+		statusText = "Audio: STOPPED"
+		statusColor = colorRed
+	}
+	tinyfont.WriteLine(&display, layout.Font, 20, int16(180+layout.LineHeight), statusText, statusColor)
+}
+
+func (homeView) HandleAction(a Action) {}
+
+func (homeView) ID() ViewID { return VIEW_HOME }
+
+func (homeView) Describe() string { return "HOME" }
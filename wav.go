@@ -0,0 +1,108 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+var errBadWav = errors.New("sample: not a 8 or 16-bit PCM wav file")
+
+// Format and layout of a wav file, read from its chunk headers
+type wavInfo struct {
+	Channels int
+	Bits     int
+	Rate     uint32
+	RootNote uint8
+
+	LoopStart, LoopEnd uint32 // From the smpl chunk, 0 when there is none
+
+	DataStart int64 // Offset of the PCM data in the file
+	DataLen   int64
+}
+
+// Bytes per frame of all channels
+func (w *wavInfo) frameSize() int {
+	return w.Channels * w.Bits / 8
+}
+
+// Walk the chunks of a wav file without reading the PCM data, so long files
+// can be streamed
+func readWavInfo(f File) (wavInfo, error) {
+	info := wavInfo{RootNote: NOTE_C4}
+	var hdr [12]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return info, err
+	}
+	if string(hdr[:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return info, errBadWav
+	}
+	pos := int64(12)
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(f, ch[:]); err != nil {
+			break
+		}
+		r := &byteReader{buf: ch[4:]}
+		size := int64(r.u32())
+		pos += 8
+		switch string(ch[:4]) {
+		case "fmt ", "smpl":
+			body := make([]byte, min(size, 64))
+			if _, err := io.ReadFull(f, body); err != nil {
+				return info, errBadWav
+			}
+			c := &byteReader{buf: body}
+			if string(ch[:4]) == "fmt " {
+				if c.u16() != 1 {
+					return info, errBadWav
+				}
+				info.Channels = int(c.u16())
+				info.Rate = c.u32()
+				c.u32() // Byte rate
+				c.u16() // Block align
+				info.Bits = int(c.u16())
+			} else {
+				c.sub(12)
+				info.RootNote = uint8(c.u32())
+				c.sub(12)
+				if c.u32() > 0 {
+					c.sub(12)
+					info.LoopStart = c.u32()
+					info.LoopEnd = c.u32() + 1 // smpl stores the last sample played
+				}
+			}
+		case "data":
+			info.DataStart, info.DataLen = pos, size
+		}
+		pos += size + size&1 // Chunks are padded to even sizes
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			break
+		}
+	}
+	if info.Channels < 1 || (info.Bits != 8 && info.Bits != 16) || info.Rate == 0 || info.DataStart == 0 {
+		return info, errBadWav
+	}
+	return info, nil
+}
+
+// Convert whole frames of PCM to mono 16-bit, returning the frames written
+func decodePCM(dst []int16, src []byte, channels, bits int) int {
+	frame := channels * bits / 8
+	n := min(len(dst), len(src)/frame)
+	for i := 0; i < n; i++ {
+		var sum int32
+		for ch := 0; ch < channels; ch++ {
+			if bits == 8 {
+				sum += (int32(src[i*frame+ch]) - 128) << 8
+			} else {
+				o := i*frame + ch*2
+				sum += int32(int16(uint16(src[o]) | uint16(src[o+1])<<8))
+			}
+		}
+		dst[i] = int16(sum / int32(channels))
+	}
+	return n
+}
@@ -0,0 +1,142 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+import "math"
+
+// Wavetable configuration
+const (
+	WAVETABLE_BITS = 8
+	WAVETABLE_SIZE = 1 << WAVETABLE_BITS // Samples in one cycle
+
+	NUM_WAVETABLES = 8 // Built-in tables first, the rest are user slots
+)
+
+// Built-in wavetables
+const (
+	WAVE_SINE = iota
+	WAVE_SAW
+	WAVE_SQUARE
+	WAVE_TRIANGLE
+	NUM_BUILTIN_WAVES
+)
+
+// One single-cycle waveform
+type Wavetable [WAVETABLE_SIZE]int16
+
+var wavetables [NUM_WAVETABLES]Wavetable
+
+// Fill in the built-in tables
+func initWavetables() {
+	for i := 0; i < WAVETABLE_SIZE; i++ {
+		// Position in the cycle, 0 to 65535
+		pos := int32(i << (16 - WAVETABLE_BITS))
+
+		wavetables[WAVE_SINE][i] = int16(32767 * math.Sin(2*math.Pi*float64(i)/WAVETABLE_SIZE))
+		wavetables[WAVE_SAW][i] = int16(pos - 32768)
+		if pos < 32768 {
+			wavetables[WAVE_SQUARE][i] = 32767
+			wavetables[WAVE_TRIANGLE][i] = clip16(2*pos - 32768)
+		} else {
+			wavetables[WAVE_SQUARE][i] = -32767
+			wavetables[WAVE_TRIANGLE][i] = clip16(98303 - 2*pos)
+		}
+	}
+}
+
+// Load a single cycle of any length into a user table slot, resampling it
+// to WAVETABLE_SIZE with nearest neighbour
+func loadWavetable(slot int, cycle []int16) bool {
+	if slot < NUM_BUILTIN_WAVES || slot >= NUM_WAVETABLES || len(cycle) == 0 {
+		return false
+	}
+	for i := range wavetables[slot] {
+		wavetables[slot][i] = cycle[i*len(cycle)/WAVETABLE_SIZE]
+	}
+	return true
+}
+
+// Fill the user slots from wave1.wav to wave4.wav in a project's folder,
+// each a single cycle. Slots without a file are left silent.
+func loadUserWavetables(name string) {
+	for slot := NUM_BUILTIN_WAVES; slot < NUM_WAVETABLES; slot++ {
+		var cycle []int16
+		path := joinPath(projectsDir, name, "wave"+itoa(slot-NUM_BUILTIN_WAVES+1)+".wav")
+		if _, err := storage.Stat(path); err == nil {
+			s, err := loadSample(path)
+			if err != nil {
+				println("Failed to load", path+":", err.Error())
+			} else {
+				cycle = s.Data
+			}
+		}
+		audioMu.Lock()
+		if !loadWavetable(slot, cycle) {
+			wavetables[slot] = Wavetable{}
+		}
+		audioMu.Unlock()
+	}
+}
+
+// Phase increment per sample for a 32-bit accumulator at a frequency in mHz
+func phaseIncrement(milliHz uint32) uint32 {
+	return uint32((uint64(milliHz) << 32) / (uint64(sampleRate) * 1000))
+}
+
+// Oscillator reading a wavetable with a 32-bit phase accumulator; the top
+// WAVETABLE_BITS of the phase index the table. Level is 0-255.
+type WavetableVoice struct {
+	Table *Wavetable
+	Level uint8
+
+	phase    uint32
+	inc      uint32
+	freq     uint32
+	velocity uint8
+	note     uint8
+	bend     int // Cents, see Bend
+}
+
+// Set the pitch in mHz
+func (v *WavetableVoice) SetFrequency(milliHz uint32) {
+	v.freq = milliHz
+	v.inc = phaseIncrement(milliHz)
+}
+
+func (v *WavetableVoice) Retune() { v.SetFrequency(v.freq) }
+
+func (v *WavetableVoice) NoteOn(note, velocity uint8) {
+	if velocity == 0 {
+		v.NoteOff()
+		return
+	}
+	n := noteIndex(note)
+	v.freq, v.inc, v.velocity, v.note = noteFrequencies[n], noteIncrements[n], velocity, n
+	if v.bend != 0 {
+		v.SetFrequency(noteFrequency(int(n), v.bend))
+	}
+}
+
+// Offset the pitch from the last NoteOn by cents, without starting a note
+func (v *WavetableVoice) Bend(cents int) {
+	v.bend = cents
+	if v.freq != 0 {
+		v.SetFrequency(noteFrequency(int(v.note), cents))
+	}
+}
+
+func (v *WavetableVoice) NoteOff() { v.SetFrequency(0) }
+
+func (v *WavetableVoice) Sounding() bool { return v.Table != nil && v.inc != 0 }
+
+func (v *WavetableVoice) Render(out []int32) {
+	if v.Table == nil || v.inc == 0 {
+		return
+	}
+	level := velocityLevel(v.Level, v.velocity)
+	for i := range out {
+		out[i] += int32(v.Table[v.phase>>(32-WAVETABLE_BITS)]) * level >> 8
+		v.phase += v.inc
+	}
+}
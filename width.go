@@ -0,0 +1,46 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Stereo width of the master bus, worked in mid/side: the side signal is
+// scaled by Width percent, so 0 folds the mix to mono, WIDTH_NORMAL leaves
+// it alone and above that widens it. Folding to mono before a bounce shows
+// what phase cancellation would do to the mix on a mono speaker. The
+// project's width is set when the song starts and the M command moves it
+// while the song plays.
+const (
+	WIDTH_NORMAL = 100
+	WIDTH_MAX    = 200
+)
+
+func init() {
+	addTool("STEREO WIDTH", openWidthView)
+}
+
+// Scale the side of a stereo block by width percent
+func stereoWidth(left, right []int32, width uint8) {
+	w := int32(min(width, WIDTH_MAX))
+	for i := range left {
+		mid := (left[i] + right[i]) >> 1
+		side := ((left[i] - right[i]) >> 1) * w / 100
+		left[i], right[i] = mid+side, mid-side
+	}
+}
+
+// Width of the project, heard at once
+func openWidthView() {
+	openParamList("STEREO WIDTH", []settingItem{
+		byteChoice("WIDTH", func() *uint8 { return &project.Width }, []uint8{0, 25, 50, 75, 100, 125, 150, 200},
+			func(v uint8) string {
+				if v == 0 {
+					return "MONO"
+				}
+				return itoa(int(v)) + "%"
+			}),
+	}, func() {
+		audioMu.Lock()
+		mixer.Width = project.Width
+		audioMu.Unlock()
+	})
+}
@@ -0,0 +1,72 @@
+//go:build tinygo
+// +build tinygo
+
+package main
+
+// Per-zone tuning of the selected instrument. Each line shows a zone's key
+// range, root and tuning; ENTER raises the tuning by ZONE_FINE_STEP cents,
+// wrapping from the top of the range to the bottom.
+const (
+	ZONE_FINE_STEP = 5
+	ZONE_FINE_MAX  = 50
+)
+
+func init() {
+	addTool("ZONE TUNING", openZoneTuningView)
+}
+
+// Key range, root and tuning of a zone as one line
+func zoneLine(p *Project, in *Instrument, i int) string {
+	z := &in.Zones[i]
+	// Round-robin variations share the range of the first of them
+	first := i
+	for first > 0 && in.Zones[first-1].High == z.High {
+		first--
+	}
+	low := uint8(0)
+	if first > 0 {
+		low = in.Zones[first-1].High + 1
+	}
+	root := "OWN"
+	if z.Root != EMPTY {
+		root = noteName(z.Root)
+	}
+	fine := itoa(int(z.Fine))
+	if z.Fine >= 0 {
+		fine = "+" + fine
+	}
+	line := noteName(low) + "-" + noteName(z.High) + " " + root + " " + fine + "C"
+	if first < i {
+		line = "  RR" + itoa(i-first+1) + " " + root + " " + fine + "C"
+	}
+	if z.Sample < MAX_SAMPLES {
+		line += " " + baseName(p.Samples[z.Sample])
+	}
+	return line
+}
+
+func openZoneTuningView() {
+	slot := session.Instrument
+	if slot >= NUM_INSTRUMENTS || project.Instruments[slot].NumZones == 0 {
+		showStatus("NO ZONES", colorRed)
+		return
+	}
+	in := &project.Instruments[slot]
+	list := &ListView{Title: "ZONES " + itoa(int(slot))}
+	refresh := func() {
+		list.Items = list.Items[:0]
+		for i := range in.Zones[:min(in.NumZones, MAX_ZONES)] {
+			list.Items = append(list.Items, zoneLine(project, in, i))
+		}
+	}
+	refresh()
+	list.OnSelect = func(i int) {
+		z := &in.Zones[i]
+		z.Fine += ZONE_FINE_STEP
+		if z.Fine > ZONE_FINE_MAX {
+			z.Fine = -ZONE_FINE_MAX
+		}
+		refresh()
+	}
+	pushView(list)
+}